@@ -4,7 +4,7 @@ import (
 	"accounts-service/auth"
 	"accounts-service/communication"
 	"accounts-service/models"
-	"io"
+	"accounts-service/oidc"
 	"os"
 
 	"google.golang.org/api/firebaseappdistribution/v1"
@@ -14,17 +14,13 @@ import (
 	accountsv1 "accounts-service/protorepo/noted/accounts/v1"
 	v1 "accounts-service/protorepo/noted/notes/v1"
 	"accounts-service/validators"
+	"accounts-service/webauthn"
 	"context"
-	"encoding/json"
 	"errors"
 	"time"
 
-	"net/http"
-
 	"github.com/mennanov/fmutils"
 	"go.uber.org/zap"
-	"golang.org/x/crypto/bcrypt"
-	"golang.org/x/oauth2"
 	"google.golang.org/genproto/protobuf/field_mask"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
@@ -39,10 +35,40 @@ type accountsAPI struct {
 
 	firebaseService *firebaseappdistribution.Service
 
-	auth        auth.Service
-	logger      *zap.Logger
-	repo        models.AccountsRepository
-	googleOAuth *oauth2.Config
+	auth          auth.Service
+	keyring       *auth.Keyring
+	logger        *zap.Logger
+	repo          models.AccountsRepository
+	refreshTokens models.RefreshTokensRepository
+	sessions      models.SessionsRepository
+	challenges    models.ChallengesRepository
+	passkeys      models.PasskeysRepository
+	throttles     models.ThrottlesRepository
+
+	verificationTokens models.VerificationTokensRepository
+	identities         models.IdentitiesRepository
+	oauthClients       models.OAuthClientsRepository
+	consents           models.ConsentsRepository
+
+	personalAccessTokens models.PersonalAccessTokensRepository
+	deviceAuthorizations models.DeviceAuthorizationsRepository
+	loginRequests        models.LoginRequestsRepository
+
+	serviceAccounts models.ServiceAccountsRepository
+	passwords       auth.PasswordHasher
+	passwordPolicy  *auth.PasswordPolicy
+	providers       *oidc.Registry
+	relyingParty    *webauthn.RelyingParty
+	trustedProxies  ipRanges
+
+	refreshTokenLifetime   time.Duration
+	verificationCodeLength int
+	passwordHistoryDepth   int
+
+	accessTokenLifetime time.Duration
+	oauthIssuer         string
+	oauthConsentURL     string
+	deviceVerifyURL     string
 }
 
 var _ accountsv1.AccountsAPIServer = &accountsAPI{}
@@ -53,10 +79,14 @@ func (srv *accountsAPI) CreateAccount(ctx context.Context, in *accountsv1.Create
 		return nil, status.Error(codes.InvalidArgument, err.Error())
 	}
 
-	hashed, err := bcrypt.GenerateFromPassword([]byte(in.Password), 8)
+	err = srv.checkPasswordPolicy(in.Password, in.Email, in.Name)
 	if err != nil {
-		srv.logger.Error("bcrypt failed to hash password", zap.Error(err))
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, err
+	}
+
+	hashed, err := srv.hashPassword(in.Password)
+	if err != nil {
+		return nil, err
 	}
 
 	acc, err := srv.repo.Create(ctx, &models.AccountPayload{Email: &in.Email, Name: &in.Name, Hash: &hashed}, false)
@@ -73,8 +103,13 @@ func (srv *accountsAPI) CreateAccount(ctx context.Context, in *accountsv1.Create
 		srv.logger.Warn("CreateWorkspace was not called on CreateAccount because it is not connected to the notes-service")
 	}
 
+	validationToken, _, err := srv.createVerificationToken(ctx, models.VerificationPurposeValidateEmail, acc.ID, "")
+	if err != nil {
+		return nil, err
+	}
+
 	if srv.mailingService != nil {
-		emailInformation := ValidateAccountByEmail(acc.ID, acc.ValidationToken)
+		emailInformation := ValidateAccountByEmail(acc.ID, validationToken)
 		err = srv.mailingService.SendEmails(ctx, emailInformation, []string{in.Email})
 		if err != nil {
 			return nil, status.Error(codes.Internal, err.Error())
@@ -98,26 +133,18 @@ func (srv *accountsAPI) ValidateAccount(ctx context.Context, in *accountsv1.Vali
 		return nil, status.Error(codes.InvalidArgument, "validator: "+err.Error())
 	}
 
-	acc, err := srv.repo.Get(ctx, &models.OneAccountFilter{Email: in.Email})
-	if err != nil {
-		return nil, statusFromModelError(err)
-	}
-
-	if acc.Hash == nil {
-		return nil, status.Error(codes.InvalidArgument, "account created with google (no password)")
-	}
-
-	err = bcrypt.CompareHashAndPassword(*acc.Hash, []byte(in.Password))
+	acc, err := srv.verifyPassword(ctx, in.Email, in.Password)
 	if err != nil {
-		return nil, status.Error(codes.InvalidArgument, "wrong password or email")
+		return nil, err
 	}
 
 	if acc.IsValidated {
 		return nil, status.Error(codes.InvalidArgument, "account already validate")
 	}
 
-	if acc.ValidationToken != in.ValidationToken {
-		return nil, status.Error(codes.NotFound, "validation-token does not match")
+	_, err = srv.useVerificationToken(ctx, models.VerificationPurposeValidateEmail, acc.ID, in.ValidationToken)
+	if err != nil {
+		return nil, err
 	}
 
 	acc, err = srv.repo.UpdateAccountValidationState(ctx, &models.OneAccountFilter{ID: acc.ID})
@@ -129,12 +156,7 @@ func (srv *accountsAPI) ValidateAccount(ctx context.Context, in *accountsv1.Vali
 }
 
 func (srv *accountsAPI) GetAccount(ctx context.Context, in *accountsv1.GetAccountRequest) (*accountsv1.GetAccountResponse, error) {
-	_, err := srv.authenticate(ctx)
-	if err != nil {
-		return nil, err
-	}
-
-	err = validators.ValidateGetAccountRequest(in)
+	err := validators.ValidateGetAccountRequest(in)
 	if err != nil {
 		return nil, status.Error(codes.InvalidArgument, err.Error())
 	}
@@ -173,20 +195,11 @@ func (srv *accountsAPI) GetMailsFromIDs(ctx context.Context, in *accountsv1.GetM
 }
 
 func (srv *accountsAPI) UpdateAccount(ctx context.Context, in *accountsv1.UpdateAccountRequest) (*accountsv1.UpdateAccountResponse, error) {
-	token, err := srv.authenticate(ctx)
-	if err != nil {
-		return nil, err
-	}
-
-	err = validators.ValidateUpdateAccountRequest(in)
+	err := validators.ValidateUpdateAccountRequest(in)
 	if err != nil {
 		return nil, status.Error(codes.InvalidArgument, err.Error())
 	}
 
-	if token.AccountID != in.AccountId {
-		return nil, status.Error(codes.NotFound, "account not found")
-	}
-
 	err = applyUpdateMask(in.UpdateMask, in.Account, []string{"name"})
 	if err != nil {
 		return nil, err
@@ -201,7 +214,7 @@ func (srv *accountsAPI) UpdateAccount(ctx context.Context, in *accountsv1.Update
 }
 
 func (srv *accountsAPI) DeleteAccount(ctx context.Context, in *accountsv1.DeleteAccountRequest) (*accountsv1.DeleteAccountResponse, error) {
-	token, err := srv.authenticate(ctx)
+	token, err := srv.principal(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -211,34 +224,66 @@ func (srv *accountsAPI) DeleteAccount(ctx context.Context, in *accountsv1.Delete
 		return nil, status.Error(codes.InvalidArgument, err.Error())
 	}
 
-	if token.AccountID != in.AccountId {
-		return nil, status.Error(codes.NotFound, "account not found")
+	err = srv.requireRecentAuthentication(ctx, token, sensitiveOperationMaxAuthAge)
+	if err != nil {
+		return nil, err
+	}
+
+	err = srv.deleteAccount(ctx, in.AccountId)
+	if err != nil {
+		return nil, err
 	}
 
+	return &accountsv1.DeleteAccountResponse{}, nil
+}
+
+// deleteAccount deletes the account along with its data. The notes-service
+// deletes the data of the account found in the outgoing context of ctx.
+func (srv *accountsAPI) deleteAccount(ctx context.Context, accountID string) error {
 	if srv.noteService != nil {
-		_, err = srv.noteService.Notes.OnAccountDelete(ctx, &v1.OnAccountDeleteRequest{})
+		_, err := srv.noteService.Notes.OnAccountDelete(ctx, &v1.OnAccountDeleteRequest{})
 		if err != nil {
-			return nil, status.Error(codes.Internal, err.Error())
+			return status.Error(codes.Internal, err.Error())
 		}
 	} else {
 		srv.logger.Warn("OnAccountDelete from notes-service was not called due to the fact that the accounts-service is not connected to the notes one")
 	}
 
-	err = srv.repo.Delete(ctx, &models.OneAccountFilter{ID: in.AccountId})
+	err := srv.repo.Delete(ctx, &models.OneAccountFilter{ID: accountID})
 	if err != nil {
-		return nil, statusFromModelError(err)
+		return statusFromModelError(err)
 	}
 
-	return &accountsv1.DeleteAccountResponse{}, nil
-}
+	err = srv.passkeys.DeleteMany(ctx, &models.ManyPasskeysFilter{AccountID: accountID})
+	if err != nil {
+		srv.logger.Error("failed to delete passkeys of deleted account", zap.Error(err), zap.String("account_id", accountID))
+	}
 
-func (srv *accountsAPI) ListAccounts(ctx context.Context, in *accountsv1.ListAccountsRequest) (*accountsv1.ListAccountsResponse, error) {
-	_, err := srv.authenticate(ctx)
+	err = srv.identities.DeleteMany(ctx, &models.ManyIdentitiesFilter{AccountID: accountID})
 	if err != nil {
-		return nil, err
+		srv.logger.Error("failed to delete identities of deleted account", zap.Error(err), zap.String("account_id", accountID))
 	}
 
-	err = validators.ValidateListRequest(in)
+	err = srv.consents.DeleteMany(ctx, &models.ManyConsentsFilter{AccountID: accountID})
+	if err != nil {
+		srv.logger.Error("failed to delete consents of deleted account", zap.Error(err), zap.String("account_id", accountID))
+	}
+
+	err = srv.personalAccessTokens.DeleteMany(ctx, &models.ManyPersonalAccessTokensFilter{AccountID: accountID})
+	if err != nil {
+		srv.logger.Error("failed to delete personal access tokens of deleted account", zap.Error(err), zap.String("account_id", accountID))
+	}
+
+	err = srv.revokeSessions(ctx, &models.ManySessionsFilter{AccountID: accountID})
+	if err != nil {
+		srv.logger.Error("failed to revoke sessions of deleted account", zap.Error(err), zap.String("account_id", accountID))
+	}
+
+	return nil
+}
+
+func (srv *accountsAPI) ListAccounts(ctx context.Context, in *accountsv1.ListAccountsRequest) (*accountsv1.ListAccountsResponse, error) {
+	err := validators.ValidateListRequest(in)
 	if err != nil {
 		return nil, status.Error(codes.InvalidArgument, err.Error())
 	}
@@ -253,12 +298,8 @@ func (srv *accountsAPI) ListAccounts(ctx context.Context, in *accountsv1.ListAcc
 	}
 
 	accountsResp := []*accountsv1.Account{}
-	for _, account := range accounts {
-		elem := &accountsv1.Account{Id: account.ID, Name: *account.Name, Email: *account.Email}
-		if err != nil {
-			srv.logger.Error("failed to decode account", zap.Error(err))
-		}
-		accountsResp = append(accountsResp, elem)
+	for i := range accounts {
+		accountsResp = append(accountsResp, modelsAccountToProtobufAccount(&accounts[i]))
 	}
 	return &accountsv1.ListAccountsResponse{Accounts: accountsResp}, nil
 }
@@ -269,27 +310,26 @@ func (srv *accountsAPI) ForgetAccountPassword(ctx context.Context, in *accountsv
 		return nil, status.Error(codes.InvalidArgument, err.Error())
 	}
 
-	accountToken, err := srv.repo.UpdateAccountWithResetPasswordToken(ctx, &models.OneAccountFilter{Email: in.Email})
+	acc, err := srv.repo.Get(ctx, &models.OneAccountFilter{Email: in.Email})
 	if err != nil {
 		return nil, statusFromModelError(err)
 	}
 
-	emailInformation := ForgetAccountPasswordMailContent(accountToken.ID, accountToken.Token)
-
-	filters := []*models.OneAccountFilter{}
-	for _, accountID := range emailInformation.To {
-		filters = append(filters, &models.OneAccountFilter{ID: accountID})
-	}
-	mails, err := srv.repo.GetMailsFromIDs(ctx, filters)
+	resetCode, resetToken, err := srv.createVerificationToken(ctx, models.VerificationPurposeResetPassword, acc.ID, "")
 	if err != nil {
-		return nil, statusFromModelError(err)
+		return nil, err
 	}
 
-	err = srv.mailingService.SendEmails(ctx, emailInformation, mails)
-	if err != nil {
-		return nil, status.Error(codes.Internal, err.Error())
+	if srv.mailingService != nil {
+		err = srv.mailingService.SendEmails(ctx, ForgetAccountPasswordMailContent(acc.ID, resetCode), []string{*acc.Email})
+		if err != nil {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+	} else {
+		srv.logger.Warn("SendEmails was not called on ForgetAccountPassword because it is not connected to the mailing-service")
 	}
-	return &accountsv1.ForgetAccountPasswordResponse{AccountId: accountToken.ID, ValidUntil: accountToken.ValidUntil.String()}, nil
+
+	return &accountsv1.ForgetAccountPasswordResponse{AccountId: acc.ID, ValidUntil: resetToken.ExpiresAt.String()}, nil
 }
 
 func (srv *accountsAPI) ForgetAccountPasswordValidateToken(ctx context.Context, in *accountsv1.ForgetAccountPasswordValidateTokenRequest) (*accountsv1.ForgetAccountPasswordValidateTokenResponse, error) {
@@ -298,30 +338,59 @@ func (srv *accountsAPI) ForgetAccountPasswordValidateToken(ctx context.Context,
 		return nil, status.Error(codes.InvalidArgument, err.Error())
 	}
 
+	_, err = srv.useVerificationToken(ctx, models.VerificationPurposeResetPassword, in.AccountId, in.Token)
+	if err != nil {
+		return nil, err
+	}
+
 	acc, err := srv.repo.Get(ctx, &models.OneAccountFilter{ID: in.AccountId})
 	if err != nil {
 		return nil, statusFromModelError(err)
 	}
 
-	if acc.Token != in.Token {
-		return nil, status.Error(codes.NotFound, "reset-token does not match")
+	if acc.IsSuspended() {
+		return nil, status.Error(codes.PermissionDenied, "account suspended")
+	}
+
+	// The emailed code is exchanged for a token which is only good for a
+	// single password update.
+	resetToken, err := auth.GenerateSecret(resetTokenBytes)
+	if err != nil {
+		srv.logger.Error("failed to generate reset token", zap.Error(err))
+		return nil, status.Error(codes.Internal, "failed to generate reset token")
 	}
+	_, err = srv.storeVerificationToken(ctx, models.VerificationPurposeResetPasswordToken, acc.ID, "", resetToken)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &accountsv1.ForgetAccountPasswordValidateTokenResponse{Account: modelsAccountToProtobufAccount(acc), ResetToken: resetToken}
 
-	if !time.Now().UTC().Before(acc.ValidUntil) {
-		return nil, status.Error(codes.InvalidArgument, "reset-token expire")
+	// Reading the mailbox is not enough to get past the second factor, which
+	// must be answered to get the token the reset token is used with.
+	if acc.HasSecondFactor() {
+		res.Challenge, err = srv.createSecondFactorChallenge(ctx, acc, auth.AuthMethodEmail)
+		if err != nil {
+			return nil, err
+		}
+		return res, nil
 	}
 
-	tokenString, err := srv.auth.SignToken(&auth.Token{AccountID: acc.ID})
+	session, err := srv.startSession(ctx, acc.ID, []string{auth.AuthMethodEmail})
 	if err != nil {
-		srv.logger.Error("failed to sign token", zap.Error(err))
-		return nil, status.Error(codes.Internal, "failed to authenticate user")
+		return nil, err
+	}
+
+	res.AuthToken, err = srv.signToken(acc, session)
+	if err != nil {
+		return nil, err
 	}
 
-	return &accountsv1.ForgetAccountPasswordValidateTokenResponse{Account: modelsAccountToProtobufAccount(acc), ResetToken: acc.Token, AuthToken: tokenString}, nil
+	return res, nil
 }
 
 func (srv *accountsAPI) UpdateAccountPassword(ctx context.Context, in *accountsv1.UpdateAccountPasswordRequest) (*accountsv1.UpdateAccountPasswordResponse, error) {
-	_, err := srv.authenticate(ctx)
+	token, err := srv.principal(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -331,41 +400,89 @@ func (srv *accountsAPI) UpdateAccountPassword(ctx context.Context, in *accountsv
 		return nil, status.Error(codes.InvalidArgument, err.Error())
 	}
 
-	var acc *models.Account
+	if in.OldPassword == "" && in.Token == "" {
+		return nil, status.Error(codes.InvalidArgument, "missing argument, old password or reset password token")
+	}
+
+	acc, err := srv.repo.Get(ctx, &models.OneAccountFilter{ID: in.AccountId})
+	if err != nil {
+		return nil, statusFromModelError(err)
+	}
+
+	// The policy is checked first so that a reset token is not consumed by
+	// a rejected password.
+	err = srv.checkPasswordPolicy(in.Password, *acc.Email, *acc.Name)
+	if err != nil {
+		return nil, err
+	}
+
 	if in.OldPassword != "" {
-		acc, err = srv.repo.Get(ctx, &models.OneAccountFilter{ID: in.AccountId})
+		throttleKeys := srv.throttleKeys(ctx, throttlePassword, acc.ID)
+		err = srv.reserveAttempt(ctx, throttleKeys)
 		if err != nil {
-			return nil, statusFromModelError(err)
+			return nil, err
 		}
-		err = bcrypt.CompareHashAndPassword(*acc.Hash, []byte(in.OldPassword))
+		ok, _, err := srv.comparePassword(acc, in.OldPassword)
 		if err != nil {
+			srv.releaseAttempt(ctx, throttleKeys)
+			return nil, err
+		}
+		if !ok {
 			return nil, status.Error(codes.InvalidArgument, "password does not match")
 		}
-	} else if in.Token != "" {
-		acc, err = srv.repo.Get(ctx, &models.OneAccountFilter{ID: in.AccountId})
+		srv.resetThrottle(ctx, throttleKeys)
+
+		// Checked once the old password is proven so that it cannot be
+		// used to guess the previous passwords.
+		err = srv.checkPasswordReuse(acc, in.Password)
 		if err != nil {
-			return nil, statusFromModelError(err)
+			return nil, err
 		}
-		if acc.Token != in.Token {
-			return nil, status.Error(codes.NotFound, "reset-token does not match")
+	} else {
+		// The old password proves the authentication on its own, but a
+		// reset token only proves access to the mailbox of the account.
+		err = srv.requireRecentAuthentication(ctx, token, sensitiveOperationMaxAuthAge)
+		if err != nil {
+			return nil, err
 		}
 
-		if !time.Now().UTC().Before(acc.ValidUntil) {
-			return nil, status.Error(codes.InvalidArgument, "reset-token expire")
+		err = srv.checkPasswordReuse(acc, in.Password)
+		if err != nil {
+			return nil, err
+		}
+
+		_, err = srv.useVerificationToken(ctx, models.VerificationPurposeResetPasswordToken, acc.ID, in.Token)
+		if err != nil {
+			return nil, err
 		}
-	} else {
-		return nil, status.Error(codes.InvalidArgument, "missing argument, old password or reset password token")
 	}
 
-	hashed, err := bcrypt.GenerateFromPassword([]byte(in.Password), 8)
+	hashed, err := srv.hashPassword(in.Password)
 	if err != nil {
-		srv.logger.Error("bcrypt failed to hash password", zap.Error(err))
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, err
 	}
-	acc, err = srv.repo.UpdateAccountPassword(ctx, &models.OneAccountFilter{ID: in.AccountId}, &models.AccountPayload{Hash: &hashed})
+	acc, err = srv.repo.ChangeAccountPassword(ctx, &models.OneAccountFilter{ID: in.AccountId}, hashed, srv.passwordHistoryDepth)
 	if err != nil {
 		return nil, statusFromModelError(err)
 	}
+
+	err = srv.revokeSessions(ctx, &models.ManySessionsFilter{AccountID: acc.ID, ExceptID: token.SessionID})
+	if err != nil {
+		srv.logger.Error("failed to revoke sessions after password update", zap.Error(err), zap.String("account_id", acc.ID))
+	}
+
+	err = srv.personalAccessTokens.DeleteMany(ctx, &models.ManyPersonalAccessTokensFilter{AccountID: acc.ID})
+	if err != nil {
+		srv.logger.Error("failed to revoke personal access tokens after password update", zap.Error(err), zap.String("account_id", acc.ID))
+	}
+
+	for _, purpose := range []string{models.VerificationPurposeResetPassword, models.VerificationPurposeResetPasswordToken} {
+		err = srv.verificationTokens.DeleteMany(ctx, &models.ManyVerificationTokensFilter{Purpose: purpose, AccountID: acc.ID})
+		if err != nil {
+			srv.logger.Error("failed to delete reset tokens after password update", zap.Error(err), zap.String("account_id", acc.ID))
+		}
+	}
+
 	return &accountsv1.UpdateAccountPasswordResponse{Account: modelsAccountToProtobufAccount(acc)}, nil
 }
 
@@ -398,100 +515,168 @@ func (srv *accountsAPI) Authenticate(ctx context.Context, in *accountsv1.Authent
 		return nil, status.Error(codes.InvalidArgument, err.Error())
 	}
 
-	acc, err := srv.repo.Get(ctx, &models.OneAccountFilter{Email: in.Email})
+	acc, err := srv.verifyPassword(ctx, in.Email, in.Password)
+	if err != nil {
+		return nil, err
+	}
+
+	if acc.HasSecondFactor() {
+		challenge, err := srv.createSecondFactorChallenge(ctx, acc, auth.AuthMethodPassword)
+		if err != nil {
+			return nil, err
+		}
+		return &accountsv1.AuthenticateResponse{Challenge: challenge}, nil
+	}
+
+	tokenString, refreshToken, err := srv.issueTokens(ctx, acc, auth.AuthMethodPassword)
+	if err != nil {
+		return nil, err
+	}
+
+	return &accountsv1.AuthenticateResponse{Token: tokenString, RefreshToken: refreshToken}, nil
+}
+
+func (srv *accountsAPI) RefreshToken(ctx context.Context, in *accountsv1.RefreshTokenRequest) (*accountsv1.RefreshTokenResponse, error) {
+	err := validators.ValidateRefreshTokenRequest(in)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	session, err := srv.useRefreshToken(ctx, in.RefreshToken)
+	if err != nil {
+		return nil, err
+	}
+	// The refresh tokens of third-party apps only grant their scopes.
+	if session.ClientID != "" {
+		return nil, status.Error(codes.Unauthenticated, "invalid refresh token")
+	}
+
+	acc, err := srv.repo.Get(ctx, &models.OneAccountFilter{ID: session.AccountID})
 	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			return nil, status.Error(codes.Unauthenticated, "invalid refresh token")
+		}
 		return nil, statusFromModelError(err)
 	}
 
-	if acc.Hash == nil {
-		return nil, status.Error(codes.InvalidArgument, "account created with google (no password)")
+	tokenString, refreshToken, err := srv.issueSessionTokens(ctx, acc, session)
+	if err != nil {
+		return nil, err
 	}
 
-	err = bcrypt.CompareHashAndPassword(*acc.Hash, []byte(in.Password))
+	return &accountsv1.RefreshTokenResponse{Token: tokenString, RefreshToken: refreshToken}, nil
+}
+
+// useRefreshToken consumes a refresh token and returns its session, of which
+// the expiration date is extended.
+func (srv *accountsAPI) useRefreshToken(ctx context.Context, refreshToken string) (*models.Session, error) {
+	hash := auth.HashSecret(refreshToken)
+	used, err := srv.refreshTokens.Use(ctx, &models.OneRefreshTokenFilter{ID: hash})
 	if err != nil {
-		return nil, status.Error(codes.InvalidArgument, "wrong password or email")
+		if !errors.Is(err, models.ErrNotFound) {
+			return nil, statusFromModelError(err)
+		}
+		// A refresh token which exists but cannot be used anymore has either
+		// expired or been replayed. A replay means that the token leaked, so
+		// the whole session is revoked to log out both parties.
+		replayed, getErr := srv.refreshTokens.Get(ctx, &models.OneRefreshTokenFilter{ID: hash})
+		if getErr == nil && replayed.UsedAt != nil {
+			srv.logger.Warn("refresh token reuse detected", zap.String("account_id", replayed.AccountID), zap.String("session_id", replayed.FamilyID))
+			err = srv.revokeSession(ctx, &models.OneSessionFilter{ID: replayed.FamilyID})
+			if err != nil && !errors.Is(err, models.ErrNotFound) {
+				srv.logger.Error("failed to revoke session", zap.Error(err))
+			}
+		}
+		return nil, status.Error(codes.Unauthenticated, "invalid refresh token")
 	}
 
-	tokenString, err := srv.auth.SignToken(&auth.Token{AccountID: acc.ID})
+	session, err := srv.sessions.UpdateLastUse(ctx, &models.OneSessionFilter{ID: used.FamilyID}, time.Now().UTC().Add(srv.refreshTokenLifetime))
 	if err != nil {
-		srv.logger.Error("failed to sign token", zap.Error(err))
-		return nil, status.Error(codes.Internal, "failed to authenticate user")
+		if errors.Is(err, models.ErrNotFound) {
+			return nil, status.Error(codes.Unauthenticated, "invalid refresh token")
+		}
+		return nil, statusFromModelError(err)
 	}
 
-	return &accountsv1.AuthenticateResponse{Token: tokenString}, nil
+	return session, nil
 }
 
+// GetAccessTokenGoogle exchanges a code returned by Google for an access
+// token and an ID token.
+//
+// Deprecated: use BeginAuthenticateWithProvider and AuthenticateWithProvider.
 func (srv *accountsAPI) GetAccessTokenGoogle(ctx context.Context, in *accountsv1.GetAccessTokenGoogleRequest) (*accountsv1.GetAccessTokenGoogleResponse, error) {
 	err := validators.ValidateGetAccessTokenGoogleRequest(in)
 	if err != nil {
 		return nil, status.Error(codes.InvalidArgument, err.Error())
 	}
 
-	token, err := srv.googleOAuth.Exchange(context.Background(), in.Code)
+	provider, err := srv.getGoogleProvider()
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := provider.Exchange(ctx, in.Code, "")
 	if err != nil {
 		return nil, status.Error(codes.Internal, err.Error())
 	}
 
-	return &accountsv1.GetAccessTokenGoogleResponse{AccessToken: token.AccessToken}, nil
+	return &accountsv1.GetAccessTokenGoogleResponse{AccessToken: token.AccessToken, IdToken: token.IDToken}, nil
 }
 
+// AuthenticateGoogle logs in with an ID token issued by Google for the
+// client of the accounts service. The access token formerly sent in
+// ClientAccessToken is ignored.
+//
+// Deprecated: use BeginAuthenticateWithProvider and AuthenticateWithProvider.
 func (srv *accountsAPI) AuthenticateGoogle(ctx context.Context, in *accountsv1.AuthenticateGoogleRequest) (*accountsv1.AuthenticateGoogleResponse, error) {
 	err := validators.ValidateAuthenticateGoogleRequest(in)
 	if err != nil {
 		return nil, status.Error(codes.InvalidArgument, err.Error())
 	}
 
-	content, err := getGoogleUserInfo(in.ClientAccessToken)
+	provider, err := srv.getGoogleProvider()
 	if err != nil {
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, err
 	}
 
-	var userInfo map[string]interface{}
-	err = json.Unmarshal(content, &userInfo)
+	idToken, err := provider.VerifyIDToken(ctx, in.IdToken, "")
 	if err != nil {
-		return nil, status.Error(codes.InvalidArgument, "failed to unmarshal response body: "+err.Error())
+		srv.logger.Warn("id token verification failed", zap.String("provider", googleProviderName), zap.Error(err))
+		return nil, status.Error(codes.Unauthenticated, "invalid id token")
 	}
 
-	if userInfo["email"] == nil || userInfo["name"] == nil {
-		return nil, status.Error(codes.InvalidArgument, "missing email or name in response body")
+	account, err := srv.getAccountOfIdentity(ctx, googleProviderName, idToken)
+	if err != nil {
+		return nil, err
 	}
 
-	email := userInfo["email"].(string)
-	name := userInfo["name"].(string)
-
-	account, err := srv.repo.Get(ctx, &models.OneAccountFilter{Email: email})
-	if err != nil && err == models.ErrNotFound {
-		// Creating the account without password, he would never be able to login without GoogleAuthenticate
-		account, err = srv.repo.Create(ctx, &models.AccountPayload{Email: &email, Name: &name}, true)
+	if account.HasSecondFactor() {
+		challenge, err := srv.createSecondFactorChallenge(ctx, account, auth.AuthMethodFederated)
 		if err != nil {
-			return nil, statusFromModelError(err)
-		}
-		if srv.noteService != nil {
-			_, err = srv.noteService.Groups.CreateWorkspace(ctx, &v1.CreateWorkspaceRequest{AccountId: account.ID})
-			if err != nil {
-				return nil, err
-			}
-		} else {
-			srv.logger.Warn("CreateWorkspace was not called on CreateAccount because it is not connected to the notes-service")
+			return nil, err
 		}
+		return &accountsv1.AuthenticateGoogleResponse{Challenge: challenge}, nil
 	}
 
-	tokenString, err := srv.auth.SignToken(&auth.Token{AccountID: account.ID})
+	tokenString, refreshToken, err := srv.issueTokens(ctx, account, auth.AuthMethodFederated)
 	if err != nil {
-		srv.logger.Error("failed to sign token", zap.Error(err))
-		return nil, status.Error(codes.Internal, "failed to authenticate user")
+		return nil, err
 	}
 
-	return &accountsv1.AuthenticateGoogleResponse{Token: string(tokenString)}, nil
+	return &accountsv1.AuthenticateGoogleResponse{Token: tokenString, RefreshToken: refreshToken}, nil
 }
 
-func (srv *accountsAPI) RegisterUserToMobileBeta(ctx context.Context, in *accountsv1.RegisterUserToMobileBetaRequest) (*accountsv1.RegisterUserToMobileBetaResponse, error) {
-	_, err := srv.authenticate(ctx)
+func (srv *accountsAPI) getGoogleProvider() (*oidc.Provider, error) {
+	provider, err := srv.getProvider(googleProviderName)
 	if err != nil {
-		return nil, err
+		return nil, status.Error(codes.FailedPrecondition, "google login is not configured")
 	}
+	return provider, nil
+}
 
-	err = validators.ValidateRegisterUserToMobileBeta(in)
+func (srv *accountsAPI) RegisterUserToMobileBeta(ctx context.Context, in *accountsv1.RegisterUserToMobileBetaRequest) (*accountsv1.RegisterUserToMobileBetaResponse, error) {
+	err := validators.ValidateRegisterUserToMobileBeta(in)
 	if err != nil {
 		return nil, status.Error(codes.InvalidArgument, err.Error())
 	}
@@ -540,13 +725,76 @@ func (srv *accountsAPI) RegisterUserToMobileBeta(ctx context.Context, in *accoun
 	return &accountsv1.RegisterUserToMobileBetaResponse{}, nil
 }
 
-func (srv *accountsAPI) authenticate(ctx context.Context) (*auth.Token, error) {
-	token, err := srv.auth.TokenFromContext(ctx)
+// issueTokens starts a new session of the account, authenticated with
+// methods, and returns its tokens. A session started without methods must
+// reauthenticate before sensitive operations.
+func (srv *accountsAPI) issueTokens(ctx context.Context, acc *models.Account, methods ...string) (string, string, error) {
+	if acc.IsSuspended() {
+		return "", "", status.Error(codes.PermissionDenied, "account suspended")
+	}
+
+	session, err := srv.startSession(ctx, acc.ID, methods)
+	if err != nil {
+		return "", "", err
+	}
+
+	return srv.issueSessionTokens(ctx, acc, session)
+}
+
+// issueSessionTokens signs a new access token for the session and creates
+// the refresh token which replaces it once expired.
+func (srv *accountsAPI) issueSessionTokens(ctx context.Context, acc *models.Account, session *models.Session) (string, string, error) {
+	if acc.IsSuspended() {
+		return "", "", status.Error(codes.PermissionDenied, "account suspended")
+	}
+
+	tokenString, err := srv.signToken(acc, session)
+	if err != nil {
+		return "", "", err
+	}
+
+	refreshToken, err := srv.createRefreshToken(ctx, acc.ID, session.ID)
+	if err != nil {
+		return "", "", err
+	}
+
+	return tokenString, refreshToken, nil
+}
+
+// createRefreshToken stores the hash of a new refresh token of the session
+// and returns it.
+func (srv *accountsAPI) createRefreshToken(ctx context.Context, accountID string, sessionID string) (string, error) {
+	refreshToken, err := auth.GenerateSecret(32)
+	if err != nil {
+		srv.logger.Error("failed to generate refresh token", zap.Error(err))
+		return "", status.Error(codes.Internal, "failed to authenticate user")
+	}
+
+	_, err = srv.refreshTokens.Create(ctx, &models.RefreshTokenPayload{
+		ID:        auth.HashSecret(refreshToken),
+		AccountID: accountID,
+		FamilyID:  sessionID,
+		ExpiresAt: time.Now().UTC().Add(srv.refreshTokenLifetime),
+	})
 	if err != nil {
-		srv.logger.Debug("failed to authenticate request", zap.Error(err))
-		return nil, status.Error(codes.Unauthenticated, "invalid token")
+		return "", statusFromModelError(err)
 	}
-	return token, nil
+
+	return refreshToken, nil
+}
+
+func (srv *accountsAPI) signToken(acc *models.Account, session *models.Session) (string, error) {
+	token := &auth.Token{AccountID: acc.ID, SessionID: session.ID, Roles: acc.Roles, AuthMethods: session.AuthMethods}
+	if !session.AuthenticatedAt.IsZero() {
+		token.AuthTime = session.AuthenticatedAt.Unix()
+	}
+
+	tokenString, err := srv.auth.SignToken(token)
+	if err != nil {
+		srv.logger.Error("failed to sign token", zap.Error(err))
+		return "", status.Error(codes.Internal, "failed to authenticate user")
+	}
+	return tokenString, nil
 }
 
 func (srv *accountsAPI) IsAccountValidate(ctx context.Context, in *accountsv1.IsAccountValidateRequest) (*accountsv1.IsAccountValidateResponse, error) {
@@ -561,9 +809,9 @@ func (srv *accountsAPI) IsAccountValidate(ctx context.Context, in *accountsv1.Is
 	}
 
 	if acc.Hash != nil {
-		err = bcrypt.CompareHashAndPassword(*acc.Hash, []byte(in.Password))
+		acc, err = srv.verifyPassword(ctx, in.Email, in.Password)
 		if err != nil {
-			return nil, status.Error(codes.InvalidArgument, "wrong password or email")
+			return nil, err
 		}
 	}
 
@@ -576,26 +824,22 @@ func (srv *accountsAPI) SendValidationToken(ctx context.Context, in *accountsv1.
 		return nil, status.Error(codes.InvalidArgument, err.Error())
 	}
 
-	acc, err := srv.repo.Get(ctx, &models.OneAccountFilter{Email: in.Email})
+	acc, err := srv.verifyPassword(ctx, in.Email, in.Password)
 	if err != nil {
-		return nil, statusFromModelError(err)
+		return nil, err
 	}
 
-	if acc.Hash == nil {
-		return nil, status.Error(codes.InvalidArgument, "account created with google (no password)")
+	if acc.IsValidated {
+		return nil, status.Error(codes.InvalidArgument, "account already validate")
 	}
 
-	err = bcrypt.CompareHashAndPassword(*acc.Hash, []byte(in.Password))
+	validationToken, _, err := srv.createVerificationToken(ctx, models.VerificationPurposeValidateEmail, acc.ID, "")
 	if err != nil {
-		return nil, status.Error(codes.InvalidArgument, "wrong password or email")
-	}
-
-	if acc.IsValidated {
-		return nil, status.Error(codes.InvalidArgument, "account already validate")
+		return nil, err
 	}
 
 	if srv.mailingService != nil {
-		emailInformation := ValidateAccountByEmail(acc.ID, acc.ValidationToken)
+		emailInformation := ValidateAccountByEmail(acc.ID, validationToken)
 		err = srv.mailingService.SendEmails(ctx, emailInformation, []string{in.Email})
 		if err != nil {
 			return nil, status.Error(codes.Internal, err.Error())
@@ -623,7 +867,7 @@ func statusFromModelError(err error) error {
 }
 
 func modelsAccountToProtobufAccount(acc *models.Account) *accountsv1.Account {
-	return &accountsv1.Account{Id: acc.ID, Name: *acc.Name, Email: *acc.Email, IsInMobileBeta: acc.IsInMobileBeta}
+	return &accountsv1.Account{Id: acc.ID, Name: *acc.Name, Email: *acc.Email, IsInMobileBeta: acc.IsInMobileBeta, Roles: acc.Roles, IsSuspended: acc.IsSuspended()}
 }
 
 func applyUpdateMask(mask *field_mask.FieldMask, msg protoreflect.ProtoMessage, allowedFields []string) error {
@@ -638,24 +882,3 @@ func applyUpdateMask(mask *field_mask.FieldMask, msg protoreflect.ProtoMessage,
 	fmutils.Filter(msg, allowedFields)
 	return nil
 }
-
-func getGoogleUserInfo(accessToken string) ([]byte, error) {
-	req, err := http.NewRequest("GET", "https://www.googleapis.com/oauth2/v3/userinfo?access_token="+accessToken, nil)
-	if err != nil {
-		return nil, err
-	}
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
-	}
-
-	return body, nil
-}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"accounts-service/auth"
 	"accounts-service/models"
 	accountsv1 "accounts-service/protorepo/noted/accounts/v1"
 	"context"
@@ -72,6 +73,45 @@ func TestAccountsAPI(t *testing.T) {
 		require.NotEmpty(t, res.Token)
 	})
 
+	var refreshToken string
+
+	t.Run("owner-can-authenticate-and-get-refresh-token", func(t *testing.T) {
+		res, err := tu.accounts.Authenticate(dave.Context, &accountsv1.AuthenticateRequest{
+			Email:    daveEmail,
+			Password: davePassword,
+		})
+		require.NoError(t, err)
+		require.NotEmpty(t, res.RefreshToken)
+		refreshToken = res.RefreshToken
+	})
+
+	var rotatedRefreshToken string
+
+	t.Run("owner-can-refresh-token", func(t *testing.T) {
+		res, err := tu.accounts.RefreshToken(context.Background(), &accountsv1.RefreshTokenRequest{
+			RefreshToken: refreshToken,
+		})
+		require.NoError(t, err)
+		require.NotEmpty(t, res.Token)
+		require.NotEmpty(t, res.RefreshToken)
+		require.NotEqual(t, refreshToken, res.RefreshToken)
+		rotatedRefreshToken = res.RefreshToken
+	})
+
+	t.Run("refresh-token-reuse-revokes-the-family", func(t *testing.T) {
+		res, err := tu.accounts.RefreshToken(context.Background(), &accountsv1.RefreshTokenRequest{
+			RefreshToken: refreshToken,
+		})
+		requireErrorHasGRPCCode(t, codes.Unauthenticated, err)
+		require.Nil(t, res)
+
+		res, err = tu.accounts.RefreshToken(context.Background(), &accountsv1.RefreshTokenRequest{
+			RefreshToken: rotatedRefreshToken,
+		})
+		requireErrorHasGRPCCode(t, codes.Unauthenticated, err)
+		require.Nil(t, res)
+	})
+
 	t.Run("owner-cannot-authenticate-with-wrong-password", func(t *testing.T) {
 		res, err := tu.accounts.Authenticate(dave.Context, &accountsv1.AuthenticateRequest{
 			Email:    daveEmail,
@@ -133,8 +173,10 @@ func TestAccountsAPI(t *testing.T) {
 		require.Equal(t, dave.ID, res.Account.Id)
 	})
 
+	notesService := tu.newTestServiceContext(t, auth.ScopeAccountsEmailsRead)
+
 	t.Run("service-can-get-emails-by-accounts-ids", func(t *testing.T) {
-		res, err := tu.accounts.GetMailsFromIDs(context.TODO(), &accountsv1.GetMailsFromIDsRequest{
+		res, err := tu.accounts.GetMailsFromIDs(notesService, &accountsv1.GetMailsFromIDsRequest{
 			AccountsIds: []string{
 				dave.ID,
 			},
@@ -147,11 +189,35 @@ func TestAccountsAPI(t *testing.T) {
 	})
 
 	t.Run("service-cannot-get-emails-by-no-accounts-ids", func(t *testing.T) {
-		res, err := tu.accounts.GetMailsFromIDs(context.TODO(), &accountsv1.GetMailsFromIDsRequest{})
+		res, err := tu.accounts.GetMailsFromIDs(notesService, &accountsv1.GetMailsFromIDsRequest{})
 		require.Error(t, err)
 		require.Nil(t, res)
 	})
 
+	t.Run("account-cannot-get-emails-by-accounts-ids", func(t *testing.T) {
+		res, err := tu.accounts.GetMailsFromIDs(stranger.Context, &accountsv1.GetMailsFromIDsRequest{
+			AccountsIds: []string{dave.ID},
+		})
+		requireErrorHasGRPCCode(t, codes.PermissionDenied, err)
+		require.Nil(t, res)
+	})
+
+	t.Run("anonymous-cannot-get-emails-by-accounts-ids", func(t *testing.T) {
+		res, err := tu.accounts.GetMailsFromIDs(context.TODO(), &accountsv1.GetMailsFromIDsRequest{
+			AccountsIds: []string{dave.ID},
+		})
+		requireErrorHasGRPCCode(t, codes.Unauthenticated, err)
+		require.Nil(t, res)
+	})
+
+	t.Run("service-without-scope-cannot-get-emails-by-accounts-ids", func(t *testing.T) {
+		res, err := tu.accounts.GetMailsFromIDs(tu.newTestServiceContext(t, auth.ScopeMailInviteSend), &accountsv1.GetMailsFromIDsRequest{
+			AccountsIds: []string{dave.ID},
+		})
+		requireErrorHasGRPCCode(t, codes.PermissionDenied, err)
+		require.Nil(t, res)
+	})
+
 	t.Run("owner-can-update-account-name", func(t *testing.T) {
 		res, err := tu.accounts.UpdateAccount(dave.Context, &accountsv1.UpdateAccountRequest{
 			AccountId: dave.ID,
@@ -177,6 +243,17 @@ func TestAccountsAPI(t *testing.T) {
 		requireErrorHasGRPCCode(t, codes.InvalidArgument, err)
 		require.Nil(t, res)
 	})
+
+	t.Run("stranger-cannot-update-password-of-owner", func(t *testing.T) {
+		res, err := tu.accounts.UpdateAccountPassword(stranger.Context, &accountsv1.UpdateAccountPasswordRequest{
+			AccountId:   dave.ID,
+			Password:    "new_password",
+			OldPassword: davePassword,
+		})
+		requireErrorHasGRPCCode(t, codes.NotFound, err)
+		require.Nil(t, res)
+	})
+
 	t.Run("owner-cannot-update-password-with-invalid-old-password", func(t *testing.T) {
 		res, err := tu.accounts.UpdateAccountPassword(dave.Context, &accountsv1.UpdateAccountPasswordRequest{
 			AccountId:   dave.ID,
@@ -204,16 +281,30 @@ func TestAccountsAPI(t *testing.T) {
 	daveUpdatedPassword := tu.randomAlphanumeric()
 
 	t.Run("stranger-update-password-with-reset-token", func(t *testing.T) {
-		reset, err := tu.accountsRepository.UpdateAccountWithResetPasswordToken(stranger.Context, &models.OneAccountFilter{Email: daveEmail})
+		reset, err := tu.accounts.ForgetAccountPassword(stranger.Context, &accountsv1.ForgetAccountPasswordRequest{Email: daveEmail})
 		require.NoError(t, err)
-		require.NotNil(t, reset)
-		require.NotNil(t, reset.Token)
-		require.Equal(t, dave.ID, reset.ID)
-		validation, err := tu.accounts.ForgetAccountPasswordValidateToken(stranger.Context, &accountsv1.ForgetAccountPasswordValidateTokenRequest{AccountId: reset.ID, Token: reset.Token})
+		require.Equal(t, dave.ID, reset.AccountId)
+
+		// The code sent by email is not observable, plant a known one instead.
+		plantVerificationToken(t, tu, models.VerificationPurposeResetPassword, dave.ID, "", "424242")
+
+		// The code must be exchanged for a reset token first.
+		_, err = tu.accounts.UpdateAccountPassword(dave.Context, &accountsv1.UpdateAccountPasswordRequest{
+			AccountId: dave.ID,
+			Password:  daveUpdatedPassword,
+			Token:     "424242",
+		})
+		requireErrorHasGRPCCode(t, codes.NotFound, err)
+
+		validation, err := tu.accounts.ForgetAccountPasswordValidateToken(stranger.Context, &accountsv1.ForgetAccountPasswordValidateTokenRequest{AccountId: dave.ID, Token: "424242"})
 		require.NoError(t, err)
 		require.NotNil(t, validation)
 		require.NotNil(t, validation.AuthToken)
-		require.Equal(t, reset.Token, validation.ResetToken)
+		require.NotEmpty(t, validation.ResetToken)
+
+		_, err = tu.accounts.ForgetAccountPasswordValidateToken(stranger.Context, &accountsv1.ForgetAccountPasswordValidateTokenRequest{AccountId: dave.ID, Token: "424242"})
+		requireErrorHasGRPCCode(t, codes.NotFound, err)
+
 		res, err := tu.accounts.UpdateAccountPassword(dave.Context, &accountsv1.UpdateAccountPasswordRequest{
 			AccountId: dave.ID,
 			Password:  daveUpdatedPassword,
@@ -225,6 +316,13 @@ func TestAccountsAPI(t *testing.T) {
 		require.Equal(t, res.Account.Id, dave.ID)
 		require.Equal(t, res.Account.Email, daveEmail)
 		require.Equal(t, "Dave Doe Jr", res.Account.Name)
+
+		_, err = tu.accounts.UpdateAccountPassword(dave.Context, &accountsv1.UpdateAccountPasswordRequest{
+			AccountId: dave.ID,
+			Password:  daveUpdatedPassword,
+			Token:     validation.ResetToken,
+		})
+		requireErrorHasGRPCCode(t, codes.NotFound, err)
 	})
 
 	t.Run("owner-cannot-authenticate-with-old-password", func(t *testing.T) {
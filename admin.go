@@ -0,0 +1,167 @@
+package main
+
+import (
+	"accounts-service/auth"
+	"accounts-service/models"
+	"accounts-service/models/mongo"
+	accountsv1 "accounts-service/protorepo/noted/accounts/v1"
+	"accounts-service/validators"
+	"context"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func (srv *accountsAPI) SearchAccounts(ctx context.Context, in *accountsv1.SearchAccountsRequest) (*accountsv1.SearchAccountsResponse, error) {
+	err := validators.ValidateSearchAccountsRequest(in)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	if in.Limit == 0 {
+		in.Limit = 20
+	}
+
+	accounts, err := srv.repo.List(ctx, &models.ManyAccountsFilter{Query: in.Query}, &models.Pagination{Offset: int64(in.Offset), Limit: int64(in.Limit)})
+	if err != nil {
+		return nil, statusFromModelError(err)
+	}
+
+	accountsResp := []*accountsv1.Account{}
+	for i := range accounts {
+		accountsResp = append(accountsResp, modelsAccountToProtobufAccount(&accounts[i]))
+	}
+	return &accountsv1.SearchAccountsResponse{Accounts: accountsResp}, nil
+}
+
+// SuspendAccount prevents an account from logging in and revokes all of its
+// sessions until it is reinstated.
+func (srv *accountsAPI) SuspendAccount(ctx context.Context, in *accountsv1.SuspendAccountRequest) (*accountsv1.SuspendAccountResponse, error) {
+	token, err := srv.principal(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	err = validators.ValidateSuspendAccountRequest(in)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	if token.AccountID == in.AccountId {
+		return nil, status.Error(codes.InvalidArgument, "cannot suspend your own account")
+	}
+
+	_, err = srv.getModeratedAccount(ctx, token, in.AccountId)
+	if err != nil {
+		return nil, err
+	}
+
+	acc, err := srv.repo.SuspendAccount(ctx, &models.OneAccountFilter{ID: in.AccountId}, in.Reason)
+	if err != nil {
+		return nil, statusFromModelError(err)
+	}
+
+	err = srv.revokeSessions(ctx, &models.ManySessionsFilter{AccountID: acc.ID})
+	if err != nil {
+		return nil, statusFromModelError(err)
+	}
+
+	srv.logger.Info("account suspended", zap.String("account_id", acc.ID), zap.String("by", token.AccountID))
+
+	return &accountsv1.SuspendAccountResponse{Account: modelsAccountToProtobufAccount(acc)}, nil
+}
+
+func (srv *accountsAPI) ReinstateAccount(ctx context.Context, in *accountsv1.ReinstateAccountRequest) (*accountsv1.ReinstateAccountResponse, error) {
+	token, err := srv.principal(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	err = validators.ValidateReinstateAccountRequest(in)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	_, err = srv.getModeratedAccount(ctx, token, in.AccountId)
+	if err != nil {
+		return nil, err
+	}
+
+	acc, err := srv.repo.ReinstateAccount(ctx, &models.OneAccountFilter{ID: in.AccountId})
+	if err != nil {
+		return nil, statusFromModelError(err)
+	}
+
+	srv.logger.Info("account reinstated", zap.String("account_id", acc.ID), zap.String("by", token.AccountID))
+
+	return &accountsv1.ReinstateAccountResponse{Account: modelsAccountToProtobufAccount(acc)}, nil
+}
+
+// getModeratedAccount returns the account the caller wants to suspend or
+// reinstate. Only admins may do so to the accounts of supports and admins.
+func (srv *accountsAPI) getModeratedAccount(ctx context.Context, token *auth.Token, accountID string) (*models.Account, error) {
+	acc, err := srv.repo.Get(ctx, &models.OneAccountFilter{ID: accountID})
+	if err != nil {
+		return nil, statusFromModelError(err)
+	}
+
+	if token.HasRole(auth.RoleAdmin) {
+		return acc, nil
+	}
+	for _, role := range acc.Roles {
+		if role == auth.RoleSupport || role == auth.RoleAdmin {
+			return nil, status.Error(codes.PermissionDenied, "only admins can moderate the accounts of supports and admins")
+		}
+	}
+
+	return acc, nil
+}
+
+// ForceDeleteAccount deletes any account along with its data.
+func (srv *accountsAPI) ForceDeleteAccount(ctx context.Context, in *accountsv1.ForceDeleteAccountRequest) (*accountsv1.ForceDeleteAccountResponse, error) {
+	token, err := srv.principal(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	err = validators.ValidateForceDeleteAccountRequest(in)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	acc, err := srv.repo.Get(ctx, &models.OneAccountFilter{ID: in.AccountId})
+	if err != nil {
+		return nil, statusFromModelError(err)
+	}
+
+	// The notes-service deletes the data of the account authenticated by the
+	// outgoing context, which must not be the one of the administrator.
+	notesCtx, err := srv.auth.ContextWithToken(metadata.NewOutgoingContext(ctx, metadata.MD{}), &auth.Token{AccountID: acc.ID})
+	if err != nil {
+		srv.logger.Error("failed to sign token", zap.Error(err))
+		return nil, status.Error(codes.Internal, "failed to delete account")
+	}
+
+	err = srv.deleteAccount(notesCtx, acc.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	srv.logger.Info("account force deleted", zap.String("account_id", acc.ID), zap.String("by", token.AccountID))
+
+	return &accountsv1.ForceDeleteAccountResponse{}, nil
+}
+
+// setAccountRoles replaces the roles granted to the account registered
+// with email.
+func setAccountRoles(email string, roles []string) {
+	logger := zap.NewNop()
+	db, err := mongo.NewDatabase(context.Background(), *mongoUri, *mongoDbName, logger)
+	must(err, "could not instantiate mongo database")
+	defer db.Disconnect(context.Background())
+
+	_, err = mongo.NewAccountsRepository(db.DB, logger).UpdateAccountRoles(context.Background(), &models.OneAccountFilter{Email: email}, roles)
+	must(err, "could not update account roles")
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"accounts-service/auth"
+	"accounts-service/models"
+	accountsv1 "accounts-service/protorepo/noted/accounts/v1"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+)
+
+func TestAdmin(t *testing.T) {
+	tu := newTestUtilsOrDie(t)
+	name := "Suspended " + tu.randomAlphanumeric()
+	email := tu.randomAlphanumeric() + "@gmail.fr"
+	password := "123456"
+	tu.newTestAccount(t, name, email, password)
+	user := tu.validateTestAccount(t, email, password)
+
+	adminCtx, err := tu.auth.ContextWithToken(context.TODO(), &auth.Token{AccountID: tu.newUUID(), Roles: []string{auth.RoleAdmin}})
+	require.NoError(t, err)
+	supportCtx, err := tu.auth.ContextWithToken(context.TODO(), &auth.Token{AccountID: tu.newUUID(), Roles: []string{auth.RoleSupport}})
+	require.NoError(t, err)
+
+	t.Run("user-cannot-list-accounts", func(t *testing.T) {
+		res, err := tu.accounts.ListAccounts(user.Context, &accountsv1.ListAccountsRequest{})
+		requireErrorHasGRPCCode(t, codes.PermissionDenied, err)
+		require.Nil(t, res)
+	})
+
+	t.Run("user-cannot-search-accounts", func(t *testing.T) {
+		res, err := tu.accounts.SearchAccounts(user.Context, &accountsv1.SearchAccountsRequest{Query: name})
+		requireErrorHasGRPCCode(t, codes.PermissionDenied, err)
+		require.Nil(t, res)
+	})
+
+	t.Run("support-can-search-accounts", func(t *testing.T) {
+		res, err := tu.accounts.SearchAccounts(supportCtx, &accountsv1.SearchAccountsRequest{Query: name})
+		require.NoError(t, err)
+		require.Len(t, res.Accounts, 1)
+		require.Equal(t, user.ID, res.Accounts[0].Id)
+	})
+
+	t.Run("support-can-suspend-account", func(t *testing.T) {
+		res, err := tu.accounts.SuspendAccount(supportCtx, &accountsv1.SuspendAccountRequest{AccountId: user.ID, Reason: "spam"})
+		require.NoError(t, err)
+		require.True(t, res.Account.IsSuspended)
+
+		acc, err := tu.accountsRepository.Get(context.TODO(), &models.OneAccountFilter{ID: user.ID})
+		require.NoError(t, err)
+		require.Equal(t, "spam", acc.SuspensionReason)
+	})
+
+	t.Run("support-cannot-suspend-staff", func(t *testing.T) {
+		staffEmail := tu.randomAlphanumeric() + "@gmail.fr"
+		tu.newTestAccount(t, "Staff", staffEmail, password)
+		staff := tu.validateTestAccount(t, staffEmail, password)
+		_, err := tu.accountsRepository.UpdateAccountRoles(context.TODO(), &models.OneAccountFilter{ID: staff.ID}, []string{auth.RoleSupport})
+		require.NoError(t, err)
+
+		_, err = tu.accounts.SuspendAccount(supportCtx, &accountsv1.SuspendAccountRequest{AccountId: staff.ID, Reason: "revenge"})
+		requireErrorHasGRPCCode(t, codes.PermissionDenied, err)
+		_, err = tu.accounts.ReinstateAccount(supportCtx, &accountsv1.ReinstateAccountRequest{AccountId: staff.ID})
+		requireErrorHasGRPCCode(t, codes.PermissionDenied, err)
+
+		_, err = tu.accounts.SuspendAccount(adminCtx, &accountsv1.SuspendAccountRequest{AccountId: staff.ID, Reason: "abuse"})
+		require.NoError(t, err)
+	})
+
+	t.Run("suspended-account-cannot-authenticate", func(t *testing.T) {
+		res, err := tu.accounts.Authenticate(context.TODO(), &accountsv1.AuthenticateRequest{Email: email, Password: password})
+		requireErrorHasGRPCCode(t, codes.PermissionDenied, err)
+		require.Nil(t, res)
+	})
+
+	t.Run("support-can-reinstate-account", func(t *testing.T) {
+		res, err := tu.accounts.ReinstateAccount(supportCtx, &accountsv1.ReinstateAccountRequest{AccountId: user.ID})
+		require.NoError(t, err)
+		require.False(t, res.Account.IsSuspended)
+
+		_, err = tu.accounts.Authenticate(context.TODO(), &accountsv1.AuthenticateRequest{Email: email, Password: password})
+		require.NoError(t, err)
+	})
+
+	t.Run("support-cannot-force-delete-account", func(t *testing.T) {
+		res, err := tu.accounts.ForceDeleteAccount(supportCtx, &accountsv1.ForceDeleteAccountRequest{AccountId: user.ID})
+		requireErrorHasGRPCCode(t, codes.PermissionDenied, err)
+		require.Nil(t, res)
+	})
+
+	t.Run("admin-can-force-delete-account", func(t *testing.T) {
+		_, err := tu.accounts.ForceDeleteAccount(adminCtx, &accountsv1.ForceDeleteAccountRequest{AccountId: user.ID})
+		require.NoError(t, err)
+
+		_, err = tu.accountsRepository.Get(context.TODO(), &models.OneAccountFilter{ID: user.ID})
+		require.ErrorIs(t, err, models.ErrNotFound)
+	})
+}
@@ -0,0 +1,252 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+// Access tells which callers are let through to a method.
+type Access int
+
+const (
+	// Anyone, such as the methods called to log in, which authenticate the
+	// caller themselves.
+	AccessPublic Access = iota + 1
+
+	// Any account, with a token issued by the accounts service to the
+	// account itself.
+	AccessAccount
+
+	// The account whose ID is held by the OwnerField of the request.
+	AccessOwner
+
+	// The accounts granted one of Roles.
+	AccessRole
+
+	// The machine identities granted Scope.
+	AccessService
+
+	// The third-party apps granted Scope by an account.
+	AccessApp
+)
+
+// Policy describes who may call a method.
+type Policy struct {
+	Access Access
+
+	// Name of the string field of the request holding the ID of the account
+	// the request acts on, for AccessOwner.
+	OwnerField protoreflect.Name
+
+	// Roles for AccessRole, any of which is enough.
+	Roles []string
+
+	// Scope for AccessService and AccessApp.
+	Scope string
+}
+
+// Authorizer is a gRPC interceptor letting through the calls allowed by the
+// policy of their method. The token of the caller is placed on the context
+// of the handlers, where PrincipalFromContext finds it.
+type Authorizer struct {
+	auth     Service
+	policies map[string]Policy
+}
+
+// NewAuthorizer creates an Authorizer verifying the tokens with srv.
+func NewAuthorizer(srv Service) *Authorizer {
+	return &Authorizer{auth: srv, policies: map[string]Policy{}}
+}
+
+// Register sets the policies of the methods of the gRPC service named
+// serviceName, keyed by method name.
+func (a *Authorizer) Register(serviceName string, policies map[string]Policy) {
+	for method, policy := range policies {
+		a.policies[fullMethodName(serviceName, method)] = policy
+	}
+}
+
+// Check returns an error unless every method of services has a valid
+// policy and every policy belongs to one of the methods. It is given the
+// services registered on the gRPC server, so that a method added without a
+// policy prevents the server from starting.
+func (a *Authorizer) Check(services map[string]grpc.ServiceInfo) error {
+	registered := map[string]bool{}
+	for serviceName, info := range services {
+		for _, method := range info.Methods {
+			fullMethod := fullMethodName(serviceName, method.Name)
+			registered[fullMethod] = true
+
+			policy, ok := a.policies[fullMethod]
+			if !ok {
+				return fmt.Errorf("method %s has no authorization policy", fullMethod)
+			}
+			err := checkPolicy(serviceName, method.Name, policy)
+			if err != nil {
+				return fmt.Errorf("invalid authorization policy of %s: %w", fullMethod, err)
+			}
+		}
+	}
+
+	for fullMethod := range a.policies {
+		if !registered[fullMethod] {
+			return fmt.Errorf("authorization policy of unknown method %s", fullMethod)
+		}
+	}
+
+	return nil
+}
+
+// UnaryInterceptor enforces the policy of the method called. The calls to
+// methods without a policy are refused.
+func (a *Authorizer) UnaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	policy, ok := a.policies[info.FullMethod]
+	if !ok {
+		return nil, status.Error(codes.PermissionDenied, "method has no authorization policy")
+	}
+	if policy.Access == AccessPublic {
+		return handler(ctx, req)
+	}
+
+	token, err := a.auth.TokenFromContext(ctx)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, "invalid token")
+	}
+
+	err = authorize(token, policy, req)
+	if err != nil {
+		return nil, err
+	}
+
+	return handler(ContextWithPrincipal(ctx, token), req)
+}
+
+func authorize(token *Token, policy Policy, req interface{}) error {
+	switch policy.Access {
+	case AccessService:
+		if !token.IsService() {
+			return status.Error(codes.PermissionDenied, "only services may call this method")
+		}
+		if !token.HasScope(policy.Scope) {
+			return status.Error(codes.PermissionDenied, "missing scope "+policy.Scope)
+		}
+		return nil
+	case AccessApp:
+		if !token.IsDelegated() || !token.HasScope(policy.Scope) {
+			return status.Error(codes.PermissionDenied, "missing scope "+policy.Scope)
+		}
+		return nil
+	}
+
+	if token.IsService() {
+		return status.Error(codes.PermissionDenied, "services cannot act on behalf of an account")
+	}
+	if token.IsDelegated() {
+		return status.Error(codes.PermissionDenied, "third-party apps cannot manage the account")
+	}
+	if token.IsPersonal() {
+		return status.Error(codes.PermissionDenied, "personal access tokens cannot manage the account")
+	}
+
+	switch policy.Access {
+	case AccessAccount:
+		return nil
+	case AccessOwner:
+		// Accounts are not told whether the accounts of others exist.
+		if token.AccountID == "" || ownerOf(req, policy.OwnerField) != token.AccountID {
+			return status.Error(codes.NotFound, "account not found")
+		}
+		return nil
+	case AccessRole:
+		for _, role := range policy.Roles {
+			if token.HasRole(role) {
+				return nil
+			}
+		}
+		return status.Error(codes.PermissionDenied, "insufficient role")
+	}
+
+	return status.Error(codes.PermissionDenied, "invalid authorization policy")
+}
+
+// ownerOf returns the value of the field of req named field, or an empty
+// string if it has none.
+func ownerOf(req interface{}, field protoreflect.Name) string {
+	msg, ok := req.(proto.Message)
+	if !ok {
+		return ""
+	}
+	m := msg.ProtoReflect()
+	fd := m.Descriptor().Fields().ByName(field)
+	if fd == nil || fd.Kind() != protoreflect.StringKind || fd.IsList() {
+		return ""
+	}
+	return m.Get(fd).String()
+}
+
+func checkPolicy(serviceName string, methodName string, policy Policy) error {
+	switch policy.Access {
+	case AccessPublic, AccessAccount:
+		return nil
+	case AccessRole:
+		if len(policy.Roles) == 0 {
+			return errors.New("no role")
+		}
+		return nil
+	case AccessService, AccessApp:
+		if policy.Scope == "" {
+			return errors.New("no scope")
+		}
+		return nil
+	case AccessOwner:
+		return checkOwnerField(serviceName, methodName, policy.OwnerField)
+	}
+	return fmt.Errorf("unknown access %d", policy.Access)
+}
+
+func checkOwnerField(serviceName string, methodName string, field protoreflect.Name) error {
+	desc, err := protoregistry.GlobalFiles.FindDescriptorByName(protoreflect.FullName(serviceName))
+	if err != nil {
+		return fmt.Errorf("could not find service %s: %w", serviceName, err)
+	}
+	service, ok := desc.(protoreflect.ServiceDescriptor)
+	if !ok {
+		return fmt.Errorf("%s is not a service", serviceName)
+	}
+	method := service.Methods().ByName(protoreflect.Name(methodName))
+	if method == nil {
+		return fmt.Errorf("service %s has no method %s", serviceName, methodName)
+	}
+	fd := method.Input().Fields().ByName(field)
+	if fd == nil || fd.Kind() != protoreflect.StringKind || fd.IsList() {
+		return fmt.Errorf("%s has no string field %s", method.Input().FullName(), field)
+	}
+	return nil
+}
+
+func fullMethodName(serviceName string, method string) string {
+	return "/" + serviceName + "/" + method
+}
+
+type principalKey struct{}
+
+// ContextWithPrincipal returns a copy of parent carrying the token of the
+// caller.
+func ContextWithPrincipal(parent context.Context, token *Token) context.Context {
+	return context.WithValue(parent, principalKey{}, token)
+}
+
+// PrincipalFromContext returns the token of the caller let through by an
+// Authorizer, if any.
+func PrincipalFromContext(ctx context.Context) (*Token, bool) {
+	token, ok := ctx.Value(principalKey{}).(*Token)
+	return token, ok && token != nil
+}
@@ -0,0 +1,179 @@
+package auth_test
+
+import (
+	"accounts-service/auth"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+const healthService = "grpc.health.v1.Health"
+
+func newHealthServer() *grpc.Server {
+	server := grpc.NewServer()
+	healthpb.RegisterHealthServer(server, health.NewServer())
+	return server
+}
+
+func TestAuthorizer_Check(t *testing.T) {
+	services := newHealthServer().GetServiceInfo()
+
+	t.Run("every method has a policy", func(t *testing.T) {
+		authorizer := auth.NewAuthorizer(&auth.TestService{})
+		authorizer.Register(healthService, map[string]auth.Policy{
+			"Check": {Access: auth.AccessOwner, OwnerField: "service"},
+			"Watch": {Access: auth.AccessPublic},
+		})
+		require.NoError(t, authorizer.Check(services))
+	})
+
+	t.Run("missing policy", func(t *testing.T) {
+		authorizer := auth.NewAuthorizer(&auth.TestService{})
+		authorizer.Register(healthService, map[string]auth.Policy{
+			"Check": {Access: auth.AccessPublic},
+		})
+		require.Error(t, authorizer.Check(services))
+	})
+
+	t.Run("policy of unknown method", func(t *testing.T) {
+		authorizer := auth.NewAuthorizer(&auth.TestService{})
+		authorizer.Register(healthService, map[string]auth.Policy{
+			"Check": {Access: auth.AccessPublic},
+			"Watch": {Access: auth.AccessPublic},
+			"Ping":  {Access: auth.AccessPublic},
+		})
+		require.Error(t, authorizer.Check(services))
+	})
+
+	t.Run("invalid policies", func(t *testing.T) {
+		for _, policy := range []auth.Policy{
+			{},
+			{Access: auth.AccessOwner, OwnerField: "account_id"},
+			{Access: auth.AccessRole},
+			{Access: auth.AccessService},
+		} {
+			authorizer := auth.NewAuthorizer(&auth.TestService{})
+			authorizer.Register(healthService, map[string]auth.Policy{
+				"Check": policy,
+				"Watch": {Access: auth.AccessPublic},
+			})
+			require.Error(t, authorizer.Check(services), "%+v", policy)
+		}
+	})
+}
+
+func TestAuthorizer_UnaryInterceptor(t *testing.T) {
+	srv := &auth.TestService{}
+	info := &grpc.UnaryServerInfo{FullMethod: "/" + healthService + "/Check"}
+	req := &healthpb.HealthCheckRequest{Service: "123"}
+
+	authorize := func(policy auth.Policy, token *auth.Token) (*auth.Token, error) {
+		authorizer := auth.NewAuthorizer(srv)
+		authorizer.Register(healthService, map[string]auth.Policy{"Check": policy})
+
+		ctx := context.TODO()
+		if token != nil {
+			var err error
+			ctx, err = srv.ContextWithToken(ctx, token)
+			require.NoError(t, err)
+		}
+
+		var principal *auth.Token
+		_, err := authorizer.UnaryInterceptor(ctx, req, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+			principal, _ = auth.PrincipalFromContext(ctx)
+			return nil, nil
+		})
+		return principal, err
+	}
+
+	requireCode := func(t *testing.T, code codes.Code, err error) {
+		require.Equal(t, code, status.Code(err), "%v", err)
+	}
+
+	t.Run("public", func(t *testing.T) {
+		_, err := authorize(auth.Policy{Access: auth.AccessPublic}, nil)
+		require.NoError(t, err)
+	})
+
+	t.Run("method without policy", func(t *testing.T) {
+		authorizer := auth.NewAuthorizer(srv)
+		_, err := authorizer.UnaryInterceptor(context.TODO(), req, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+			return nil, nil
+		})
+		requireCode(t, codes.PermissionDenied, err)
+	})
+
+	t.Run("account", func(t *testing.T) {
+		policy := auth.Policy{Access: auth.AccessAccount}
+
+		_, err := authorize(policy, nil)
+		requireCode(t, codes.Unauthenticated, err)
+
+		principal, err := authorize(policy, &auth.Token{AccountID: "456"})
+		require.NoError(t, err)
+		require.Equal(t, "456", principal.AccountID)
+
+		for _, token := range []*auth.Token{
+			{ServiceID: "notes-service"},
+			{AccountID: "456", ClientID: "app"},
+			{AccountID: "456", PersonalAccessTokenID: "pat"},
+		} {
+			_, err = authorize(policy, token)
+			requireCode(t, codes.PermissionDenied, err)
+		}
+	})
+
+	t.Run("owner", func(t *testing.T) {
+		policy := auth.Policy{Access: auth.AccessOwner, OwnerField: "service"}
+
+		principal, err := authorize(policy, &auth.Token{AccountID: "123"})
+		require.NoError(t, err)
+		require.Equal(t, "123", principal.AccountID)
+
+		_, err = authorize(policy, &auth.Token{AccountID: "456"})
+		requireCode(t, codes.NotFound, err)
+
+		_, err = authorize(policy, &auth.Token{AccountID: "123", ClientID: "app"})
+		requireCode(t, codes.PermissionDenied, err)
+	})
+
+	t.Run("role", func(t *testing.T) {
+		policy := auth.Policy{Access: auth.AccessRole, Roles: []string{auth.RoleAdmin, auth.RoleSupport}}
+
+		_, err := authorize(policy, &auth.Token{AccountID: "456", Roles: []string{auth.RoleSupport}})
+		require.NoError(t, err)
+
+		_, err = authorize(policy, &auth.Token{AccountID: "456"})
+		requireCode(t, codes.PermissionDenied, err)
+	})
+
+	t.Run("service", func(t *testing.T) {
+		policy := auth.Policy{Access: auth.AccessService, Scope: auth.ScopeAccountsEmailsRead}
+
+		principal, err := authorize(policy, &auth.Token{ServiceID: "notes-service", Scopes: []string{auth.ScopeAccountsEmailsRead}})
+		require.NoError(t, err)
+		require.Equal(t, "notes-service", principal.ServiceID)
+
+		_, err = authorize(policy, &auth.Token{ServiceID: "notes-service", Scopes: []string{auth.ScopeMailInviteSend}})
+		requireCode(t, codes.PermissionDenied, err)
+
+		_, err = authorize(policy, &auth.Token{AccountID: "456", Roles: []string{auth.RoleAdmin}})
+		requireCode(t, codes.PermissionDenied, err)
+	})
+
+	t.Run("app", func(t *testing.T) {
+		policy := auth.Policy{Access: auth.AccessApp, Scope: auth.ScopeOpenID}
+
+		_, err := authorize(policy, &auth.Token{AccountID: "456", ClientID: "app", Scopes: []string{auth.ScopeOpenID}})
+		require.NoError(t, err)
+
+		_, err = authorize(policy, &auth.Token{AccountID: "456"})
+		requireCode(t, codes.PermissionDenied, err)
+	})
+}
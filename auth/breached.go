@@ -0,0 +1,95 @@
+package auth
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/binary"
+	"io"
+	"math"
+	"os"
+)
+
+// BreachedPasswords is a bloom filter of passwords known to have leaked.
+// It may report a password which is not in the list as breached, at the
+// configured rate, but never misses a password of the list. It is safe for
+// concurrent reads once built.
+type BreachedPasswords struct {
+	bits   []uint64
+	m      uint64 // Number of bits.
+	hashes uint64
+}
+
+// NewBreachedPasswords creates an empty filter sized for n passwords with a
+// false positive rate of falsePositiveRate.
+func NewBreachedPasswords(n int, falsePositiveRate float64) *BreachedPasswords {
+	if n < 1 {
+		n = 1
+	}
+	m := uint64(math.Ceil(-float64(n) * math.Log(falsePositiveRate) / (math.Ln2 * math.Ln2)))
+	k := uint64(math.Round(float64(m) / float64(n) * math.Ln2))
+	if k < 1 {
+		k = 1
+	}
+	return &BreachedPasswords{bits: make([]uint64, (m+63)/64), m: m, hashes: k}
+}
+
+// LoadBreachedPasswords builds a filter from a file listing one password
+// per line, such as the lists of the most common leaked passwords.
+func LoadBreachedPasswords(path string, falsePositiveRate float64) (*BreachedPasswords, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	// The file is read twice to size the filter without holding the list in
+	// memory.
+	n := 0
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		n++
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	_, err = f.Seek(0, io.SeekStart)
+	if err != nil {
+		return nil, err
+	}
+
+	b := NewBreachedPasswords(n, falsePositiveRate)
+	scanner = bufio.NewScanner(f)
+	for scanner.Scan() {
+		if line := scanner.Text(); line != "" {
+			b.Add(line)
+		}
+	}
+	return b, scanner.Err()
+}
+
+func (b *BreachedPasswords) Add(password string) {
+	h1, h2 := bloomHashes(password)
+	for i := uint64(0); i < b.hashes; i++ {
+		bit := (h1 + i*h2) % b.m
+		b.bits[bit/64] |= 1 << (bit % 64)
+	}
+}
+
+// Contains reports whether password is probably in the list.
+func (b *BreachedPasswords) Contains(password string) bool {
+	h1, h2 := bloomHashes(password)
+	for i := uint64(0); i < b.hashes; i++ {
+		bit := (h1 + i*h2) % b.m
+		if b.bits[bit/64]&(1<<(bit%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// bloomHashes derives the k hashes of the filter from two halves of a
+// SHA-256 digest, as described by Kirsch and Mitzenmacher.
+func bloomHashes(password string) (uint64, uint64) {
+	sum := sha256.Sum256([]byte(password))
+	return binary.BigEndian.Uint64(sum[:8]), binary.BigEndian.Uint64(sum[8:16]) | 1
+}
@@ -0,0 +1,156 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+var (
+	ErrUnknownKey = errors.New("unknown signing key")
+	ErrInvalidKey = errors.New("invalid ed25519 key")
+)
+
+// JSONWebKey is the public part of an Ed25519 signing key as described by
+// RFC 8037.
+type JSONWebKey struct {
+	KeyType   string `json:"kty"`
+	Curve     string `json:"crv"`
+	X         string `json:"x"`
+	KeyID     string `json:"kid"`
+	Algorithm string `json:"alg"`
+	Use       string `json:"use"`
+}
+
+// JSONWebKeySet is the document published to let other services verify the
+// tokens signed by the accounts service.
+type JSONWebKeySet struct {
+	Keys []JSONWebKey `json:"keys"`
+}
+
+// Keyring holds the key used to sign tokens along with the keys which are
+// still accepted when verifying them. Each key is identified by the 'kid'
+// header of the tokens it signs. A keyring is safe for use in multiple
+// goroutines.
+//
+// Rotating keys without invalidating the tokens in circulation is done in
+// three steps: publish the new key with Add, make it the signing key with
+// Rotate once every verifier knows it, then Retire the previous key after
+// the lifetime of the tokens it signed.
+type Keyring struct {
+	mu        sync.RWMutex
+	signing   ed25519.PrivateKey
+	signingID string
+	keys      map[string]ed25519.PublicKey
+}
+
+// NewKeyring creates a keyring which signs tokens with key. A keyring
+// created with a nil key can only verify tokens.
+func NewKeyring(key ed25519.PrivateKey) *Keyring {
+	k := &Keyring{keys: map[string]ed25519.PublicKey{}}
+	if key != nil {
+		k.Rotate(key)
+	}
+	return k
+}
+
+// Add accepts the tokens signed by the private counterpart of key and
+// returns its key ID.
+func (k *Keyring) Add(key ed25519.PublicKey) string {
+	kid := KeyID(key)
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.keys[kid] = key
+	return kid
+}
+
+// Rotate makes key the signing key. The previous signing key is still
+// accepted until it is retired.
+func (k *Keyring) Rotate(key ed25519.PrivateKey) string {
+	pub := key.Public().(ed25519.PublicKey)
+	kid := KeyID(pub)
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.keys[kid] = pub
+	k.signing = key
+	k.signingID = kid
+	return kid
+}
+
+// Retire stops accepting the tokens signed with the key identified by kid.
+// The signing key cannot be retired.
+func (k *Keyring) Retire(kid string) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if kid == k.signingID {
+		return fmt.Errorf("cannot retire signing key %q", kid)
+	}
+	if _, ok := k.keys[kid]; !ok {
+		return ErrUnknownKey
+	}
+	delete(k.keys, kid)
+	return nil
+}
+
+// SigningKey returns the key used to sign new tokens along with its ID.
+func (k *Keyring) SigningKey() (ed25519.PrivateKey, string, bool) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.signing, k.signingID, k.signing != nil
+}
+
+// PublicKey returns the non-retired key identified by kid.
+func (k *Keyring) PublicKey(kid string) (ed25519.PublicKey, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	key, ok := k.keys[kid]
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+	return key, nil
+}
+
+// JSONWebKeySet returns the non-retired keys of the keyring.
+func (k *Keyring) JSONWebKeySet() *JSONWebKeySet {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	jwks := &JSONWebKeySet{Keys: []JSONWebKey{}}
+	for kid, key := range k.keys {
+		jwks.Keys = append(jwks.Keys, JSONWebKey{
+			KeyType:   "OKP",
+			Curve:     "Ed25519",
+			X:         base64.RawURLEncoding.EncodeToString(key),
+			KeyID:     kid,
+			Algorithm: "EdDSA",
+			Use:       "sig",
+		})
+	}
+	return jwks
+}
+
+// KeyID returns the RFC 7638 thumbprint of key.
+func KeyID(key ed25519.PublicKey) string {
+	x := base64.RawURLEncoding.EncodeToString(key)
+	sum := sha256.Sum256([]byte(`{"crv":"Ed25519","kty":"OKP","x":"` + x + `"}`))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// ParseKey decodes a base64 encoded ed25519 key. Both private and public
+// keys are accepted, in which case the private key is nil.
+func ParseKey(s string) (ed25519.PrivateKey, ed25519.PublicKey, error) {
+	raw, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, nil, err
+	}
+	switch len(raw) {
+	case ed25519.PrivateKeySize:
+		priv := ed25519.PrivateKey(raw)
+		return priv, priv.Public().(ed25519.PublicKey), nil
+	case ed25519.PublicKeySize:
+		return nil, ed25519.PublicKey(raw), nil
+	}
+	return nil, nil, ErrInvalidKey
+}
@@ -0,0 +1,79 @@
+package auth_test
+
+import (
+	"accounts-service/auth"
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeyringRotation(t *testing.T) {
+	// Given
+	_, oldKey := genKeyOrFail(t)
+	newPub, newKey := genKeyOrFail(t)
+	keyring := auth.NewKeyring(oldKey)
+	srv := auth.NewService(keyring)
+
+	oldCtx, err := srv.ContextWithToken(context.TODO(), &auth.Token{AccountID: "123"})
+	require.NoError(t, err)
+
+	t.Run("a published key should be part of the key set", func(t *testing.T) {
+		kid := keyring.Add(newPub)
+		require.Equal(t, auth.KeyID(newPub), kid)
+
+		jwks := keyring.JSONWebKeySet()
+		require.Len(t, jwks.Keys, 2)
+		for _, key := range jwks.Keys {
+			require.Equal(t, "OKP", key.KeyType)
+			require.Equal(t, "Ed25519", key.Curve)
+			require.Equal(t, "EdDSA", key.Algorithm)
+		}
+	})
+
+	t.Run("tokens of the previous key should be accepted after a rotation", func(t *testing.T) {
+		keyring.Rotate(newKey)
+
+		newCtx, err := srv.ContextWithToken(context.TODO(), &auth.Token{AccountID: "456"})
+		require.NoError(t, err)
+		token, err := srv.TokenFromContext(newCtx)
+		require.NoError(t, err)
+		require.Equal(t, "456", token.AccountID)
+
+		token, err = srv.TokenFromContext(oldCtx)
+		require.NoError(t, err)
+		require.Equal(t, "123", token.AccountID)
+	})
+
+	t.Run("tokens of a retired key should be rejected", func(t *testing.T) {
+		oldPub := oldKey.Public().(ed25519.PublicKey)
+		require.NoError(t, keyring.Retire(auth.KeyID(oldPub)))
+
+		_, err := srv.TokenFromContext(oldCtx)
+		require.Error(t, err)
+		require.Len(t, keyring.JSONWebKeySet().Keys, 1)
+	})
+
+	t.Run("the signing key cannot be retired", func(t *testing.T) {
+		require.Error(t, keyring.Retire(auth.KeyID(newPub)))
+	})
+}
+
+func TestParseKey(t *testing.T) {
+	pub, priv := genKeyOrFail(t)
+
+	parsedPriv, parsedPub, err := auth.ParseKey(base64.StdEncoding.EncodeToString(priv))
+	require.NoError(t, err)
+	require.Equal(t, priv, parsedPriv)
+	require.Equal(t, pub, parsedPub)
+
+	parsedPriv, parsedPub, err = auth.ParseKey(base64.StdEncoding.EncodeToString(pub))
+	require.NoError(t, err)
+	require.Nil(t, parsedPriv)
+	require.Equal(t, pub, parsedPub)
+
+	_, _, err = auth.ParseKey(base64.StdEncoding.EncodeToString([]byte("too short")))
+	require.ErrorIs(t, err, auth.ErrInvalidKey)
+}
@@ -0,0 +1,81 @@
+package auth_test
+
+import (
+	"accounts-service/auth"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var testArgon2idParams = auth.Argon2idParams{Memory: 64, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+
+func TestArgon2idHasher(t *testing.T) {
+	hasher := auth.NewArgon2idHasher(testArgon2idParams)
+
+	hash, err := hasher.Hash("correct horse battery staple")
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(string(hash), "$argon2id$v=19$m=64,t=1,p=1$"))
+
+	ok, needsRehash, err := hasher.Verify(hash, "correct horse battery staple")
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.False(t, needsRehash)
+
+	ok, _, err = hasher.Verify(hash, "correct horse battery stapler")
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	other, err := hasher.Hash("correct horse battery staple")
+	require.NoError(t, err)
+	require.NotEqual(t, hash, other, "hashes must be salted")
+}
+
+func TestArgon2idHasherLongPasswords(t *testing.T) {
+	hasher := auth.NewArgon2idHasher(testArgon2idParams)
+	long := strings.Repeat("a", 100)
+
+	hash, err := hasher.Hash(long + "1")
+	require.NoError(t, err)
+
+	// bcrypt would ignore everything past the 72nd byte.
+	ok, _, err := hasher.Verify(hash, long+"2")
+	require.NoError(t, err)
+	require.False(t, ok)
+}
+
+func TestArgon2idHasherRehash(t *testing.T) {
+	stronger := testArgon2idParams
+	stronger.Iterations = 2
+	hasher := auth.NewArgon2idHasher(stronger)
+
+	t.Run("outdated-parameters", func(t *testing.T) {
+		hash, err := auth.NewArgon2idHasher(testArgon2idParams).Hash("password")
+		require.NoError(t, err)
+
+		ok, needsRehash, err := hasher.Verify(hash, "password")
+		require.NoError(t, err)
+		require.True(t, ok)
+		require.True(t, needsRehash)
+	})
+
+	t.Run("bcrypt", func(t *testing.T) {
+		hash, err := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+		require.NoError(t, err)
+
+		ok, needsRehash, err := hasher.Verify(hash, "password")
+		require.NoError(t, err)
+		require.True(t, ok)
+		require.True(t, needsRehash)
+
+		ok, _, err = hasher.Verify(hash, "wrong")
+		require.NoError(t, err)
+		require.False(t, ok)
+	})
+
+	t.Run("unknown-format", func(t *testing.T) {
+		_, _, err := hasher.Verify([]byte("plaintext"), "plaintext")
+		require.ErrorIs(t, err, auth.ErrUnknownPasswordHash)
+	})
+}
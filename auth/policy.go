@@ -0,0 +1,165 @@
+package auth
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Reasons for which a password is rejected by a PasswordPolicy.
+const (
+	PasswordTooShort             = "too_short"
+	PasswordTooLong              = "too_long"
+	PasswordTooWeak              = "too_weak"
+	PasswordContainsPersonalInfo = "contains_personal_info"
+	PasswordBreached             = "breached"
+)
+
+// PasswordViolation describes a rule of a PasswordPolicy that a password
+// does not follow, in a message which can be displayed to the user.
+type PasswordViolation struct {
+	Reason  string
+	Message string
+}
+
+// PasswordPolicy decides whether a password is strong enough to be set on
+// an account.
+type PasswordPolicy struct {
+	MinLength int
+	MaxLength int
+
+	// Minimum strength of the passwords, in bits, as estimated by
+	// EstimatePasswordEntropy.
+	MinEntropy float64
+
+	// Passwords known to have leaked. No password is considered breached
+	// when nil.
+	Breached *BreachedPasswords
+}
+
+// DefaultPasswordPolicy follows the recommendations of NIST SP 800-63B.
+var DefaultPasswordPolicy = PasswordPolicy{
+	MinLength:  8,
+	MaxLength:  128,
+	MinEntropy: 40,
+}
+
+// Check returns the rules of the policy that password does not follow. The
+// personal information of the account, such as its email and name, cannot
+// be part of the password.
+func (p *PasswordPolicy) Check(password string, personalInfo ...string) []PasswordViolation {
+	violations := []PasswordViolation{}
+
+	length := utf8.RuneCountInString(password)
+	if length < p.MinLength {
+		violations = append(violations, PasswordViolation{
+			Reason:  PasswordTooShort,
+			Message: fmt.Sprintf("password must be at least %d characters long", p.MinLength),
+		})
+	}
+	if p.MaxLength > 0 && length > p.MaxLength {
+		violations = append(violations, PasswordViolation{
+			Reason:  PasswordTooLong,
+			Message: fmt.Sprintf("password must be at most %d characters long", p.MaxLength),
+		})
+	}
+
+	if containsPersonalInfo(password, personalInfo) {
+		violations = append(violations, PasswordViolation{
+			Reason:  PasswordContainsPersonalInfo,
+			Message: "password must not contain your email or name",
+		})
+	}
+	if length >= p.MinLength && EstimatePasswordEntropy(password) < p.MinEntropy {
+		violations = append(violations, PasswordViolation{
+			Reason:  PasswordTooWeak,
+			Message: "password is too easy to guess, use a longer or less predictable one",
+		})
+	}
+
+	if p.Breached != nil && p.Breached.Contains(password) {
+		violations = append(violations, PasswordViolation{
+			Reason:  PasswordBreached,
+			Message: "password appeared in a data breach, choose another one",
+		})
+	}
+
+	return violations
+}
+
+// Parts of personal information shorter than this are too common to be
+// looked for in passwords.
+const minPersonalInfoLength = 3
+
+func containsPersonalInfo(password string, personalInfo []string) bool {
+	password = strings.ToLower(password)
+	for _, info := range personalInfo {
+		info = strings.ToLower(info)
+		parts := strings.FieldsFunc(info, func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		})
+		for _, part := range append(parts, info) {
+			if utf8.RuneCountInString(part) >= minPersonalInfoLength && strings.Contains(password, part) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// EstimatePasswordEntropy estimates the number of bits an attacker must
+// guess to find password. Each character is worth the size of the smallest
+// alphabet containing all the characters of the password, except the ones
+// which repeat or continue a sequence of the previous ones, which are
+// easily guessed and worth a single bit.
+func EstimatePasswordEntropy(password string) float64 {
+	var lower, upper, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			symbol = true
+		}
+	}
+
+	alphabet := 0
+	if lower {
+		alphabet += 26
+	}
+	if upper {
+		alphabet += 26
+	}
+	if digit {
+		alphabet += 10
+	}
+	if symbol {
+		alphabet += 33
+	}
+	if alphabet == 0 {
+		return 0
+	}
+	bitsPerRune := math.Log2(float64(alphabet))
+
+	entropy := 0.0
+	var prev, prevStep rune
+	for i, r := range []rune(password) {
+		step := r - prev
+		switch {
+		case i > 0 && step == 0:
+			entropy++
+		case i > 1 && step == prevStep && (step == 1 || step == -1):
+			entropy++
+		default:
+			entropy += bitsPerRune
+		}
+		prev, prevStep = r, step
+	}
+	return entropy
+}
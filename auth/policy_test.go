@@ -0,0 +1,67 @@
+package auth_test
+
+import (
+	"accounts-service/auth"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func passwordViolationReasons(violations []auth.PasswordViolation) []string {
+	reasons := []string{}
+	for _, v := range violations {
+		reasons = append(reasons, v.Reason)
+	}
+	return reasons
+}
+
+func TestPasswordPolicy(t *testing.T) {
+	breached := auth.NewBreachedPasswords(10, 0.001)
+	breached.Add("Password1!")
+	policy := auth.DefaultPasswordPolicy
+	policy.Breached = breached
+
+	for password, reasons := range map[string][]string{
+		"correct horse battery staple": {},
+		"Tr0ub4dor&3x":                 {},
+		"1234":                         {auth.PasswordTooShort},
+		"12345678":                     {auth.PasswordTooWeak},
+		"aaaaaaaaaaaa":                 {auth.PasswordTooWeak},
+		"abcdefghijkl":                 {auth.PasswordTooWeak},
+		"Password1!":                   {auth.PasswordBreached},
+		strings.Repeat("a1B!", 33):     {auth.PasswordTooLong},
+		"my name is Dave Doe!":         {auth.PasswordContainsPersonalInfo},
+		"dave.doe@gmail.com rocks":     {auth.PasswordContainsPersonalInfo},
+	} {
+		violations := policy.Check(password, "dave.doe@gmail.com", "Dave Doe")
+		require.ElementsMatch(t, reasons, passwordViolationReasons(violations), password)
+		for _, v := range violations {
+			require.NotEmpty(t, v.Message)
+		}
+	}
+}
+
+func TestEstimatePasswordEntropy(t *testing.T) {
+	require.Zero(t, auth.EstimatePasswordEntropy(""))
+	require.Less(t, auth.EstimatePasswordEntropy("abcdefgh"), auth.EstimatePasswordEntropy("hfbdaecg"))
+	require.Less(t, auth.EstimatePasswordEntropy("aaaaaaaa"), auth.EstimatePasswordEntropy("aaaabbbb"))
+	require.Less(t, auth.EstimatePasswordEntropy("password"), auth.EstimatePasswordEntropy("Pa$sword"))
+}
+
+func TestLoadBreachedPasswords(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "breached.txt")
+	require.NoError(t, os.WriteFile(path, []byte("123456\npassword\nqwerty\n"), 0600))
+
+	breached, err := auth.LoadBreachedPasswords(path, 0.0001)
+	require.NoError(t, err)
+	for _, password := range []string{"123456", "password", "qwerty"} {
+		require.True(t, breached.Contains(password))
+	}
+	require.False(t, breached.Contains("correct horse battery staple"))
+
+	_, err = auth.LoadBreachedPasswords(filepath.Join(t.TempDir(), "missing.txt"), 0.0001)
+	require.Error(t, err)
+}
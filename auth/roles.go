@@ -0,0 +1,19 @@
+package auth
+
+// Roles which can be granted to accounts.
+const (
+	// Implicitly granted to every account.
+	RoleUser = "user"
+
+	// Helps users with their accounts.
+	RoleSupport = "support"
+
+	// Administrates the accounts of the platform.
+	RoleAdmin = "admin"
+)
+
+// GrantableRoles lists the roles which must be granted explicitly.
+var GrantableRoles = []string{
+	RoleSupport,
+	RoleAdmin,
+}
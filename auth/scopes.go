@@ -0,0 +1,45 @@
+package auth
+
+// Scopes which can be granted to machine identities.
+const (
+	// Resolve account IDs into email addresses.
+	ScopeAccountsEmailsRead = "accounts.emails.read"
+
+	// Send group invitation emails.
+	ScopeMailInviteSend = "mail.invite.send"
+
+	// Introspect the tokens presented by the clients of the service.
+	ScopeTokensIntrospect = "tokens.introspect"
+)
+
+// KnownScopes lists every scope understood by the accounts service.
+var KnownScopes = []string{
+	ScopeAccountsEmailsRead,
+	ScopeMailInviteSend,
+	ScopeTokensIntrospect,
+}
+
+// Scopes which can be delegated by an account to a third-party app.
+const (
+	// Log in with Noted and obtain an ID token.
+	ScopeOpenID = "openid"
+
+	// Read the name of the account.
+	ScopeProfile = "profile"
+
+	// Read the email address of the account.
+	ScopeEmail = "email"
+
+	// Read and edit the notes of the account.
+	ScopeNotesRead  = "notes.read"
+	ScopeNotesWrite = "notes.write"
+)
+
+// DelegableScopes lists every scope third-party apps can request.
+var DelegableScopes = []string{
+	ScopeOpenID,
+	ScopeProfile,
+	ScopeEmail,
+	ScopeNotesRead,
+	ScopeNotesWrite,
+}
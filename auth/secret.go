@@ -0,0 +1,102 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// GenerateSecret returns a URL-safe string encoding n bytes read from
+// crypto/rand. It is used for opaque credentials such as refresh tokens.
+func GenerateSecret(n int) (string, error) {
+	b := make([]byte, n)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// GeneratePersonalAccessToken returns a new personal access token, made of
+// PersonalAccessTokenPrefix and a secret.
+func GeneratePersonalAccessToken() (string, error) {
+	secret, err := GenerateSecret(32)
+	if err != nil {
+		return "", err
+	}
+	return PersonalAccessTokenPrefix + secret, nil
+}
+
+// HashSecret returns the hex encoded SHA-256 digest of secret. Only the
+// digest of an opaque credential is stored, so that a leak of the database
+// does not leak usable credentials.
+func HashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// Lowercase letters and digits without the ambiguous l, o, 0 and 1. Its
+// length divides 256 so that each character is equally likely.
+const recoveryCodeAlphabet = "abcdefghijkmnpqrstuvwxyz23456789"
+
+// GenerateRecoveryCode returns a single-use code, formatted as two groups of
+// five characters, which users can type in when they lose access to their
+// second factor.
+func GenerateRecoveryCode() (string, error) {
+	b := make([]byte, 10)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	for i := range b {
+		b[i] = recoveryCodeAlphabet[int(b[i])%len(recoveryCodeAlphabet)]
+	}
+	return string(b[:5]) + "-" + string(b[5:]), nil
+}
+
+// NormalizeRecoveryCode removes the formatting of a recovery code typed in
+// by a user, so that its hash can be compared to the stored one.
+func NormalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+}
+
+// GenerateCode returns a random code of the given number of digits, short
+// enough to be typed in from an email or a text message.
+func GenerateCode(digits int) (string, error) {
+	max := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(digits)), nil)
+	n, err := rand.Int(rand.Reader, max)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%0*d", digits, n), nil
+}
+
+// Uppercase consonants without vowels, so that user codes cannot spell
+// words, and without the Y which is sometimes read as a vowel.
+const userCodeAlphabet = "BCDFGHJKLMNPQRSTVWXZ"
+
+// GenerateUserCode returns a code, formatted as two groups of four
+// characters, which users type in on another device to approve the login of
+// a device without a browser.
+func GenerateUserCode() (string, error) {
+	b := make([]byte, 8)
+	max := big.NewInt(int64(len(userCodeAlphabet)))
+	for i := range b {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		b[i] = userCodeAlphabet[n.Int64()]
+	}
+	return string(b[:4]) + "-" + string(b[4:]), nil
+}
+
+// NormalizeUserCode removes the formatting of a user code typed in by a
+// user, so that it can be compared to the generated one.
+func NormalizeUserCode(code string) string {
+	return strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(code))
+}
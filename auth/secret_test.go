@@ -0,0 +1,35 @@
+package auth_test
+
+import (
+	"accounts-service/auth"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerateSecret(t *testing.T) {
+	a, err := auth.GenerateSecret(32)
+	require.NoError(t, err)
+	b, err := auth.GenerateSecret(32)
+	require.NoError(t, err)
+
+	require.Len(t, a, 43)
+	require.NotEqual(t, a, b)
+	require.NotEqual(t, a, auth.HashSecret(a))
+	require.Equal(t, auth.HashSecret(a), auth.HashSecret(a))
+}
+
+func TestGenerateCode(t *testing.T) {
+	code, err := auth.GenerateCode(6)
+	require.NoError(t, err)
+	require.Regexp(t, `^[0-9]{6}$`, code)
+}
+
+func TestGenerateUserCode(t *testing.T) {
+	code, err := auth.GenerateUserCode()
+	require.NoError(t, err)
+	require.Regexp(t, `^[BCDFGHJKLMNPQRSTVWXZ]{4}-[BCDFGHJKLMNPQRSTVWXZ]{4}$`, code)
+	require.Equal(t, auth.NormalizeUserCode(code), auth.NormalizeUserCode(" "+strings.ToLower(code)))
+	require.Len(t, auth.NormalizeUserCode(code), 8)
+}
@@ -1,15 +1,13 @@
 // Package auth implements all the authentication logic used by
 // the accounts service.
-//
-// TODO: Add configurable standard claims such as the token expiration date.
 package auth
 
 import (
 	"context"
-	"crypto/ed25519"
 	"errors"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/golang-jwt/jwt"
 	"google.golang.org/grpc/metadata"
@@ -19,6 +17,11 @@ var (
 	ErrNoTokenInCtx    = errors.New("no token in context")
 	ErrNoMetadataInCtx = errors.New("no metadata in context")
 	ErrInvalidClaims   = errors.New("token has invalid claims")
+	ErrTokenNoExpiry   = errors.New("token has no expiration date")
+	ErrSessionRevoked  = errors.New("session has been revoked")
+	ErrCannotSign      = errors.New("verify-only service cannot sign tokens")
+
+	ErrNoPersonalAccessTokens = errors.New("personal access tokens are not accepted")
 )
 
 const (
@@ -27,6 +30,14 @@ const (
 
 	// The value of the authorization header must be "Bearer <token>".
 	AuthorizationHeaderPrefix = "Bearer"
+
+	// The lifetime of the tokens signed by a service created without the
+	// WithTokenLifetime option.
+	DefaultTokenLifetime = 15 * time.Minute
+
+	// Personal access tokens start with this prefix, so that they can be
+	// told apart from JWTs and found by secret scanners.
+	PersonalAccessTokenPrefix = "noted_pat_"
 )
 
 // Service is used to create JWTs for use with other services or to
@@ -38,6 +49,10 @@ type Service interface {
 	// is returned.
 	TokenFromContext(ctx context.Context) (*Token, error)
 
+	// ParseToken verifies tokenString like TokenFromContext, for the tokens
+	// which are not presented in the authorization header.
+	ParseToken(ctx context.Context, tokenString string) (*Token, error)
+
 	// ContextWithToken returns a copy of parent in which a new value for the
 	// key 'authorization' is set to a string encoded JWT.
 	ContextWithToken(parent context.Context, info *Token) (context.Context, error)
@@ -45,18 +60,92 @@ type Service interface {
 	// SignToken returns a signed JWT string containing the payload
 	// of info.
 	SignToken(info *Token) (string, error)
+
+	// SignIDToken returns a signed JWT string containing the payload of
+	// info, signed with the same keys as the access tokens.
+	SignIDToken(info *IDToken) (string, error)
+}
+
+// SessionValidator is consulted by TokenFromContext once a token has been
+// verified, so that the tokens of revoked sessions can be rejected.
+type SessionValidator interface {
+	// ValidateSession returns ErrSessionRevoked if the session of token is
+	// no longer active.
+	ValidateSession(ctx context.Context, token *Token) error
+}
+
+// PersonalAccessTokenResolver is consulted by TokenFromContext to look up
+// the personal access tokens, which are opaque.
+type PersonalAccessTokenResolver interface {
+	// ResolvePersonalAccessToken returns the payload of the unexpired
+	// personal access token secret, or an error if there is none.
+	ResolvePersonalAccessToken(ctx context.Context, secret string) (*Token, error)
+}
+
+// Option configures the claims set and enforced by a Service.
+type Option func(*service)
+
+// WithTokenLifetime sets the duration after which signed tokens expire.
+func WithTokenLifetime(lifetime time.Duration) Option {
+	return func(srv *service) {
+		srv.lifetime = lifetime
+	}
+}
+
+// WithIssuer sets the 'iss' claim of signed tokens. Tokens with another
+// issuer are rejected.
+func WithIssuer(issuer string) Option {
+	return func(srv *service) {
+		srv.issuer = issuer
+	}
+}
+
+// WithAudience sets the 'aud' claim of signed tokens. Tokens with another
+// audience are rejected.
+func WithAudience(audience string) Option {
+	return func(srv *service) {
+		srv.audience = audience
+	}
 }
 
-// NewService creates a new authentication service which encodes/decodes
-// signed-JWTs with the key provided as argument.
-func NewService(key ed25519.PrivateKey) Service {
-	return &service{
-		key: key,
+// WithSessionValidator rejects the tokens of the sessions reported as revoked
+// by validator.
+func WithSessionValidator(validator SessionValidator) Option {
+	return func(srv *service) {
+		srv.sessions = validator
 	}
 }
 
+// WithPersonalAccessTokens accepts the personal access tokens known to
+// resolver along with the JWTs.
+func WithPersonalAccessTokens(resolver PersonalAccessTokenResolver) Option {
+	return func(srv *service) {
+		srv.personalTokens = resolver
+	}
+}
+
+// NewService creates a new authentication service which signs JWTs with the
+// signing key of keyring and verifies them against any of its keys.
+func NewService(keyring *Keyring, opts ...Option) Service {
+	srv := &service{
+		keyring:  keyring,
+		lifetime: DefaultTokenLifetime,
+	}
+	for _, opt := range opts {
+		opt(srv)
+	}
+	return srv
+}
+
 type service struct {
-	key ed25519.PrivateKey
+	keyring  *Keyring
+	lifetime time.Duration
+	issuer   string
+	audience string
+	sessions SessionValidator
+	jwks     *jwksFetcher
+
+	personalTokens PersonalAccessTokenResolver
 }
 
 func (srv *service) TokenFromContext(ctx context.Context) (*Token, error) {
@@ -78,13 +167,37 @@ func (srv *service) TokenFromContext(ctx context.Context) (*Token, error) {
 	if tokenString == "" {
 		return nil, ErrNoTokenInCtx
 	}
+
+	return srv.ParseToken(ctx, tokenString)
+}
+
+func (srv *service) ParseToken(ctx context.Context, tokenString string) (*Token, error) {
+	if strings.HasPrefix(tokenString, PersonalAccessTokenPrefix) {
+		if srv.personalTokens == nil {
+			return nil, ErrNoPersonalAccessTokens
+		}
+		return srv.personalTokens.ResolvePersonalAccessToken(ctx, tokenString)
+	}
+
 	tok, err := jwt.ParseWithClaims(tokenString, &Token{}, func(t *jwt.Token) (interface{}, error) {
-		pub, ok := srv.key.Public().(ed25519.PublicKey)
+		if _, ok := t.Method.(*jwt.SigningMethodEd25519); !ok {
+			return nil, fmt.Errorf("unexpected signing method %v", t.Header["alg"])
+		}
+		kid, ok := t.Header["kid"].(string)
 		if !ok {
-			// This should never happen
-			return nil, errors.New("invalid key")
+			// Tokens signed before the introduction of the keyring carry no
+			// key ID and can only have been signed by the signing key.
+			_, kid, _ = srv.keyring.SigningKey()
 		}
-		return pub, nil
+		key, err := srv.keyring.PublicKey(kid)
+		if errors.Is(err, ErrUnknownKey) && srv.jwks != nil {
+			err = srv.jwks.refresh(ctx)
+			if err != nil {
+				return nil, err
+			}
+			key, err = srv.keyring.PublicKey(kid)
+		}
+		return key, err
 	})
 	if err != nil {
 		return nil, fmt.Errorf("could not parse token: %v", err)
@@ -95,9 +208,37 @@ func (srv *service) TokenFromContext(ctx context.Context) (*Token, error) {
 		return nil, ErrInvalidClaims
 	}
 
+	err = srv.verifyStandardClaims(claims)
+	if err != nil {
+		return nil, err
+	}
+
+	// Machine identities authenticate without starting a session.
+	if srv.sessions != nil && !claims.IsService() {
+		err = srv.sessions.ValidateSession(ctx, claims)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	return claims, nil
 }
 
+// verifyStandardClaims checks the claims which jwt.StandardClaims.Valid
+// does not enforce. The expiration date itself is checked while parsing.
+func (srv *service) verifyStandardClaims(claims *Token) error {
+	if claims.ExpiresAt == 0 {
+		return ErrTokenNoExpiry
+	}
+	if srv.issuer != "" && !claims.VerifyIssuer(srv.issuer, true) {
+		return fmt.Errorf("%w: unexpected issuer %q", ErrInvalidClaims, claims.Issuer)
+	}
+	if srv.audience != "" && !claims.VerifyAudience(srv.audience, true) {
+		return fmt.Errorf("%w: unexpected audience %q", ErrInvalidClaims, claims.Audience)
+	}
+	return nil
+}
+
 func (srv *service) ContextWithToken(parent context.Context, info *Token) (context.Context, error) {
 	ss, err := srv.SignToken(info)
 	if err != nil {
@@ -106,9 +247,49 @@ func (srv *service) ContextWithToken(parent context.Context, info *Token) (conte
 	return metadata.AppendToOutgoingContext(parent, AuthorizationHeaderKey, fmt.Sprint(AuthorizationHeaderPrefix, " ", ss)), nil
 }
 
+// SignToken fills the standard claims left empty in info before signing it.
+// An expiration date already set by the caller is kept as is.
 func (srv *service) SignToken(info *Token) (string, error) {
-	jwtTok := jwt.NewWithClaims(&jwt.SigningMethodEd25519{}, info)
-	return jwtTok.SignedString(srv.key)
+	claims := *info
+	srv.fillStandardClaims(&claims.StandardClaims)
+	return srv.sign(&claims)
+}
+
+// SignIDToken fills the standard claims left empty in info like SignToken,
+// except for the audience which must be set by the caller.
+func (srv *service) SignIDToken(info *IDToken) (string, error) {
+	claims := *info
+	if claims.Audience == "" {
+		return "", fmt.Errorf("%w: id token has no audience", ErrInvalidClaims)
+	}
+	srv.fillStandardClaims(&claims.StandardClaims)
+	return srv.sign(&claims)
+}
+
+func (srv *service) fillStandardClaims(claims *jwt.StandardClaims) {
+	now := time.Now()
+	if claims.IssuedAt == 0 {
+		claims.IssuedAt = now.Unix()
+	}
+	if claims.ExpiresAt == 0 {
+		claims.ExpiresAt = now.Add(srv.lifetime).Unix()
+	}
+	if claims.Issuer == "" {
+		claims.Issuer = srv.issuer
+	}
+	if claims.Audience == "" {
+		claims.Audience = srv.audience
+	}
+}
+
+func (srv *service) sign(claims jwt.Claims) (string, error) {
+	key, kid, ok := srv.keyring.SigningKey()
+	if !ok {
+		return "", ErrCannotSign
+	}
+	jwtTok := jwt.NewWithClaims(&jwt.SigningMethodEd25519{}, claims)
+	jwtTok.Header["kid"] = kid
+	return jwtTok.SignedString(key)
 }
 
 // TokenFromBearerString extracts the token from "Bearer <token>".
@@ -4,7 +4,9 @@ import (
 	"accounts-service/auth"
 	"context"
 	"crypto/ed25519"
+	"errors"
 	"testing"
+	"time"
 
 	"github.com/golang-jwt/jwt"
 	"github.com/stretchr/testify/require"
@@ -14,7 +16,7 @@ import (
 func Test_service_ContextWithToken(t *testing.T) {
 	// Given
 	pub, priv := genKeyOrFail(t)
-	srv := auth.NewService(priv)
+	srv := auth.NewService(auth.NewKeyring(priv))
 
 	// When
 	ctx, err := srv.ContextWithToken(context.TODO(), &auth.Token{AccountID: "123"})
@@ -52,7 +54,7 @@ func Test_service_ContextWithToken(t *testing.T) {
 func Test_service_TokenFromContext(t *testing.T) {
 	// Given
 	_, priv := genKeyOrFail(t)
-	srv := auth.NewService(priv)
+	srv := auth.NewService(auth.NewKeyring(priv))
 	ctx, err := srv.ContextWithToken(context.TODO(), &auth.Token{AccountID: "123"})
 	require.NoError(t, err)
 
@@ -72,3 +74,153 @@ func genKeyOrFail(t *testing.T) (ed25519.PublicKey, ed25519.PrivateKey) {
 	require.NoError(t, err)
 	return pub, priv
 }
+
+func Test_service_TokenFromContext_StandardClaims(t *testing.T) {
+	_, priv := genKeyOrFail(t)
+	srv := auth.NewService(auth.NewKeyring(priv), auth.WithIssuer("accounts-service"), auth.WithAudience("noted"))
+
+	t.Run("signed tokens should carry the standard claims", func(t *testing.T) {
+		ctx, err := srv.ContextWithToken(context.TODO(), &auth.Token{AccountID: "123"})
+		require.NoError(t, err)
+		token, err := srv.TokenFromContext(ctx)
+		require.NoError(t, err)
+		require.Equal(t, "accounts-service", token.Issuer)
+		require.Equal(t, "noted", token.Audience)
+		require.NotZero(t, token.IssuedAt)
+		require.InDelta(t, time.Now().Add(auth.DefaultTokenLifetime).Unix(), token.ExpiresAt, 5)
+	})
+
+	t.Run("expired tokens should be rejected", func(t *testing.T) {
+		ctx, err := srv.ContextWithToken(context.TODO(), &auth.Token{
+			AccountID:      "123",
+			StandardClaims: jwt.StandardClaims{ExpiresAt: time.Now().Add(-time.Minute).Unix()},
+		})
+		require.NoError(t, err)
+		_, err = srv.TokenFromContext(ctx)
+		require.Error(t, err)
+	})
+
+	t.Run("tokens without expiration date should be rejected", func(t *testing.T) {
+		tokenString, err := jwt.NewWithClaims(&jwt.SigningMethodEd25519{}, &auth.Token{AccountID: "123"}).SignedString(priv)
+		require.NoError(t, err)
+		ctx := metadata.AppendToOutgoingContext(context.TODO(), auth.AuthorizationHeaderKey, auth.AuthorizationHeaderPrefix+" "+tokenString)
+		_, err = srv.TokenFromContext(ctx)
+		require.ErrorIs(t, err, auth.ErrTokenNoExpiry)
+	})
+
+	t.Run("tokens from another issuer should be rejected", func(t *testing.T) {
+		other := auth.NewService(auth.NewKeyring(priv), auth.WithIssuer("someone-else"), auth.WithAudience("noted"))
+		ctx, err := other.ContextWithToken(context.TODO(), &auth.Token{AccountID: "123"})
+		require.NoError(t, err)
+		_, err = srv.TokenFromContext(ctx)
+		require.ErrorIs(t, err, auth.ErrInvalidClaims)
+	})
+
+	t.Run("tokens for another audience should be rejected", func(t *testing.T) {
+		other := auth.NewService(auth.NewKeyring(priv), auth.WithIssuer("accounts-service"), auth.WithAudience("someone-else"))
+		ctx, err := other.ContextWithToken(context.TODO(), &auth.Token{AccountID: "123"})
+		require.NoError(t, err)
+		_, err = srv.TokenFromContext(ctx)
+		require.ErrorIs(t, err, auth.ErrInvalidClaims)
+	})
+}
+
+type revokedSessions map[string]bool
+
+func (r revokedSessions) ValidateSession(ctx context.Context, token *auth.Token) error {
+	if r[token.SessionID] {
+		return auth.ErrSessionRevoked
+	}
+	return nil
+}
+
+func Test_service_TokenFromContext_RevokedSession(t *testing.T) {
+	_, priv := genKeyOrFail(t)
+	srv := auth.NewService(auth.NewKeyring(priv), auth.WithSessionValidator(revokedSessions{"revoked": true}))
+
+	ctx, err := srv.ContextWithToken(context.TODO(), &auth.Token{AccountID: "123", SessionID: "active"})
+	require.NoError(t, err)
+	token, err := srv.TokenFromContext(ctx)
+	require.NoError(t, err)
+	require.Equal(t, "active", token.SessionID)
+
+	ctx, err = srv.ContextWithToken(context.TODO(), &auth.Token{AccountID: "123", SessionID: "revoked"})
+	require.NoError(t, err)
+	_, err = srv.TokenFromContext(ctx)
+	require.ErrorIs(t, err, auth.ErrSessionRevoked)
+}
+
+func Test_service_TokenFromContext_ServiceToken(t *testing.T) {
+	_, priv := genKeyOrFail(t)
+	srv := auth.NewService(auth.NewKeyring(priv), auth.WithSessionValidator(revokedSessions{"": true}))
+
+	ctx, err := srv.ContextWithToken(context.TODO(), &auth.Token{ServiceID: "notes-service", Scopes: []string{auth.ScopeAccountsEmailsRead}})
+	require.NoError(t, err)
+
+	token, err := srv.TokenFromContext(ctx)
+	require.NoError(t, err)
+	require.True(t, token.IsService())
+	require.True(t, token.HasScope(auth.ScopeAccountsEmailsRead))
+}
+
+func Test_service_SignIDToken(t *testing.T) {
+	pub, priv := genKeyOrFail(t)
+	srv := auth.NewService(auth.NewKeyring(priv), auth.WithIssuer("accounts-service"), auth.WithAudience("noted"))
+
+	_, err := srv.SignIDToken(&auth.IDToken{Email: "jane@example.com"})
+	require.ErrorIs(t, err, auth.ErrInvalidClaims, "the audience is the app")
+
+	tokenString, err := srv.SignIDToken(&auth.IDToken{
+		Nonce:          "nonce",
+		StandardClaims: jwt.StandardClaims{Subject: "123", Audience: "client", Issuer: "https://accounts.example.com"},
+	})
+	require.NoError(t, err)
+
+	tok, err := jwt.ParseWithClaims(tokenString, &auth.IDToken{}, func(*jwt.Token) (interface{}, error) {
+		return pub, nil
+	})
+	require.NoError(t, err)
+	claims := tok.Claims.(*auth.IDToken)
+	require.Equal(t, "client", claims.Audience)
+	require.Equal(t, "https://accounts.example.com", claims.Issuer)
+	require.Equal(t, "nonce", claims.Nonce)
+	require.NotZero(t, claims.ExpiresAt)
+
+	// ID tokens are meant for the app and cannot be used as access tokens.
+	ctx := metadata.AppendToOutgoingContext(context.TODO(), auth.AuthorizationHeaderKey, auth.AuthorizationHeaderPrefix+" "+tokenString)
+	_, err = srv.TokenFromContext(ctx)
+	require.ErrorIs(t, err, auth.ErrInvalidClaims)
+}
+
+type personalAccessTokens map[string]*auth.Token
+
+func (p personalAccessTokens) ResolvePersonalAccessToken(ctx context.Context, secret string) (*auth.Token, error) {
+	token, ok := p[secret]
+	if !ok {
+		return nil, errors.New("unknown personal access token")
+	}
+	return token, nil
+}
+
+func Test_service_TokenFromContext_PersonalAccessToken(t *testing.T) {
+	_, priv := genKeyOrFail(t)
+	secret, err := auth.GeneratePersonalAccessToken()
+	require.NoError(t, err)
+	ctx := metadata.AppendToOutgoingContext(context.TODO(), auth.AuthorizationHeaderKey, auth.AuthorizationHeaderPrefix+" "+secret)
+
+	_, err = auth.NewService(auth.NewKeyring(priv)).TokenFromContext(ctx)
+	require.ErrorIs(t, err, auth.ErrNoPersonalAccessTokens)
+
+	srv := auth.NewService(auth.NewKeyring(priv), auth.WithPersonalAccessTokens(personalAccessTokens{
+		secret: {AccountID: "123", PersonalAccessTokenID: "export", Scopes: []string{auth.ScopeNotesRead}},
+	}))
+	token, err := srv.TokenFromContext(ctx)
+	require.NoError(t, err)
+	require.True(t, token.IsPersonal())
+	require.True(t, token.HasScope(auth.ScopeNotesRead))
+
+	other, err := auth.GeneratePersonalAccessToken()
+	require.NoError(t, err)
+	_, err = srv.TokenFromContext(metadata.AppendToOutgoingContext(context.TODO(), auth.AuthorizationHeaderKey, auth.AuthorizationHeaderPrefix+" "+other))
+	require.Error(t, err)
+}
@@ -4,11 +4,14 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"strings"
 
 	"google.golang.org/grpc/metadata"
 )
 
 type TestService struct {
+	// Resolves the personal access tokens when set.
+	PersonalAccessTokens PersonalAccessTokenResolver
 }
 
 var _ Service = &TestService{}
@@ -41,6 +44,14 @@ func (srv *TestService) TokenFromContext(ctx context.Context) (*Token, error) {
 		return nil, ErrNoTokenInCtx
 	}
 
+	return srv.ParseToken(ctx, tokenString)
+}
+
+func (srv *TestService) ParseToken(ctx context.Context, tokenString string) (*Token, error) {
+	if strings.HasPrefix(tokenString, PersonalAccessTokenPrefix) && srv.PersonalAccessTokens != nil {
+		return srv.PersonalAccessTokens.ResolvePersonalAccessToken(ctx, tokenString)
+	}
+
 	token := &Token{}
 	json.Unmarshal([]byte(tokenString), token)
 
@@ -51,3 +62,8 @@ func (srv *TestService) SignToken(info *Token) (string, error) {
 	bytes, err := json.Marshal(info)
 	return string(bytes), err
 }
+
+func (srv *TestService) SignIDToken(info *IDToken) (string, error) {
+	bytes, err := json.Marshal(info)
+	return string(bytes), err
+}
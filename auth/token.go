@@ -1,11 +1,102 @@
 package auth
 
 import (
+	"time"
+
 	"github.com/golang-jwt/jwt"
 )
 
-// Token represents the payload section of a JWT.
+// Methods an account authenticated with, as listed in the amr claim. The
+// values registered by RFC 8176 are used where one applies.
+const (
+	AuthMethodPassword    = "pwd"
+	AuthMethodPasskey     = "hwk"
+	AuthMethodOTP         = "otp" // TOTP or recovery code.
+	AuthMethodMultiFactor = "mfa"
+	AuthMethodEmail       = "email" // Code or link sent by email.
+	AuthMethodFederated   = "fed"   // Login with an identity provider.
+)
+
+// Token represents the payload section of a JWT. A token either identifies
+// an account or, when ServiceID is set, a machine identity calling the
+// accounts service on its own behalf. When ClientID is set, the token was
+// issued to a third-party app which may only act on behalf of the account
+// within its Scopes. Personal access tokens are resolved into a Token with
+// PersonalAccessTokenID set, limited to its Scopes as well.
+//
+// AuthTime is the last time the session of the token proved a credential of
+// the account, with AuthMethods. It is zero when the session never did,
+// like the sessions approved from another device.
 type Token struct {
-	AccountID string `json:"aid,omitempty"`
+	AccountID string   `json:"aid,omitempty"`
+	SessionID string   `json:"sid,omitempty"`
+	Roles     []string `json:"roles,omitempty"`
+	ServiceID string   `json:"svc,omitempty"`
+	ClientID  string   `json:"cid,omitempty"`
+	Scopes    []string `json:"scp,omitempty"`
+
+	PersonalAccessTokenID string `json:"pat,omitempty"`
+
+	AuthTime    int64    `json:"auth_time,omitempty"`
+	AuthMethods []string `json:"amr,omitempty"`
+
 	jwt.StandardClaims
 }
+
+// IDToken is the payload of the OpenID Connect ID tokens telling third-party
+// apps which account logged in. The audience is the ID of the app.
+type IDToken struct {
+	Nonce         string `json:"nonce,omitempty"`
+	Email         string `json:"email,omitempty"`
+	EmailVerified bool   `json:"email_verified,omitempty"`
+	Name          string `json:"name,omitempty"`
+	jwt.StandardClaims
+}
+
+// IsService reports whether the token was issued to a machine identity.
+func (t *Token) IsService() bool {
+	return t.ServiceID != ""
+}
+
+// IsDelegated reports whether the token was issued to a third-party app.
+func (t *Token) IsDelegated() bool {
+	return t.ClientID != ""
+}
+
+// IsPersonal reports whether the token is a personal access token.
+func (t *Token) IsPersonal() bool {
+	return t.PersonalAccessTokenID != ""
+}
+
+// AuthenticatedWithin reports whether the session of the token proved a
+// credential of the account less than maxAge ago.
+func (t *Token) AuthenticatedWithin(maxAge time.Duration) bool {
+	return t.AuthTime != 0 && time.Since(time.Unix(t.AuthTime, 0)) <= maxAge
+}
+
+// HasRole reports whether the account of the token was granted role. Every
+// account has the user role.
+func (t *Token) HasRole(role string) bool {
+	if t.IsService() {
+		return false
+	}
+	if role == RoleUser {
+		return true
+	}
+	for _, r := range t.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// HasScope reports whether the token grants scope.
+func (t *Token) HasScope(scope string) bool {
+	for _, s := range t.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,50 @@
+package auth_test
+
+import (
+	"accounts-service/auth"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestToken(t *testing.T) {
+	human := &auth.Token{AccountID: "123"}
+	require.False(t, human.IsService())
+	require.False(t, human.HasScope(auth.ScopeAccountsEmailsRead))
+
+	machine := &auth.Token{ServiceID: "notes-service", Scopes: []string{auth.ScopeAccountsEmailsRead}}
+	require.True(t, machine.IsService())
+	require.True(t, machine.HasScope(auth.ScopeAccountsEmailsRead))
+	require.False(t, machine.HasScope(auth.ScopeMailInviteSend))
+
+	app := &auth.Token{AccountID: "123", ClientID: "discord-bot", Scopes: []string{auth.ScopeNotesRead}}
+	require.True(t, app.IsDelegated())
+	require.False(t, app.IsService())
+	require.True(t, app.HasScope(auth.ScopeNotesRead))
+	require.False(t, human.IsDelegated())
+}
+
+func TestToken_HasRole(t *testing.T) {
+	user := &auth.Token{AccountID: "123"}
+	require.True(t, user.HasRole(auth.RoleUser))
+	require.False(t, user.HasRole(auth.RoleAdmin))
+
+	admin := &auth.Token{AccountID: "123", Roles: []string{auth.RoleAdmin}}
+	require.True(t, admin.HasRole(auth.RoleUser))
+	require.True(t, admin.HasRole(auth.RoleAdmin))
+	require.False(t, admin.HasRole(auth.RoleSupport))
+
+	machine := &auth.Token{ServiceID: "notes-service", Roles: []string{auth.RoleAdmin}}
+	require.False(t, machine.HasRole(auth.RoleUser))
+	require.False(t, machine.HasRole(auth.RoleAdmin))
+}
+
+func TestToken_AuthenticatedWithin(t *testing.T) {
+	recent := &auth.Token{AccountID: "123", AuthTime: time.Now().Add(-time.Minute).Unix()}
+	require.True(t, recent.AuthenticatedWithin(5*time.Minute))
+	require.False(t, recent.AuthenticatedWithin(time.Second))
+
+	never := &auth.Token{AccountID: "123"}
+	require.False(t, never.AuthenticatedWithin(24*time.Hour))
+}
@@ -0,0 +1,49 @@
+package auth_test
+
+import (
+	"accounts-service/auth"
+	"encoding/base32"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTOTPCode(t *testing.T) {
+	// Test vectors of RFC 6238 appendix B, truncated to 6 digits.
+	secret := base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+	for unix, code := range map[int64]string{
+		59:         "287082",
+		1111111109: "081804",
+		1234567890: "005924",
+		2000000000: "279037",
+	} {
+		got, err := auth.TOTPCode(secret, time.Unix(unix, 0))
+		require.NoError(t, err)
+		require.Equal(t, code, got)
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	secret, err := auth.GenerateTOTPSecret()
+	require.NoError(t, err)
+	now := time.Now()
+
+	code, err := auth.TOTPCode(secret, now.Add(-30*time.Second))
+	require.NoError(t, err)
+	step, ok := auth.ValidateTOTP(secret, code, now)
+	require.True(t, ok)
+	require.Equal(t, now.Add(-30*time.Second).Unix()/30, step)
+
+	code, err = auth.TOTPCode(secret, now.Add(-2*time.Minute))
+	require.NoError(t, err)
+	_, ok = auth.ValidateTOTP(secret, code, now)
+	require.False(t, ok)
+}
+
+func TestGenerateRecoveryCode(t *testing.T) {
+	code, err := auth.GenerateRecoveryCode()
+	require.NoError(t, err)
+	require.Len(t, code, 11)
+	require.Equal(t, auth.NormalizeRecoveryCode(code), auth.NormalizeRecoveryCode(" "+code[:5]+" "+code[6:]))
+}
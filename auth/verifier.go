@@ -0,0 +1,117 @@
+package auth
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// The minimum duration between two fetches of a JSON Web Key Set, so that
+	// tokens with unknown key IDs cannot be used to flood its endpoint.
+	jwksMinRefreshInterval = time.Minute
+)
+
+// NewVerifier creates a service which verifies the tokens signed by the
+// private counterpart of key. It cannot sign tokens: SignToken and
+// ContextWithToken return ErrCannotSign.
+func NewVerifier(key ed25519.PublicKey, opts ...Option) Service {
+	keyring := NewKeyring(nil)
+	keyring.Add(key)
+	return NewService(keyring, opts...)
+}
+
+// NewVerifierFromJWKS creates a verify-only service which trusts the keys
+// published by the JSON Web Key Set at url. The key set is fetched again
+// when a token signed by an unknown key is met, so that the signing key of
+// the issuer can be rotated without redeploying the verifiers.
+func NewVerifierFromJWKS(ctx context.Context, url string, opts ...Option) (Service, error) {
+	fetcher := &jwksFetcher{
+		url:     url,
+		client:  &http.Client{Timeout: 10 * time.Second},
+		keyring: NewKeyring(nil),
+	}
+	err := fetcher.fetch(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	srv := NewService(fetcher.keyring, opts...).(*service)
+	srv.jwks = fetcher
+	return srv, nil
+}
+
+type jwksFetcher struct {
+	url     string
+	client  *http.Client
+	keyring *Keyring
+
+	mu          sync.Mutex
+	lastFetchAt time.Time
+}
+
+// refresh fetches the key set again unless it was fetched recently.
+func (f *jwksFetcher) refresh(ctx context.Context) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if time.Since(f.lastFetchAt) < jwksMinRefreshInterval {
+		return nil
+	}
+	return f.fetchLocked(ctx)
+}
+
+func (f *jwksFetcher) fetch(ctx context.Context) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.fetchLocked(ctx)
+}
+
+func (f *jwksFetcher) fetchLocked(ctx context.Context) error {
+	f.lastFetchAt = time.Now()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, f.url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("could not fetch jwks: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("could not fetch jwks: unexpected status %s", resp.Status)
+	}
+
+	jwks := &JSONWebKeySet{}
+	err = json.NewDecoder(resp.Body).Decode(jwks)
+	if err != nil {
+		return fmt.Errorf("could not decode jwks: %v", err)
+	}
+
+	keys := map[string]ed25519.PublicKey{}
+	for _, jwk := range jwks.Keys {
+		if jwk.KeyType != "OKP" || jwk.Curve != "Ed25519" {
+			continue
+		}
+		x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return fmt.Errorf("%w: %q", ErrInvalidKey, jwk.KeyID)
+		}
+		kid := jwk.KeyID
+		if kid == "" {
+			kid = KeyID(x)
+		}
+		keys[kid] = ed25519.PublicKey(x)
+	}
+
+	// Keys no longer published are considered retired.
+	f.keyring.mu.Lock()
+	f.keyring.keys = keys
+	f.keyring.mu.Unlock()
+	return nil
+}
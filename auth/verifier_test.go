@@ -0,0 +1,78 @@
+package auth_test
+
+import (
+	"accounts-service/auth"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewVerifier(t *testing.T) {
+	// Given
+	pub, priv := genKeyOrFail(t)
+	signer := auth.NewService(auth.NewKeyring(priv))
+	verifier := auth.NewVerifier(pub)
+
+	t.Run("the verifier should accept tokens signed by the private key", func(t *testing.T) {
+		ctx, err := signer.ContextWithToken(context.TODO(), &auth.Token{AccountID: "123"})
+		require.NoError(t, err)
+		token, err := verifier.TokenFromContext(ctx)
+		require.NoError(t, err)
+		require.Equal(t, "123", token.AccountID)
+	})
+
+	t.Run("the verifier should reject tokens signed by another key", func(t *testing.T) {
+		_, otherPriv := genKeyOrFail(t)
+		other := auth.NewService(auth.NewKeyring(otherPriv))
+		ctx, err := other.ContextWithToken(context.TODO(), &auth.Token{AccountID: "123"})
+		require.NoError(t, err)
+		_, err = verifier.TokenFromContext(ctx)
+		require.Error(t, err)
+	})
+
+	t.Run("the verifier should not be able to sign tokens", func(t *testing.T) {
+		_, err := verifier.SignToken(&auth.Token{AccountID: "123"})
+		require.ErrorIs(t, err, auth.ErrCannotSign)
+		_, err = verifier.ContextWithToken(context.TODO(), &auth.Token{AccountID: "123"})
+		require.ErrorIs(t, err, auth.ErrCannotSign)
+	})
+}
+
+func TestNewVerifierFromJWKS(t *testing.T) {
+	// Given
+	_, priv := genKeyOrFail(t)
+	keyring := auth.NewKeyring(priv)
+	signer := auth.NewService(keyring)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(keyring.JSONWebKeySet())
+	}))
+	defer server.Close()
+
+	// When
+	verifier, err := auth.NewVerifierFromJWKS(context.TODO(), server.URL)
+
+	// Then
+	require.NoError(t, err)
+
+	t.Run("the verifier should accept tokens signed by a published key", func(t *testing.T) {
+		ctx, err := signer.ContextWithToken(context.TODO(), &auth.Token{AccountID: "123"})
+		require.NoError(t, err)
+		token, err := verifier.TokenFromContext(ctx)
+		require.NoError(t, err)
+		require.Equal(t, "123", token.AccountID)
+	})
+
+	t.Run("the verifier should not be able to sign tokens", func(t *testing.T) {
+		_, err := verifier.SignToken(&auth.Token{AccountID: "123"})
+		require.ErrorIs(t, err, auth.ErrCannotSign)
+	})
+
+	t.Run("the verifier should fail on an unreachable key set", func(t *testing.T) {
+		_, err := auth.NewVerifierFromJWKS(context.TODO(), server.URL+"/missing\x00")
+		require.Error(t, err)
+	})
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"accounts-service/auth"
+	accountsv1 "accounts-service/protorepo/noted/accounts/v1"
+	"context"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	public        = auth.Policy{Access: auth.AccessPublic}
+	authenticated = auth.Policy{Access: auth.AccessAccount}
+	owner         = auth.Policy{Access: auth.AccessOwner, OwnerField: "account_id"}
+)
+
+// accountsAPIPolicies tells who may call each method of the accounts API.
+// The server refuses to start if a method is missing.
+var accountsAPIPolicies = map[string]auth.Policy{
+	"CreateAccount":                      public,
+	"ValidateAccount":                    public,
+	"GetAccount":                         authenticated,
+	"GetMailsFromIDs":                    {Access: auth.AccessService, Scope: auth.ScopeAccountsEmailsRead},
+	"UpdateAccount":                      owner,
+	"DeleteAccount":                      owner,
+	"ListAccounts":                       {Access: auth.AccessRole, Roles: []string{auth.RoleAdmin}},
+	"ForgetAccountPassword":              public,
+	"ForgetAccountPasswordValidateToken": public,
+	"UpdateAccountPassword":              owner,
+	"SendGroupInviteMail":                {Access: auth.AccessService, Scope: auth.ScopeMailInviteSend},
+	"Authenticate":                       public,
+	"RefreshToken":                       public,
+	"GetAccessTokenGoogle":               public,
+	"AuthenticateGoogle":                 public,
+	"RegisterUserToMobileBeta":           owner,
+	"IsAccountValidate":                  public,
+	"SendValidationToken":                public,
+
+	"ListSessions":      owner,
+	"RevokeSession":     owner,
+	"RevokeAllSessions": owner,
+	"Logout":            authenticated,
+
+	"GetJSONWebKeySet":    public,
+	"AuthenticateService": public,
+
+	"SearchAccounts":     {Access: auth.AccessRole, Roles: []string{auth.RoleAdmin, auth.RoleSupport}},
+	"SuspendAccount":     {Access: auth.AccessRole, Roles: []string{auth.RoleAdmin, auth.RoleSupport}},
+	"ReinstateAccount":   {Access: auth.AccessRole, Roles: []string{auth.RoleAdmin, auth.RoleSupport}},
+	"ForceDeleteAccount": {Access: auth.AccessRole, Roles: []string{auth.RoleAdmin}},
+
+	"EnrollTOTP":              owner,
+	"ConfirmTOTP":             owner,
+	"DisableTOTP":             owner,
+	"RegenerateRecoveryCodes": owner,
+	"CompleteSecondFactor":    public,
+
+	"BeginPasskeyRegistration":  owner,
+	"FinishPasskeyRegistration": owner,
+	"BeginPasskeyLogin":         public,
+	"FinishPasskeyLogin":        public,
+
+	"RequestLoginCode": public,
+	"LoginWithCode":    public,
+
+	"BeginAuthenticateWithProvider": public,
+	"AuthenticateWithProvider":      public,
+	"ListLinkedIdentities":          owner,
+	"BeginLinkIdentity":             owner,
+	"LinkIdentity":                  owner,
+	"UnlinkIdentity":                owner,
+	"SetPassword":                   owner,
+
+	"AuthorizeOAuthClient":   authenticated,
+	"ExchangeOAuthToken":     public,
+	"GetOAuthUserInfo":       {Access: auth.AccessApp, Scope: auth.ScopeOpenID},
+	"GetOpenIDConfiguration": public,
+	"ListAuthorizedApps":     owner,
+	"RevokeAuthorizedApp":    owner,
+
+	"CreatePersonalAccessToken": owner,
+	"ListPersonalAccessTokens":  owner,
+	"RevokePersonalAccessToken": owner,
+
+	"StartDeviceAuthorization": public,
+	"ApproveDevice":            authenticated,
+	"PollDeviceToken":          public,
+	"CreateLoginRequest":       public,
+	"ApproveLoginRequest":      authenticated,
+	"PollLoginRequest":         public,
+
+	"Reauthenticate": authenticated,
+
+	"IntrospectToken": {Access: auth.AccessService, Scope: auth.ScopeTokensIntrospect},
+}
+
+// newAuthorizer returns the interceptor enforcing accountsAPIPolicies.
+func newAuthorizer(authService auth.Service) *auth.Authorizer {
+	authorizer := auth.NewAuthorizer(authService)
+	authorizer.Register(accountsv1.AccountsAPI_ServiceDesc.ServiceName, accountsAPIPolicies)
+	return authorizer
+}
+
+// principal returns the caller let through by the authorizer, which is
+// only found on the context of the methods which are not public.
+func (srv *accountsAPI) principal(ctx context.Context) (*auth.Token, error) {
+	token, ok := auth.PrincipalFromContext(ctx)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "invalid token")
+	}
+	return token, nil
+}
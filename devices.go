@@ -0,0 +1,188 @@
+package main
+
+import (
+	"accounts-service/auth"
+	"accounts-service/models"
+	accountsv1 "accounts-service/protorepo/noted/accounts/v1"
+	"accounts-service/validators"
+	"context"
+	"errors"
+	"net/url"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+const (
+	deviceAuthorizationLifetime = 10 * time.Minute
+	// Minimum duration between two polls of the same device code.
+	deviceAuthorizationInterval = 5 * time.Second
+
+	// Reasons of the errors returned to the devices polling for their
+	// token, named after the error codes of RFC 8628.
+	deviceAuthorizationPendingReason = "AUTHORIZATION_PENDING"
+	deviceSlowDownReason             = "SLOW_DOWN"
+)
+
+var (
+	errInvalidUserCode   = status.Error(codes.NotFound, "invalid or expired code")
+	errInvalidDeviceCode = status.Error(codes.InvalidArgument, "invalid or expired device code")
+)
+
+// StartDeviceAuthorization starts the login of a device which cannot show
+// a browser, such as the CLI. The device shows the user code and the
+// verification URI to the user, who approves the login from another device
+// with ApproveDevice, while it polls PollDeviceToken with the device code.
+func (srv *accountsAPI) StartDeviceAuthorization(ctx context.Context, in *accountsv1.StartDeviceAuthorizationRequest) (*accountsv1.StartDeviceAuthorizationResponse, error) {
+	deviceCode, err := auth.GenerateSecret(32)
+	if err != nil {
+		srv.logger.Error("failed to generate device code", zap.Error(err))
+		return nil, status.Error(codes.Internal, "failed to start device authorization")
+	}
+
+	var userCode string
+	// User codes are short, so a code still in use may be drawn again.
+	for i := 0; i < 3; i++ {
+		userCode, err = auth.GenerateUserCode()
+		if err != nil {
+			srv.logger.Error("failed to generate user code", zap.Error(err))
+			return nil, status.Error(codes.Internal, "failed to start device authorization")
+		}
+		_, err = srv.deviceAuthorizations.Create(ctx, &models.DeviceAuthorizationPayload{
+			ID:        auth.HashSecret(deviceCode),
+			UserCode:  auth.NormalizeUserCode(userCode),
+			ExpiresAt: time.Now().UTC().Add(deviceAuthorizationLifetime),
+		})
+		if !errors.Is(err, models.ErrDuplicateKeyFound) {
+			break
+		}
+	}
+	if err != nil {
+		return nil, statusFromModelError(err)
+	}
+
+	verificationURL, err := url.Parse(srv.deviceVerifyURL)
+	if err != nil {
+		srv.logger.Error("invalid device verification url", zap.Error(err))
+		return nil, status.Error(codes.Internal, "failed to start device authorization")
+	}
+	query := verificationURL.Query()
+	query.Set("user_code", userCode)
+	verificationURL.RawQuery = query.Encode()
+
+	return &accountsv1.StartDeviceAuthorizationResponse{
+		DeviceCode:              deviceCode,
+		UserCode:                userCode,
+		VerificationUri:         srv.deviceVerifyURL,
+		VerificationUriComplete: verificationURL.String(),
+		ExpiresIn:               int32(deviceAuthorizationLifetime.Seconds()),
+		Interval:                int32(deviceAuthorizationInterval.Seconds()),
+	}, nil
+}
+
+// ApproveDevice is called by the page of the frontend where the user types
+// in the user code shown by a device, and logs the device in to the account
+// of the user.
+func (srv *accountsAPI) ApproveDevice(ctx context.Context, in *accountsv1.ApproveDeviceRequest) (*accountsv1.ApproveDeviceResponse, error) {
+	token, err := srv.principal(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	err = validators.ValidateApproveDeviceRequest(in)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	// User codes are short enough to be guessed, which would log the device
+	// of another user in to the account of the guesser.
+	keys := srv.throttleKeys(ctx, throttleUserCode, token.AccountID)
+	err = srv.reserveAttempt(ctx, keys)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = srv.deviceAuthorizations.Approve(ctx, &models.OneDeviceAuthorizationFilter{UserCode: auth.NormalizeUserCode(in.UserCode)}, token.AccountID)
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			return nil, errInvalidUserCode
+		}
+		srv.releaseAttempt(ctx, keys)
+		return nil, statusFromModelError(err)
+	}
+	// The failures are not reset, otherwise approving a device of their
+	// own between guesses would let anyone guess without limit.
+	srv.releaseAttempt(ctx, keys)
+
+	return &accountsv1.ApproveDeviceResponse{}, nil
+}
+
+// PollDeviceToken returns the tokens of the device once the user approved
+// it. Until then, it fails with FailedPrecondition and the
+// AUTHORIZATION_PENDING reason, or with ResourceExhausted and the SLOW_DOWN
+// reason when the device polls more often than the interval returned by
+// StartDeviceAuthorization.
+func (srv *accountsAPI) PollDeviceToken(ctx context.Context, in *accountsv1.PollDeviceTokenRequest) (*accountsv1.PollDeviceTokenResponse, error) {
+	err := validators.ValidatePollDeviceTokenRequest(in)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	filter := &models.OneDeviceAuthorizationFilter{ID: auth.HashSecret(in.DeviceCode)}
+	authorization, err := srv.deviceAuthorizations.Poll(ctx, filter)
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			return nil, errInvalidDeviceCode
+		}
+		return nil, statusFromModelError(err)
+	}
+
+	if authorization.LastPolledAt != nil && time.Since(*authorization.LastPolledAt) < deviceAuthorizationInterval {
+		return nil, devicePollError(codes.ResourceExhausted, deviceSlowDownReason, "polling too often, slow down")
+	}
+	if authorization.AccountID == "" {
+		return nil, devicePollError(codes.FailedPrecondition, deviceAuthorizationPendingReason, "authorization pending")
+	}
+
+	// Only one of concurrent polls gets the tokens.
+	filter.AccountID = authorization.AccountID
+	err = srv.deviceAuthorizations.Delete(ctx, filter)
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			return nil, errInvalidDeviceCode
+		}
+		return nil, statusFromModelError(err)
+	}
+
+	acc, err := srv.repo.Get(ctx, &models.OneAccountFilter{ID: authorization.AccountID})
+	if err != nil {
+		return nil, statusFromModelError(err)
+	}
+
+	// The device proved no credential itself.
+	tokenString, refreshToken, err := srv.issueTokens(ctx, acc)
+	if err != nil {
+		return nil, err
+	}
+
+	return &accountsv1.PollDeviceTokenResponse{Token: tokenString, RefreshToken: refreshToken}, nil
+}
+
+// devicePollError returns the error telling a polling device why it got no
+// token yet. Devices which poll too often are also told how long to wait.
+func devicePollError(code codes.Code, reason string, message string) error {
+	errorInfo := &errdetails.ErrorInfo{Reason: reason, Domain: errorDomain}
+
+	st, err := status.New(code, message).WithDetails(errorInfo)
+	if code == codes.ResourceExhausted {
+		st, err = status.New(code, message).WithDetails(errorInfo, &errdetails.RetryInfo{RetryDelay: durationpb.New(deviceAuthorizationInterval)})
+	}
+	if err != nil {
+		return status.Error(code, message)
+	}
+	return st.Err()
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	accountsv1 "accounts-service/protorepo/noted/accounts/v1"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func requireDevicePollReason(t *testing.T, reason string, err error) {
+	st, ok := status.FromError(err)
+	require.True(t, ok)
+	require.NotEmpty(t, st.Details())
+	errorInfo, ok := st.Details()[0].(*errdetails.ErrorInfo)
+	require.True(t, ok)
+	require.Equal(t, reason, errorInfo.Reason)
+}
+
+func TestDeviceAuthorization(t *testing.T) {
+	tu := newTestUtilsOrDie(t)
+
+	email := tu.randomAlphanumeric() + "@gmail.fr"
+	tu.newTestAccount(t, "Approver", email, "123456")
+	acc := tu.validateTestAccount(t, email, "123456")
+
+	t.Run("pending-then-slow-down", func(t *testing.T) {
+		start, err := tu.accounts.StartDeviceAuthorization(context.TODO(), &accountsv1.StartDeviceAuthorizationRequest{})
+		require.NoError(t, err)
+
+		_, err = tu.accounts.PollDeviceToken(context.TODO(), &accountsv1.PollDeviceTokenRequest{DeviceCode: start.DeviceCode})
+		requireErrorHasGRPCCode(t, codes.FailedPrecondition, err)
+		requireDevicePollReason(t, deviceAuthorizationPendingReason, err)
+
+		_, err = tu.accounts.PollDeviceToken(context.TODO(), &accountsv1.PollDeviceTokenRequest{DeviceCode: start.DeviceCode})
+		requireErrorHasGRPCCode(t, codes.ResourceExhausted, err)
+		requireDevicePollReason(t, deviceSlowDownReason, err)
+	})
+
+	t.Run("unauthenticated-approval", func(t *testing.T) {
+		start, err := tu.accounts.StartDeviceAuthorization(context.TODO(), &accountsv1.StartDeviceAuthorizationRequest{})
+		require.NoError(t, err)
+
+		_, err = tu.accounts.ApproveDevice(context.TODO(), &accountsv1.ApproveDeviceRequest{UserCode: start.UserCode})
+		requireErrorHasGRPCCode(t, codes.Unauthenticated, err)
+	})
+
+	t.Run("unknown-user-code", func(t *testing.T) {
+		_, err := tu.accounts.ApproveDevice(acc.Context, &accountsv1.ApproveDeviceRequest{UserCode: "BCDF-GHJK"})
+		requireErrorHasGRPCCode(t, codes.NotFound, err)
+	})
+
+	t.Run("approve-and-poll", func(t *testing.T) {
+		start, err := tu.accounts.StartDeviceAuthorization(context.TODO(), &accountsv1.StartDeviceAuthorizationRequest{})
+		require.NoError(t, err)
+		require.Contains(t, start.VerificationUriComplete, "user_code="+start.UserCode)
+
+		// Users may type in the code without its formatting.
+		typed := strings.ToLower(strings.Replace(start.UserCode, "-", "", 1))
+		_, err = tu.accounts.ApproveDevice(acc.Context, &accountsv1.ApproveDeviceRequest{UserCode: typed})
+		require.NoError(t, err)
+
+		_, err = tu.accounts.ApproveDevice(acc.Context, &accountsv1.ApproveDeviceRequest{UserCode: start.UserCode})
+		requireErrorHasGRPCCode(t, codes.NotFound, err)
+
+		res, err := tu.accounts.PollDeviceToken(context.TODO(), &accountsv1.PollDeviceTokenRequest{DeviceCode: start.DeviceCode})
+		require.NoError(t, err)
+		require.NotEmpty(t, res.RefreshToken)
+
+		got, err := tu.accounts.GetAccount(contextWithSignedToken(res.Token), &accountsv1.GetAccountRequest{AccountId: acc.ID})
+		require.NoError(t, err)
+		require.Equal(t, email, got.Account.Email)
+
+		_, err = tu.accounts.PollDeviceToken(context.TODO(), &accountsv1.PollDeviceTokenRequest{DeviceCode: start.DeviceCode})
+		requireErrorHasGRPCCode(t, codes.InvalidArgument, err)
+	})
+}
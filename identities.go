@@ -0,0 +1,195 @@
+package main
+
+import (
+	"accounts-service/models"
+	accountsv1 "accounts-service/protorepo/noted/accounts/v1"
+	"accounts-service/validators"
+	"context"
+	"errors"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func (srv *accountsAPI) ListLinkedIdentities(ctx context.Context, in *accountsv1.ListLinkedIdentitiesRequest) (*accountsv1.ListLinkedIdentitiesResponse, error) {
+	token, err := srv.principal(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	err = validators.ValidateListLinkedIdentitiesRequest(in)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	acc, err := srv.getOwnAccount(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	identities, err := srv.identities.List(ctx, &models.ManyIdentitiesFilter{AccountID: acc.ID})
+	if err != nil {
+		return nil, statusFromModelError(err)
+	}
+
+	res := []*accountsv1.Identity{}
+	for i := range identities {
+		res = append(res, modelsIdentityToProtobufIdentity(&identities[i]))
+	}
+
+	return &accountsv1.ListLinkedIdentitiesResponse{Identities: res}, nil
+}
+
+// BeginLinkIdentity returns the URL of the page of the provider where the
+// user logs in to prove they own the identity to link. The state is bound
+// to the account and must be given to LinkIdentity along with the code
+// returned by the provider.
+func (srv *accountsAPI) BeginLinkIdentity(ctx context.Context, in *accountsv1.BeginLinkIdentityRequest) (*accountsv1.BeginLinkIdentityResponse, error) {
+	token, err := srv.principal(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	err = validators.ValidateBeginLinkIdentityRequest(in)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	acc, err := srv.getOwnAccount(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	url, state, err := srv.beginProviderFlow(ctx, models.ChallengePurposeOIDCLink, acc.ID, in.Provider)
+	if err != nil {
+		return nil, err
+	}
+
+	return &accountsv1.BeginLinkIdentityResponse{AuthorizationUrl: url, State: state}, nil
+}
+
+// LinkIdentity links the identity the user logged in with at the provider
+// to the account, so that it can be used to log in. An account has at most
+// one identity per provider, and an identity belongs to a single account.
+func (srv *accountsAPI) LinkIdentity(ctx context.Context, in *accountsv1.LinkIdentityRequest) (*accountsv1.LinkIdentityResponse, error) {
+	token, err := srv.principal(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	err = validators.ValidateLinkIdentityRequest(in)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	acc, err := srv.getOwnAccount(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	idToken, err := srv.finishProviderFlow(ctx, models.ChallengePurposeOIDCLink, acc.ID, in.Provider, in.Code, in.State)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = srv.identities.Get(ctx, &models.OneIdentityFilter{Provider: in.Provider, AccountID: acc.ID})
+	if err == nil {
+		return nil, status.Errorf(codes.AlreadyExists, "an identity of %s is already linked to the account", in.Provider)
+	}
+	if !errors.Is(err, models.ErrNotFound) {
+		return nil, statusFromModelError(err)
+	}
+
+	identity, err := srv.identities.Create(ctx, &models.IdentityPayload{
+		Provider:  in.Provider,
+		Subject:   idToken.Subject,
+		AccountID: acc.ID,
+		Email:     idToken.Email,
+	})
+	if err != nil {
+		if errors.Is(err, models.ErrDuplicateKeyFound) {
+			return nil, status.Error(codes.AlreadyExists, "identity already linked to another account")
+		}
+		return nil, statusFromModelError(err)
+	}
+
+	return &accountsv1.LinkIdentityResponse{Identity: modelsIdentityToProtobufIdentity(identity)}, nil
+}
+
+// UnlinkIdentity refuses to unlink the last way to log in to the account.
+// Login codes are not counted as they only prove access to the mailbox.
+func (srv *accountsAPI) UnlinkIdentity(ctx context.Context, in *accountsv1.UnlinkIdentityRequest) (*accountsv1.UnlinkIdentityResponse, error) {
+	token, err := srv.principal(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	err = validators.ValidateUnlinkIdentityRequest(in)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	acc, err := srv.getOwnAccount(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	filter := &models.OneIdentityFilter{ID: in.IdentityId, AccountID: acc.ID}
+	_, err = srv.identities.Get(ctx, filter)
+	if err != nil {
+		return nil, statusFromModelError(err)
+	}
+
+	ok, err := srv.hasOtherSignInMethod(ctx, acc, in.IdentityId)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, status.Error(codes.FailedPrecondition, "cannot unlink the last way to log in to the account, set a password or link another identity first")
+	}
+
+	err = srv.identities.Delete(ctx, filter)
+	if err != nil {
+		return nil, statusFromModelError(err)
+	}
+
+	return &accountsv1.UnlinkIdentityResponse{}, nil
+}
+
+// hasOtherSignInMethod reports whether acc can log in with a password, a
+// passkey or another identity than identityID.
+func (srv *accountsAPI) hasOtherSignInMethod(ctx context.Context, acc *models.Account, identityID string) (bool, error) {
+	if acc.Hash != nil {
+		return true, nil
+	}
+
+	passkeys, err := srv.passkeys.List(ctx, &models.ManyPasskeysFilter{AccountID: acc.ID})
+	if err != nil {
+		return false, statusFromModelError(err)
+	}
+	if len(passkeys) > 0 {
+		return true, nil
+	}
+
+	identities, err := srv.identities.List(ctx, &models.ManyIdentitiesFilter{AccountID: acc.ID})
+	if err != nil {
+		return false, statusFromModelError(err)
+	}
+	for _, identity := range identities {
+		if identity.ID != identityID {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func modelsIdentityToProtobufIdentity(identity *models.Identity) *accountsv1.Identity {
+	return &accountsv1.Identity{
+		Id:         identity.ID,
+		Provider:   identity.Provider,
+		Email:      identity.Email,
+		CreateTime: timestamppb.New(identity.CreatedAt),
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"accounts-service/models"
+	"accounts-service/oidc/oidctest"
+	accountsv1 "accounts-service/protorepo/noted/accounts/v1"
+	"context"
+	"encoding/base64"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+)
+
+// linkTestIdentity links user at the provider to the account authenticated
+// in ctx.
+func linkTestIdentity(t *testing.T, srv *testAccountsAPI, issuer *oidctest.Issuer, ctx context.Context, accountID string, provider string, user oidctest.User) (*accountsv1.LinkIdentityResponse, error) {
+	begin, err := srv.BeginLinkIdentity(ctx, &accountsv1.BeginLinkIdentityRequest{AccountId: accountID, Provider: provider})
+	require.NoError(t, err)
+
+	code, state, err := issuer.Authorize(begin.AuthorizationUrl, user)
+	require.NoError(t, err)
+
+	return srv.LinkIdentity(ctx, &accountsv1.LinkIdentityRequest{AccountId: accountID, Provider: provider, Code: code, State: state})
+}
+
+func TestLinkIdentity(t *testing.T) {
+	tu := newTestUtilsOrDie(t)
+	srv, issuer := withTestProvider(t, tu)
+
+	email := tu.randomAlphanumeric() + "@gmail.fr"
+	tu.newTestAccount(t, "Linker", email, "123456")
+	acc := tu.validateTestAccount(t, email, "123456")
+	user := oidctest.User{Subject: tu.newUUID(), Email: tu.randomAlphanumeric() + "@gmail.fr"}
+
+	t.Run("unauthenticated", func(t *testing.T) {
+		_, err := srv.BeginLinkIdentity(context.TODO(), &accountsv1.BeginLinkIdentityRequest{AccountId: acc.ID, Provider: testProviderName})
+		requireErrorHasGRPCCode(t, codes.Unauthenticated, err)
+	})
+
+	t.Run("link-and-log-in", func(t *testing.T) {
+		res, err := linkTestIdentity(t, srv, issuer, acc.Context, acc.ID, testProviderName, user)
+		require.NoError(t, err)
+		require.Equal(t, testProviderName, res.Identity.Provider)
+		require.Equal(t, user.Email, res.Identity.Email)
+
+		list, err := srv.ListLinkedIdentities(acc.Context, &accountsv1.ListLinkedIdentitiesRequest{AccountId: acc.ID})
+		require.NoError(t, err)
+		require.Len(t, list.Identities, 1)
+		require.Equal(t, res.Identity.Id, list.Identities[0].Id)
+
+		login, err := loginWithTestProvider(t, srv, issuer, user)
+		require.NoError(t, err)
+		require.NotEmpty(t, login.Token)
+	})
+
+	t.Run("one-identity-per-provider", func(t *testing.T) {
+		_, err := linkTestIdentity(t, srv, issuer, acc.Context, acc.ID, testProviderName, oidctest.User{Subject: tu.newUUID()})
+		requireErrorHasGRPCCode(t, codes.AlreadyExists, err)
+	})
+
+	t.Run("identity-of-another-account", func(t *testing.T) {
+		otherEmail := tu.randomAlphanumeric() + "@gmail.fr"
+		tu.newTestAccount(t, "Other", otherEmail, "123456")
+		other := tu.validateTestAccount(t, otherEmail, "123456")
+
+		_, err := linkTestIdentity(t, srv, issuer, other.Context, other.ID, testProviderName, user)
+		requireErrorHasGRPCCode(t, codes.AlreadyExists, err)
+	})
+
+	t.Run("state-of-another-account", func(t *testing.T) {
+		otherEmail := tu.randomAlphanumeric() + "@gmail.fr"
+		tu.newTestAccount(t, "Victim", otherEmail, "123456")
+		victim := tu.validateTestAccount(t, otherEmail, "123456")
+
+		// A link started by an attacker cannot be completed by the victim.
+		begin, err := srv.BeginLinkIdentity(acc.Context, &accountsv1.BeginLinkIdentityRequest{AccountId: acc.ID, Provider: googleProviderName})
+		require.NoError(t, err)
+		code, state, err := issuer.Authorize(begin.AuthorizationUrl, oidctest.User{Subject: tu.newUUID()})
+		require.NoError(t, err)
+
+		_, err = srv.LinkIdentity(victim.Context, &accountsv1.LinkIdentityRequest{AccountId: victim.ID, Provider: googleProviderName, Code: code, State: state})
+		requireErrorHasGRPCCode(t, codes.InvalidArgument, err)
+	})
+}
+
+func TestUnlinkIdentity(t *testing.T) {
+	tu := newTestUtilsOrDie(t)
+	srv, issuer := withTestProvider(t, tu)
+
+	user := oidctest.User{Subject: tu.newUUID(), Email: tu.randomAlphanumeric() + "@gmail.fr", EmailVerified: true, Name: "Unlinker"}
+	login, err := loginWithTestProvider(t, srv, issuer, user)
+	require.NoError(t, err)
+	ctx := contextWithSignedToken(login.Token)
+	acc, err := tu.accountsRepository.Get(context.TODO(), &models.OneAccountFilter{Email: user.Email})
+	require.NoError(t, err)
+
+	list, err := srv.ListLinkedIdentities(ctx, &accountsv1.ListLinkedIdentitiesRequest{AccountId: acc.ID})
+	require.NoError(t, err)
+	require.Len(t, list.Identities, 1)
+	first := list.Identities[0]
+
+	t.Run("last-identity-of-account-without-password", func(t *testing.T) {
+		_, err := srv.UnlinkIdentity(ctx, &accountsv1.UnlinkIdentityRequest{AccountId: acc.ID, IdentityId: first.Id})
+		requireErrorHasGRPCCode(t, codes.FailedPrecondition, err)
+	})
+
+	t.Run("identity-of-another-account", func(t *testing.T) {
+		email := tu.randomAlphanumeric() + "@gmail.fr"
+		tu.newTestAccount(t, "Other", email, "123456")
+		other := tu.validateTestAccount(t, email, "123456")
+
+		_, err := srv.UnlinkIdentity(other.Context, &accountsv1.UnlinkIdentityRequest{AccountId: other.ID, IdentityId: first.Id})
+		requireErrorHasGRPCCode(t, codes.NotFound, err)
+	})
+
+	t.Run("identity-with-another-one-linked", func(t *testing.T) {
+		second, err := linkTestIdentity(t, srv, issuer, ctx, acc.ID, googleProviderName, oidctest.User{Subject: tu.newUUID()})
+		require.NoError(t, err)
+
+		_, err = srv.UnlinkIdentity(ctx, &accountsv1.UnlinkIdentityRequest{AccountId: acc.ID, IdentityId: first.Id})
+		require.NoError(t, err)
+
+		_, err = srv.UnlinkIdentity(ctx, &accountsv1.UnlinkIdentityRequest{AccountId: acc.ID, IdentityId: second.Identity.Id})
+		requireErrorHasGRPCCode(t, codes.FailedPrecondition, err)
+	})
+
+	t.Run("passkey-account-without-identity-is-not-legacy", func(t *testing.T) {
+		authenticator := newTestAuthenticator()
+		b64 := base64.RawURLEncoding.EncodeToString
+		begin, err := srv.BeginPasskeyRegistration(ctx, &accountsv1.BeginPasskeyRegistrationRequest{AccountId: acc.ID})
+		require.NoError(t, err)
+		clientData, attestation := authenticator.Register(challengeFromOptions(t, begin.OptionsJson), []byte(acc.ID))
+		_, err = srv.FinishPasskeyRegistration(ctx, &accountsv1.FinishPasskeyRegistrationRequest{AccountId: acc.ID, ClientDataJson: b64(clientData), AttestationObject: b64(attestation)})
+		require.NoError(t, err)
+
+		list, err := srv.ListLinkedIdentities(ctx, &accountsv1.ListLinkedIdentitiesRequest{AccountId: acc.ID})
+		require.NoError(t, err)
+		require.Len(t, list.Identities, 1)
+		_, err = srv.UnlinkIdentity(ctx, &accountsv1.UnlinkIdentityRequest{AccountId: acc.ID, IdentityId: list.Identities[0].Id})
+		require.NoError(t, err)
+
+		_, err = tu.accountsRepository.MarkLegacyExternalAccounts(context.TODO())
+		require.NoError(t, err)
+
+		// Another user of the provider with the same email cannot take the
+		// account over.
+		_, err = srv.AuthenticateGoogle(context.TODO(), &accountsv1.AuthenticateGoogleRequest{IdToken: issuer.SignIDToken(issuer.IDTokenClaims(oidctest.User{Subject: tu.newUUID(), Email: user.Email, EmailVerified: true}, ""))})
+		requireErrorHasGRPCCode(t, codes.FailedPrecondition, err)
+		_, err = loginWithTestProvider(t, srv, issuer, oidctest.User{Subject: tu.newUUID(), Email: user.Email, EmailVerified: true})
+		requireErrorHasGRPCCode(t, codes.FailedPrecondition, err)
+	})
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"accounts-service/auth"
+	"accounts-service/models"
+	accountsv1 "accounts-service/protorepo/noted/accounts/v1"
+	"accounts-service/validators"
+	"context"
+	"errors"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Duration for which the services may cache the result of an introspection.
+// It bounds the time a revoked token keeps being accepted by them.
+const introspectionCacheTTL = 30 * time.Second
+
+// IntrospectToken tells the other services whether a token presented to
+// them is active, and what it grants, in the spirit of RFC 7662. Unlike
+// verifying the token themselves, it reflects the revocation of its session
+// and the suspension of its account. Inactive tokens are described by
+// Active alone. The result may be cached for CacheTtl seconds.
+func (srv *accountsAPI) IntrospectToken(ctx context.Context, in *accountsv1.IntrospectTokenRequest) (*accountsv1.IntrospectTokenResponse, error) {
+	err := validators.ValidateIntrospectTokenRequest(in)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	inactive := &accountsv1.IntrospectTokenResponse{CacheTtl: int32(introspectionCacheTTL.Seconds())}
+
+	token, err := srv.auth.ParseToken(ctx, in.Token)
+	if err != nil {
+		srv.logger.Debug("introspected invalid token", zap.Error(err))
+		return inactive, nil
+	}
+
+	active, err := srv.isTokenActive(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	if !active {
+		return inactive, nil
+	}
+
+	res := &accountsv1.IntrospectTokenResponse{
+		Active:      true,
+		AccountId:   token.AccountID,
+		Roles:       token.Roles,
+		Scopes:      token.Scopes,
+		SessionId:   token.SessionID,
+		ClientId:    token.ClientID,
+		ServiceId:   token.ServiceID,
+		AuthMethods: token.AuthMethods,
+		CacheTtl:    inactive.CacheTtl,
+	}
+	if token.ExpiresAt != 0 {
+		expiresAt := time.Unix(token.ExpiresAt, 0)
+		res.ExpireTime = timestamppb.New(expiresAt)
+		if ttl := time.Until(expiresAt); ttl < introspectionCacheTTL {
+			res.CacheTtl = int32(ttl.Seconds())
+		}
+	}
+	if token.AuthTime != 0 {
+		res.AuthTime = timestamppb.New(time.Unix(token.AuthTime, 0))
+	}
+
+	return res, nil
+}
+
+// isTokenActive reports whether a verified token has not expired, and its
+// session and account are still active. The tokens of machine identities
+// have neither, and personal access tokens have no session.
+func (srv *accountsAPI) isTokenActive(ctx context.Context, token *auth.Token) (bool, error) {
+	if token.ExpiresAt != 0 && time.Now().Unix() >= token.ExpiresAt {
+		return false, nil
+	}
+	if token.IsService() {
+		return true, nil
+	}
+
+	if !token.IsPersonal() {
+		if token.SessionID == "" {
+			return false, nil
+		}
+		_, err := srv.sessions.Get(ctx, &models.OneSessionFilter{ID: token.SessionID, AccountID: token.AccountID})
+		if errors.Is(err, models.ErrNotFound) {
+			return false, nil
+		}
+		if err != nil {
+			return false, statusFromModelError(err)
+		}
+	}
+
+	acc, err := srv.repo.Get(ctx, &models.OneAccountFilter{ID: token.AccountID})
+	if errors.Is(err, models.ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, statusFromModelError(err)
+	}
+
+	return !acc.IsSuspended(), nil
+}
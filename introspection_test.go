@@ -0,0 +1,96 @@
+package main
+
+import (
+	"accounts-service/auth"
+	accountsv1 "accounts-service/protorepo/noted/accounts/v1"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+)
+
+func TestIntrospectToken(t *testing.T) {
+	tu := newTestUtilsOrDie(t)
+
+	email := tu.randomAlphanumeric() + "@gmail.fr"
+	tu.newTestAccount(t, "Introspected", email, "123456")
+	acc := tu.validateTestAccount(t, email, "123456")
+
+	serviceCtx := tu.newTestServiceContext(t, auth.ScopeTokensIntrospect)
+	adminCtx, err := tu.auth.ContextWithToken(context.TODO(), &auth.Token{AccountID: tu.newUUID(), Roles: []string{auth.RoleAdmin}})
+	require.NoError(t, err)
+
+	login := func(t *testing.T) string {
+		res, err := tu.accounts.Authenticate(context.TODO(), &accountsv1.AuthenticateRequest{Email: email, Password: "123456"})
+		require.NoError(t, err)
+		return res.Token
+	}
+
+	t.Run("only-granted-services-introspect", func(t *testing.T) {
+		_, err := tu.accounts.IntrospectToken(acc.Context, &accountsv1.IntrospectTokenRequest{Token: login(t)})
+		requireErrorHasGRPCCode(t, codes.PermissionDenied, err)
+
+		_, err = tu.accounts.IntrospectToken(tu.newTestServiceContext(t, auth.ScopeAccountsEmailsRead), &accountsv1.IntrospectTokenRequest{Token: login(t)})
+		requireErrorHasGRPCCode(t, codes.PermissionDenied, err)
+	})
+
+	t.Run("invalid-token-is-inactive", func(t *testing.T) {
+		res, err := tu.accounts.IntrospectToken(serviceCtx, &accountsv1.IntrospectTokenRequest{Token: "not-a-token"})
+		require.NoError(t, err)
+		require.False(t, res.Active)
+		require.Empty(t, res.AccountId)
+	})
+
+	t.Run("revoked-session-is-inactive", func(t *testing.T) {
+		token := login(t)
+
+		res, err := tu.accounts.IntrospectToken(serviceCtx, &accountsv1.IntrospectTokenRequest{Token: token})
+		require.NoError(t, err)
+		require.True(t, res.Active)
+		require.Equal(t, acc.ID, res.AccountId)
+		require.NotEmpty(t, res.SessionId)
+		require.Equal(t, []string{auth.AuthMethodPassword}, res.AuthMethods)
+		require.NotNil(t, res.AuthTime)
+		require.Greater(t, res.CacheTtl, int32(0))
+		require.LessOrEqual(t, res.CacheTtl, int32(introspectionCacheTTL.Seconds()))
+
+		_, err = tu.accounts.Logout(contextWithSignedToken(token), &accountsv1.LogoutRequest{})
+		require.NoError(t, err)
+
+		res, err = tu.accounts.IntrospectToken(serviceCtx, &accountsv1.IntrospectTokenRequest{Token: token})
+		require.NoError(t, err)
+		require.False(t, res.Active)
+		require.Empty(t, res.SessionId)
+	})
+
+	t.Run("service-token-is-active", func(t *testing.T) {
+		token, err := tu.auth.SignToken(&auth.Token{ServiceID: "notes-service", Scopes: []string{auth.ScopeMailInviteSend}})
+		require.NoError(t, err)
+
+		res, err := tu.accounts.IntrospectToken(serviceCtx, &accountsv1.IntrospectTokenRequest{Token: token})
+		require.NoError(t, err)
+		require.True(t, res.Active)
+		require.Equal(t, "notes-service", res.ServiceId)
+		require.Equal(t, []string{auth.ScopeMailInviteSend}, res.Scopes)
+	})
+
+	t.Run("suspended-account-is-inactive", func(t *testing.T) {
+		pat, err := tu.accounts.CreatePersonalAccessToken(acc.Context, &accountsv1.CreatePersonalAccessTokenRequest{AccountId: acc.ID, Name: "CLI", Scopes: []string{auth.ScopeNotesRead}})
+		require.NoError(t, err)
+
+		res, err := tu.accounts.IntrospectToken(serviceCtx, &accountsv1.IntrospectTokenRequest{Token: pat.Token})
+		require.NoError(t, err)
+		require.True(t, res.Active)
+		require.Equal(t, acc.ID, res.AccountId)
+		require.Equal(t, []string{auth.ScopeNotesRead}, res.Scopes)
+		require.Empty(t, res.SessionId)
+
+		_, err = tu.accounts.SuspendAccount(adminCtx, &accountsv1.SuspendAccountRequest{AccountId: acc.ID, Reason: "spam"})
+		require.NoError(t, err)
+
+		res, err = tu.accounts.IntrospectToken(serviceCtx, &accountsv1.IntrospectTokenRequest{Token: pat.Token})
+		require.NoError(t, err)
+		require.False(t, res.Active)
+	})
+}
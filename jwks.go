@@ -0,0 +1,27 @@
+package main
+
+import (
+	accountsv1 "accounts-service/protorepo/noted/accounts/v1"
+	"context"
+)
+
+// GetJSONWebKeySet publishes the public keys against which the tokens signed
+// by the accounts service can be verified, so that the signing key can be
+// rotated without redeploying the services verifying them.
+func (srv *accountsAPI) GetJSONWebKeySet(ctx context.Context, in *accountsv1.GetJSONWebKeySetRequest) (*accountsv1.GetJSONWebKeySetResponse, error) {
+	jwks := srv.keyring.JSONWebKeySet()
+
+	keys := []*accountsv1.JSONWebKey{}
+	for _, key := range jwks.Keys {
+		keys = append(keys, &accountsv1.JSONWebKey{
+			Kty: key.KeyType,
+			Crv: key.Curve,
+			X:   key.X,
+			Kid: key.KeyID,
+			Alg: key.Algorithm,
+			Use: key.Use,
+		})
+	}
+
+	return &accountsv1.GetJSONWebKeySetResponse{Keys: keys}, nil
+}
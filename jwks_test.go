@@ -0,0 +1,33 @@
+package main
+
+import (
+	"accounts-service/auth"
+	accountsv1 "accounts-service/protorepo/noted/accounts/v1"
+	"context"
+	"crypto/ed25519"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetJSONWebKeySet(t *testing.T) {
+	_, priv, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	pub, _, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	keyring := auth.NewKeyring(priv)
+	keyring.Add(pub)
+	api := &accountsAPI{keyring: keyring}
+
+	res, err := api.GetJSONWebKeySet(context.TODO(), &accountsv1.GetJSONWebKeySetRequest{})
+	require.NoError(t, err)
+	require.Len(t, res.Keys, 2)
+
+	kids := []string{}
+	for _, key := range res.Keys {
+		require.Equal(t, "OKP", key.Kty)
+		require.Equal(t, "Ed25519", key.Crv)
+		kids = append(kids, key.Kid)
+	}
+	require.ElementsMatch(t, []string{auth.KeyID(priv.Public().(ed25519.PublicKey)), auth.KeyID(pub)}, kids)
+}
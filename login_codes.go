@@ -0,0 +1,165 @@
+package main
+
+import (
+	"accounts-service/auth"
+	"accounts-service/models"
+	accountsv1 "accounts-service/protorepo/noted/accounts/v1"
+	"accounts-service/validators"
+	"context"
+	"crypto/subtle"
+	"errors"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	loginCodeDigits      = 6
+	loginCodeLifetime    = 10 * time.Minute
+	loginCodeMaxAttempts = 5
+	// Minimum duration between two codes sent to the same account, so that
+	// requesting new codes does not grant new attempts too quickly.
+	loginCodeResendInterval = time.Minute
+)
+
+var errInvalidLoginCode = status.Error(codes.Unauthenticated, "invalid or expired code")
+
+// RequestLoginCode emails a single-use code which logs in to the account
+// without its password. It succeeds whether the account exists or not, so
+// that it cannot be used to find out registered emails.
+func (srv *accountsAPI) RequestLoginCode(ctx context.Context, in *accountsv1.RequestLoginCodeRequest) (*accountsv1.RequestLoginCodeResponse, error) {
+	err := validators.ValidateRequestLoginCodeRequest(in)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	acc, err := srv.repo.Get(ctx, &models.OneAccountFilter{Email: in.Email})
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			return &accountsv1.RequestLoginCodeResponse{}, nil
+		}
+		return nil, statusFromModelError(err)
+	}
+	if acc.IsSuspended() {
+		return &accountsv1.RequestLoginCodeResponse{}, nil
+	}
+
+	filter := &models.OneChallengeFilter{Purpose: models.ChallengePurposeLoginCode, AccountID: acc.ID}
+	previous, err := srv.challenges.Get(ctx, filter)
+	if err != nil && !errors.Is(err, models.ErrNotFound) {
+		return nil, statusFromModelError(err)
+	}
+	if previous != nil && time.Since(previous.CreatedAt) < loginCodeResendInterval {
+		// Refusing would tell that the email is registered.
+		return &accountsv1.RequestLoginCodeResponse{}, nil
+	}
+
+	code, err := auth.GenerateCode(loginCodeDigits)
+	if err != nil {
+		srv.logger.Error("failed to generate login code", zap.Error(err))
+		return nil, status.Error(codes.Internal, "failed to send login code")
+	}
+
+	// Only the last code sent is valid.
+	err = srv.challenges.DeleteMany(ctx, &models.ManyChallengesFilter{Purpose: models.ChallengePurposeLoginCode, AccountID: acc.ID})
+	if err != nil {
+		return nil, statusFromModelError(err)
+	}
+	_, err = srv.challenges.Create(ctx, &models.ChallengePayload{
+		ID:        loginCodeHash(acc.ID, code),
+		Purpose:   models.ChallengePurposeLoginCode,
+		AccountID: acc.ID,
+		ExpiresAt: time.Now().UTC().Add(loginCodeLifetime),
+	})
+	if err != nil {
+		return nil, statusFromModelError(err)
+	}
+
+	if srv.mailingService != nil {
+		err = srv.mailingService.SendEmails(ctx, LoginCodeMailContent(acc.ID, code), []string{*acc.Email})
+		if err != nil {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+	} else {
+		srv.logger.Warn("SendEmails was not called on RequestLoginCode because it is not connected to the mailing-service")
+	}
+
+	return &accountsv1.RequestLoginCodeResponse{}, nil
+}
+
+// LoginWithCode exchanges a code sent by RequestLoginCode for a token. It
+// also validates the account, since receiving the code proves that the email
+// belongs to its owner.
+func (srv *accountsAPI) LoginWithCode(ctx context.Context, in *accountsv1.LoginWithCodeRequest) (*accountsv1.LoginWithCodeResponse, error) {
+	err := validators.ValidateLoginWithCodeRequest(in)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	acc, err := srv.repo.Get(ctx, &models.OneAccountFilter{Email: in.Email})
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			return nil, errInvalidLoginCode
+		}
+		return nil, statusFromModelError(err)
+	}
+
+	keys := srv.throttleKeys(ctx, throttleLoginCode, acc.ID)
+	err = srv.reserveAttempt(ctx, keys)
+	if err != nil {
+		return nil, err
+	}
+
+	filter := &models.OneChallengeFilter{Purpose: models.ChallengePurposeLoginCode, AccountID: acc.ID}
+	challenge, err := srv.challenges.Attempt(ctx, filter, loginCodeMaxAttempts)
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			return nil, errInvalidLoginCode
+		}
+		srv.releaseAttempt(ctx, keys)
+		return nil, statusFromModelError(err)
+	}
+
+	if subtle.ConstantTimeCompare([]byte(challenge.ID), []byte(loginCodeHash(acc.ID, in.Code))) != 1 {
+		return nil, errInvalidLoginCode
+	}
+
+	err = srv.challenges.Delete(ctx, &models.OneChallengeFilter{ID: challenge.ID, Purpose: models.ChallengePurposeLoginCode})
+	if err != nil {
+		// The code was used concurrently.
+		srv.releaseAttempt(ctx, keys)
+		return nil, errInvalidLoginCode
+	}
+	srv.resetThrottle(ctx, keys)
+
+	if !acc.IsValidated {
+		acc, err = srv.repo.UpdateAccountValidationState(ctx, &models.OneAccountFilter{ID: acc.ID})
+		if err != nil {
+			return nil, statusFromModelError(err)
+		}
+	}
+
+	if acc.HasSecondFactor() {
+		challenge, err := srv.createSecondFactorChallenge(ctx, acc, auth.AuthMethodEmail)
+		if err != nil {
+			return nil, err
+		}
+		return &accountsv1.LoginWithCodeResponse{Challenge: challenge}, nil
+	}
+
+	tokenString, refreshToken, err := srv.issueTokens(ctx, acc, auth.AuthMethodEmail)
+	if err != nil {
+		return nil, err
+	}
+
+	return &accountsv1.LoginWithCodeResponse{Token: tokenString, RefreshToken: refreshToken}, nil
+}
+
+// loginCodeHash is the ID under which a login code is stored. Codes are
+// short, so the account ID is mixed in to keep the hashes of the codes of
+// distinct accounts apart.
+func loginCodeHash(accountID string, code string) string {
+	return auth.HashSecret(accountID + ":" + code)
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"accounts-service/models"
+	accountsv1 "accounts-service/protorepo/noted/accounts/v1"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+)
+
+func TestLoginWithCode(t *testing.T) {
+	tu := newTestUtilsOrDie(t)
+	email := tu.randomAlphanumeric() + "@gmail.fr"
+	acc := tu.newTestAccount(t, "Passwordless", email, "123456")
+
+	// The code sent by email is not observable, plant a known one instead.
+	plantCode := func(t *testing.T, code string) {
+		require.NoError(t, tu.challengesRepository.DeleteMany(context.TODO(), &models.ManyChallengesFilter{Purpose: models.ChallengePurposeLoginCode, AccountID: acc.ID}))
+		_, err := tu.challengesRepository.Create(context.TODO(), &models.ChallengePayload{
+			ID:        loginCodeHash(acc.ID, code),
+			Purpose:   models.ChallengePurposeLoginCode,
+			AccountID: acc.ID,
+			ExpiresAt: time.Now().UTC().Add(loginCodeLifetime),
+		})
+		require.NoError(t, err)
+	}
+	forgetFailures := func(t *testing.T) {
+		require.NoError(t, tu.throttlesRepository.Delete(context.TODO(), &models.OneThrottleFilter{ID: accountThrottleKey(throttleLoginCode, acc.ID).id}))
+	}
+
+	t.Run("request-for-unknown-email-succeeds", func(t *testing.T) {
+		_, err := tu.accounts.RequestLoginCode(context.TODO(), &accountsv1.RequestLoginCodeRequest{Email: tu.randomAlphanumeric() + "@gmail.fr"})
+		require.NoError(t, err)
+	})
+
+	t.Run("requests-are-throttled", func(t *testing.T) {
+		filter := &models.OneChallengeFilter{Purpose: models.ChallengePurposeLoginCode, AccountID: acc.ID}
+
+		_, err := tu.accounts.RequestLoginCode(context.TODO(), &accountsv1.RequestLoginCodeRequest{Email: email})
+		require.NoError(t, err)
+		sent, err := tu.challengesRepository.Get(context.TODO(), filter)
+		require.NoError(t, err)
+
+		// The second request looks the same to the caller but sends no code.
+		_, err = tu.accounts.RequestLoginCode(context.TODO(), &accountsv1.RequestLoginCodeRequest{Email: email})
+		require.NoError(t, err)
+		current, err := tu.challengesRepository.Get(context.TODO(), filter)
+		require.NoError(t, err)
+		require.Equal(t, sent.ID, current.ID)
+	})
+
+	t.Run("code-logs-in-and-validates-account", func(t *testing.T) {
+		plantCode(t, "424242")
+
+		res, err := tu.accounts.LoginWithCode(context.TODO(), &accountsv1.LoginWithCodeRequest{Email: email, Code: "424242"})
+		require.NoError(t, err)
+		require.NotEmpty(t, res.Token)
+
+		validated, err := tu.accountsRepository.Get(context.TODO(), &models.OneAccountFilter{ID: acc.ID})
+		require.NoError(t, err)
+		require.True(t, validated.IsValidated)
+
+		_, err = tu.accounts.LoginWithCode(context.TODO(), &accountsv1.LoginWithCodeRequest{Email: email, Code: "424242"})
+		requireErrorHasGRPCCode(t, codes.Unauthenticated, err)
+	})
+
+	t.Run("code-is-attempt-limited", func(t *testing.T) {
+		forgetFailures(t)
+		plantCode(t, "424242")
+
+		for i := 0; i < loginCodeMaxAttempts; i++ {
+			_, err := tu.accounts.LoginWithCode(context.TODO(), &accountsv1.LoginWithCodeRequest{Email: email, Code: "000000"})
+			requireErrorHasGRPCCode(t, codes.Unauthenticated, err)
+		}
+
+		// The failures lock the account too, forget them to reach the code.
+		forgetFailures(t)
+
+		_, err := tu.accounts.LoginWithCode(context.TODO(), &accountsv1.LoginWithCodeRequest{Email: email, Code: "424242"})
+		requireErrorHasGRPCCode(t, codes.Unauthenticated, err)
+	})
+
+	t.Run("lockout-survives-new-codes", func(t *testing.T) {
+		forgetFailures(t)
+		plantCode(t, "424242")
+		for i := 0; i < throttleAccountFreeFailures-1; i++ {
+			_, err := tu.accounts.LoginWithCode(context.TODO(), &accountsv1.LoginWithCodeRequest{Email: email, Code: "000000"})
+			requireErrorHasGRPCCode(t, codes.Unauthenticated, err)
+		}
+
+		plantCode(t, "434343")
+		_, err := tu.accounts.LoginWithCode(context.TODO(), &accountsv1.LoginWithCodeRequest{Email: email, Code: "000000"})
+		requireErrorHasGRPCCode(t, codes.Unauthenticated, err)
+
+		_, err = tu.accounts.LoginWithCode(context.TODO(), &accountsv1.LoginWithCodeRequest{Email: email, Code: "434343"})
+		requireErrorHasGRPCCode(t, codes.ResourceExhausted, err)
+	})
+}
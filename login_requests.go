@@ -0,0 +1,165 @@
+package main
+
+import (
+	"accounts-service/auth"
+	"accounts-service/models"
+	accountsv1 "accounts-service/protorepo/noted/accounts/v1"
+	"accounts-service/validators"
+	"context"
+	"errors"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// The desktop shows a new QR code once its login request expires.
+	loginRequestLifetime = 2 * time.Minute
+	// A login request expires when the desktop which created it stops
+	// polling it for this duration, such as when its tab is closed.
+	loginRequestIdleTimeout = 10 * time.Second
+	// Interval at which the desktop should poll its login request.
+	loginRequestPollInterval = 2 * time.Second
+)
+
+var errInvalidLoginRequest = status.Error(codes.NotFound, "invalid or expired login request")
+
+// CreateLoginRequest starts the login of a desktop browser by the mobile
+// app. The desktop shows the returned ID in a QR code, which the logged in
+// app scans to call ApproveLoginRequest, and polls PollLoginRequest with
+// the ID and the returned secret until it gets its tokens. The secret
+// binds the request to the desktop, so that the ID alone, which anyone
+// looking at the screen can read, cannot be used to get the tokens.
+func (srv *accountsAPI) CreateLoginRequest(ctx context.Context, in *accountsv1.CreateLoginRequestRequest) (*accountsv1.CreateLoginRequestResponse, error) {
+	id, err := auth.GenerateSecret(16)
+	if err != nil {
+		srv.logger.Error("failed to generate login request id", zap.Error(err))
+		return nil, status.Error(codes.Internal, "failed to create login request")
+	}
+	secret, err := auth.GenerateSecret(32)
+	if err != nil {
+		srv.logger.Error("failed to generate login request secret", zap.Error(err))
+		return nil, status.Error(codes.Internal, "failed to create login request")
+	}
+
+	client := srv.clientInfo(ctx)
+	_, err = srv.loginRequests.Create(ctx, &models.LoginRequestPayload{
+		ID:         auth.HashSecret(id),
+		SecretHash: auth.HashSecret(secret),
+		ExpiresAt:  time.Now().UTC().Add(loginRequestIdleTimeout),
+		Device:     client.Device,
+		IPAddress:  client.IPAddress,
+		UserAgent:  client.UserAgent,
+	})
+	if err != nil {
+		return nil, statusFromModelError(err)
+	}
+
+	return &accountsv1.CreateLoginRequestResponse{
+		LoginRequestId: id,
+		Secret:         secret,
+		Interval:       int32(loginRequestPollInterval.Seconds()),
+	}, nil
+}
+
+// ApproveLoginRequest is called by the mobile app once it scanned the QR
+// code of a login request. Unless Approve is set, it only returns the
+// client which created the request, which the app must show to the user so
+// that they do not log in a desktop which is not theirs.
+func (srv *accountsAPI) ApproveLoginRequest(ctx context.Context, in *accountsv1.ApproveLoginRequestRequest) (*accountsv1.ApproveLoginRequestResponse, error) {
+	token, err := srv.principal(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	err = validators.ValidateApproveLoginRequestRequest(in)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	acc, err := srv.repo.Get(ctx, &models.OneAccountFilter{ID: token.AccountID})
+	if err != nil {
+		return nil, statusFromModelError(err)
+	}
+	if !acc.IsInMobileBeta {
+		return nil, status.Error(codes.PermissionDenied, "login from the mobile app is reserved to the mobile beta")
+	}
+
+	filter := &models.OneLoginRequestFilter{ID: auth.HashSecret(in.LoginRequestId)}
+	request, err := srv.loginRequests.Get(ctx, filter)
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			return nil, errInvalidLoginRequest
+		}
+		return nil, statusFromModelError(err)
+	}
+	if time.Since(request.CreatedAt) > loginRequestLifetime {
+		return nil, errInvalidLoginRequest
+	}
+
+	res := &accountsv1.ApproveLoginRequestResponse{Device: request.Device, IpAddress: request.IPAddress, UserAgent: request.UserAgent}
+	if !in.Approve {
+		return res, nil
+	}
+
+	_, err = srv.loginRequests.Approve(ctx, filter, acc.ID)
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			return nil, errInvalidLoginRequest
+		}
+		return nil, statusFromModelError(err)
+	}
+
+	res.Approved = true
+	return res, nil
+}
+
+// PollLoginRequest keeps a login request alive and returns the tokens of
+// the desktop once the request is approved. The response holds no token
+// until then.
+func (srv *accountsAPI) PollLoginRequest(ctx context.Context, in *accountsv1.PollLoginRequestRequest) (*accountsv1.PollLoginRequestResponse, error) {
+	err := validators.ValidatePollLoginRequestRequest(in)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	filter := &models.OneLoginRequestFilter{ID: auth.HashSecret(in.LoginRequestId), SecretHash: auth.HashSecret(in.Secret)}
+	request, err := srv.loginRequests.Poll(ctx, filter, time.Now().UTC().Add(loginRequestIdleTimeout))
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			return nil, errInvalidLoginRequest
+		}
+		return nil, statusFromModelError(err)
+	}
+	if time.Since(request.CreatedAt) > loginRequestLifetime {
+		return nil, errInvalidLoginRequest
+	}
+	if request.AccountID == "" {
+		return &accountsv1.PollLoginRequestResponse{}, nil
+	}
+
+	// The request is single-use, even when polled concurrently.
+	filter.AccountID = request.AccountID
+	err = srv.loginRequests.Delete(ctx, filter)
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			return nil, errInvalidLoginRequest
+		}
+		return nil, statusFromModelError(err)
+	}
+
+	acc, err := srv.repo.Get(ctx, &models.OneAccountFilter{ID: request.AccountID})
+	if err != nil {
+		return nil, statusFromModelError(err)
+	}
+
+	// The desktop proved no credential itself.
+	tokenString, refreshToken, err := srv.issueTokens(ctx, acc)
+	if err != nil {
+		return nil, err
+	}
+
+	return &accountsv1.PollLoginRequestResponse{Token: tokenString, RefreshToken: refreshToken}, nil
+}
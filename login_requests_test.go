@@ -0,0 +1,73 @@
+package main
+
+import (
+	"accounts-service/models"
+	accountsv1 "accounts-service/protorepo/noted/accounts/v1"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+)
+
+func TestLoginRequest(t *testing.T) {
+	tu := newTestUtilsOrDie(t)
+
+	email := tu.randomAlphanumeric() + "@gmail.fr"
+	tu.newTestAccount(t, "Phone", email, "123456")
+	acc := tu.validateTestAccount(t, email, "123456")
+
+	login, err := tu.accounts.CreateLoginRequest(context.TODO(), &accountsv1.CreateLoginRequestRequest{})
+	require.NoError(t, err)
+	approve := func(approve bool) (*accountsv1.ApproveLoginRequestResponse, error) {
+		return tu.accounts.ApproveLoginRequest(acc.Context, &accountsv1.ApproveLoginRequestRequest{LoginRequestId: login.LoginRequestId, Approve: approve})
+	}
+
+	t.Run("reserved-to-mobile-beta", func(t *testing.T) {
+		_, err := approve(true)
+		requireErrorHasGRPCCode(t, codes.PermissionDenied, err)
+	})
+
+	_, err = tu.accountsRepository.RegisterUserToMobileBeta(context.TODO(), &models.OneAccountFilter{ID: acc.ID})
+	require.NoError(t, err)
+
+	t.Run("pending", func(t *testing.T) {
+		res, err := tu.accounts.PollLoginRequest(context.TODO(), &accountsv1.PollLoginRequestRequest{LoginRequestId: login.LoginRequestId, Secret: login.Secret})
+		require.NoError(t, err)
+		require.Empty(t, res.Token)
+	})
+
+	t.Run("preview-does-not-approve", func(t *testing.T) {
+		res, err := approve(false)
+		require.NoError(t, err)
+		require.False(t, res.Approved)
+
+		poll, err := tu.accounts.PollLoginRequest(context.TODO(), &accountsv1.PollLoginRequestRequest{LoginRequestId: login.LoginRequestId, Secret: login.Secret})
+		require.NoError(t, err)
+		require.Empty(t, poll.Token)
+	})
+
+	res, err := approve(true)
+	require.NoError(t, err)
+	require.True(t, res.Approved)
+
+	t.Run("single-approval", func(t *testing.T) {
+		_, err := approve(true)
+		requireErrorHasGRPCCode(t, codes.NotFound, err)
+	})
+
+	t.Run("bound-to-the-desktop", func(t *testing.T) {
+		_, err := tu.accounts.PollLoginRequest(context.TODO(), &accountsv1.PollLoginRequestRequest{LoginRequestId: login.LoginRequestId, Secret: "read-from-the-screen"})
+		requireErrorHasGRPCCode(t, codes.NotFound, err)
+	})
+
+	poll, err := tu.accounts.PollLoginRequest(context.TODO(), &accountsv1.PollLoginRequestRequest{LoginRequestId: login.LoginRequestId, Secret: login.Secret})
+	require.NoError(t, err)
+	require.NotEmpty(t, poll.Token)
+	require.NotEmpty(t, poll.RefreshToken)
+
+	t.Run("single-use", func(t *testing.T) {
+		_, err := tu.accounts.PollLoginRequest(context.TODO(), &accountsv1.PollLoginRequestRequest{LoginRequestId: login.LoginRequestId, Secret: login.Secret})
+		requireErrorHasGRPCCode(t, codes.NotFound, err)
+	})
+}
@@ -58,3 +58,33 @@ func SendGroupInviteMailContent(in *accountsv1.SendGroupInviteMailRequest) *mail
 		Body:    body,
 	}
 }
+
+func LoginCodeMailContent(accountID string, code string) *mailing.SendEmailsRequest {
+	body := fmt.Sprintf(`<span>Bonjour,<br/>Voici votre code de connexion Noted.
+		<br/>Si vous n'avez pas fait la demande, ignorez simplement ce message.
+		<br/>Attention, votre code n'est valable que 10 minutes.
+		<br/><div style="padding:16px 24px;border:1px solid #eeeeee;background-color:#f4f4f4;
+		border-radius:3px;font-family:monospace;margin:24px 0px 24px 0px ">%s</div></span>`, code)
+
+	return &mailing.SendEmailsRequest{
+		To:      []string{accountID},
+		Sender:  "noted.organisation@gmail.com",
+		Title:   "Noted: Code de connexion",
+		Subject: "Connectez-vous à Noted",
+		Body:    body,
+	}
+}
+
+func PasswordSetMailContent(accountID string) *mailing.SendEmailsRequest {
+	body := `<span>Bonjour,<br/>Un mot de passe vient d'être défini sur votre compte Noted.
+		<br/>Vous pouvez désormais vous connecter avec votre adresse email et ce mot de passe.
+		<br/>Si vous n'êtes pas à l'origine de ce changement, réinitialisez votre mot de passe et déconnectez vos sessions.</span>`
+
+	return &mailing.SendEmailsRequest{
+		To:      []string{accountID},
+		Sender:  "noted.organisation@gmail.com",
+		Title:   "Noted: Mot de passe défini",
+		Subject: "Un mot de passe a été défini sur votre compte",
+		Body:    body,
+	}
+}
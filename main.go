@@ -18,7 +18,48 @@ var (
 	mongoUri         = app.Flag("mongo-uri", "address of the mongodb server").Default("mongodb://localhost:27017").String()
 	mongoDbName      = app.Flag("mongo-db-name", "name of the mongo database").Default("accounts-service").String()
 	jwtPrivateKey    = app.Flag("jwt-private-key", "base64 encoded ed25519 private key").Default("SGfCQAb05CtmhEesWxcrfXSQR6JjmEMeyjR7Mo21S60ZDW9VVTUuCvEMlGjlqiw4I/z8T11KqAXexvGIPiuffA==").String()
+	jwtVerifyKeys    = app.Flag("jwt-verification-keys", "comma separated base64 encoded ed25519 keys which are still accepted when verifying tokens").Default("").String()
+	jwtLifetime      = app.Flag("jwt-lifetime", "lifetime of the access tokens").Default("15m").Duration()
+	jwtIssuer        = app.Flag("jwt-issuer", "issuer claim of the access tokens").Default("noted-accounts-service").String()
+	jwtAudience      = app.Flag("jwt-audience", "audience claim of the access tokens").Default("noted").String()
+	refreshLifetime  = app.Flag("refresh-token-lifetime", "lifetime of the refresh tokens").Default("720h").Duration()
+	webauthnRPID     = app.Flag("webauthn-rp-id", "domain the passkeys are scoped to").Default("notes-are-noted.vercel.app").String()
+	webauthnOrigins  = app.Flag("webauthn-origins", "comma separated origins of the clients allowed to use passkeys").Default("https://notes-are-noted.vercel.app").String()
+	verifyCodeLength = app.Flag("verification-code-length", "number of digits of the verification codes sent by email").Default("6").Int()
+	argon2Memory     = app.Flag("argon2-memory", "memory in KiB used by argon2id to hash passwords").Default("19456").Uint32()
+	argon2Iterations = app.Flag("argon2-iterations", "number of passes of argon2id over the memory").Default("2").Uint32()
+	argon2Threads    = app.Flag("argon2-parallelism", "number of threads used by argon2id").Default("1").Uint8()
+	pwdMinLength     = app.Flag("password-min-length", "minimum number of characters of the passwords").Default("8").Int()
+	pwdMaxLength     = app.Flag("password-max-length", "maximum number of characters of the passwords").Default("128").Int()
+	pwdMinEntropy    = app.Flag("password-min-entropy", "minimum estimated strength of the passwords, in bits").Default("40").Float64()
+	pwdHistoryDepth  = app.Flag("password-history-depth", "number of previous passwords of each account which cannot be used again").Default("5").Int()
+	breachedPwdsFile = app.Flag("breached-passwords-file", "file listing one leaked password per line, which cannot be used").Default("").String()
+	oidcProviders    = app.Flag("oidc-providers", "json file listing the openid connect providers users can log in with").Default("").String()
+	googleClientID   = app.Flag("google-client-id", "client id of the accounts service at google, when the google provider is not listed in --oidc-providers").Default("871625340195-kf7c2u88u9aivgdru776a36hgel0kjja.apps.googleusercontent.com").String()
+	googleJWKSURL    = app.Flag("google-jwks-url", "url of the keys signing the google id tokens").Default("https://www.googleapis.com/oauth2/v3/certs").String()
+	oauthIssuer      = app.Flag("oauth-issuer", "public url under which the gateway exposes the authorization server to third-party apps").Default("https://notes-are-noted.vercel.app").String()
+	oauthConsentURL  = app.Flag("oauth-consent-url", "url of the page of the frontend where users authorize third-party apps").Default("https://notes-are-noted.vercel.app/oauth/authorize").String()
+	deviceVerifyURL  = app.Flag("device-verification-url", "url of the page of the frontend where users approve the login of devices without a browser").Default("https://notes-are-noted.vercel.app/device").String()
+	trustedProxyIPs  = app.Flag("trusted-proxies", "comma separated addresses or cidr ranges of the gateways and proxies whose x-forwarded-for header is trusted").Default("127.0.0.1,::1").String()
 	gmailSuperSecret = app.Flag("gmail-super-secret", "token to authenticate accounts service with noted gmail account").Default("").String()
+
+	serveCmd = app.Command("serve", "run the grpc server").Default()
+
+	createServiceAccountCmd    = app.Command("create-service-account", "register the machine identity of another service and print its credentials")
+	createServiceAccountName   = createServiceAccountCmd.Arg("name", "name of the service").Required().String()
+	createServiceAccountScopes = createServiceAccountCmd.Flag("scope", "scope granted to the service").Required().Enums(auth.KnownScopes...)
+
+	createOAuthClientCmd          = app.Command("create-oauth-client", "register a third-party app and print its credentials")
+	createOAuthClientName         = createOAuthClientCmd.Arg("name", "name of the app shown to the users").Required().String()
+	createOAuthClientRedirectURIs = createOAuthClientCmd.Flag("redirect-uri", "uri the users are sent back to after authorizing the app").Required().Strings()
+	createOAuthClientScopes       = createOAuthClientCmd.Flag("scope", "scope the app may request").Required().Enums(auth.DelegableScopes...)
+	createOAuthClientPublic       = createOAuthClientCmd.Flag("public", "the app cannot keep a secret, like browser extensions").Bool()
+
+	setAccountRolesCmd   = app.Command("set-account-roles", "replace the roles granted to an account")
+	setAccountRolesEmail = setAccountRolesCmd.Arg("email", "email of the account").Required().String()
+	setAccountRolesRoles = setAccountRolesCmd.Flag("role", "role granted to the account").Enums(auth.GrantableRoles...)
+
+	markLegacyAccountsCmd = app.Command("mark-legacy-accounts", "mark the accounts left without password nor identity by the former google login")
 )
 
 var (
@@ -27,10 +68,19 @@ var (
 )
 
 func main() {
-	kingpin.MustParse(app.Parse(os.Args[1:]))
-
-	s := &server{}
-	s.Init(grpc.ChainUnaryInterceptor(s.LoggerUnaryInterceptor, auth.ForwardAuthMetadatathUnaryInterceptor))
-	s.Run()
-	defer s.Close()
+	switch kingpin.MustParse(app.Parse(os.Args[1:])) {
+	case createServiceAccountCmd.FullCommand():
+		createServiceAccount(*createServiceAccountName, *createServiceAccountScopes)
+	case createOAuthClientCmd.FullCommand():
+		createOAuthClient(*createOAuthClientName, *createOAuthClientRedirectURIs, *createOAuthClientScopes, *createOAuthClientPublic)
+	case setAccountRolesCmd.FullCommand():
+		setAccountRoles(*setAccountRolesEmail, *setAccountRolesRoles)
+	case markLegacyAccountsCmd.FullCommand():
+		markLegacyAccounts()
+	case serveCmd.FullCommand():
+		s := &server{}
+		s.Init(grpc.ChainUnaryInterceptor(s.LoggerUnaryInterceptor, auth.ForwardAuthMetadatathUnaryInterceptor))
+		s.Run()
+		defer s.Close()
+	}
 }
@@ -6,15 +6,42 @@ import (
 )
 
 type Account struct {
-	ID              string    `json:"id" bson:"_id,omitempty"`
-	Email           *string   `json:"email" bson:"email,omitempty"`
-	Name            *string   `json:"name" bson:"name,omitempty"`
-	Hash            *[]byte   `json:"hash" bson:"hash,omitempty"`
-	ValidationToken string    `json:"validation_token" bson:"validation_token,omitempty"`
-	IsValidated     bool      `json:"is_validated" bson:"is_validated"`
-	IsInMobileBeta  bool      `json:"is_in_mobile_beta" bson:"is_in_mobile_beta,omitempty"`
-	Token           string    `json:"token" bson:"token,omitempty"`
-	ValidUntil      time.Time `json:"valid_until" bson:"valid_until,omitempty"`
+	ID             string  `json:"id" bson:"_id,omitempty"`
+	Email          *string `json:"email" bson:"email,omitempty"`
+	Name           *string `json:"name" bson:"name,omitempty"`
+	Hash           *[]byte `json:"hash" bson:"hash,omitempty"`
+	IsValidated    bool    `json:"is_validated" bson:"is_validated"`
+	IsInMobileBeta bool    `json:"is_in_mobile_beta" bson:"is_in_mobile_beta,omitempty"`
+
+	// Set on the accounts created by the former Google login, which stored
+	// no identity, until a Google identity is linked to them.
+	IsLegacyExternal bool `json:"is_legacy_external" bson:"is_legacy_external,omitempty"`
+
+	// Hashes of the previous passwords, most recent first, which cannot be
+	// used again.
+	PasswordHistory [][]byte `json:"password_history" bson:"password_history,omitempty"`
+
+	Roles            []string   `json:"roles" bson:"roles,omitempty"`
+	SuspendedAt      *time.Time `json:"suspended_at" bson:"suspended_at,omitempty"`
+	SuspensionReason string     `json:"suspension_reason" bson:"suspension_reason,omitempty"`
+
+	// The TOTP secret is set on enrollment but only required to log in once
+	// confirmed with a first code.
+	TOTPSecret       string     `json:"totp_secret" bson:"totp_secret,omitempty"`
+	TOTPEnabledAt    *time.Time `json:"totp_enabled_at" bson:"totp_enabled_at,omitempty"`
+	TOTPLastUsedStep int64      `json:"totp_last_used_step" bson:"totp_last_used_step,omitempty"`
+	RecoveryCodes    []string   `json:"recovery_codes" bson:"recovery_codes,omitempty"` // Hashes of the unused codes.
+}
+
+// IsSuspended reports whether an administrator has suspended the account.
+func (acc *Account) IsSuspended() bool {
+	return acc.SuspendedAt != nil
+}
+
+// HasSecondFactor reports whether logging in to the account requires a
+// second factor.
+func (acc *Account) HasSecondFactor() bool {
+	return acc.TOTPEnabledAt != nil
 }
 
 type AccountPayload struct {
@@ -29,14 +56,11 @@ type OneAccountFilter struct {
 	IsValidated bool   `json:"is_validated" bson:"is_validated,omitempty"`
 }
 
-type AccountSecretToken struct {
-	ID         string    `json:"id" bson:"_id,omitempty"`
-	Token      string    `json:"token" bson:"token,omitempty"`
-	ValidUntil time.Time `json:"valid_until" bson:"valid_until,omitempty"`
+type ManyAccountsFilter struct {
+	// Matches the accounts whose email or name contains Query, ignoring case.
+	Query string
 }
 
-type ManyAccountsFilter struct{}
-
 // AccountsRepository is safe for use in multiple goroutines.
 type AccountsRepository interface {
 	Create(ctx context.Context, filter *AccountPayload, isValidated bool) (*Account, error)
@@ -51,13 +75,58 @@ type AccountsRepository interface {
 
 	List(ctx context.Context, filter *ManyAccountsFilter, pagination *Pagination) ([]Account, error)
 
-	UpdateAccountWithResetPasswordToken(ctx context.Context, filter *OneAccountFilter) (*AccountSecretToken, error)
-
 	UpdateAccountPassword(ctx context.Context, filter *OneAccountFilter, account *AccountPayload) (*Account, error)
 
+	// ChangeAccountPassword replaces the password hash of the account and
+	// moves the previous one to the front of its password history, which is
+	// capped at historyDepth hashes.
+	ChangeAccountPassword(ctx context.Context, filter *OneAccountFilter, hash []byte, historyDepth int) (*Account, error)
+
+	// RehashAccountPassword replaces the password hash of the account with
+	// hash only if it is still oldHash. ErrNotFound is returned if the
+	// password changed in the meantime.
+	RehashAccountPassword(ctx context.Context, filter *OneAccountFilter, oldHash []byte, hash []byte) error
+
 	UpdateAccountValidationState(ctx context.Context, filter *OneAccountFilter) (*Account, error)
 
 	RegisterUserToMobileBeta(ctx context.Context, filter *OneAccountFilter) (*Account, error)
 
 	UnsetAccountPasswordAndSetValidationState(ctx context.Context, filter *OneAccountFilter) (*Account, error)
+
+	UpdateAccountRoles(ctx context.Context, filter *OneAccountFilter, roles []string) (*Account, error)
+
+	SuspendAccount(ctx context.Context, filter *OneAccountFilter, reason string) (*Account, error)
+
+	ReinstateAccount(ctx context.Context, filter *OneAccountFilter) (*Account, error)
+
+	// MarkLegacyExternalAccounts marks the accounts without password,
+	// identity nor passkey, which only the former Google login left, and
+	// returns their number.
+	MarkLegacyExternalAccounts(ctx context.Context) (int64, error)
+
+	// AdoptLegacyExternalAccount atomically unmarks a legacy account.
+	// ErrNotFound is returned if the account is not marked, so that it can
+	// only be adopted once.
+	AdoptLegacyExternalAccount(ctx context.Context, filter *OneAccountFilter) (*Account, error)
+
+	// SetTOTPSecret starts the enrollment of an authenticator, replacing any
+	// unconfirmed one.
+	SetTOTPSecret(ctx context.Context, filter *OneAccountFilter, secret string) (*Account, error)
+
+	// EnableTOTP confirms the enrollment of an authenticator with the code of
+	// step.
+	EnableTOTP(ctx context.Context, filter *OneAccountFilter, step int64, recoveryCodes []string) (*Account, error)
+
+	DisableTOTP(ctx context.Context, filter *OneAccountFilter) (*Account, error)
+
+	// UseTOTPStep atomically records that the code of step was used.
+	// ErrNotFound is returned if a code of the same or a later step was
+	// already used, so that a code cannot be replayed.
+	UseTOTPStep(ctx context.Context, filter *OneAccountFilter, step int64) (*Account, error)
+
+	UpdateRecoveryCodes(ctx context.Context, filter *OneAccountFilter, recoveryCodes []string) (*Account, error)
+
+	// UseRecoveryCode atomically removes a recovery code. ErrNotFound is
+	// returned if the account has no such code.
+	UseRecoveryCode(ctx context.Context, filter *OneAccountFilter, recoveryCode string) (*Account, error)
 }
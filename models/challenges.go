@@ -0,0 +1,81 @@
+package models
+
+import (
+	"context"
+	"time"
+)
+
+const (
+	// Handed out in place of a token to the accounts which must prove a
+	// second factor to complete their login.
+	ChallengePurposeSecondFactor = "second_factor"
+	// Signed by authenticators during the WebAuthn ceremonies.
+	ChallengePurposePasskeyRegistration = "passkey_registration"
+	ChallengePurposePasskeyLogin        = "passkey_login"
+	// Emailed to log in without a password.
+	ChallengePurposeLoginCode = "login_code"
+	// Passed as the state of the logins with an OpenID Connect provider,
+	// and of the links of a provider to an account.
+	ChallengePurposeOIDCLogin = "oidc_login"
+	ChallengePurposeOIDCLink  = "oidc_link"
+	// Handed out to third-party apps to exchange for the tokens of the
+	// account which authorized them.
+	ChallengePurposeOAuthCode = "oauth_code"
+)
+
+// Challenge is a random value handed out to a client to prove that a
+// following request belongs to the same ceremony.
+type Challenge struct {
+	ID        string    `json:"id" bson:"_id,omitempty"` // Hash of the challenge.
+	Purpose   string    `json:"purpose" bson:"purpose"`
+	AccountID string    `json:"account_id" bson:"account_id,omitempty"`
+	Attempts  int       `json:"attempts" bson:"attempts"`
+	CreatedAt time.Time `json:"created_at" bson:"created_at"`
+	ExpiresAt time.Time `json:"expires_at" bson:"expires_at"`
+
+	// Values of the ceremony which must be kept until the challenge is
+	// answered.
+	Data map[string]string `json:"data,omitempty" bson:"data,omitempty"`
+}
+
+type ChallengePayload struct {
+	ID        string
+	Purpose   string
+	AccountID string // Empty when the account is not known yet.
+	ExpiresAt time.Time
+	Data      map[string]string
+}
+
+// OneChallengeFilter always matches on Purpose, so that a challenge cannot
+// be used for another purpose than the one it was created for.
+type OneChallengeFilter struct {
+	ID        string `json:"id" bson:"_id,omitempty"`
+	Purpose   string `json:"purpose" bson:"purpose"`
+	AccountID string `json:"account_id" bson:"account_id,omitempty"`
+}
+
+type ManyChallengesFilter struct {
+	Purpose   string
+	AccountID string
+}
+
+// ChallengesRepository is safe for use in multiple goroutines.
+type ChallengesRepository interface {
+	Create(ctx context.Context, payload *ChallengePayload) (*Challenge, error)
+
+	// Get returns an unexpired challenge.
+	Get(ctx context.Context, filter *OneChallengeFilter) (*Challenge, error)
+
+	// Attempt atomically counts an attempt to answer an unexpired challenge
+	// and returns it. ErrNotFound is returned if no such challenge exists or
+	// if it was already attempted maxAttempts times.
+	Attempt(ctx context.Context, filter *OneChallengeFilter, maxAttempts int) (*Challenge, error)
+
+	// Use atomically deletes an unexpired challenge and returns it.
+	// ErrNotFound is returned if no such challenge exists.
+	Use(ctx context.Context, filter *OneChallengeFilter) (*Challenge, error)
+
+	Delete(ctx context.Context, filter *OneChallengeFilter) error
+
+	DeleteMany(ctx context.Context, filter *ManyChallengesFilter) error
+}
@@ -0,0 +1,47 @@
+package models
+
+import (
+	"context"
+	"time"
+)
+
+// Consent records the scopes an account authorized a third-party app to
+// use on its behalf, so that the user is not asked again for them.
+type Consent struct {
+	ID        string    `json:"id" bson:"_id,omitempty"`
+	AccountID string    `json:"account_id" bson:"account_id"`
+	ClientID  string    `json:"client_id" bson:"client_id"`
+	Scopes    []string  `json:"scopes" bson:"scopes"`
+	CreatedAt time.Time `json:"created_at" bson:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" bson:"updated_at"`
+}
+
+type ConsentPayload struct {
+	AccountID string
+	ClientID  string
+	Scopes    []string
+}
+
+type OneConsentFilter struct {
+	AccountID string `json:"account_id" bson:"account_id,omitempty"`
+	ClientID  string `json:"client_id" bson:"client_id,omitempty"`
+}
+
+type ManyConsentsFilter struct {
+	AccountID string
+}
+
+// ConsentsRepository is safe for use in multiple goroutines.
+type ConsentsRepository interface {
+	// Grant records the consent of the account to the client, adding the
+	// scopes of payload to the ones it already granted.
+	Grant(ctx context.Context, payload *ConsentPayload) (*Consent, error)
+
+	Get(ctx context.Context, filter *OneConsentFilter) (*Consent, error)
+
+	List(ctx context.Context, filter *ManyConsentsFilter) ([]Consent, error)
+
+	Delete(ctx context.Context, filter *OneConsentFilter) error
+
+	DeleteMany(ctx context.Context, filter *ManyConsentsFilter) error
+}
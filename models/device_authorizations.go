@@ -0,0 +1,48 @@
+package models
+
+import (
+	"context"
+	"time"
+)
+
+// DeviceAuthorization is a login started on a device without a browser,
+// such as the CLI, which the user approves from another device by typing in
+// its user code.
+type DeviceAuthorization struct {
+	ID           string     `json:"id" bson:"_id,omitempty"` // Hash of the device code.
+	UserCode     string     `json:"user_code" bson:"user_code"`
+	AccountID    string     `json:"account_id" bson:"account_id,omitempty"` // Empty until approved.
+	CreatedAt    time.Time  `json:"created_at" bson:"created_at"`
+	ExpiresAt    time.Time  `json:"expires_at" bson:"expires_at"`
+	LastPolledAt *time.Time `json:"last_polled_at" bson:"last_polled_at,omitempty"`
+}
+
+type DeviceAuthorizationPayload struct {
+	ID        string
+	UserCode  string
+	ExpiresAt time.Time
+}
+
+type OneDeviceAuthorizationFilter struct {
+	ID        string `json:"id" bson:"_id,omitempty"`
+	UserCode  string `json:"user_code" bson:"user_code,omitempty"`
+	AccountID string `json:"account_id" bson:"account_id,omitempty"`
+}
+
+// DeviceAuthorizationsRepository is safe for use in multiple goroutines.
+type DeviceAuthorizationsRepository interface {
+	Create(ctx context.Context, payload *DeviceAuthorizationPayload) (*DeviceAuthorization, error)
+
+	// Approve atomically binds an unexpired authorization which was not
+	// approved yet to the account and returns it. ErrNotFound is returned
+	// if no such authorization exists.
+	Approve(ctx context.Context, filter *OneDeviceAuthorizationFilter, accountID string) (*DeviceAuthorization, error)
+
+	// Poll atomically records a poll of an unexpired authorization and
+	// returns it as it was before, so that the time of the previous poll
+	// can be checked. ErrNotFound is returned if no such authorization
+	// exists.
+	Poll(ctx context.Context, filter *OneDeviceAuthorizationFilter) (*DeviceAuthorization, error)
+
+	Delete(ctx context.Context, filter *OneDeviceAuthorizationFilter) error
+}
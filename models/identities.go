@@ -0,0 +1,50 @@
+package models
+
+import (
+	"context"
+	"time"
+)
+
+// Identity links an account to the account of the user at an identity
+// provider, which the user can log in with.
+type Identity struct {
+	ID        string    `json:"id" bson:"_id,omitempty"`
+	Provider  string    `json:"provider" bson:"provider"`
+	Subject   string    `json:"subject" bson:"subject"` // Identifier of the user at the provider.
+	AccountID string    `json:"account_id" bson:"account_id"`
+	Email     string    `json:"email" bson:"email"` // Email of the user at the provider when linked.
+	CreatedAt time.Time `json:"created_at" bson:"created_at"`
+}
+
+type IdentityPayload struct {
+	Provider  string
+	Subject   string
+	AccountID string
+	Email     string
+}
+
+type OneIdentityFilter struct {
+	ID        string `json:"id" bson:"_id,omitempty"`
+	Provider  string `json:"provider" bson:"provider,omitempty"`
+	Subject   string `json:"subject" bson:"subject,omitempty"`
+	AccountID string `json:"account_id" bson:"account_id,omitempty"`
+}
+
+type ManyIdentitiesFilter struct {
+	AccountID string
+}
+
+// IdentitiesRepository is safe for use in multiple goroutines.
+type IdentitiesRepository interface {
+	// Create returns ErrDuplicateKeyFound if the subject is already linked
+	// to an account.
+	Create(ctx context.Context, payload *IdentityPayload) (*Identity, error)
+
+	Get(ctx context.Context, filter *OneIdentityFilter) (*Identity, error)
+
+	List(ctx context.Context, filter *ManyIdentitiesFilter) ([]Identity, error)
+
+	Delete(ctx context.Context, filter *OneIdentityFilter) error
+
+	DeleteMany(ctx context.Context, filter *ManyIdentitiesFilter) error
+}
@@ -0,0 +1,57 @@
+package models
+
+import (
+	"context"
+	"time"
+)
+
+// LoginRequest is a login started on a desktop browser, which the user
+// approves by scanning its ID with the mobile app where they are logged in.
+// The request is abandoned once the desktop stops polling it.
+type LoginRequest struct {
+	ID         string    `json:"id" bson:"_id,omitempty"`                // Hash of the ID shown in the QR code.
+	SecretHash string    `json:"secret_hash" bson:"secret_hash"`         // Hash of the secret kept by the desktop.
+	AccountID  string    `json:"account_id" bson:"account_id,omitempty"` // Empty until approved.
+	CreatedAt  time.Time `json:"created_at" bson:"created_at"`
+	ExpiresAt  time.Time `json:"expires_at" bson:"expires_at"`
+
+	// Client which created the request, shown to the user before approving
+	// it.
+	Device    string `json:"device" bson:"device,omitempty"`
+	IPAddress string `json:"ip_address" bson:"ip_address,omitempty"`
+	UserAgent string `json:"user_agent" bson:"user_agent,omitempty"`
+}
+
+type LoginRequestPayload struct {
+	ID         string
+	SecretHash string
+	ExpiresAt  time.Time
+	Device     string
+	IPAddress  string
+	UserAgent  string
+}
+
+type OneLoginRequestFilter struct {
+	ID         string `json:"id" bson:"_id,omitempty"`
+	SecretHash string `json:"secret_hash" bson:"secret_hash,omitempty"`
+	AccountID  string `json:"account_id" bson:"account_id,omitempty"`
+}
+
+// LoginRequestsRepository is safe for use in multiple goroutines.
+type LoginRequestsRepository interface {
+	Create(ctx context.Context, payload *LoginRequestPayload) (*LoginRequest, error)
+
+	// Get returns an unexpired request.
+	Get(ctx context.Context, filter *OneLoginRequestFilter) (*LoginRequest, error)
+
+	// Approve atomically binds an unexpired request which was not approved
+	// yet to the account and returns it. ErrNotFound is returned if no such
+	// request exists.
+	Approve(ctx context.Context, filter *OneLoginRequestFilter, accountID string) (*LoginRequest, error)
+
+	// Poll atomically postpones the expiry of an unexpired request and
+	// returns it. ErrNotFound is returned if no such request exists.
+	Poll(ctx context.Context, filter *OneLoginRequestFilter, expiresAt time.Time) (*LoginRequest, error)
+
+	Delete(ctx context.Context, filter *OneLoginRequestFilter) error
+}
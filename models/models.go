@@ -21,5 +21,8 @@ var (
 	// Returned when a `Update`, try to update non-existant field.
 	ErrUpdateInvalidField = errors.New("invalid update field requested")
 
+	// Returned when a `DeleteMany` is called with an empty filter.
+	ErrEmptyFilter = errors.New("empty filter")
+
 	ErrUnknown = errors.New("unknown error")
 )
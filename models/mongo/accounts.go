@@ -5,15 +5,13 @@ package mongo
 import (
 	"accounts-service/models"
 	"context"
-	"crypto/rand"
 	"errors"
-	"fmt"
-	"math/big"
-	m "math/rand"
+	"regexp"
 	"time"
 
 	"github.com/jaevor/go-nanoid"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"go.uber.org/zap"
@@ -54,9 +52,7 @@ func NewAccountsRepository(db *mongo.Database, logger *zap.Logger) models.Accoun
 }
 
 func (repo *accountsRepository) Create(ctx context.Context, payload *models.AccountPayload, isValidated bool) (*models.Account, error) {
-	token := m.Intn(9999)
-	tokenFormatted := fmt.Sprintf("%04d", token)
-	account := models.Account{ID: repo.newUUID(), Email: payload.Email, Name: payload.Name, Hash: payload.Hash, ValidationToken: tokenFormatted}
+	account := models.Account{ID: repo.newUUID(), Email: payload.Email, Name: payload.Name, Hash: payload.Hash}
 
 	_, err := repo.coll.InsertOne(ctx, account)
 	if err != nil {
@@ -162,7 +158,16 @@ func (repo *accountsRepository) List(ctx context.Context, filter *models.ManyAcc
 		Limit: &pagination.Limit,
 		Skip:  &pagination.Offset,
 	}
-	cursor, err := repo.coll.Find(ctx, bson.D{}, &opt)
+	query := bson.D{}
+	if filter.Query != "" {
+		pattern := primitive.Regex{Pattern: regexp.QuoteMeta(filter.Query), Options: "i"}
+		query = append(query, bson.E{Key: "$or", Value: bson.A{
+			bson.D{{Key: "email", Value: pattern}},
+			bson.D{{Key: "name", Value: pattern}},
+		}})
+	}
+
+	cursor, err := repo.coll.Find(ctx, query, &opt)
 	if err != nil {
 		repo.logger.Error("mongo find accounts query failed", zap.Error(err))
 		return nil, err
@@ -181,42 +186,54 @@ func (repo *accountsRepository) List(ctx context.Context, filter *models.ManyAcc
 	return accounts, nil
 }
 
-func (repo *accountsRepository) UpdateAccountWithResetPasswordToken(ctx context.Context, filter *models.OneAccountFilter) (*models.AccountSecretToken, error) {
-	var accountSecretToken models.AccountSecretToken
-	max := big.NewInt(9999)
-	randInt, err := rand.Int(rand.Reader, max)
-	if err != nil {
-		repo.logger.Error("could not generate reset token", zap.Error(err))
-		return nil, models.ErrUnknown
-	}
+func (repo *accountsRepository) UpdateAccountPassword(ctx context.Context, filter *models.OneAccountFilter, account *models.AccountPayload) (*models.Account, error) {
+	var updatedAccount models.Account
 
-	tokenFormatted := fmt.Sprintf("%04d", randInt)
-	token := &models.AccountSecretToken{Token: tokenFormatted, ValidUntil: time.Now().Add(time.Hour * 1)}
-	field := bson.D{{Key: "$set", Value: token}}
+	field := bson.D{{Key: "$set", Value: bson.D{{Key: "hash", Value: account.Hash}}}}
 
-	err = repo.coll.FindOneAndUpdate(ctx, filter, field, options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&accountSecretToken)
+	err := repo.coll.FindOneAndUpdate(ctx, filter, field, options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&updatedAccount)
 	if err != nil {
 		if errors.Is(err, mongo.ErrNoDocuments) {
 			return nil, models.ErrNotFound
 		}
-		repo.logger.Error("update reset token failed", zap.Error(err))
+		repo.logger.Error("update account password failed", zap.Error(err))
 		return nil, models.ErrUnknown
 	}
 
-	return &accountSecretToken, nil
+	return &updatedAccount, nil
 }
 
-func (repo *accountsRepository) UpdateAccountPassword(ctx context.Context, filter *models.OneAccountFilter, account *models.AccountPayload) (*models.Account, error) {
+func (repo *accountsRepository) ChangeAccountPassword(ctx context.Context, filter *models.OneAccountFilter, hash []byte, historyDepth int) (*models.Account, error) {
 	var updatedAccount models.Account
 
-	field := bson.D{{Key: "$set", Value: bson.D{{Key: "hash", Value: account.Hash}}}}
+	// The expressions of a $set stage are evaluated against the document
+	// before the update, so $hash is the previous hash. Accounts created
+	// with google have no previous hash.
+	var history interface{} = bson.A{}
+	if historyDepth > 0 {
+		previous := bson.D{{Key: "$cond", Value: bson.A{
+			bson.D{{Key: "$eq", Value: bson.A{bson.D{{Key: "$ifNull", Value: bson.A{"$hash", nil}}}, nil}}},
+			bson.A{},
+			bson.A{"$hash"},
+		}}}
+		history = bson.D{{Key: "$slice", Value: bson.A{
+			bson.D{{Key: "$concatArrays", Value: bson.A{previous, bson.D{{Key: "$ifNull", Value: bson.A{"$password_history", bson.A{}}}}}}},
+			historyDepth,
+		}}}
+	}
+	field := bson.A{
+		bson.D{{Key: "$set", Value: bson.D{
+			{Key: "password_history", Value: history},
+			{Key: "hash", Value: hash},
+		}}},
+	}
 
 	err := repo.coll.FindOneAndUpdate(ctx, filter, field, options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&updatedAccount)
 	if err != nil {
 		if errors.Is(err, mongo.ErrNoDocuments) {
 			return nil, models.ErrNotFound
 		}
-		repo.logger.Error("update account password failed", zap.Error(err))
+		repo.logger.Error("change account password failed", zap.Error(err))
 		return nil, models.ErrUnknown
 	}
 
@@ -240,6 +257,25 @@ func (repo *accountsRepository) UnsetAccountPasswordAndSetValidationState(ctx co
 	return &updatedAccount, nil
 }
 
+func (repo *accountsRepository) RehashAccountPassword(ctx context.Context, filter *models.OneAccountFilter, oldHash []byte, hash []byte) error {
+	query := bson.D{
+		{Key: "_id", Value: filter.ID},
+		{Key: "hash", Value: oldHash},
+	}
+	field := bson.D{{Key: "$set", Value: bson.D{{Key: "hash", Value: hash}}}}
+
+	err := repo.coll.FindOneAndUpdate(ctx, query, field).Err()
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return models.ErrNotFound
+		}
+		repo.logger.Error("rehash account password failed", zap.Error(err))
+		return models.ErrUnknown
+	}
+
+	return nil
+}
+
 func (repo *accountsRepository) UpdateAccountValidationState(ctx context.Context, filter *models.OneAccountFilter) (*models.Account, error) {
 	var updatedAccount models.Account
 
@@ -273,3 +309,241 @@ func (repo *accountsRepository) RegisterUserToMobileBeta(ctx context.Context, fi
 
 	return &updatedAccount, nil
 }
+
+func (repo *accountsRepository) UpdateAccountRoles(ctx context.Context, filter *models.OneAccountFilter, roles []string) (*models.Account, error) {
+	var updatedAccount models.Account
+
+	field := bson.D{{Key: "$set", Value: bson.D{{Key: "roles", Value: roles}}}}
+
+	err := repo.coll.FindOneAndUpdate(ctx, filter, field, options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&updatedAccount)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, models.ErrNotFound
+		}
+		repo.logger.Error("update account roles failed", zap.Error(err))
+		return nil, models.ErrUnknown
+	}
+
+	return &updatedAccount, nil
+}
+
+func (repo *accountsRepository) SuspendAccount(ctx context.Context, filter *models.OneAccountFilter, reason string) (*models.Account, error) {
+	var updatedAccount models.Account
+
+	field := bson.D{{Key: "$set", Value: bson.D{
+		{Key: "suspended_at", Value: time.Now().UTC()},
+		{Key: "suspension_reason", Value: reason},
+	}}}
+
+	err := repo.coll.FindOneAndUpdate(ctx, filter, field, options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&updatedAccount)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, models.ErrNotFound
+		}
+		repo.logger.Error("suspend account failed", zap.Error(err))
+		return nil, models.ErrUnknown
+	}
+
+	return &updatedAccount, nil
+}
+
+func (repo *accountsRepository) ReinstateAccount(ctx context.Context, filter *models.OneAccountFilter) (*models.Account, error) {
+	var updatedAccount models.Account
+
+	field := bson.D{{Key: "$unset", Value: bson.D{
+		{Key: "suspended_at", Value: 0},
+		{Key: "suspension_reason", Value: 0},
+	}}}
+
+	err := repo.coll.FindOneAndUpdate(ctx, filter, field, options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&updatedAccount)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, models.ErrNotFound
+		}
+		repo.logger.Error("reinstate account failed", zap.Error(err))
+		return nil, models.ErrUnknown
+	}
+
+	return &updatedAccount, nil
+}
+
+func (repo *accountsRepository) MarkLegacyExternalAccounts(ctx context.Context) (int64, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.D{{Key: "hash", Value: bson.D{{Key: "$exists", Value: false}}}}}},
+		{{Key: "$lookup", Value: bson.D{{Key: "from", Value: "identities"}, {Key: "localField", Value: "_id"}, {Key: "foreignField", Value: "account_id"}, {Key: "as", Value: "identities"}}}},
+		{{Key: "$lookup", Value: bson.D{{Key: "from", Value: "passkeys"}, {Key: "localField", Value: "_id"}, {Key: "foreignField", Value: "account_id"}, {Key: "as", Value: "passkeys"}}}},
+		{{Key: "$match", Value: bson.D{{Key: "identities", Value: bson.D{{Key: "$size", Value: 0}}}, {Key: "passkeys", Value: bson.D{{Key: "$size", Value: 0}}}}}},
+		{{Key: "$project", Value: bson.D{{Key: "_id", Value: 1}}}},
+	}
+
+	cursor, err := repo.coll.Aggregate(ctx, pipeline)
+	if err != nil {
+		repo.logger.Error("find legacy accounts failed", zap.Error(err))
+		return 0, models.ErrUnknown
+	}
+	var accounts []models.Account
+	err = cursor.All(ctx, &accounts)
+	if err != nil {
+		repo.logger.Error("find legacy accounts failed", zap.Error(err))
+		return 0, models.ErrUnknown
+	}
+	if len(accounts) == 0 {
+		return 0, nil
+	}
+
+	ids := make([]string, len(accounts))
+	for i, account := range accounts {
+		ids[i] = account.ID
+	}
+
+	res, err := repo.coll.UpdateMany(ctx,
+		bson.D{{Key: "_id", Value: bson.D{{Key: "$in", Value: ids}}}},
+		bson.D{{Key: "$set", Value: bson.D{{Key: "is_legacy_external", Value: true}}}},
+	)
+	if err != nil {
+		repo.logger.Error("mark legacy accounts failed", zap.Error(err))
+		return 0, models.ErrUnknown
+	}
+
+	return res.ModifiedCount, nil
+}
+
+func (repo *accountsRepository) AdoptLegacyExternalAccount(ctx context.Context, filter *models.OneAccountFilter) (*models.Account, error) {
+	var updatedAccount models.Account
+
+	query := bson.D{
+		{Key: "_id", Value: filter.ID},
+		{Key: "is_legacy_external", Value: true},
+	}
+	field := bson.D{{Key: "$unset", Value: bson.D{{Key: "is_legacy_external", Value: 0}}}}
+
+	err := repo.coll.FindOneAndUpdate(ctx, query, field, options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&updatedAccount)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, models.ErrNotFound
+		}
+		repo.logger.Error("adopt legacy account failed", zap.Error(err))
+		return nil, models.ErrUnknown
+	}
+
+	return &updatedAccount, nil
+}
+
+func (repo *accountsRepository) SetTOTPSecret(ctx context.Context, filter *models.OneAccountFilter, secret string) (*models.Account, error) {
+	var updatedAccount models.Account
+
+	field := bson.D{{Key: "$set", Value: bson.D{{Key: "totp_secret", Value: secret}}}}
+
+	err := repo.coll.FindOneAndUpdate(ctx, filter, field, options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&updatedAccount)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, models.ErrNotFound
+		}
+		repo.logger.Error("set totp secret failed", zap.Error(err))
+		return nil, models.ErrUnknown
+	}
+
+	return &updatedAccount, nil
+}
+
+func (repo *accountsRepository) EnableTOTP(ctx context.Context, filter *models.OneAccountFilter, step int64, recoveryCodes []string) (*models.Account, error) {
+	var updatedAccount models.Account
+
+	field := bson.D{{Key: "$set", Value: bson.D{
+		{Key: "totp_enabled_at", Value: time.Now().UTC()},
+		{Key: "totp_last_used_step", Value: step},
+		{Key: "recovery_codes", Value: recoveryCodes},
+	}}}
+
+	err := repo.coll.FindOneAndUpdate(ctx, filter, field, options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&updatedAccount)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, models.ErrNotFound
+		}
+		repo.logger.Error("enable totp failed", zap.Error(err))
+		return nil, models.ErrUnknown
+	}
+
+	return &updatedAccount, nil
+}
+
+func (repo *accountsRepository) DisableTOTP(ctx context.Context, filter *models.OneAccountFilter) (*models.Account, error) {
+	var updatedAccount models.Account
+
+	field := bson.D{{Key: "$unset", Value: bson.D{
+		{Key: "totp_secret", Value: 0},
+		{Key: "totp_enabled_at", Value: 0},
+		{Key: "totp_last_used_step", Value: 0},
+		{Key: "recovery_codes", Value: 0},
+	}}}
+
+	err := repo.coll.FindOneAndUpdate(ctx, filter, field, options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&updatedAccount)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, models.ErrNotFound
+		}
+		repo.logger.Error("disable totp failed", zap.Error(err))
+		return nil, models.ErrUnknown
+	}
+
+	return &updatedAccount, nil
+}
+
+func (repo *accountsRepository) UseTOTPStep(ctx context.Context, filter *models.OneAccountFilter, step int64) (*models.Account, error) {
+	var updatedAccount models.Account
+
+	query := bson.D{
+		{Key: "_id", Value: filter.ID},
+		{Key: "totp_last_used_step", Value: bson.D{{Key: "$not", Value: bson.D{{Key: "$gte", Value: step}}}}},
+	}
+	field := bson.D{{Key: "$set", Value: bson.D{{Key: "totp_last_used_step", Value: step}}}}
+
+	err := repo.coll.FindOneAndUpdate(ctx, query, field, options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&updatedAccount)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, models.ErrNotFound
+		}
+		repo.logger.Error("use totp step failed", zap.Error(err))
+		return nil, models.ErrUnknown
+	}
+
+	return &updatedAccount, nil
+}
+
+func (repo *accountsRepository) UpdateRecoveryCodes(ctx context.Context, filter *models.OneAccountFilter, recoveryCodes []string) (*models.Account, error) {
+	var updatedAccount models.Account
+
+	field := bson.D{{Key: "$set", Value: bson.D{{Key: "recovery_codes", Value: recoveryCodes}}}}
+
+	err := repo.coll.FindOneAndUpdate(ctx, filter, field, options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&updatedAccount)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, models.ErrNotFound
+		}
+		repo.logger.Error("update recovery codes failed", zap.Error(err))
+		return nil, models.ErrUnknown
+	}
+
+	return &updatedAccount, nil
+}
+
+func (repo *accountsRepository) UseRecoveryCode(ctx context.Context, filter *models.OneAccountFilter, recoveryCode string) (*models.Account, error) {
+	var updatedAccount models.Account
+
+	query := bson.D{
+		{Key: "_id", Value: filter.ID},
+		{Key: "recovery_codes", Value: recoveryCode},
+	}
+	field := bson.D{{Key: "$pull", Value: bson.D{{Key: "recovery_codes", Value: recoveryCode}}}}
+
+	err := repo.coll.FindOneAndUpdate(ctx, query, field, options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&updatedAccount)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, models.ErrNotFound
+		}
+		repo.logger.Error("use recovery code failed", zap.Error(err))
+		return nil, models.ErrUnknown
+	}
+
+	return &updatedAccount, nil
+}
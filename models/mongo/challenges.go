@@ -0,0 +1,160 @@
+package mongo
+
+import (
+	"accounts-service/models"
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+)
+
+type challengesRepository struct {
+	logger *zap.Logger
+	db     *mongo.Database
+	coll   *mongo.Collection
+}
+
+func NewChallengesRepository(db *mongo.Database, logger *zap.Logger) models.ChallengesRepository {
+	rep := &challengesRepository{
+		logger: logger.Named("mongo").Named("challenges"),
+		db:     db,
+		coll:   db.Collection("challenges"),
+	}
+
+	_, err := rep.coll.Indexes().CreateMany(
+		context.Background(),
+		[]mongo.IndexModel{
+			{
+				Keys: bson.D{{Key: "account_id", Value: 1}, {Key: "purpose", Value: 1}},
+			},
+			{
+				Keys:    bson.D{{Key: "expires_at", Value: 1}},
+				Options: options.Index().SetExpireAfterSeconds(0),
+			},
+		},
+	)
+	if err != nil {
+		rep.logger.Error("index creation failed", zap.Error(err))
+	}
+
+	return rep
+}
+
+func (repo *challengesRepository) Create(ctx context.Context, payload *models.ChallengePayload) (*models.Challenge, error) {
+	challenge := models.Challenge{
+		ID:        payload.ID,
+		Purpose:   payload.Purpose,
+		AccountID: payload.AccountID,
+		CreatedAt: time.Now().UTC(),
+		ExpiresAt: payload.ExpiresAt,
+		Data:      payload.Data,
+	}
+
+	_, err := repo.coll.InsertOne(ctx, challenge)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return nil, models.ErrDuplicateKeyFound
+		}
+		repo.logger.Error("insert failed", zap.Error(err), zap.String("account_id", challenge.AccountID))
+		return nil, err
+	}
+
+	return &challenge, nil
+}
+
+func (repo *challengesRepository) Get(ctx context.Context, filter *models.OneChallengeFilter) (*models.Challenge, error) {
+	var challenge models.Challenge
+
+	err := repo.coll.FindOne(ctx, oneChallengeQuery(filter)).Decode(&challenge)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, models.ErrNotFound
+		}
+		repo.logger.Error("query failed", zap.Error(err))
+		return nil, err
+	}
+
+	return &challenge, nil
+}
+
+func (repo *challengesRepository) Attempt(ctx context.Context, filter *models.OneChallengeFilter, maxAttempts int) (*models.Challenge, error) {
+	var challenge models.Challenge
+
+	query := append(oneChallengeQuery(filter), bson.E{Key: "attempts", Value: bson.D{{Key: "$lt", Value: maxAttempts}}})
+	field := bson.D{{Key: "$inc", Value: bson.D{{Key: "attempts", Value: 1}}}}
+
+	err := repo.coll.FindOneAndUpdate(ctx, query, field, options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&challenge)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, models.ErrNotFound
+		}
+		repo.logger.Error("attempt challenge failed", zap.Error(err))
+		return nil, models.ErrUnknown
+	}
+
+	return &challenge, nil
+}
+
+func (repo *challengesRepository) Use(ctx context.Context, filter *models.OneChallengeFilter) (*models.Challenge, error) {
+	var challenge models.Challenge
+
+	err := repo.coll.FindOneAndDelete(ctx, oneChallengeQuery(filter)).Decode(&challenge)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, models.ErrNotFound
+		}
+		repo.logger.Error("use challenge failed", zap.Error(err))
+		return nil, models.ErrUnknown
+	}
+
+	return &challenge, nil
+}
+
+func (repo *challengesRepository) Delete(ctx context.Context, filter *models.OneChallengeFilter) error {
+	delete, err := repo.coll.DeleteOne(ctx, filter)
+	if err != nil {
+		repo.logger.Error("delete failed", zap.Error(err))
+		return err
+	}
+	if delete.DeletedCount == 0 {
+		return models.ErrNotFound
+	}
+
+	return nil
+}
+
+func (repo *challengesRepository) DeleteMany(ctx context.Context, filter *models.ManyChallengesFilter) error {
+	if filter.AccountID == "" {
+		return models.ErrEmptyFilter
+	}
+
+	query := bson.D{{Key: "account_id", Value: filter.AccountID}}
+	if filter.Purpose != "" {
+		query = append(query, bson.E{Key: "purpose", Value: filter.Purpose})
+	}
+
+	_, err := repo.coll.DeleteMany(ctx, query)
+	if err != nil {
+		repo.logger.Error("delete many failed", zap.Error(err))
+		return err
+	}
+
+	return nil
+}
+
+// oneChallengeQuery matches the unexpired challenge described by filter. The
+// TTL index only removes expired documents periodically.
+func oneChallengeQuery(filter *models.OneChallengeFilter) bson.D {
+	query := bson.D{{Key: "purpose", Value: filter.Purpose}}
+	if filter.ID != "" {
+		query = append(query, bson.E{Key: "_id", Value: filter.ID})
+	}
+	if filter.AccountID != "" {
+		query = append(query, bson.E{Key: "account_id", Value: filter.AccountID})
+	}
+	return append(query, bson.E{Key: "expires_at", Value: bson.D{{Key: "$gt", Value: time.Now().UTC()}}})
+}
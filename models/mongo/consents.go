@@ -0,0 +1,135 @@
+package mongo
+
+import (
+	"accounts-service/models"
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jaevor/go-nanoid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+)
+
+type consentsRepository struct {
+	logger  *zap.Logger
+	db      *mongo.Database
+	coll    *mongo.Collection
+	newUUID func() string
+}
+
+func NewConsentsRepository(db *mongo.Database, logger *zap.Logger) models.ConsentsRepository {
+	newUUID, err := nanoid.Standard(21)
+	if err != nil {
+		panic(err)
+	}
+
+	rep := &consentsRepository{
+		logger:  logger.Named("mongo").Named("consents"),
+		db:      db,
+		coll:    db.Collection("consents"),
+		newUUID: newUUID,
+	}
+
+	_, err = rep.coll.Indexes().CreateOne(
+		context.Background(),
+		mongo.IndexModel{
+			Keys:    bson.D{{Key: "account_id", Value: 1}, {Key: "client_id", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+	)
+	if err != nil {
+		rep.logger.Error("index creation failed", zap.Error(err))
+	}
+
+	return rep
+}
+
+func (repo *consentsRepository) Grant(ctx context.Context, payload *models.ConsentPayload) (*models.Consent, error) {
+	var consent models.Consent
+	now := time.Now().UTC()
+
+	filter := bson.D{{Key: "account_id", Value: payload.AccountID}, {Key: "client_id", Value: payload.ClientID}}
+	update := bson.D{
+		{Key: "$addToSet", Value: bson.D{{Key: "scopes", Value: bson.D{{Key: "$each", Value: payload.Scopes}}}}},
+		{Key: "$set", Value: bson.D{{Key: "updated_at", Value: now}}},
+		{Key: "$setOnInsert", Value: bson.D{{Key: "_id", Value: repo.newUUID()}, {Key: "created_at", Value: now}}},
+	}
+
+	opt := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+	err := repo.coll.FindOneAndUpdate(ctx, filter, update, opt).Decode(&consent)
+	if err != nil {
+		repo.logger.Error("upsert failed", zap.Error(err), zap.String("account_id", payload.AccountID))
+		return nil, err
+	}
+
+	return &consent, nil
+}
+
+func (repo *consentsRepository) Get(ctx context.Context, filter *models.OneConsentFilter) (*models.Consent, error) {
+	var consent models.Consent
+
+	err := repo.coll.FindOne(ctx, filter).Decode(&consent)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, models.ErrNotFound
+		}
+		repo.logger.Error("query failed", zap.Error(err))
+		return nil, err
+	}
+
+	return &consent, nil
+}
+
+func (repo *consentsRepository) List(ctx context.Context, filter *models.ManyConsentsFilter) ([]models.Consent, error) {
+	consents := []models.Consent{}
+
+	opt := options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}})
+	cursor, err := repo.coll.Find(ctx, bson.D{{Key: "account_id", Value: filter.AccountID}}, opt)
+	if err != nil {
+		repo.logger.Error("mongo find consents query failed", zap.Error(err))
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var elem models.Consent
+		err := cursor.Decode(&elem)
+		if err != nil {
+			repo.logger.Error("failed to decode mongo cursor result", zap.Error(err))
+			continue
+		}
+		consents = append(consents, elem)
+	}
+
+	return consents, nil
+}
+
+func (repo *consentsRepository) Delete(ctx context.Context, filter *models.OneConsentFilter) error {
+	delete, err := repo.coll.DeleteOne(ctx, filter)
+	if err != nil {
+		repo.logger.Error("delete failed", zap.Error(err))
+		return err
+	}
+	if delete.DeletedCount == 0 {
+		return models.ErrNotFound
+	}
+
+	return nil
+}
+
+func (repo *consentsRepository) DeleteMany(ctx context.Context, filter *models.ManyConsentsFilter) error {
+	if filter.AccountID == "" {
+		return models.ErrEmptyFilter
+	}
+
+	_, err := repo.coll.DeleteMany(ctx, bson.D{{Key: "account_id", Value: filter.AccountID}})
+	if err != nil {
+		repo.logger.Error("delete many failed", zap.Error(err))
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,130 @@
+package mongo
+
+import (
+	"accounts-service/models"
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+)
+
+type deviceAuthorizationsRepository struct {
+	logger *zap.Logger
+	db     *mongo.Database
+	coll   *mongo.Collection
+}
+
+func NewDeviceAuthorizationsRepository(db *mongo.Database, logger *zap.Logger) models.DeviceAuthorizationsRepository {
+	rep := &deviceAuthorizationsRepository{
+		logger: logger.Named("mongo").Named("device-authorizations"),
+		db:     db,
+		coll:   db.Collection("device_authorizations"),
+	}
+
+	_, err := rep.coll.Indexes().CreateMany(
+		context.Background(),
+		[]mongo.IndexModel{
+			{
+				Keys:    bson.D{{Key: "user_code", Value: 1}},
+				Options: options.Index().SetUnique(true),
+			},
+			{
+				Keys:    bson.D{{Key: "expires_at", Value: 1}},
+				Options: options.Index().SetExpireAfterSeconds(0),
+			},
+		},
+	)
+	if err != nil {
+		rep.logger.Error("index creation failed", zap.Error(err))
+	}
+
+	return rep
+}
+
+func (repo *deviceAuthorizationsRepository) Create(ctx context.Context, payload *models.DeviceAuthorizationPayload) (*models.DeviceAuthorization, error) {
+	authorization := models.DeviceAuthorization{
+		ID:        payload.ID,
+		UserCode:  payload.UserCode,
+		CreatedAt: time.Now().UTC(),
+		ExpiresAt: payload.ExpiresAt,
+	}
+
+	_, err := repo.coll.InsertOne(ctx, authorization)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return nil, models.ErrDuplicateKeyFound
+		}
+		repo.logger.Error("insert failed", zap.Error(err))
+		return nil, err
+	}
+
+	return &authorization, nil
+}
+
+func (repo *deviceAuthorizationsRepository) Approve(ctx context.Context, filter *models.OneDeviceAuthorizationFilter, accountID string) (*models.DeviceAuthorization, error) {
+	var authorization models.DeviceAuthorization
+
+	query := append(oneDeviceAuthorizationQuery(filter), bson.E{Key: "account_id", Value: bson.D{{Key: "$exists", Value: false}}})
+	field := bson.D{{Key: "$set", Value: bson.D{{Key: "account_id", Value: accountID}}}}
+
+	err := repo.coll.FindOneAndUpdate(ctx, query, field, options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&authorization)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, models.ErrNotFound
+		}
+		repo.logger.Error("approve device authorization failed", zap.Error(err))
+		return nil, models.ErrUnknown
+	}
+
+	return &authorization, nil
+}
+
+func (repo *deviceAuthorizationsRepository) Poll(ctx context.Context, filter *models.OneDeviceAuthorizationFilter) (*models.DeviceAuthorization, error) {
+	var authorization models.DeviceAuthorization
+
+	field := bson.D{{Key: "$set", Value: bson.D{{Key: "last_polled_at", Value: time.Now().UTC()}}}}
+
+	err := repo.coll.FindOneAndUpdate(ctx, oneDeviceAuthorizationQuery(filter), field, options.FindOneAndUpdate().SetReturnDocument(options.Before)).Decode(&authorization)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, models.ErrNotFound
+		}
+		repo.logger.Error("poll device authorization failed", zap.Error(err))
+		return nil, models.ErrUnknown
+	}
+
+	return &authorization, nil
+}
+
+func (repo *deviceAuthorizationsRepository) Delete(ctx context.Context, filter *models.OneDeviceAuthorizationFilter) error {
+	delete, err := repo.coll.DeleteOne(ctx, filter)
+	if err != nil {
+		repo.logger.Error("delete failed", zap.Error(err))
+		return err
+	}
+	if delete.DeletedCount == 0 {
+		return models.ErrNotFound
+	}
+
+	return nil
+}
+
+// oneDeviceAuthorizationQuery matches the unexpired authorization described
+// by filter. The TTL index only removes expired documents periodically.
+func oneDeviceAuthorizationQuery(filter *models.OneDeviceAuthorizationFilter) bson.D {
+	query := bson.D{}
+	if filter.ID != "" {
+		query = append(query, bson.E{Key: "_id", Value: filter.ID})
+	}
+	if filter.UserCode != "" {
+		query = append(query, bson.E{Key: "user_code", Value: filter.UserCode})
+	}
+	if filter.AccountID != "" {
+		query = append(query, bson.E{Key: "account_id", Value: filter.AccountID})
+	}
+	return append(query, bson.E{Key: "expires_at", Value: bson.D{{Key: "$gt", Value: time.Now().UTC()}}})
+}
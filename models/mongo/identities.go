@@ -0,0 +1,141 @@
+package mongo
+
+import (
+	"accounts-service/models"
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jaevor/go-nanoid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+)
+
+type identitiesRepository struct {
+	logger  *zap.Logger
+	db      *mongo.Database
+	coll    *mongo.Collection
+	newUUID func() string
+}
+
+func NewIdentitiesRepository(db *mongo.Database, logger *zap.Logger) models.IdentitiesRepository {
+	newUUID, err := nanoid.Standard(21)
+	if err != nil {
+		panic(err)
+	}
+
+	rep := &identitiesRepository{
+		logger:  logger.Named("mongo").Named("identities"),
+		db:      db,
+		coll:    db.Collection("identities"),
+		newUUID: newUUID,
+	}
+
+	_, err = rep.coll.Indexes().CreateMany(
+		context.Background(),
+		[]mongo.IndexModel{
+			{
+				Keys:    bson.D{{Key: "provider", Value: 1}, {Key: "subject", Value: 1}},
+				Options: options.Index().SetUnique(true),
+			},
+			{
+				Keys: bson.D{{Key: "account_id", Value: 1}},
+			},
+		},
+	)
+	if err != nil {
+		rep.logger.Error("index creation failed", zap.Error(err))
+	}
+
+	return rep
+}
+
+func (repo *identitiesRepository) Create(ctx context.Context, payload *models.IdentityPayload) (*models.Identity, error) {
+	identity := models.Identity{
+		ID:        repo.newUUID(),
+		Provider:  payload.Provider,
+		Subject:   payload.Subject,
+		AccountID: payload.AccountID,
+		Email:     payload.Email,
+		CreatedAt: time.Now().UTC(),
+	}
+
+	_, err := repo.coll.InsertOne(ctx, identity)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return nil, models.ErrDuplicateKeyFound
+		}
+		repo.logger.Error("insert failed", zap.Error(err), zap.String("account_id", identity.AccountID))
+		return nil, err
+	}
+
+	return &identity, nil
+}
+
+func (repo *identitiesRepository) Get(ctx context.Context, filter *models.OneIdentityFilter) (*models.Identity, error) {
+	var identity models.Identity
+
+	err := repo.coll.FindOne(ctx, filter).Decode(&identity)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, models.ErrNotFound
+		}
+		repo.logger.Error("query failed", zap.Error(err))
+		return nil, err
+	}
+
+	return &identity, nil
+}
+
+func (repo *identitiesRepository) List(ctx context.Context, filter *models.ManyIdentitiesFilter) ([]models.Identity, error) {
+	identities := []models.Identity{}
+
+	opt := options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}})
+	cursor, err := repo.coll.Find(ctx, bson.D{{Key: "account_id", Value: filter.AccountID}}, opt)
+	if err != nil {
+		repo.logger.Error("mongo find identities query failed", zap.Error(err))
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var elem models.Identity
+		err := cursor.Decode(&elem)
+		if err != nil {
+			repo.logger.Error("failed to decode mongo cursor result", zap.Error(err))
+			continue
+		}
+		identities = append(identities, elem)
+	}
+
+	return identities, nil
+}
+
+func (repo *identitiesRepository) Delete(ctx context.Context, filter *models.OneIdentityFilter) error {
+	delete, err := repo.coll.DeleteOne(ctx, filter)
+	if err != nil {
+		repo.logger.Error("delete failed", zap.Error(err))
+		return err
+	}
+	if delete.DeletedCount == 0 {
+		return models.ErrNotFound
+	}
+
+	return nil
+}
+
+func (repo *identitiesRepository) DeleteMany(ctx context.Context, filter *models.ManyIdentitiesFilter) error {
+	if filter.AccountID == "" {
+		return models.ErrEmptyFilter
+	}
+
+	_, err := repo.coll.DeleteMany(ctx, bson.D{{Key: "account_id", Value: filter.AccountID}})
+	if err != nil {
+		repo.logger.Error("delete many failed", zap.Error(err))
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,144 @@
+package mongo
+
+import (
+	"accounts-service/models"
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+)
+
+type loginRequestsRepository struct {
+	logger *zap.Logger
+	db     *mongo.Database
+	coll   *mongo.Collection
+}
+
+func NewLoginRequestsRepository(db *mongo.Database, logger *zap.Logger) models.LoginRequestsRepository {
+	rep := &loginRequestsRepository{
+		logger: logger.Named("mongo").Named("login-requests"),
+		db:     db,
+		coll:   db.Collection("login_requests"),
+	}
+
+	_, err := rep.coll.Indexes().CreateMany(
+		context.Background(),
+		[]mongo.IndexModel{
+			{
+				Keys:    bson.D{{Key: "expires_at", Value: 1}},
+				Options: options.Index().SetExpireAfterSeconds(0),
+			},
+		},
+	)
+	if err != nil {
+		rep.logger.Error("index creation failed", zap.Error(err))
+	}
+
+	return rep
+}
+
+func (repo *loginRequestsRepository) Create(ctx context.Context, payload *models.LoginRequestPayload) (*models.LoginRequest, error) {
+	request := models.LoginRequest{
+		ID:         payload.ID,
+		SecretHash: payload.SecretHash,
+		CreatedAt:  time.Now().UTC(),
+		ExpiresAt:  payload.ExpiresAt,
+		Device:     payload.Device,
+		IPAddress:  payload.IPAddress,
+		UserAgent:  payload.UserAgent,
+	}
+
+	_, err := repo.coll.InsertOne(ctx, request)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return nil, models.ErrDuplicateKeyFound
+		}
+		repo.logger.Error("insert failed", zap.Error(err))
+		return nil, err
+	}
+
+	return &request, nil
+}
+
+func (repo *loginRequestsRepository) Get(ctx context.Context, filter *models.OneLoginRequestFilter) (*models.LoginRequest, error) {
+	var request models.LoginRequest
+
+	err := repo.coll.FindOne(ctx, oneLoginRequestQuery(filter)).Decode(&request)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, models.ErrNotFound
+		}
+		repo.logger.Error("query failed", zap.Error(err))
+		return nil, err
+	}
+
+	return &request, nil
+}
+
+func (repo *loginRequestsRepository) Approve(ctx context.Context, filter *models.OneLoginRequestFilter, accountID string) (*models.LoginRequest, error) {
+	var request models.LoginRequest
+
+	query := append(oneLoginRequestQuery(filter), bson.E{Key: "account_id", Value: bson.D{{Key: "$exists", Value: false}}})
+	field := bson.D{{Key: "$set", Value: bson.D{{Key: "account_id", Value: accountID}}}}
+
+	err := repo.coll.FindOneAndUpdate(ctx, query, field, options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&request)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, models.ErrNotFound
+		}
+		repo.logger.Error("approve login request failed", zap.Error(err))
+		return nil, models.ErrUnknown
+	}
+
+	return &request, nil
+}
+
+func (repo *loginRequestsRepository) Poll(ctx context.Context, filter *models.OneLoginRequestFilter, expiresAt time.Time) (*models.LoginRequest, error) {
+	var request models.LoginRequest
+
+	field := bson.D{{Key: "$set", Value: bson.D{{Key: "expires_at", Value: expiresAt}}}}
+
+	err := repo.coll.FindOneAndUpdate(ctx, oneLoginRequestQuery(filter), field, options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&request)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, models.ErrNotFound
+		}
+		repo.logger.Error("poll login request failed", zap.Error(err))
+		return nil, models.ErrUnknown
+	}
+
+	return &request, nil
+}
+
+func (repo *loginRequestsRepository) Delete(ctx context.Context, filter *models.OneLoginRequestFilter) error {
+	delete, err := repo.coll.DeleteOne(ctx, filter)
+	if err != nil {
+		repo.logger.Error("delete failed", zap.Error(err))
+		return err
+	}
+	if delete.DeletedCount == 0 {
+		return models.ErrNotFound
+	}
+
+	return nil
+}
+
+// oneLoginRequestQuery matches the unexpired request described by
+// filter. The TTL index only removes expired documents periodically.
+func oneLoginRequestQuery(filter *models.OneLoginRequestFilter) bson.D {
+	query := bson.D{}
+	if filter.ID != "" {
+		query = append(query, bson.E{Key: "_id", Value: filter.ID})
+	}
+	if filter.SecretHash != "" {
+		query = append(query, bson.E{Key: "secret_hash", Value: filter.SecretHash})
+	}
+	if filter.AccountID != "" {
+		query = append(query, bson.E{Key: "account_id", Value: filter.AccountID})
+	}
+	return append(query, bson.E{Key: "expires_at", Value: bson.D{{Key: "$gt", Value: time.Now().UTC()}}})
+}
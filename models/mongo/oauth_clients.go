@@ -0,0 +1,67 @@
+package mongo
+
+import (
+	"accounts-service/models"
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jaevor/go-nanoid"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.uber.org/zap"
+)
+
+type oauthClientsRepository struct {
+	logger  *zap.Logger
+	db      *mongo.Database
+	coll    *mongo.Collection
+	newUUID func() string
+}
+
+func NewOAuthClientsRepository(db *mongo.Database, logger *zap.Logger) models.OAuthClientsRepository {
+	newUUID, err := nanoid.Standard(21)
+	if err != nil {
+		panic(err)
+	}
+
+	return &oauthClientsRepository{
+		logger:  logger.Named("mongo").Named("oauth-clients"),
+		db:      db,
+		coll:    db.Collection("oauth_clients"),
+		newUUID: newUUID,
+	}
+}
+
+func (repo *oauthClientsRepository) Create(ctx context.Context, payload *models.OAuthClientPayload) (*models.OAuthClient, error) {
+	client := models.OAuthClient{
+		ID:           repo.newUUID(),
+		Name:         payload.Name,
+		SecretHash:   payload.SecretHash,
+		RedirectURIs: payload.RedirectURIs,
+		Scopes:       payload.Scopes,
+		CreatedAt:    time.Now().UTC(),
+	}
+
+	_, err := repo.coll.InsertOne(ctx, client)
+	if err != nil {
+		repo.logger.Error("insert failed", zap.Error(err), zap.String("name", client.Name))
+		return nil, err
+	}
+
+	return &client, nil
+}
+
+func (repo *oauthClientsRepository) Get(ctx context.Context, filter *models.OneOAuthClientFilter) (*models.OAuthClient, error) {
+	var client models.OAuthClient
+
+	err := repo.coll.FindOne(ctx, filter).Decode(&client)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, models.ErrNotFound
+		}
+		repo.logger.Error("query failed", zap.Error(err))
+		return nil, err
+	}
+
+	return &client, nil
+}
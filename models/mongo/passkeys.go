@@ -0,0 +1,140 @@
+package mongo
+
+import (
+	"accounts-service/models"
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+)
+
+type passkeysRepository struct {
+	logger *zap.Logger
+	db     *mongo.Database
+	coll   *mongo.Collection
+}
+
+func NewPasskeysRepository(db *mongo.Database, logger *zap.Logger) models.PasskeysRepository {
+	rep := &passkeysRepository{
+		logger: logger.Named("mongo").Named("passkeys"),
+		db:     db,
+		coll:   db.Collection("passkeys"),
+	}
+
+	_, err := rep.coll.Indexes().CreateOne(
+		context.Background(),
+		mongo.IndexModel{
+			Keys: bson.D{{Key: "account_id", Value: 1}},
+		},
+	)
+	if err != nil {
+		rep.logger.Error("index creation failed", zap.Error(err))
+	}
+
+	return rep
+}
+
+func (repo *passkeysRepository) Create(ctx context.Context, payload *models.PasskeyPayload) (*models.Passkey, error) {
+	passkey := models.Passkey{
+		ID:        payload.ID,
+		AccountID: payload.AccountID,
+		Name:      payload.Name,
+		PublicKey: payload.PublicKey,
+		SignCount: payload.SignCount,
+		CreatedAt: time.Now().UTC(),
+	}
+
+	_, err := repo.coll.InsertOne(ctx, passkey)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return nil, models.ErrDuplicateKeyFound
+		}
+		repo.logger.Error("insert failed", zap.Error(err), zap.String("account_id", passkey.AccountID))
+		return nil, err
+	}
+
+	return &passkey, nil
+}
+
+func (repo *passkeysRepository) Get(ctx context.Context, filter *models.OnePasskeyFilter) (*models.Passkey, error) {
+	var passkey models.Passkey
+
+	err := repo.coll.FindOne(ctx, filter).Decode(&passkey)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, models.ErrNotFound
+		}
+		repo.logger.Error("query failed", zap.Error(err))
+		return nil, err
+	}
+
+	return &passkey, nil
+}
+
+func (repo *passkeysRepository) List(ctx context.Context, filter *models.ManyPasskeysFilter) ([]models.Passkey, error) {
+	passkeys := []models.Passkey{}
+
+	opt := options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}})
+	cursor, err := repo.coll.Find(ctx, bson.D{{Key: "account_id", Value: filter.AccountID}}, opt)
+	if err != nil {
+		repo.logger.Error("mongo find passkeys query failed", zap.Error(err))
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var elem models.Passkey
+		err := cursor.Decode(&elem)
+		if err != nil {
+			repo.logger.Error("failed to decode mongo cursor result", zap.Error(err))
+			continue
+		}
+		passkeys = append(passkeys, elem)
+	}
+
+	return passkeys, nil
+}
+
+func (repo *passkeysRepository) UpdateSignCount(ctx context.Context, filter *models.OnePasskeyFilter, signCount uint32) (*models.Passkey, error) {
+	var updatedPasskey models.Passkey
+
+	query := bson.D{{Key: "_id", Value: filter.ID}}
+	if signCount == 0 {
+		query = append(query, bson.E{Key: "sign_count", Value: 0})
+	} else {
+		query = append(query, bson.E{Key: "sign_count", Value: bson.D{{Key: "$lt", Value: signCount}}})
+	}
+	field := bson.D{{Key: "$set", Value: bson.D{
+		{Key: "sign_count", Value: signCount},
+		{Key: "last_used_at", Value: time.Now().UTC()},
+	}}}
+
+	err := repo.coll.FindOneAndUpdate(ctx, query, field, options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&updatedPasskey)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, models.ErrNotFound
+		}
+		repo.logger.Error("update passkey sign count failed", zap.Error(err))
+		return nil, models.ErrUnknown
+	}
+
+	return &updatedPasskey, nil
+}
+
+func (repo *passkeysRepository) DeleteMany(ctx context.Context, filter *models.ManyPasskeysFilter) error {
+	if filter.AccountID == "" {
+		return models.ErrEmptyFilter
+	}
+
+	_, err := repo.coll.DeleteMany(ctx, bson.D{{Key: "account_id", Value: filter.AccountID}})
+	if err != nil {
+		repo.logger.Error("delete many failed", zap.Error(err))
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,156 @@
+package mongo
+
+import (
+	"accounts-service/models"
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jaevor/go-nanoid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+)
+
+type personalAccessTokensRepository struct {
+	logger  *zap.Logger
+	db      *mongo.Database
+	coll    *mongo.Collection
+	newUUID func() string
+}
+
+func NewPersonalAccessTokensRepository(db *mongo.Database, logger *zap.Logger) models.PersonalAccessTokensRepository {
+	newUUID, err := nanoid.Standard(21)
+	if err != nil {
+		panic(err)
+	}
+
+	rep := &personalAccessTokensRepository{
+		logger:  logger.Named("mongo").Named("personal-access-tokens"),
+		db:      db,
+		coll:    db.Collection("personal_access_tokens"),
+		newUUID: newUUID,
+	}
+
+	_, err = rep.coll.Indexes().CreateMany(
+		context.Background(),
+		[]mongo.IndexModel{
+			{
+				Keys:    bson.D{{Key: "hash", Value: 1}},
+				Options: options.Index().SetUnique(true),
+			},
+			{
+				Keys: bson.D{{Key: "account_id", Value: 1}},
+			},
+			{
+				Keys:    bson.D{{Key: "expires_at", Value: 1}},
+				Options: options.Index().SetExpireAfterSeconds(0),
+			},
+		},
+	)
+	if err != nil {
+		rep.logger.Error("index creation failed", zap.Error(err))
+	}
+
+	return rep
+}
+
+func (repo *personalAccessTokensRepository) Create(ctx context.Context, payload *models.PersonalAccessTokenPayload) (*models.PersonalAccessToken, error) {
+	token := models.PersonalAccessToken{
+		ID:        repo.newUUID(),
+		AccountID: payload.AccountID,
+		Name:      payload.Name,
+		Hash:      payload.Hash,
+		Scopes:    payload.Scopes,
+		CreatedAt: time.Now().UTC(),
+		ExpiresAt: payload.ExpiresAt,
+	}
+
+	_, err := repo.coll.InsertOne(ctx, token)
+	if err != nil {
+		repo.logger.Error("insert failed", zap.Error(err), zap.String("account_id", token.AccountID))
+		return nil, err
+	}
+
+	return &token, nil
+}
+
+func (repo *personalAccessTokensRepository) List(ctx context.Context, filter *models.ManyPersonalAccessTokensFilter) ([]models.PersonalAccessToken, error) {
+	tokens := []models.PersonalAccessToken{}
+
+	opt := options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}})
+	cursor, err := repo.coll.Find(ctx, bson.D{{Key: "account_id", Value: filter.AccountID}}, opt)
+	if err != nil {
+		repo.logger.Error("mongo find personal access tokens query failed", zap.Error(err))
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var elem models.PersonalAccessToken
+		err := cursor.Decode(&elem)
+		if err != nil {
+			repo.logger.Error("failed to decode mongo cursor result", zap.Error(err))
+			continue
+		}
+		tokens = append(tokens, elem)
+	}
+
+	return tokens, nil
+}
+
+func (repo *personalAccessTokensRepository) Use(ctx context.Context, filter *models.OnePersonalAccessTokenFilter) (*models.PersonalAccessToken, error) {
+	var token models.PersonalAccessToken
+	now := time.Now().UTC()
+
+	// Expired tokens are only removed by the TTL index once a minute.
+	query := bson.D{
+		{Key: "$and", Value: bson.A{
+			filter,
+			bson.D{{Key: "$or", Value: bson.A{
+				bson.D{{Key: "expires_at", Value: bson.D{{Key: "$exists", Value: false}}}},
+				bson.D{{Key: "expires_at", Value: bson.D{{Key: "$gt", Value: now}}}},
+			}}},
+		}},
+	}
+	field := bson.D{{Key: "$set", Value: bson.D{{Key: "last_used_at", Value: now}}}}
+
+	err := repo.coll.FindOneAndUpdate(ctx, query, field, options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&token)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, models.ErrNotFound
+		}
+		repo.logger.Error("use personal access token failed", zap.Error(err))
+		return nil, models.ErrUnknown
+	}
+
+	return &token, nil
+}
+
+func (repo *personalAccessTokensRepository) Delete(ctx context.Context, filter *models.OnePersonalAccessTokenFilter) error {
+	delete, err := repo.coll.DeleteOne(ctx, filter)
+	if err != nil {
+		repo.logger.Error("delete failed", zap.Error(err))
+		return err
+	}
+	if delete.DeletedCount == 0 {
+		return models.ErrNotFound
+	}
+
+	return nil
+}
+
+func (repo *personalAccessTokensRepository) DeleteMany(ctx context.Context, filter *models.ManyPersonalAccessTokensFilter) error {
+	if filter.AccountID == "" {
+		return models.ErrEmptyFilter
+	}
+
+	_, err := repo.coll.DeleteMany(ctx, bson.D{{Key: "account_id", Value: filter.AccountID}})
+	if err != nil {
+		repo.logger.Error("delete many failed", zap.Error(err))
+		return err
+	}
+
+	return nil
+}
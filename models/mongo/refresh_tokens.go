@@ -0,0 +1,142 @@
+package mongo
+
+import (
+	"accounts-service/models"
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jaevor/go-nanoid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+)
+
+type refreshTokensRepository struct {
+	logger  *zap.Logger
+	db      *mongo.Database
+	coll    *mongo.Collection
+	newUUID func() string
+}
+
+func NewRefreshTokensRepository(db *mongo.Database, logger *zap.Logger) models.RefreshTokensRepository {
+	newUUID, err := nanoid.Standard(21)
+	if err != nil {
+		panic(err)
+	}
+
+	rep := &refreshTokensRepository{
+		logger:  logger.Named("mongo").Named("refresh-tokens"),
+		db:      db,
+		coll:    db.Collection("refresh_tokens"),
+		newUUID: newUUID,
+	}
+
+	_, err = rep.coll.Indexes().CreateMany(
+		context.Background(),
+		[]mongo.IndexModel{
+			{
+				Keys: bson.D{{Key: "family_id", Value: 1}},
+			},
+			{
+				Keys:    bson.D{{Key: "expires_at", Value: 1}},
+				Options: options.Index().SetExpireAfterSeconds(0),
+			},
+		},
+	)
+	if err != nil {
+		rep.logger.Error("index creation failed", zap.Error(err))
+	}
+
+	return rep
+}
+
+func (repo *refreshTokensRepository) Create(ctx context.Context, payload *models.RefreshTokenPayload) (*models.RefreshToken, error) {
+	token := models.RefreshToken{
+		ID:        payload.ID,
+		AccountID: payload.AccountID,
+		FamilyID:  payload.FamilyID,
+		CreatedAt: time.Now().UTC(),
+		ExpiresAt: payload.ExpiresAt,
+	}
+	if token.FamilyID == "" {
+		token.FamilyID = repo.newUUID()
+	}
+
+	_, err := repo.coll.InsertOne(ctx, token)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return nil, models.ErrDuplicateKeyFound
+		}
+		repo.logger.Error("insert failed", zap.Error(err), zap.String("account_id", token.AccountID))
+		return nil, err
+	}
+
+	return &token, nil
+}
+
+func (repo *refreshTokensRepository) Get(ctx context.Context, filter *models.OneRefreshTokenFilter) (*models.RefreshToken, error) {
+	var token models.RefreshToken
+
+	err := repo.coll.FindOne(ctx, filter).Decode(&token)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, models.ErrNotFound
+		}
+		repo.logger.Error("query failed", zap.Error(err))
+		return nil, err
+	}
+
+	return &token, nil
+}
+
+func (repo *refreshTokensRepository) Use(ctx context.Context, filter *models.OneRefreshTokenFilter) (*models.RefreshToken, error) {
+	var token models.RefreshToken
+	now := time.Now().UTC()
+
+	query := bson.D{
+		{Key: "_id", Value: filter.ID},
+		{Key: "used_at", Value: bson.D{{Key: "$exists", Value: false}}},
+		{Key: "expires_at", Value: bson.D{{Key: "$gt", Value: now}}},
+	}
+	field := bson.D{{Key: "$set", Value: bson.D{{Key: "used_at", Value: now}}}}
+
+	err := repo.coll.FindOneAndUpdate(ctx, query, field, options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&token)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, models.ErrNotFound
+		}
+		repo.logger.Error("use refresh token failed", zap.Error(err))
+		return nil, models.ErrUnknown
+	}
+
+	return &token, nil
+}
+
+func (repo *refreshTokensRepository) DeleteMany(ctx context.Context, filter *models.ManyRefreshTokensFilter) error {
+	if filter.AccountID == "" && filter.FamilyID == "" {
+		return models.ErrEmptyFilter
+	}
+
+	_, err := repo.coll.DeleteMany(ctx, manyRefreshTokensQuery(filter))
+	if err != nil {
+		repo.logger.Error("delete many failed", zap.Error(err))
+		return err
+	}
+
+	return nil
+}
+
+func manyRefreshTokensQuery(filter *models.ManyRefreshTokensFilter) bson.D {
+	query := bson.D{}
+	if filter.AccountID != "" {
+		query = append(query, bson.E{Key: "account_id", Value: filter.AccountID})
+	}
+	if filter.FamilyID != "" {
+		query = append(query, bson.E{Key: "family_id", Value: filter.FamilyID})
+	} else if filter.ExceptFamilyID != "" {
+		query = append(query, bson.E{Key: "family_id", Value: bson.D{{Key: "$ne", Value: filter.ExceptFamilyID}}})
+	}
+	return query
+}
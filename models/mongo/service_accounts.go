@@ -0,0 +1,84 @@
+package mongo
+
+import (
+	"accounts-service/models"
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jaevor/go-nanoid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+)
+
+type serviceAccountsRepository struct {
+	logger  *zap.Logger
+	db      *mongo.Database
+	coll    *mongo.Collection
+	newUUID func() string
+}
+
+func NewServiceAccountsRepository(db *mongo.Database, logger *zap.Logger) models.ServiceAccountsRepository {
+	newUUID, err := nanoid.Standard(21)
+	if err != nil {
+		panic(err)
+	}
+
+	rep := &serviceAccountsRepository{
+		logger:  logger.Named("mongo").Named("service-accounts"),
+		db:      db,
+		coll:    db.Collection("service_accounts"),
+		newUUID: newUUID,
+	}
+
+	_, err = rep.coll.Indexes().CreateOne(
+		context.Background(),
+		mongo.IndexModel{
+			Keys:    bson.D{{Key: "name", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+	)
+	if err != nil {
+		rep.logger.Error("index creation failed", zap.Error(err))
+	}
+
+	return rep
+}
+
+func (repo *serviceAccountsRepository) Create(ctx context.Context, payload *models.ServiceAccountPayload) (*models.ServiceAccount, error) {
+	serviceAccount := models.ServiceAccount{
+		ID:         repo.newUUID(),
+		Name:       payload.Name,
+		SecretHash: payload.SecretHash,
+		Scopes:     payload.Scopes,
+		CreatedAt:  time.Now().UTC(),
+	}
+
+	_, err := repo.coll.InsertOne(ctx, serviceAccount)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return nil, models.ErrDuplicateKeyFound
+		}
+		repo.logger.Error("insert failed", zap.Error(err), zap.String("name", serviceAccount.Name))
+		return nil, err
+	}
+
+	return &serviceAccount, nil
+}
+
+func (repo *serviceAccountsRepository) Get(ctx context.Context, filter *models.OneServiceAccountFilter) (*models.ServiceAccount, error) {
+	var serviceAccount models.ServiceAccount
+
+	err := repo.coll.FindOne(ctx, filter).Decode(&serviceAccount)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, models.ErrNotFound
+		}
+		repo.logger.Error("query failed", zap.Error(err))
+		return nil, err
+	}
+
+	return &serviceAccount, nil
+}
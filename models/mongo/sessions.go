@@ -0,0 +1,203 @@
+package mongo
+
+import (
+	"accounts-service/models"
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jaevor/go-nanoid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+)
+
+type sessionsRepository struct {
+	logger  *zap.Logger
+	db      *mongo.Database
+	coll    *mongo.Collection
+	newUUID func() string
+}
+
+func NewSessionsRepository(db *mongo.Database, logger *zap.Logger) models.SessionsRepository {
+	newUUID, err := nanoid.Standard(21)
+	if err != nil {
+		panic(err)
+	}
+
+	rep := &sessionsRepository{
+		logger:  logger.Named("mongo").Named("sessions"),
+		db:      db,
+		coll:    db.Collection("sessions"),
+		newUUID: newUUID,
+	}
+
+	_, err = rep.coll.Indexes().CreateMany(
+		context.Background(),
+		[]mongo.IndexModel{
+			{
+				Keys: bson.D{{Key: "account_id", Value: 1}},
+			},
+			{
+				Keys:    bson.D{{Key: "expires_at", Value: 1}},
+				Options: options.Index().SetExpireAfterSeconds(0),
+			},
+		},
+	)
+	if err != nil {
+		rep.logger.Error("index creation failed", zap.Error(err))
+	}
+
+	return rep
+}
+
+func (repo *sessionsRepository) Create(ctx context.Context, payload *models.SessionPayload) (*models.Session, error) {
+	now := time.Now().UTC()
+	session := models.Session{
+		ID:         repo.newUUID(),
+		AccountID:  payload.AccountID,
+		Device:     payload.Device,
+		IPAddress:  payload.IPAddress,
+		UserAgent:  payload.UserAgent,
+		ClientID:   payload.ClientID,
+		Scopes:     payload.Scopes,
+		CreatedAt:  now,
+		LastUsedAt: now,
+		ExpiresAt:  payload.ExpiresAt,
+
+		AuthenticatedAt: payload.AuthenticatedAt,
+		AuthMethods:     payload.AuthMethods,
+	}
+
+	_, err := repo.coll.InsertOne(ctx, session)
+	if err != nil {
+		repo.logger.Error("insert failed", zap.Error(err), zap.String("account_id", session.AccountID))
+		return nil, err
+	}
+
+	return &session, nil
+}
+
+func (repo *sessionsRepository) Get(ctx context.Context, filter *models.OneSessionFilter) (*models.Session, error) {
+	var session models.Session
+
+	err := repo.coll.FindOne(ctx, filter).Decode(&session)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, models.ErrNotFound
+		}
+		repo.logger.Error("query failed", zap.Error(err))
+		return nil, err
+	}
+
+	return &session, nil
+}
+
+func (repo *sessionsRepository) List(ctx context.Context, filter *models.ManySessionsFilter, pagination *models.Pagination) ([]models.Session, error) {
+	sessions := []models.Session{}
+
+	opt := options.Find().
+		SetLimit(pagination.Limit).
+		SetSkip(pagination.Offset).
+		SetSort(bson.D{{Key: "last_used_at", Value: -1}})
+	cursor, err := repo.coll.Find(ctx, manySessionsQuery(filter), opt)
+	if err != nil {
+		repo.logger.Error("mongo find sessions query failed", zap.Error(err))
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var elem models.Session
+		err := cursor.Decode(&elem)
+		if err != nil {
+			repo.logger.Error("failed to decode mongo cursor result", zap.Error(err))
+			continue
+		}
+		sessions = append(sessions, elem)
+	}
+
+	return sessions, nil
+}
+
+func (repo *sessionsRepository) UpdateLastUse(ctx context.Context, filter *models.OneSessionFilter, expiresAt time.Time) (*models.Session, error) {
+	var updatedSession models.Session
+
+	field := bson.D{{Key: "$set", Value: bson.D{
+		{Key: "last_used_at", Value: time.Now().UTC()},
+		{Key: "expires_at", Value: expiresAt},
+	}}}
+
+	err := repo.coll.FindOneAndUpdate(ctx, filter, field, options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&updatedSession)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, models.ErrNotFound
+		}
+		repo.logger.Error("update session last use failed", zap.Error(err))
+		return nil, models.ErrUnknown
+	}
+
+	return &updatedSession, nil
+}
+
+func (repo *sessionsRepository) Reauthenticate(ctx context.Context, filter *models.OneSessionFilter, methods []string) (*models.Session, error) {
+	var updatedSession models.Session
+
+	field := bson.D{{Key: "$set", Value: bson.D{
+		{Key: "authenticated_at", Value: time.Now().UTC()},
+		{Key: "auth_methods", Value: methods},
+	}}}
+
+	err := repo.coll.FindOneAndUpdate(ctx, filter, field, options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&updatedSession)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, models.ErrNotFound
+		}
+		repo.logger.Error("reauthenticate session failed", zap.Error(err))
+		return nil, models.ErrUnknown
+	}
+
+	return &updatedSession, nil
+}
+
+func (repo *sessionsRepository) Delete(ctx context.Context, filter *models.OneSessionFilter) error {
+	delete, err := repo.coll.DeleteOne(ctx, filter)
+	if err != nil {
+		repo.logger.Error("delete failed", zap.Error(err))
+		return err
+	}
+	if delete.DeletedCount == 0 {
+		return models.ErrNotFound
+	}
+
+	return nil
+}
+
+func (repo *sessionsRepository) DeleteMany(ctx context.Context, filter *models.ManySessionsFilter) error {
+	if filter.AccountID == "" {
+		return models.ErrEmptyFilter
+	}
+
+	_, err := repo.coll.DeleteMany(ctx, manySessionsQuery(filter))
+	if err != nil {
+		repo.logger.Error("delete many failed", zap.Error(err))
+		return err
+	}
+
+	return nil
+}
+
+func manySessionsQuery(filter *models.ManySessionsFilter) bson.D {
+	query := bson.D{}
+	if filter.AccountID != "" {
+		query = append(query, bson.E{Key: "account_id", Value: filter.AccountID})
+	}
+	if filter.ClientID != "" {
+		query = append(query, bson.E{Key: "client_id", Value: filter.ClientID})
+	}
+	if filter.ExceptID != "" {
+		query = append(query, bson.E{Key: "_id", Value: bson.D{{Key: "$ne", Value: filter.ExceptID}}})
+	}
+	return query
+}
@@ -0,0 +1,116 @@
+package mongo
+
+import (
+	"accounts-service/models"
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+)
+
+type throttlesRepository struct {
+	logger *zap.Logger
+	db     *mongo.Database
+	coll   *mongo.Collection
+}
+
+func NewThrottlesRepository(db *mongo.Database, logger *zap.Logger) models.ThrottlesRepository {
+	rep := &throttlesRepository{
+		logger: logger.Named("mongo").Named("throttles"),
+		db:     db,
+		coll:   db.Collection("throttles"),
+	}
+
+	_, err := rep.coll.Indexes().CreateOne(
+		context.Background(),
+		mongo.IndexModel{
+			Keys:    bson.D{{Key: "expires_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		},
+	)
+	if err != nil {
+		rep.logger.Error("index creation failed", zap.Error(err))
+	}
+
+	return rep
+}
+
+func (repo *throttlesRepository) Get(ctx context.Context, filter *models.OneThrottleFilter) (*models.Throttle, error) {
+	var throttle models.Throttle
+
+	query := bson.D{
+		{Key: "_id", Value: filter.ID},
+		{Key: "expires_at", Value: bson.D{{Key: "$gt", Value: time.Now().UTC()}}},
+	}
+
+	err := repo.coll.FindOne(ctx, query).Decode(&throttle)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, models.ErrNotFound
+		}
+		repo.logger.Error("query failed", zap.Error(err))
+		return nil, err
+	}
+
+	return &throttle, nil
+}
+
+func (repo *throttlesRepository) RecordFailure(ctx context.Context, filter *models.OneThrottleFilter, expiresAt time.Time) (*models.Throttle, error) {
+	var throttle models.Throttle
+	now := time.Now().UTC()
+
+	// An expired throttle which was not removed by the TTL index yet starts
+	// over from the first failure.
+	field := bson.A{
+		bson.D{{Key: "$set", Value: bson.D{
+			{Key: "failures", Value: bson.D{{Key: "$cond", Value: bson.A{
+				bson.D{{Key: "$gt", Value: bson.A{"$expires_at", now}}},
+				bson.D{{Key: "$add", Value: bson.A{"$failures", 1}}},
+				1,
+			}}}},
+			{Key: "previous_failure_at", Value: "$last_failure_at"},
+			{Key: "last_failure_at", Value: now},
+			{Key: "expires_at", Value: expiresAt},
+		}}},
+	}
+
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+	err := repo.coll.FindOneAndUpdate(ctx, bson.D{{Key: "_id", Value: filter.ID}}, field, opts).Decode(&throttle)
+	if err != nil {
+		repo.logger.Error("record failure failed", zap.Error(err))
+		return nil, models.ErrUnknown
+	}
+
+	return &throttle, nil
+}
+
+func (repo *throttlesRepository) CancelFailure(ctx context.Context, filter *models.OneThrottleFilter) error {
+	field := bson.A{
+		bson.D{{Key: "$set", Value: bson.D{
+			{Key: "failures", Value: bson.D{{Key: "$max", Value: bson.A{bson.D{{Key: "$subtract", Value: bson.A{"$failures", 1}}}, 0}}}},
+			{Key: "last_failure_at", Value: "$previous_failure_at"},
+		}}},
+	}
+
+	_, err := repo.coll.UpdateOne(ctx, bson.D{{Key: "_id", Value: filter.ID}}, field)
+	if err != nil {
+		repo.logger.Error("cancel failure failed", zap.Error(err))
+		return models.ErrUnknown
+	}
+
+	return nil
+}
+
+func (repo *throttlesRepository) Delete(ctx context.Context, filter *models.OneThrottleFilter) error {
+	_, err := repo.coll.DeleteOne(ctx, filter)
+	if err != nil {
+		repo.logger.Error("delete failed", zap.Error(err))
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,111 @@
+package mongo
+
+import (
+	"accounts-service/models"
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+)
+
+type verificationTokensRepository struct {
+	logger *zap.Logger
+	db     *mongo.Database
+	coll   *mongo.Collection
+}
+
+func NewVerificationTokensRepository(db *mongo.Database, logger *zap.Logger) models.VerificationTokensRepository {
+	rep := &verificationTokensRepository{
+		logger: logger.Named("mongo").Named("verification_tokens"),
+		db:     db,
+		coll:   db.Collection("verification_tokens"),
+	}
+
+	_, err := rep.coll.Indexes().CreateMany(
+		context.Background(),
+		[]mongo.IndexModel{
+			{
+				Keys: bson.D{{Key: "account_id", Value: 1}, {Key: "purpose", Value: 1}},
+			},
+			{
+				Keys:    bson.D{{Key: "expires_at", Value: 1}},
+				Options: options.Index().SetExpireAfterSeconds(0),
+			},
+		},
+	)
+	if err != nil {
+		rep.logger.Error("index creation failed", zap.Error(err))
+	}
+
+	return rep
+}
+
+func (repo *verificationTokensRepository) Create(ctx context.Context, payload *models.VerificationTokenPayload) (*models.VerificationToken, error) {
+	token := models.VerificationToken{
+		ID:        payload.ID,
+		Purpose:   payload.Purpose,
+		AccountID: payload.AccountID,
+		Email:     payload.Email,
+		CreatedAt: time.Now().UTC(),
+		ExpiresAt: payload.ExpiresAt,
+	}
+
+	_, err := repo.coll.InsertOne(ctx, token)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return nil, models.ErrDuplicateKeyFound
+		}
+		repo.logger.Error("insert failed", zap.Error(err), zap.String("account_id", token.AccountID))
+		return nil, err
+	}
+
+	return &token, nil
+}
+
+func (repo *verificationTokensRepository) Use(ctx context.Context, filter *models.OneVerificationTokenFilter) (*models.VerificationToken, error) {
+	var token models.VerificationToken
+
+	// The TTL index only removes expired documents periodically.
+	query := bson.D{
+		{Key: "_id", Value: filter.ID},
+		{Key: "purpose", Value: filter.Purpose},
+		{Key: "expires_at", Value: bson.D{{Key: "$gt", Value: time.Now().UTC()}}},
+	}
+	if filter.AccountID != "" {
+		query = append(query, bson.E{Key: "account_id", Value: filter.AccountID})
+	}
+
+	err := repo.coll.FindOneAndDelete(ctx, query).Decode(&token)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, models.ErrNotFound
+		}
+		repo.logger.Error("use verification token failed", zap.Error(err))
+		return nil, models.ErrUnknown
+	}
+
+	return &token, nil
+}
+
+func (repo *verificationTokensRepository) DeleteMany(ctx context.Context, filter *models.ManyVerificationTokensFilter) error {
+	if filter.AccountID == "" {
+		return models.ErrEmptyFilter
+	}
+
+	query := bson.D{{Key: "account_id", Value: filter.AccountID}}
+	if filter.Purpose != "" {
+		query = append(query, bson.E{Key: "purpose", Value: filter.Purpose})
+	}
+
+	_, err := repo.coll.DeleteMany(ctx, query)
+	if err != nil {
+		repo.logger.Error("delete many failed", zap.Error(err))
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,42 @@
+package models
+
+import (
+	"context"
+	"time"
+)
+
+// OAuthClient is a third-party app which users can authorize to act on
+// behalf of their account. Confidential clients authenticate with their ID
+// and a secret, of which only the hash is stored. Public clients, such as
+// browser extensions, cannot keep a secret and have none.
+type OAuthClient struct {
+	ID           string    `json:"id" bson:"_id,omitempty"`
+	Name         string    `json:"name" bson:"name"`
+	SecretHash   *string   `json:"secret_hash" bson:"secret_hash,omitempty"`
+	RedirectURIs []string  `json:"redirect_uris" bson:"redirect_uris"`
+	Scopes       []string  `json:"scopes" bson:"scopes"` // Scopes the client may request.
+	CreatedAt    time.Time `json:"created_at" bson:"created_at"`
+}
+
+// IsPublic reports whether the client has no secret.
+func (c *OAuthClient) IsPublic() bool {
+	return c.SecretHash == nil
+}
+
+type OAuthClientPayload struct {
+	Name         string
+	SecretHash   *string // Nil for public clients.
+	RedirectURIs []string
+	Scopes       []string
+}
+
+type OneOAuthClientFilter struct {
+	ID string `json:"id" bson:"_id,omitempty"`
+}
+
+// OAuthClientsRepository is safe for use in multiple goroutines.
+type OAuthClientsRepository interface {
+	Create(ctx context.Context, payload *OAuthClientPayload) (*OAuthClient, error)
+
+	Get(ctx context.Context, filter *OneOAuthClientFilter) (*OAuthClient, error)
+}
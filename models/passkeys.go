@@ -0,0 +1,52 @@
+package models
+
+import (
+	"context"
+	"time"
+)
+
+// Passkey is a WebAuthn credential registered to log in to an account
+// without a password.
+type Passkey struct {
+	ID         string     `json:"id" bson:"_id,omitempty"` // Base64url encoded credential ID.
+	AccountID  string     `json:"account_id" bson:"account_id"`
+	Name       string     `json:"name" bson:"name,omitempty"`
+	PublicKey  []byte     `json:"public_key" bson:"public_key"` // COSE encoded.
+	SignCount  uint32     `json:"sign_count" bson:"sign_count"`
+	CreatedAt  time.Time  `json:"created_at" bson:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at" bson:"last_used_at,omitempty"`
+}
+
+type PasskeyPayload struct {
+	ID        string
+	AccountID string
+	Name      string
+	PublicKey []byte
+	SignCount uint32
+}
+
+type OnePasskeyFilter struct {
+	ID        string `json:"id" bson:"_id,omitempty"`
+	AccountID string `json:"account_id" bson:"account_id,omitempty"`
+}
+
+type ManyPasskeysFilter struct {
+	AccountID string
+}
+
+// PasskeysRepository is safe for use in multiple goroutines.
+type PasskeysRepository interface {
+	Create(ctx context.Context, payload *PasskeyPayload) (*Passkey, error)
+
+	Get(ctx context.Context, filter *OnePasskeyFilter) (*Passkey, error)
+
+	List(ctx context.Context, filter *ManyPasskeysFilter) ([]Passkey, error)
+
+	// UpdateSignCount atomically replaces the signature counter of a passkey
+	// with a greater one, or with zero if the authenticator does not
+	// implement it. ErrNotFound is returned if the counter was updated
+	// concurrently.
+	UpdateSignCount(ctx context.Context, filter *OnePasskeyFilter, signCount uint32) (*Passkey, error)
+
+	DeleteMany(ctx context.Context, filter *ManyPasskeysFilter) error
+}
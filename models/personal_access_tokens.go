@@ -0,0 +1,52 @@
+package models
+
+import (
+	"context"
+	"time"
+)
+
+// PersonalAccessToken is a long-lived credential created by a user for their
+// scripts, limited to a set of scopes. Only the hash of the token is stored.
+type PersonalAccessToken struct {
+	ID         string     `json:"id" bson:"_id,omitempty"`
+	AccountID  string     `json:"account_id" bson:"account_id"`
+	Name       string     `json:"name" bson:"name"`
+	Hash       string     `json:"hash" bson:"hash"`
+	Scopes     []string   `json:"scopes" bson:"scopes"`
+	CreatedAt  time.Time  `json:"created_at" bson:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at" bson:"expires_at,omitempty"` // Never expires when nil.
+	LastUsedAt *time.Time `json:"last_used_at" bson:"last_used_at,omitempty"`
+}
+
+type PersonalAccessTokenPayload struct {
+	AccountID string
+	Name      string
+	Hash      string
+	Scopes    []string
+	ExpiresAt *time.Time
+}
+
+type OnePersonalAccessTokenFilter struct {
+	ID        string `json:"id" bson:"_id,omitempty"`
+	AccountID string `json:"account_id" bson:"account_id,omitempty"`
+	Hash      string `json:"hash" bson:"hash,omitempty"`
+}
+
+type ManyPersonalAccessTokensFilter struct {
+	AccountID string
+}
+
+// PersonalAccessTokensRepository is safe for use in multiple goroutines.
+type PersonalAccessTokensRepository interface {
+	Create(ctx context.Context, payload *PersonalAccessTokenPayload) (*PersonalAccessToken, error)
+
+	List(ctx context.Context, filter *ManyPersonalAccessTokensFilter) ([]PersonalAccessToken, error)
+
+	// Use atomically records the use of an unexpired token and returns it.
+	// ErrNotFound is returned if no such token exists.
+	Use(ctx context.Context, filter *OnePersonalAccessTokenFilter) (*PersonalAccessToken, error)
+
+	Delete(ctx context.Context, filter *OnePersonalAccessTokenFilter) error
+
+	DeleteMany(ctx context.Context, filter *ManyPersonalAccessTokensFilter) error
+}
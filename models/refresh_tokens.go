@@ -0,0 +1,48 @@
+package models
+
+import (
+	"context"
+	"time"
+)
+
+// RefreshToken is a single-use credential exchanged for a new access token.
+// Each exchange consumes the token and issues a new one in the same family,
+// so that the reuse of a consumed token reveals that it was stolen.
+type RefreshToken struct {
+	ID        string     `json:"id" bson:"_id,omitempty"` // Hash of the token.
+	AccountID string     `json:"account_id" bson:"account_id"`
+	FamilyID  string     `json:"family_id" bson:"family_id"`
+	CreatedAt time.Time  `json:"created_at" bson:"created_at"`
+	ExpiresAt time.Time  `json:"expires_at" bson:"expires_at"`
+	UsedAt    *time.Time `json:"used_at" bson:"used_at,omitempty"`
+}
+
+type RefreshTokenPayload struct {
+	ID        string
+	AccountID string
+	FamilyID  string // A new family is started when left empty.
+	ExpiresAt time.Time
+}
+
+type OneRefreshTokenFilter struct {
+	ID string `json:"id" bson:"_id,omitempty"`
+}
+
+type ManyRefreshTokensFilter struct {
+	AccountID      string
+	FamilyID       string
+	ExceptFamilyID string
+}
+
+// RefreshTokensRepository is safe for use in multiple goroutines.
+type RefreshTokensRepository interface {
+	Create(ctx context.Context, payload *RefreshTokenPayload) (*RefreshToken, error)
+
+	Get(ctx context.Context, filter *OneRefreshTokenFilter) (*RefreshToken, error)
+
+	// Use atomically marks an unused and unexpired refresh token as used and
+	// returns it. ErrNotFound is returned if no such token exists.
+	Use(ctx context.Context, filter *OneRefreshTokenFilter) (*RefreshToken, error)
+
+	DeleteMany(ctx context.Context, filter *ManyRefreshTokensFilter) error
+}
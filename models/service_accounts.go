@@ -0,0 +1,33 @@
+package models
+
+import (
+	"context"
+	"time"
+)
+
+// ServiceAccount is the machine identity of another Noted service. It
+// authenticates with its ID and a secret, of which only the hash is stored.
+type ServiceAccount struct {
+	ID         string    `json:"id" bson:"_id,omitempty"`
+	Name       string    `json:"name" bson:"name"`
+	SecretHash string    `json:"secret_hash" bson:"secret_hash"`
+	Scopes     []string  `json:"scopes" bson:"scopes"`
+	CreatedAt  time.Time `json:"created_at" bson:"created_at"`
+}
+
+type ServiceAccountPayload struct {
+	Name       string
+	SecretHash string
+	Scopes     []string
+}
+
+type OneServiceAccountFilter struct {
+	ID string `json:"id" bson:"_id,omitempty"`
+}
+
+// ServiceAccountsRepository is safe for use in multiple goroutines.
+type ServiceAccountsRepository interface {
+	Create(ctx context.Context, payload *ServiceAccountPayload) (*ServiceAccount, error)
+
+	Get(ctx context.Context, filter *OneServiceAccountFilter) (*ServiceAccount, error)
+}
@@ -0,0 +1,74 @@
+package models
+
+import (
+	"context"
+	"time"
+)
+
+// Session is a login of an account on a given client. The refresh tokens
+// issued for a session all belong to the family identified by the session ID.
+// The sessions of the third-party apps authorized by the account carry the
+// ID of the app and the scopes it was granted.
+type Session struct {
+	ID         string    `json:"id" bson:"_id,omitempty"`
+	AccountID  string    `json:"account_id" bson:"account_id"`
+	Device     string    `json:"device" bson:"device,omitempty"`
+	IPAddress  string    `json:"ip_address" bson:"ip_address,omitempty"`
+	UserAgent  string    `json:"user_agent" bson:"user_agent,omitempty"`
+	ClientID   string    `json:"client_id" bson:"client_id,omitempty"`
+	Scopes     []string  `json:"scopes" bson:"scopes,omitempty"`
+	CreatedAt  time.Time `json:"created_at" bson:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at" bson:"last_used_at"`
+	ExpiresAt  time.Time `json:"expires_at" bson:"expires_at"`
+
+	// Last time the session proved a credential of the account, with the
+	// methods of auth.Token. Zero for the sessions approved from another
+	// device, which never did.
+	AuthenticatedAt time.Time `json:"authenticated_at" bson:"authenticated_at,omitempty"`
+	AuthMethods     []string  `json:"auth_methods" bson:"auth_methods,omitempty"`
+}
+
+type SessionPayload struct {
+	AccountID string
+	Device    string
+	IPAddress string
+	UserAgent string
+	ClientID  string
+	Scopes    []string
+	ExpiresAt time.Time
+
+	AuthenticatedAt time.Time
+	AuthMethods     []string
+}
+
+type OneSessionFilter struct {
+	ID        string `json:"id" bson:"_id,omitempty"`
+	AccountID string `json:"account_id" bson:"account_id,omitempty"`
+}
+
+type ManySessionsFilter struct {
+	AccountID string
+	ClientID  string
+	ExceptID  string // Excludes a session, usually the one of the caller.
+}
+
+// SessionsRepository is safe for use in multiple goroutines.
+type SessionsRepository interface {
+	Create(ctx context.Context, payload *SessionPayload) (*Session, error)
+
+	Get(ctx context.Context, filter *OneSessionFilter) (*Session, error)
+
+	List(ctx context.Context, filter *ManySessionsFilter, pagination *Pagination) ([]Session, error)
+
+	// UpdateLastUse records that the session has just been used and extends
+	// its expiration date.
+	UpdateLastUse(ctx context.Context, filter *OneSessionFilter, expiresAt time.Time) (*Session, error)
+
+	// Reauthenticate records that the session has just proved a credential
+	// of the account with methods.
+	Reauthenticate(ctx context.Context, filter *OneSessionFilter, methods []string) (*Session, error)
+
+	Delete(ctx context.Context, filter *OneSessionFilter) error
+
+	DeleteMany(ctx context.Context, filter *ManySessionsFilter) error
+}
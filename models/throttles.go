@@ -0,0 +1,38 @@
+package models
+
+import (
+	"context"
+	"time"
+)
+
+// Throttle counts the consecutive failed attempts to prove a credential,
+// either for an account or from an IP address.
+type Throttle struct {
+	ID                string    `json:"id" bson:"_id,omitempty"`
+	Failures          int       `json:"failures" bson:"failures"`
+	LastFailureAt     time.Time `json:"last_failure_at" bson:"last_failure_at"`
+	PreviousFailureAt time.Time `json:"previous_failure_at" bson:"previous_failure_at"`
+	ExpiresAt         time.Time `json:"expires_at" bson:"expires_at"`
+}
+
+type OneThrottleFilter struct {
+	ID string `json:"id" bson:"_id,omitempty"`
+}
+
+// ThrottlesRepository is safe for use in multiple goroutines.
+type ThrottlesRepository interface {
+	Get(ctx context.Context, filter *OneThrottleFilter) (*Throttle, error)
+
+	// RecordFailure atomically counts a failure, creating the throttle if
+	// needed, and returns the updated throttle. The throttle is forgotten at
+	// expiresAt unless another failure is recorded. PreviousFailureAt keeps
+	// the time of the failure before, so that the caller can tell whether
+	// the throttle was locked when the failure was counted.
+	RecordFailure(ctx context.Context, filter *OneThrottleFilter, expiresAt time.Time) (*Throttle, error)
+
+	// CancelFailure atomically uncounts the last failure recorded, for
+	// attempts which turned out not to fail.
+	CancelFailure(ctx context.Context, filter *OneThrottleFilter) error
+
+	Delete(ctx context.Context, filter *OneThrottleFilter) error
+}
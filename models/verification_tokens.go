@@ -0,0 +1,63 @@
+package models
+
+import (
+	"context"
+	"time"
+)
+
+const (
+	// Emailed on sign up to prove that the email belongs to the owner of
+	// the account.
+	VerificationPurposeValidateEmail = "validate_email"
+	// Emailed to reset a forgotten password.
+	VerificationPurposeResetPassword = "reset_password"
+	// Handed in exchange for a reset password code, to update the password
+	// once.
+	VerificationPurposeResetPasswordToken = "reset_password_token"
+	// Emailed to the new address of an account to confirm that it can be
+	// used in place of the current one.
+	VerificationPurposeChangeEmail = "change_email"
+)
+
+// VerificationToken is a single-use secret sent out of band to prove that
+// the owner of an account can read its email.
+type VerificationToken struct {
+	ID        string    `json:"id" bson:"_id,omitempty"` // Hash of the token.
+	Purpose   string    `json:"purpose" bson:"purpose"`
+	AccountID string    `json:"account_id" bson:"account_id"`
+	Email     string    `json:"email" bson:"email,omitempty"` // Address the token was sent to, if not the one of the account.
+	CreatedAt time.Time `json:"created_at" bson:"created_at"`
+	ExpiresAt time.Time `json:"expires_at" bson:"expires_at"`
+}
+
+type VerificationTokenPayload struct {
+	ID        string
+	Purpose   string
+	AccountID string
+	Email     string
+	ExpiresAt time.Time
+}
+
+// OneVerificationTokenFilter always matches on Purpose, so that a token
+// cannot be used for another purpose than the one it was created for.
+type OneVerificationTokenFilter struct {
+	ID        string
+	Purpose   string
+	AccountID string
+}
+
+type ManyVerificationTokensFilter struct {
+	Purpose   string
+	AccountID string
+}
+
+// VerificationTokensRepository is safe for use in multiple goroutines.
+type VerificationTokensRepository interface {
+	Create(ctx context.Context, payload *VerificationTokenPayload) (*VerificationToken, error)
+
+	// Use atomically deletes an unexpired verification token and returns it.
+	// ErrNotFound is returned if no such token exists.
+	Use(ctx context.Context, filter *OneVerificationTokenFilter) (*VerificationToken, error)
+
+	DeleteMany(ctx context.Context, filter *ManyVerificationTokensFilter) error
+}
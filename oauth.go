@@ -0,0 +1,421 @@
+package main
+
+import (
+	"accounts-service/auth"
+	"accounts-service/models"
+	"accounts-service/models/mongo"
+	accountsv1 "accounts-service/protorepo/noted/accounts/v1"
+	"accounts-service/validators"
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/oauth2"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const (
+	// Paths under the issuer at which the gateway exposes the authorization
+	// server to third-party apps.
+	oauthTokenPath    = "/oauth/token"
+	oauthUserInfoPath = "/oauth/userinfo"
+	oauthJWKSPath     = "/.well-known/jwks.json"
+
+	oauthGrantTypeAuthorizationCode = "authorization_code"
+	oauthGrantTypeRefreshToken      = "refresh_token"
+)
+
+var (
+	errInvalidOAuthClient = status.Error(codes.Unauthenticated, "invalid client credentials")
+	errInvalidOAuthGrant  = status.Error(codes.InvalidArgument, "invalid or expired grant")
+)
+
+// AuthorizeOAuthClient is called by the page of the frontend to which
+// third-party apps send users to authorize them. Unless the account already
+// consented to the requested scopes, the page must show them to the user
+// and call it again with Approve once they agree. The user is then sent
+// back to the app with an authorization code, which the app exchanges for
+// tokens with ExchangeOAuthToken.
+func (srv *accountsAPI) AuthorizeOAuthClient(ctx context.Context, in *accountsv1.AuthorizeOAuthClientRequest) (*accountsv1.AuthorizeOAuthClientResponse, error) {
+	token, err := srv.principal(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	err = validators.ValidateAuthorizeOAuthClientRequest(in)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	client, err := srv.oauthClients.Get(ctx, &models.OneOAuthClientFilter{ID: in.ClientId})
+	if err != nil {
+		return nil, statusFromModelError(err)
+	}
+	if !containsAll(client.RedirectURIs, []string{in.RedirectUri}) {
+		return nil, status.Error(codes.InvalidArgument, "redirect uri not registered by the client")
+	}
+	scopes := strings.Fields(in.Scope)
+	if !containsAll(client.Scopes, scopes) {
+		return nil, status.Error(codes.InvalidArgument, "scope not allowed for the client")
+	}
+
+	acc, err := srv.repo.Get(ctx, &models.OneAccountFilter{ID: token.AccountID})
+	if err != nil {
+		return nil, statusFromModelError(err)
+	}
+	if acc.IsSuspended() {
+		return nil, status.Error(codes.PermissionDenied, "account suspended")
+	}
+
+	consent, err := srv.consents.Get(ctx, &models.OneConsentFilter{AccountID: acc.ID, ClientID: client.ID})
+	if err != nil && !errors.Is(err, models.ErrNotFound) {
+		return nil, statusFromModelError(err)
+	}
+	if consent == nil || !containsAll(consent.Scopes, scopes) {
+		if !in.Approve {
+			return &accountsv1.AuthorizeOAuthClientResponse{ConsentRequired: true, ClientName: client.Name, Scopes: scopes}, nil
+		}
+		_, err = srv.consents.Grant(ctx, &models.ConsentPayload{AccountID: acc.ID, ClientID: client.ID, Scopes: scopes})
+		if err != nil {
+			return nil, statusFromModelError(err)
+		}
+	}
+
+	code, err := srv.createChallengeWithData(ctx, models.ChallengePurposeOAuthCode, acc.ID, map[string]string{
+		"client_id":      client.ID,
+		"redirect_uri":   in.RedirectUri,
+		"scope":          strings.Join(scopes, " "),
+		"nonce":          in.Nonce,
+		"code_challenge": in.CodeChallenge,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	redirectURL, err := url.Parse(in.RedirectUri)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid redirect uri")
+	}
+	query := redirectURL.Query()
+	query.Set("code", code)
+	if in.State != "" {
+		query.Set("state", in.State)
+	}
+	redirectURL.RawQuery = query.Encode()
+
+	return &accountsv1.AuthorizeOAuthClientResponse{RedirectUrl: redirectURL.String(), ClientName: client.Name, Scopes: scopes}, nil
+}
+
+// ExchangeOAuthToken is the token endpoint of the authorization server. It
+// redeems an authorization code or a refresh token of a third-party app for
+// an access token limited to the scopes granted to the app. Each code
+// exchange starts a session which the user can revoke along with the app.
+func (srv *accountsAPI) ExchangeOAuthToken(ctx context.Context, in *accountsv1.ExchangeOAuthTokenRequest) (*accountsv1.ExchangeOAuthTokenResponse, error) {
+	err := validators.ValidateExchangeOAuthTokenRequest(in)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	client, err := srv.authenticateOAuthClient(ctx, in.ClientId, in.ClientSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	if in.GrantType == oauthGrantTypeRefreshToken {
+		session, err := srv.useRefreshToken(ctx, in.RefreshToken)
+		if err != nil {
+			return nil, err
+		}
+		// The token was consumed all the same, so that the next use of the
+		// token by the client it leaked from revokes the session.
+		if session.ClientID != client.ID {
+			return nil, errInvalidOAuthGrant
+		}
+		return srv.issueOAuthTokens(ctx, client, session, nil)
+	}
+
+	challenge, err := srv.challenges.Use(ctx, &models.OneChallengeFilter{ID: auth.HashSecret(in.Code), Purpose: models.ChallengePurposeOAuthCode})
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			return nil, errInvalidOAuthGrant
+		}
+		return nil, statusFromModelError(err)
+	}
+	if challenge.Data["client_id"] != client.ID || challenge.Data["redirect_uri"] != in.RedirectUri {
+		return nil, errInvalidOAuthGrant
+	}
+	if subtle.ConstantTimeCompare([]byte(oauth2.S256ChallengeFromVerifier(in.CodeVerifier)), []byte(challenge.Data["code_challenge"])) != 1 {
+		return nil, errInvalidOAuthGrant
+	}
+
+	payload := srv.clientInfo(ctx)
+	payload.AccountID = challenge.AccountID
+	payload.Device = client.Name
+	payload.ClientID = client.ID
+	payload.Scopes = strings.Fields(challenge.Data["scope"])
+	payload.ExpiresAt = time.Now().UTC().Add(srv.refreshTokenLifetime)
+	session, err := srv.sessions.Create(ctx, payload)
+	if err != nil {
+		return nil, statusFromModelError(err)
+	}
+
+	return srv.issueOAuthTokens(ctx, client, session, challenge)
+}
+
+// GetOAuthUserInfo is the userinfo endpoint of OpenID Connect. It describes
+// the account which authorized the app within the scopes of the token.
+func (srv *accountsAPI) GetOAuthUserInfo(ctx context.Context, in *accountsv1.GetOAuthUserInfoRequest) (*accountsv1.GetOAuthUserInfoResponse, error) {
+	token, err := srv.principal(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	acc, err := srv.repo.Get(ctx, &models.OneAccountFilter{ID: token.AccountID})
+	if err != nil {
+		return nil, statusFromModelError(err)
+	}
+
+	res := &accountsv1.GetOAuthUserInfoResponse{Sub: acc.ID}
+	if token.HasScope(auth.ScopeProfile) {
+		res.Name = *acc.Name
+	}
+	if token.HasScope(auth.ScopeEmail) {
+		res.Email = *acc.Email
+		res.EmailVerified = acc.IsValidated
+	}
+
+	return res, nil
+}
+
+// GetOpenIDConfiguration is the discovery document of the authorization
+// server.
+func (srv *accountsAPI) GetOpenIDConfiguration(ctx context.Context, in *accountsv1.GetOpenIDConfigurationRequest) (*accountsv1.GetOpenIDConfigurationResponse, error) {
+	issuer := strings.TrimSuffix(srv.oauthIssuer, "/")
+	return &accountsv1.GetOpenIDConfigurationResponse{
+		Issuer:                            issuer,
+		AuthorizationEndpoint:             srv.oauthConsentURL,
+		TokenEndpoint:                     issuer + oauthTokenPath,
+		UserinfoEndpoint:                  issuer + oauthUserInfoPath,
+		JwksUri:                           issuer + oauthJWKSPath,
+		ScopesSupported:                   auth.DelegableScopes,
+		ResponseTypesSupported:            []string{"code"},
+		GrantTypesSupported:               []string{oauthGrantTypeAuthorizationCode, oauthGrantTypeRefreshToken},
+		SubjectTypesSupported:             []string{"public"},
+		IdTokenSigningAlgValuesSupported:  []string{"EdDSA"},
+		CodeChallengeMethodsSupported:     []string{"S256"},
+		TokenEndpointAuthMethodsSupported: []string{"client_secret_post", "none"},
+	}, nil
+}
+
+// ListAuthorizedApps lists the third-party apps the account consented to.
+func (srv *accountsAPI) ListAuthorizedApps(ctx context.Context, in *accountsv1.ListAuthorizedAppsRequest) (*accountsv1.ListAuthorizedAppsResponse, error) {
+	token, err := srv.principal(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	err = validators.ValidateListAuthorizedAppsRequest(in)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	acc, err := srv.getOwnAccount(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	consents, err := srv.consents.List(ctx, &models.ManyConsentsFilter{AccountID: acc.ID})
+	if err != nil {
+		return nil, statusFromModelError(err)
+	}
+
+	apps := []*accountsv1.AuthorizedApp{}
+	for i := range consents {
+		client, err := srv.oauthClients.Get(ctx, &models.OneOAuthClientFilter{ID: consents[i].ClientID})
+		if err != nil {
+			if errors.Is(err, models.ErrNotFound) {
+				continue
+			}
+			return nil, statusFromModelError(err)
+		}
+		apps = append(apps, &accountsv1.AuthorizedApp{
+			ClientId:   client.ID,
+			Name:       client.Name,
+			Scopes:     consents[i].Scopes,
+			CreateTime: timestamppb.New(consents[i].CreatedAt),
+		})
+	}
+
+	return &accountsv1.ListAuthorizedAppsResponse{Apps: apps}, nil
+}
+
+// RevokeAuthorizedApp withdraws the consent of the account to the app and
+// revokes all the sessions of the app. The tokens of the app are rejected
+// from then on and the user is asked again for consent.
+func (srv *accountsAPI) RevokeAuthorizedApp(ctx context.Context, in *accountsv1.RevokeAuthorizedAppRequest) (*accountsv1.RevokeAuthorizedAppResponse, error) {
+	token, err := srv.principal(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	err = validators.ValidateRevokeAuthorizedAppRequest(in)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	acc, err := srv.getOwnAccount(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	err = srv.consents.Delete(ctx, &models.OneConsentFilter{AccountID: acc.ID, ClientID: in.ClientId})
+	if err != nil {
+		return nil, statusFromModelError(err)
+	}
+
+	sessions, err := srv.sessions.List(ctx, &models.ManySessionsFilter{AccountID: acc.ID, ClientID: in.ClientId}, &models.Pagination{})
+	if err != nil {
+		return nil, statusFromModelError(err)
+	}
+	for _, session := range sessions {
+		err = srv.revokeSession(ctx, &models.OneSessionFilter{ID: session.ID})
+		if err != nil && !errors.Is(err, models.ErrNotFound) {
+			return nil, statusFromModelError(err)
+		}
+	}
+
+	return &accountsv1.RevokeAuthorizedAppResponse{}, nil
+}
+
+// authenticateOAuthClient checks the secret of confidential clients. Public
+// clients prove that they started the authorization with PKCE instead.
+func (srv *accountsAPI) authenticateOAuthClient(ctx context.Context, clientID string, clientSecret string) (*models.OAuthClient, error) {
+	client, err := srv.oauthClients.Get(ctx, &models.OneOAuthClientFilter{ID: clientID})
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			return nil, errInvalidOAuthClient
+		}
+		return nil, statusFromModelError(err)
+	}
+
+	if client.IsPublic() {
+		if clientSecret != "" {
+			return nil, errInvalidOAuthClient
+		}
+		return client, nil
+	}
+	if subtle.ConstantTimeCompare([]byte(*client.SecretHash), []byte(auth.HashSecret(clientSecret))) != 1 {
+		return nil, errInvalidOAuthClient
+	}
+	return client, nil
+}
+
+// issueOAuthTokens signs an access token limited to the scopes of session,
+// along with a refresh token of the session. When the tokens are issued for
+// an authorization code of the openid scope, an ID token carrying the nonce
+// of the authorization is issued as well.
+func (srv *accountsAPI) issueOAuthTokens(ctx context.Context, client *models.OAuthClient, session *models.Session, code *models.Challenge) (*accountsv1.ExchangeOAuthTokenResponse, error) {
+	acc, err := srv.repo.Get(ctx, &models.OneAccountFilter{ID: session.AccountID})
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			return nil, errInvalidOAuthGrant
+		}
+		return nil, statusFromModelError(err)
+	}
+	if acc.IsSuspended() {
+		return nil, status.Error(codes.PermissionDenied, "account suspended")
+	}
+
+	token := &auth.Token{AccountID: acc.ID, SessionID: session.ID, ClientID: client.ID, Scopes: session.Scopes}
+	token.ExpiresAt = time.Now().Add(srv.accessTokenLifetime).Unix()
+	accessToken, err := srv.auth.SignToken(token)
+	if err != nil {
+		srv.logger.Error("failed to sign app token", zap.Error(err))
+		return nil, status.Error(codes.Internal, "failed to issue token")
+	}
+
+	refreshToken, err := srv.createRefreshToken(ctx, acc.ID, session.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &accountsv1.ExchangeOAuthTokenResponse{
+		AccessToken:  accessToken,
+		TokenType:    auth.AuthorizationHeaderPrefix,
+		ExpiresIn:    int32(srv.accessTokenLifetime.Seconds()),
+		RefreshToken: refreshToken,
+		Scope:        strings.Join(session.Scopes, " "),
+	}
+
+	if code != nil && token.HasScope(auth.ScopeOpenID) {
+		idToken := &auth.IDToken{Nonce: code.Data["nonce"]}
+		idToken.Issuer = strings.TrimSuffix(srv.oauthIssuer, "/")
+		idToken.Subject = acc.ID
+		idToken.Audience = client.ID
+		if token.HasScope(auth.ScopeProfile) {
+			idToken.Name = *acc.Name
+		}
+		if token.HasScope(auth.ScopeEmail) {
+			idToken.Email = *acc.Email
+			idToken.EmailVerified = acc.IsValidated
+		}
+		res.IdToken, err = srv.auth.SignIDToken(idToken)
+		if err != nil {
+			srv.logger.Error("failed to sign id token", zap.Error(err))
+			return nil, status.Error(codes.Internal, "failed to issue token")
+		}
+	}
+
+	return res, nil
+}
+
+// containsAll reports whether every element of subset is in set.
+func containsAll(set []string, subset []string) bool {
+	for _, s := range subset {
+		found := false
+		for _, e := range set {
+			found = found || e == s
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// createOAuthClient registers a third-party app and prints its credentials.
+// The secret of confidential clients is not stored and cannot be shown again.
+func createOAuthClient(name string, redirectURIs []string, scopes []string, public bool) {
+	for _, uri := range redirectURIs {
+		must(validators.ValidateOAuthRedirectURI(uri), "invalid redirect uri "+uri)
+	}
+
+	logger := zap.NewNop()
+	db, err := mongo.NewDatabase(context.Background(), *mongoUri, *mongoDbName, logger)
+	must(err, "could not instantiate mongo database")
+	defer db.Disconnect(context.Background())
+
+	payload := &models.OAuthClientPayload{Name: name, RedirectURIs: redirectURIs, Scopes: scopes}
+	secret := ""
+	if !public {
+		secret, err = auth.GenerateSecret(32)
+		must(err, "could not generate client secret")
+		hash := auth.HashSecret(secret)
+		payload.SecretHash = &hash
+	}
+
+	client, err := mongo.NewOAuthClientsRepository(db.DB, logger).Create(context.Background(), payload)
+	must(err, "could not create oauth client")
+
+	fmt.Printf("client_id: %s\n", client.ID)
+	if !public {
+		fmt.Printf("client_secret: %s\n", secret)
+	}
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"accounts-service/auth"
+	"accounts-service/models"
+	accountsv1 "accounts-service/protorepo/noted/accounts/v1"
+	"context"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+	"google.golang.org/grpc/codes"
+)
+
+const testOAuthRedirectURI = "https://app.example.com/callback"
+
+// newTestOAuthClient registers a confidential client allowed to request
+// scopes and returns it along with its secret.
+func newTestOAuthClient(t *testing.T, tu *testUtils, scopes ...string) (*models.OAuthClient, string) {
+	secret, err := auth.GenerateSecret(32)
+	require.NoError(t, err)
+	hash := auth.HashSecret(secret)
+
+	client, err := tu.oauthClientsRepository.Create(context.TODO(), &models.OAuthClientPayload{
+		Name:         "App " + tu.randomAlphanumeric(),
+		SecretHash:   &hash,
+		RedirectURIs: []string{testOAuthRedirectURI},
+		Scopes:       scopes,
+	})
+	require.NoError(t, err)
+	return client, secret
+}
+
+// authorizeTestOAuthClient approves the client for scope on behalf of the
+// account authenticated in ctx and returns the authorization code.
+func authorizeTestOAuthClient(t *testing.T, srv accountsv1.AccountsAPIServer, ctx context.Context, clientID string, scope string, verifier string) string {
+	res, err := srv.AuthorizeOAuthClient(ctx, &accountsv1.AuthorizeOAuthClientRequest{
+		ClientId:            clientID,
+		RedirectUri:         testOAuthRedirectURI,
+		ResponseType:        "code",
+		Scope:               scope,
+		State:               "state",
+		Nonce:               "nonce",
+		CodeChallenge:       oauth2.S256ChallengeFromVerifier(verifier),
+		CodeChallengeMethod: "S256",
+		Approve:             true,
+	})
+	require.NoError(t, err)
+
+	redirectURL, err := url.Parse(res.RedirectUrl)
+	require.NoError(t, err)
+	require.Equal(t, "state", redirectURL.Query().Get("state"))
+	return redirectURL.Query().Get("code")
+}
+
+func TestOAuthAuthorizationCodeFlow(t *testing.T) {
+	tu := newTestUtilsOrDie(t)
+	client, secret := newTestOAuthClient(t, tu, auth.ScopeOpenID, auth.ScopeEmail, auth.ScopeNotesRead)
+
+	email := tu.randomAlphanumeric() + "@gmail.fr"
+	tu.newTestAccount(t, "Delegator", email, "123456")
+	acc := tu.validateTestAccount(t, email, "123456")
+
+	authorize := func(in *accountsv1.AuthorizeOAuthClientRequest) (*accountsv1.AuthorizeOAuthClientResponse, error) {
+		in.ClientId, in.ResponseType, in.CodeChallengeMethod = client.ID, "code", "S256"
+		in.CodeChallenge = oauth2.S256ChallengeFromVerifier(oauth2.GenerateVerifier())
+		return tu.accounts.AuthorizeOAuthClient(acc.Context, in)
+	}
+	exchange := func(code string, verifier string) (*accountsv1.ExchangeOAuthTokenResponse, error) {
+		return tu.accounts.ExchangeOAuthToken(context.TODO(), &accountsv1.ExchangeOAuthTokenRequest{
+			GrantType:    oauthGrantTypeAuthorizationCode,
+			ClientId:     client.ID,
+			ClientSecret: secret,
+			Code:         code,
+			RedirectUri:  testOAuthRedirectURI,
+			CodeVerifier: verifier,
+		})
+	}
+
+	t.Run("unregistered-redirect-uri", func(t *testing.T) {
+		_, err := authorize(&accountsv1.AuthorizeOAuthClientRequest{RedirectUri: "https://evil.example.com/callback", Scope: auth.ScopeOpenID})
+		requireErrorHasGRPCCode(t, codes.InvalidArgument, err)
+	})
+
+	t.Run("scope-not-allowed-for-client", func(t *testing.T) {
+		_, err := authorize(&accountsv1.AuthorizeOAuthClientRequest{RedirectUri: testOAuthRedirectURI, Scope: auth.ScopeNotesWrite})
+		requireErrorHasGRPCCode(t, codes.InvalidArgument, err)
+	})
+
+	t.Run("consent-is-required-first", func(t *testing.T) {
+		res, err := authorize(&accountsv1.AuthorizeOAuthClientRequest{RedirectUri: testOAuthRedirectURI, Scope: auth.ScopeOpenID})
+		require.NoError(t, err)
+		require.True(t, res.ConsentRequired)
+		require.Equal(t, client.Name, res.ClientName)
+		require.Empty(t, res.RedirectUrl)
+	})
+
+	verifier := oauth2.GenerateVerifier()
+	code := authorizeTestOAuthClient(t, tu.accounts, acc.Context, client.ID, "openid email notes.read", verifier)
+
+	t.Run("code-requires-its-verifier", func(t *testing.T) {
+		other := oauth2.GenerateVerifier()
+		code := authorizeTestOAuthClient(t, tu.accounts, acc.Context, client.ID, auth.ScopeNotesRead, other)
+		_, err := exchange(code, verifier)
+		requireErrorHasGRPCCode(t, codes.InvalidArgument, err)
+	})
+
+	res, err := exchange(code, verifier)
+	require.NoError(t, err)
+	require.Equal(t, "openid email notes.read", res.Scope)
+	require.NotEmpty(t, res.IdToken)
+	appCtx := contextWithSignedToken(res.AccessToken)
+
+	t.Run("code-is-single-use", func(t *testing.T) {
+		_, err := exchange(code, verifier)
+		requireErrorHasGRPCCode(t, codes.InvalidArgument, err)
+	})
+
+	t.Run("userinfo-within-scopes", func(t *testing.T) {
+		info, err := tu.accounts.GetOAuthUserInfo(appCtx, &accountsv1.GetOAuthUserInfoRequest{})
+		require.NoError(t, err)
+		require.Equal(t, acc.ID, info.Sub)
+		require.Equal(t, email, info.Email)
+		require.Empty(t, info.Name, "the profile scope was not granted")
+	})
+
+	t.Run("app-cannot-manage-account", func(t *testing.T) {
+		_, err := tu.accounts.GetAccount(appCtx, &accountsv1.GetAccountRequest{AccountId: acc.ID})
+		requireErrorHasGRPCCode(t, codes.PermissionDenied, err)
+	})
+
+	t.Run("consent-is-remembered", func(t *testing.T) {
+		res, err := authorize(&accountsv1.AuthorizeOAuthClientRequest{RedirectUri: testOAuthRedirectURI, Scope: auth.ScopeEmail})
+		require.NoError(t, err)
+		require.False(t, res.ConsentRequired)
+		require.NotEmpty(t, res.RedirectUrl)
+	})
+
+	t.Run("refresh-token-is-bound-to-app", func(t *testing.T) {
+		_, err := tu.accounts.RefreshToken(context.TODO(), &accountsv1.RefreshTokenRequest{RefreshToken: res.RefreshToken})
+		requireErrorHasGRPCCode(t, codes.Unauthenticated, err)
+	})
+
+	t.Run("list-and-revoke", func(t *testing.T) {
+		code := authorizeTestOAuthClient(t, tu.accounts, acc.Context, client.ID, auth.ScopeNotesRead, verifier)
+		tokens, err := exchange(code, verifier)
+		require.NoError(t, err)
+		refreshed, err := tu.accounts.ExchangeOAuthToken(context.TODO(), &accountsv1.ExchangeOAuthTokenRequest{
+			GrantType:    oauthGrantTypeRefreshToken,
+			ClientId:     client.ID,
+			ClientSecret: secret,
+			RefreshToken: tokens.RefreshToken,
+		})
+		require.NoError(t, err)
+		require.Equal(t, auth.ScopeNotesRead, refreshed.Scope)
+		require.Empty(t, refreshed.IdToken)
+
+		list, err := tu.accounts.ListAuthorizedApps(acc.Context, &accountsv1.ListAuthorizedAppsRequest{AccountId: acc.ID})
+		require.NoError(t, err)
+		require.Len(t, list.Apps, 1)
+		require.Equal(t, client.ID, list.Apps[0].ClientId)
+		require.ElementsMatch(t, []string{auth.ScopeOpenID, auth.ScopeEmail, auth.ScopeNotesRead}, list.Apps[0].Scopes)
+
+		_, err = tu.accounts.RevokeAuthorizedApp(acc.Context, &accountsv1.RevokeAuthorizedAppRequest{AccountId: acc.ID, ClientId: client.ID})
+		require.NoError(t, err)
+
+		_, err = tu.accounts.ExchangeOAuthToken(context.TODO(), &accountsv1.ExchangeOAuthTokenRequest{
+			GrantType:    oauthGrantTypeRefreshToken,
+			ClientId:     client.ID,
+			ClientSecret: secret,
+			RefreshToken: refreshed.RefreshToken,
+		})
+		requireErrorHasGRPCCode(t, codes.Unauthenticated, err)
+
+		list, err = tu.accounts.ListAuthorizedApps(acc.Context, &accountsv1.ListAuthorizedAppsRequest{AccountId: acc.ID})
+		require.NoError(t, err)
+		require.Empty(t, list.Apps)
+	})
+}
+
+func TestOAuthClientAuthentication(t *testing.T) {
+	tu := newTestUtilsOrDie(t)
+	confidential, _ := newTestOAuthClient(t, tu, auth.ScopeNotesRead)
+	public, err := tu.oauthClientsRepository.Create(context.TODO(), &models.OAuthClientPayload{
+		Name:         "Extension",
+		RedirectURIs: []string{testOAuthRedirectURI},
+		Scopes:       []string{auth.ScopeNotesRead},
+	})
+	require.NoError(t, err)
+
+	email := tu.randomAlphanumeric() + "@gmail.fr"
+	tu.newTestAccount(t, "Delegator", email, "123456")
+	acc := tu.validateTestAccount(t, email, "123456")
+
+	exchange := func(clientID string, secret string) (*accountsv1.ExchangeOAuthTokenResponse, error) {
+		verifier := oauth2.GenerateVerifier()
+		code := authorizeTestOAuthClient(t, tu.accounts, acc.Context, clientID, auth.ScopeNotesRead, verifier)
+		return tu.accounts.ExchangeOAuthToken(context.TODO(), &accountsv1.ExchangeOAuthTokenRequest{
+			GrantType:    oauthGrantTypeAuthorizationCode,
+			ClientId:     clientID,
+			ClientSecret: secret,
+			Code:         code,
+			RedirectUri:  testOAuthRedirectURI,
+			CodeVerifier: verifier,
+		})
+	}
+
+	_, err = exchange(confidential.ID, "wrong")
+	requireErrorHasGRPCCode(t, codes.Unauthenticated, err)
+
+	_, err = exchange(public.ID, "")
+	require.NoError(t, err)
+
+	_, err = exchange(public.ID, "guessed")
+	requireErrorHasGRPCCode(t, codes.Unauthenticated, err)
+}
@@ -0,0 +1,182 @@
+package oidc_test
+
+import (
+	"accounts-service/oidc"
+	"accounts-service/oidc/oidctest"
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+)
+
+const testRedirectURL = "http://localhost:3000/authenticate/test"
+
+func newTestProvider(t *testing.T) (*oidctest.Issuer, *oidc.Provider) {
+	issuer, err := oidctest.NewIssuer("accounts", "secret")
+	require.NoError(t, err)
+	t.Cleanup(issuer.Close)
+	return issuer, oidc.NewProvider(issuer.Config("test", testRedirectURL), http.DefaultClient)
+}
+
+func TestProviderAuthorizationCodeFlow(t *testing.T) {
+	issuer, provider := newTestProvider(t)
+	ctx := context.Background()
+	user := oidctest.User{Subject: "1234", Email: "jane@example.com", EmailVerified: true, Name: "Jane"}
+	verifier := oauth2.GenerateVerifier()
+
+	authURL, err := provider.AuthCodeURL(ctx, "state", "nonce", verifier)
+	require.NoError(t, err)
+	u, err := url.Parse(authURL)
+	require.NoError(t, err)
+	require.Equal(t, "openid email profile", u.Query().Get("scope"))
+	require.Equal(t, testRedirectURL, u.Query().Get("redirect_uri"))
+
+	code, state, err := issuer.Authorize(authURL, user)
+	require.NoError(t, err)
+	require.Equal(t, "state", state)
+
+	token, err := provider.Exchange(ctx, code, verifier)
+	require.NoError(t, err)
+	require.NotEmpty(t, token.IDToken)
+
+	idToken, err := provider.VerifyIDToken(ctx, token.IDToken, "nonce")
+	require.NoError(t, err)
+	require.Equal(t, issuer.URL(), idToken.Issuer)
+	require.Equal(t, user.Subject, idToken.Subject)
+	require.Equal(t, user.Email, idToken.Email)
+	require.True(t, idToken.EmailVerified)
+
+	info, err := provider.UserInfo(ctx, token.AccessToken)
+	require.NoError(t, err)
+	require.Equal(t, user.Subject, info.Subject)
+	require.Equal(t, user.Email, info.Email)
+}
+
+func TestProviderExchangeRequiresCodeVerifier(t *testing.T) {
+	issuer, provider := newTestProvider(t)
+	ctx := context.Background()
+
+	authURL, err := provider.AuthCodeURL(ctx, "state", "nonce", oauth2.GenerateVerifier())
+	require.NoError(t, err)
+	code, _, err := issuer.Authorize(authURL, oidctest.User{Subject: "1234"})
+	require.NoError(t, err)
+
+	_, err = provider.Exchange(ctx, code, oauth2.GenerateVerifier())
+	require.Error(t, err)
+}
+
+func TestProviderVerifyIDToken(t *testing.T) {
+	issuer, provider := newTestProvider(t)
+	ctx := context.Background()
+	user := oidctest.User{Subject: "1234", Email: "jane@example.com"}
+
+	tests := []struct {
+		name   string
+		mutate func(claims map[string]interface{})
+	}{
+		{"wrong issuer", func(c map[string]interface{}) { c["iss"] = "https://evil.example.com" }},
+		{"wrong audience", func(c map[string]interface{}) { c["aud"] = "someone-else" }},
+		{"audience without authorized party", func(c map[string]interface{}) { c["aud"] = []string{"accounts", "someone-else"} }},
+		{"expired", func(c map[string]interface{}) { c["exp"] = time.Now().Add(-time.Hour).Unix() }},
+		{"issued in the future", func(c map[string]interface{}) { c["iat"] = time.Now().Add(time.Hour).Unix() }},
+		{"wrong nonce", func(c map[string]interface{}) { c["nonce"] = "other" }},
+		{"missing subject", func(c map[string]interface{}) { delete(c, "sub") }},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			claims := issuer.IDTokenClaims(user, "nonce")
+			test.mutate(claims)
+			_, err := provider.VerifyIDToken(ctx, issuer.SignIDToken(claims), "nonce")
+			require.True(t, errors.Is(err, oidc.ErrInvalidIDToken), err)
+		})
+	}
+
+	t.Run("multiple audiences with authorized party", func(t *testing.T) {
+		claims := issuer.IDTokenClaims(user, "nonce")
+		claims["aud"] = []string{"accounts", "someone-else"}
+		claims["azp"] = "accounts"
+		_, err := provider.VerifyIDToken(ctx, issuer.SignIDToken(claims), "nonce")
+		require.NoError(t, err)
+	})
+
+	t.Run("signed by another issuer", func(t *testing.T) {
+		other, err := oidctest.NewIssuer("accounts", "secret")
+		require.NoError(t, err)
+		defer other.Close()
+		claims := issuer.IDTokenClaims(user, "nonce")
+		_, err = provider.VerifyIDToken(ctx, other.SignIDToken(claims), "nonce")
+		require.True(t, errors.Is(err, oidc.ErrInvalidIDToken), err)
+	})
+}
+
+func TestProviderConfigOverrides(t *testing.T) {
+	issuer, err := oidctest.NewIssuer("accounts", "secret")
+	require.NoError(t, err)
+	defer issuer.Close()
+	other, err := oidctest.NewIssuer("accounts", "secret")
+	require.NoError(t, err)
+	defer other.Close()
+	ctx := context.Background()
+	user := oidctest.User{Subject: "1234"}
+
+	config := issuer.Config("test", testRedirectURL)
+	config.JWKSURL = other.URL() + "/jwks"
+	config.IssuerAliases = []string{"alias.example.com"}
+	provider := oidc.NewProvider(config, http.DefaultClient)
+
+	_, err = provider.VerifyIDToken(ctx, issuer.SignIDToken(issuer.IDTokenClaims(user, "")), "")
+	require.True(t, errors.Is(err, oidc.ErrInvalidIDToken), "keys are fetched from the configured url")
+
+	claims := issuer.IDTokenClaims(user, "")
+	claims["iss"] = "alias.example.com"
+	_, err = provider.VerifyIDToken(ctx, other.SignIDToken(claims), "")
+	require.NoError(t, err)
+}
+
+func TestProviderDiscoveryRejectsMismatchingIssuer(t *testing.T) {
+	issuer, err := oidctest.NewIssuer("accounts", "secret")
+	require.NoError(t, err)
+	defer issuer.Close()
+
+	// The issuer is reached under another name than the one it claims in its
+	// discovery document.
+	config := issuer.Config("test", testRedirectURL)
+	config.Issuer = strings.Replace(issuer.URL(), "127.0.0.1", "localhost", 1)
+	_, err = oidc.NewProvider(config, http.DefaultClient).AuthCodeURL(context.Background(), "state", "nonce", oauth2.GenerateVerifier())
+	require.Error(t, err)
+
+	config.Issuer = issuer.URL() + "/"
+	_, err = oidc.NewProvider(config, http.DefaultClient).AuthCodeURL(context.Background(), "state", "nonce", oauth2.GenerateVerifier())
+	require.NoError(t, err, "trailing slashes are ignored")
+}
+
+func TestRegistry(t *testing.T) {
+	_, err := oidc.NewRegistry([]oidc.Config{{Name: "a", Issuer: "https://a.example.com"}}, http.DefaultClient)
+	require.Error(t, err, "client_id is required")
+
+	_, err = oidc.NewRegistry([]oidc.Config{
+		{Name: "a", Issuer: "https://a.example.com", ClientID: "id"},
+		{Name: "a", Issuer: "https://b.example.com", ClientID: "id"},
+	}, http.DefaultClient)
+	require.Error(t, err, "names are unique")
+
+	registry, err := oidc.NewRegistry([]oidc.Config{
+		{Name: "b", Issuer: "https://b.example.com", ClientID: "id"},
+		{Name: "a", Issuer: "https://a.example.com", ClientID: "id"},
+	}, http.DefaultClient)
+	require.NoError(t, err)
+	require.Equal(t, []string{"a", "b"}, registry.Names())
+
+	provider, err := registry.Get("a")
+	require.NoError(t, err)
+	require.Equal(t, "a", provider.Name())
+	_, err = registry.Get("c")
+	require.Equal(t, oidc.ErrUnknownProvider, err)
+}
@@ -0,0 +1,45 @@
+package oidc
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+)
+
+// Registry holds the providers users can log in with, by name.
+type Registry struct {
+	providers map[string]*Provider
+}
+
+func NewRegistry(configs []Config, client *http.Client) (*Registry, error) {
+	r := &Registry{providers: map[string]*Provider{}}
+	for _, config := range configs {
+		if config.Name == "" || config.Issuer == "" || config.ClientID == "" {
+			return nil, fmt.Errorf("provider %q: name, issuer and client_id are required", config.Name)
+		}
+		if _, ok := r.providers[config.Name]; ok {
+			return nil, fmt.Errorf("provider %q is configured twice", config.Name)
+		}
+		r.providers[config.Name] = NewProvider(config, client)
+	}
+	return r, nil
+}
+
+// Get returns ErrUnknownProvider if no provider is registered under name.
+func (r *Registry) Get(name string) (*Provider, error) {
+	provider, ok := r.providers[name]
+	if !ok {
+		return nil, ErrUnknownProvider
+	}
+	return provider, nil
+}
+
+// Names returns the names of the registered providers in alphabetical order.
+func (r *Registry) Names() []string {
+	names := []string{}
+	for name := range r.providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
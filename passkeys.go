@@ -0,0 +1,276 @@
+package main
+
+import (
+	"accounts-service/auth"
+	"accounts-service/models"
+	accountsv1 "accounts-service/protorepo/noted/accounts/v1"
+	"accounts-service/validators"
+	"accounts-service/webauthn"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+var errInvalidPasskeyChallenge = status.Error(codes.InvalidArgument, "invalid or expired challenge")
+
+// BeginPasskeyRegistration returns the options to give to
+// navigator.credentials.create to register a passkey for the account.
+func (srv *accountsAPI) BeginPasskeyRegistration(ctx context.Context, in *accountsv1.BeginPasskeyRegistrationRequest) (*accountsv1.BeginPasskeyRegistrationResponse, error) {
+	token, err := srv.principal(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	err = validators.ValidateBeginPasskeyRegistrationRequest(in)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	acc, err := srv.getOwnAccount(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	passkeys, err := srv.passkeys.List(ctx, &models.ManyPasskeysFilter{AccountID: acc.ID})
+	if err != nil {
+		return nil, statusFromModelError(err)
+	}
+	exclude := [][]byte{}
+	for _, passkey := range passkeys {
+		id, err := base64.RawURLEncoding.DecodeString(passkey.ID)
+		if err == nil {
+			exclude = append(exclude, id)
+		}
+	}
+
+	challenge, err := srv.createChallenge(ctx, models.ChallengePurposePasskeyRegistration, acc.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	user := webauthn.User{ID: []byte(acc.ID), Name: *acc.Email, DisplayName: *acc.Name}
+	options, err := json.Marshal(srv.relyingParty.CreationOptions(challenge, user, exclude))
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	return &accountsv1.BeginPasskeyRegistrationResponse{OptionsJson: string(options)}, nil
+}
+
+// FinishPasskeyRegistration verifies the response of the authenticator to
+// navigator.credentials.create and stores the created passkey.
+func (srv *accountsAPI) FinishPasskeyRegistration(ctx context.Context, in *accountsv1.FinishPasskeyRegistrationRequest) (*accountsv1.FinishPasskeyRegistrationResponse, error) {
+	token, err := srv.principal(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	err = validators.ValidateFinishPasskeyRegistrationRequest(in)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	acc, err := srv.getOwnAccount(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	clientData, err := decodeWebAuthnField("client_data_json", in.ClientDataJson)
+	if err != nil {
+		return nil, err
+	}
+	attestation, err := decodeWebAuthnField("attestation_object", in.AttestationObject)
+	if err != nil {
+		return nil, err
+	}
+
+	challenge, err := srv.usePasskeyChallenge(ctx, models.ChallengePurposePasskeyRegistration, clientData)
+	if err != nil {
+		return nil, err
+	}
+	if challenge.AccountID != acc.ID {
+		return nil, errInvalidPasskeyChallenge
+	}
+
+	cred, err := srv.relyingParty.VerifyRegistration(challenge.raw, clientData, attestation)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	passkey, err := srv.passkeys.Create(ctx, &models.PasskeyPayload{
+		ID:        base64.RawURLEncoding.EncodeToString(cred.ID),
+		AccountID: acc.ID,
+		Name:      in.Name,
+		PublicKey: cred.PublicKey,
+		SignCount: cred.SignCount,
+	})
+	if err != nil {
+		return nil, statusFromModelError(err)
+	}
+
+	return &accountsv1.FinishPasskeyRegistrationResponse{Passkey: modelsPasskeyToProtobufPasskey(passkey)}, nil
+}
+
+// BeginPasskeyLogin returns the options to give to navigator.credentials.get
+// to log in with any passkey.
+func (srv *accountsAPI) BeginPasskeyLogin(ctx context.Context, in *accountsv1.BeginPasskeyLoginRequest) (*accountsv1.BeginPasskeyLoginResponse, error) {
+	challenge, err := srv.createChallenge(ctx, models.ChallengePurposePasskeyLogin, "")
+	if err != nil {
+		return nil, err
+	}
+
+	options, err := json.Marshal(srv.relyingParty.RequestOptions(challenge))
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	return &accountsv1.BeginPasskeyLoginResponse{OptionsJson: string(options)}, nil
+}
+
+// FinishPasskeyLogin verifies the response of the authenticator to
+// navigator.credentials.get and authenticates the owner of the passkey. A
+// passkey verifies the user on its own, so no second factor is asked for.
+func (srv *accountsAPI) FinishPasskeyLogin(ctx context.Context, in *accountsv1.FinishPasskeyLoginRequest) (*accountsv1.FinishPasskeyLoginResponse, error) {
+	err := validators.ValidateFinishPasskeyLoginRequest(in)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	passkey, err := srv.verifyPasskeyAssertion(ctx, &accountsv1.PasskeyAssertion{
+		CredentialId:      in.CredentialId,
+		ClientDataJson:    in.ClientDataJson,
+		AuthenticatorData: in.AuthenticatorData,
+		Signature:         in.Signature,
+		UserHandle:        in.UserHandle,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	acc, err := srv.repo.Get(ctx, &models.OneAccountFilter{ID: passkey.AccountID})
+	if err != nil {
+		return nil, statusFromModelError(err)
+	}
+
+	tokenString, refreshToken, err := srv.issueTokens(ctx, acc, auth.AuthMethodPasskey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &accountsv1.FinishPasskeyLoginResponse{Token: tokenString, RefreshToken: refreshToken}, nil
+}
+
+// verifyPasskeyAssertion verifies the response of an authenticator to
+// navigator.credentials.get, signing a passkey login challenge, and returns
+// the passkey which signed it.
+func (srv *accountsAPI) verifyPasskeyAssertion(ctx context.Context, assertion *accountsv1.PasskeyAssertion) (*models.Passkey, error) {
+	clientData, err := decodeWebAuthnField("client_data_json", assertion.ClientDataJson)
+	if err != nil {
+		return nil, err
+	}
+	authData, err := decodeWebAuthnField("authenticator_data", assertion.AuthenticatorData)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := decodeWebAuthnField("signature", assertion.Signature)
+	if err != nil {
+		return nil, err
+	}
+
+	challenge, err := srv.usePasskeyChallenge(ctx, models.ChallengePurposePasskeyLogin, clientData)
+	if err != nil {
+		return nil, err
+	}
+
+	passkey, err := srv.passkeys.Get(ctx, &models.OnePasskeyFilter{ID: strings.TrimRight(assertion.CredentialId, "=")})
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			return nil, status.Error(codes.Unauthenticated, "unknown passkey")
+		}
+		return nil, statusFromModelError(err)
+	}
+
+	if assertion.UserHandle != "" {
+		userHandle, err := decodeWebAuthnField("user_handle", assertion.UserHandle)
+		if err != nil {
+			return nil, err
+		}
+		if string(userHandle) != passkey.AccountID {
+			return nil, status.Error(codes.Unauthenticated, "unknown passkey")
+		}
+	}
+
+	cred := &webauthn.Credential{PublicKey: passkey.PublicKey, SignCount: passkey.SignCount}
+	signCount, err := srv.relyingParty.VerifyAssertion(cred, challenge.raw, clientData, authData, signature)
+	if err != nil {
+		if errors.Is(err, webauthn.ErrSignCount) {
+			srv.logger.Warn("passkey signature counter did not increase", zap.String("account_id", passkey.AccountID), zap.String("passkey_id", passkey.ID))
+		}
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+
+	_, err = srv.passkeys.UpdateSignCount(ctx, &models.OnePasskeyFilter{ID: passkey.ID}, signCount)
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			return nil, status.Error(codes.Unauthenticated, webauthn.ErrSignCount.Error())
+		}
+		return nil, statusFromModelError(err)
+	}
+
+	return passkey, nil
+}
+
+// passkeyChallenge is a consumed challenge along with its raw value, as
+// signed by the authenticator.
+type passkeyChallenge struct {
+	*models.Challenge
+	raw string
+}
+
+// usePasskeyChallenge consumes the challenge signed in clientData, which
+// must have been created for purpose.
+func (srv *accountsAPI) usePasskeyChallenge(ctx context.Context, purpose string, clientData []byte) (*passkeyChallenge, error) {
+	raw, err := webauthn.ChallengeFromClientData(clientData)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	challenge, err := srv.challenges.Use(ctx, &models.OneChallengeFilter{ID: auth.HashSecret(raw), Purpose: purpose})
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			return nil, errInvalidPasskeyChallenge
+		}
+		return nil, statusFromModelError(err)
+	}
+
+	return &passkeyChallenge{Challenge: challenge, raw: raw}, nil
+}
+
+// decodeWebAuthnField decodes a base64url encoded field of a WebAuthn
+// response, with or without padding.
+func decodeWebAuthnField(name string, value string) ([]byte, error) {
+	b, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(value, "="))
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "%s: invalid base64url encoding", name)
+	}
+	return b, nil
+}
+
+func modelsPasskeyToProtobufPasskey(passkey *models.Passkey) *accountsv1.Passkey {
+	res := &accountsv1.Passkey{
+		Id:         passkey.ID,
+		Name:       passkey.Name,
+		CreateTime: timestamppb.New(passkey.CreatedAt),
+	}
+	if passkey.LastUsedAt != nil {
+		res.LastUseTime = timestamppb.New(*passkey.LastUsedAt)
+	}
+	return res
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	accountsv1 "accounts-service/protorepo/noted/accounts/v1"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+)
+
+func TestPasskeys(t *testing.T) {
+	tu := newTestUtilsOrDie(t)
+	email := tu.randomAlphanumeric() + "@gmail.fr"
+	tu.newTestAccount(t, "Passkey", email, "123456")
+	acc := tu.validateTestAccount(t, email, "123456")
+	authenticator := newTestAuthenticator()
+	b64 := base64.RawURLEncoding.EncodeToString
+
+	t.Run("can-register-passkey", func(t *testing.T) {
+		begin, err := tu.accounts.BeginPasskeyRegistration(acc.Context, &accountsv1.BeginPasskeyRegistrationRequest{AccountId: acc.ID})
+		require.NoError(t, err)
+		challenge := challengeFromOptions(t, begin.OptionsJson)
+
+		clientData, attestation := authenticator.Register(challenge, []byte(acc.ID))
+		res, err := tu.accounts.FinishPasskeyRegistration(acc.Context, &accountsv1.FinishPasskeyRegistrationRequest{
+			AccountId:         acc.ID,
+			Name:              "Laptop",
+			ClientDataJson:    b64(clientData),
+			AttestationObject: b64(attestation),
+		})
+		require.NoError(t, err)
+		require.Equal(t, b64(authenticator.CredentialID), res.Passkey.Id)
+
+		// The challenge of a ceremony is single-use.
+		_, err = tu.accounts.FinishPasskeyRegistration(acc.Context, &accountsv1.FinishPasskeyRegistrationRequest{
+			AccountId:         acc.ID,
+			ClientDataJson:    b64(clientData),
+			AttestationObject: b64(attestation),
+		})
+		requireErrorHasGRPCCode(t, codes.InvalidArgument, err)
+	})
+
+	t.Run("can-login-with-passkey", func(t *testing.T) {
+		begin, err := tu.accounts.BeginPasskeyLogin(context.TODO(), &accountsv1.BeginPasskeyLoginRequest{})
+		require.NoError(t, err)
+		challenge := challengeFromOptions(t, begin.OptionsJson)
+
+		clientData, authData, sig := authenticator.Assert(challenge)
+		res, err := tu.accounts.FinishPasskeyLogin(context.TODO(), &accountsv1.FinishPasskeyLoginRequest{
+			CredentialId:      b64(authenticator.CredentialID),
+			ClientDataJson:    b64(clientData),
+			AuthenticatorData: b64(authData),
+			Signature:         b64(sig),
+			UserHandle:        b64(authenticator.UserHandle),
+		})
+		require.NoError(t, err)
+
+		token, err := tu.auth.TokenFromContext(contextWithSignedToken(res.Token))
+		require.NoError(t, err)
+		require.Equal(t, acc.ID, token.AccountID)
+	})
+
+	t.Run("cannot-login-with-unknown-passkey", func(t *testing.T) {
+		begin, err := tu.accounts.BeginPasskeyLogin(context.TODO(), &accountsv1.BeginPasskeyLoginRequest{})
+		require.NoError(t, err)
+		challenge := challengeFromOptions(t, begin.OptionsJson)
+
+		other := newTestAuthenticator()
+		clientData, authData, sig := other.Assert(challenge)
+		_, err = tu.accounts.FinishPasskeyLogin(context.TODO(), &accountsv1.FinishPasskeyLoginRequest{
+			CredentialId:      b64(other.CredentialID),
+			ClientDataJson:    b64(clientData),
+			AuthenticatorData: b64(authData),
+			Signature:         b64(sig),
+		})
+		requireErrorHasGRPCCode(t, codes.Unauthenticated, err)
+	})
+}
+
+func challengeFromOptions(t *testing.T, optionsJSON string) string {
+	options := struct {
+		Challenge string `json:"challenge"`
+	}{}
+	require.NoError(t, json.Unmarshal([]byte(optionsJSON), &options))
+	return options.Challenge
+}
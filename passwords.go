@@ -0,0 +1,193 @@
+package main
+
+import (
+	"accounts-service/auth"
+	"accounts-service/models"
+	accountsv1 "accounts-service/protorepo/noted/accounts/v1"
+	"accounts-service/validators"
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// Domain of the errdetails.ErrorInfo details returned by the service.
+	errorDomain = "accounts.noted"
+
+	// Reason of the errors returned for passwords which do not meet the
+	// password policy. The reasons of the violations are listed in the
+	// "violations" metadata.
+	passwordPolicyErrorReason = "PASSWORD_POLICY_VIOLATION"
+
+	// Reason of the violation of the passwords which were used recently by
+	// the account.
+	passwordReusedReason = "reused"
+
+	// Rate at which passwords which did not leak are rejected as breached.
+	breachedPasswordsFalsePositiveRate = 0.001
+
+	// Maximum age of the authentication of the session setting the first
+	// password of an account, so that a session left open cannot be used
+	// to take the account over.
+	setPasswordMaxLoginAge = 10 * time.Minute
+)
+
+var errAccountWithoutPassword = status.Error(codes.InvalidArgument, "account has no password, set one with SetPassword")
+
+// SetPassword sets the first password of an account created through an
+// identity provider, so that it can also log in with its email. The
+// session must have authenticated recently, and the account is notified by
+// email.
+func (srv *accountsAPI) SetPassword(ctx context.Context, in *accountsv1.SetPasswordRequest) (*accountsv1.SetPasswordResponse, error) {
+	token, err := srv.principal(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	err = validators.ValidateSetPasswordRequest(in)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	acc, err := srv.getOwnAccount(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	if acc.Hash != nil {
+		return nil, status.Error(codes.FailedPrecondition, "account already has a password, use UpdateAccountPassword")
+	}
+
+	err = srv.requireRecentAuthentication(ctx, token, setPasswordMaxLoginAge)
+	if err != nil {
+		return nil, err
+	}
+
+	err = srv.checkPasswordPolicy(in.Password, *acc.Email, *acc.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	hashed, err := srv.hashPassword(in.Password)
+	if err != nil {
+		return nil, err
+	}
+	acc, err = srv.repo.ChangeAccountPassword(ctx, &models.OneAccountFilter{ID: acc.ID}, hashed, srv.passwordHistoryDepth)
+	if err != nil {
+		return nil, statusFromModelError(err)
+	}
+
+	// The password is set already, so a failure to notify the account is
+	// only logged.
+	if srv.mailingService != nil {
+		err = srv.mailingService.SendEmails(ctx, PasswordSetMailContent(acc.ID), []string{*acc.Email})
+		if err != nil {
+			srv.logger.Error("failed to send password set confirmation", zap.Error(err), zap.String("account_id", acc.ID))
+		}
+	} else {
+		srv.logger.Warn("SendEmails was not called on SetPassword because it is not connected to the mailing-service")
+	}
+
+	return &accountsv1.SetPasswordResponse{Account: modelsAccountToProtobufAccount(acc)}, nil
+}
+
+// checkPasswordPolicy returns an InvalidArgument error detailing why
+// password cannot be set on the account described by personalInfo.
+func (srv *accountsAPI) checkPasswordPolicy(password string, personalInfo ...string) error {
+	violations := srv.passwordPolicy.Check(password, personalInfo...)
+	if len(violations) == 0 {
+		return nil
+	}
+	return passwordPolicyError(violations)
+}
+
+// checkPasswordReuse returns an InvalidArgument error if password is the
+// current password of acc or one of the previous ones kept in its history.
+// It is as detailed as the errors of checkPasswordPolicy.
+func (srv *accountsAPI) checkPasswordReuse(acc *models.Account, password string) error {
+	hashes := acc.PasswordHistory
+	if acc.Hash != nil {
+		hashes = append([][]byte{*acc.Hash}, hashes...)
+	}
+
+	for _, hash := range hashes {
+		ok, _, err := srv.passwords.Verify(hash, password)
+		if err != nil {
+			srv.logger.Error("failed to verify password history", zap.Error(err), zap.String("account_id", acc.ID))
+			return status.Error(codes.Internal, "failed to verify password")
+		}
+		if ok {
+			return passwordPolicyError([]auth.PasswordViolation{{
+				Reason:  passwordReusedReason,
+				Message: "password was used recently, choose another one",
+			}})
+		}
+	}
+	return nil
+}
+
+func passwordPolicyError(violations []auth.PasswordViolation) error {
+	badRequest := &errdetails.BadRequest{}
+	reasons := []string{}
+	for _, v := range violations {
+		badRequest.FieldViolations = append(badRequest.FieldViolations, &errdetails.BadRequest_FieldViolation{Field: "password", Description: v.Message})
+		reasons = append(reasons, v.Reason)
+	}
+	errorInfo := &errdetails.ErrorInfo{
+		Reason:   passwordPolicyErrorReason,
+		Domain:   errorDomain,
+		Metadata: map[string]string{"violations": strings.Join(reasons, ",")},
+	}
+
+	st, err := status.New(codes.InvalidArgument, "password does not meet the password policy").WithDetails(badRequest, errorInfo)
+	if err != nil {
+		return status.Error(codes.InvalidArgument, "password does not meet the password policy")
+	}
+	return st.Err()
+}
+
+func (srv *accountsAPI) hashPassword(password string) ([]byte, error) {
+	hash, err := srv.passwords.Hash(password)
+	if err != nil {
+		srv.logger.Error("failed to hash password", zap.Error(err))
+		return nil, status.Error(codes.Internal, "failed to hash password")
+	}
+	return hash, nil
+}
+
+// comparePassword reports whether password is the password of acc, and
+// whether its hash was computed with outdated parameters or algorithm.
+func (srv *accountsAPI) comparePassword(acc *models.Account, password string) (bool, bool, error) {
+	if acc.Hash == nil {
+		return false, false, errAccountWithoutPassword
+	}
+
+	ok, needsRehash, err := srv.passwords.Verify(*acc.Hash, password)
+	if err != nil {
+		srv.logger.Error("failed to verify password", zap.Error(err), zap.String("account_id", acc.ID))
+		return false, false, status.Error(codes.Internal, "failed to verify password")
+	}
+	return ok, needsRehash, nil
+}
+
+// upgradePasswordHash replaces the outdated hash of acc with one computed
+// with the current parameters. It must only be called once password is
+// proven. Failures are only logged since the old hash still works, and the
+// new hash is dropped if the password changed while it was computed.
+func (srv *accountsAPI) upgradePasswordHash(ctx context.Context, acc *models.Account, password string) {
+	hash, err := srv.passwords.Hash(password)
+	if err != nil {
+		srv.logger.Error("failed to rehash password", zap.Error(err), zap.String("account_id", acc.ID))
+		return
+	}
+
+	err = srv.repo.RehashAccountPassword(ctx, &models.OneAccountFilter{ID: acc.ID}, *acc.Hash, hash)
+	if err != nil && !errors.Is(err, models.ErrNotFound) {
+		srv.logger.Error("failed to store rehashed password", zap.Error(err), zap.String("account_id", acc.ID))
+	}
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"accounts-service/auth"
+	"accounts-service/models"
+	"accounts-service/oidc/oidctest"
+	accountsv1 "accounts-service/protorepo/noted/accounts/v1"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestAuthenticateUpgradesPasswordHash(t *testing.T) {
+	tu := newTestUtilsOrDie(t)
+	email := tu.randomAlphanumeric() + "@gmail.fr"
+	name := "Legacy"
+	hash, err := bcrypt.GenerateFromPassword([]byte("123456"), bcrypt.MinCost)
+	require.NoError(t, err)
+	acc, err := tu.accountsRepository.Create(context.TODO(), &models.AccountPayload{Email: &email, Name: &name, Hash: &hash}, true)
+	require.NoError(t, err)
+
+	res, err := tu.accounts.Authenticate(context.TODO(), &accountsv1.AuthenticateRequest{Email: email, Password: "123456"})
+	require.NoError(t, err)
+	require.NotEmpty(t, res.Token)
+
+	upgraded, err := tu.accountsRepository.Get(context.TODO(), &models.OneAccountFilter{ID: acc.ID})
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(string(*upgraded.Hash), "$argon2id$"))
+
+	_, err = tu.accounts.Authenticate(context.TODO(), &accountsv1.AuthenticateRequest{Email: email, Password: "123456"})
+	require.NoError(t, err)
+}
+
+func TestPasswordHashUpgradeDoesNotOverwriteNewPassword(t *testing.T) {
+	tu := newTestUtilsOrDie(t)
+	srv := tu.accounts.(*testAccountsAPI).srv
+	email := tu.randomAlphanumeric() + "@gmail.fr"
+	name := "Legacy"
+	hash, err := bcrypt.GenerateFromPassword([]byte("123456"), bcrypt.MinCost)
+	require.NoError(t, err)
+	acc, err := tu.accountsRepository.Create(context.TODO(), &models.AccountPayload{Email: &email, Name: &name, Hash: &hash}, true)
+	require.NoError(t, err)
+
+	// The password changes while the login that proved the old one is
+	// still computing its new hash.
+	newHash, err := srv.passwords.Hash("654321")
+	require.NoError(t, err)
+	_, err = tu.accountsRepository.UpdateAccountPassword(context.TODO(), &models.OneAccountFilter{ID: acc.ID}, &models.AccountPayload{Hash: &newHash})
+	require.NoError(t, err)
+	srv.upgradePasswordHash(context.TODO(), acc, "123456")
+
+	_, err = tu.accounts.Authenticate(context.TODO(), &accountsv1.AuthenticateRequest{Email: email, Password: "654321"})
+	require.NoError(t, err)
+	_, err = tu.accounts.Authenticate(context.TODO(), &accountsv1.AuthenticateRequest{Email: email, Password: "123456"})
+	requireErrorHasGRPCCode(t, codes.InvalidArgument, err)
+}
+
+func TestPasswordPolicy(t *testing.T) {
+	tu := newTestUtilsOrDie(t)
+	strict := *tu.accounts.(*testAccountsAPI).srv
+	strict.passwordPolicy = &auth.DefaultPasswordPolicy
+	email := tu.randomAlphanumeric() + "@gmail.fr"
+
+	t.Run("weak-password-is-rejected-with-reasons", func(t *testing.T) {
+		_, err := strict.CreateAccount(context.TODO(), &accountsv1.CreateAccountRequest{Name: "Weak", Email: email, Password: "1234"})
+		requireErrorHasGRPCCode(t, codes.InvalidArgument, err)
+
+		var violations []*errdetails.BadRequest_FieldViolation
+		var reasons string
+		for _, detail := range status.Convert(err).Details() {
+			switch detail := detail.(type) {
+			case *errdetails.BadRequest:
+				violations = detail.FieldViolations
+			case *errdetails.ErrorInfo:
+				reasons = detail.Metadata["violations"]
+			}
+		}
+		require.Len(t, violations, 1)
+		require.Equal(t, "password", violations[0].Field)
+		require.Equal(t, auth.PasswordTooShort, reasons)
+	})
+
+	t.Run("passphrase-is-accepted", func(t *testing.T) {
+		_, err := strict.CreateAccount(context.TODO(), &accountsv1.CreateAccountRequest{Name: "Strong", Email: email, Password: "correct horse battery staple and more"})
+		require.NoError(t, err)
+	})
+}
+
+func TestPasswordHistory(t *testing.T) {
+	tu := newTestUtilsOrDie(t)
+	email := tu.randomAlphanumeric() + "@gmail.fr"
+	tu.newTestAccount(t, "Forgetful", email, "password-a")
+	acc := tu.validateTestAccount(t, email, "password-a")
+
+	changePassword := func(oldPassword string, password string) error {
+		_, err := tu.accounts.UpdateAccountPassword(acc.Context, &accountsv1.UpdateAccountPasswordRequest{AccountId: acc.ID, OldPassword: oldPassword, Password: password})
+		return err
+	}
+
+	require.NoError(t, changePassword("password-a", "password-b"))
+
+	t.Run("current-password-is-rejected", func(t *testing.T) {
+		requireErrorHasGRPCCode(t, codes.InvalidArgument, changePassword("password-b", "password-b"))
+	})
+
+	t.Run("previous-password-is-rejected", func(t *testing.T) {
+		err := changePassword("password-b", "password-a")
+		requireErrorHasGRPCCode(t, codes.InvalidArgument, err)
+		for _, detail := range status.Convert(err).Details() {
+			if info, ok := detail.(*errdetails.ErrorInfo); ok {
+				require.Equal(t, passwordReusedReason, info.Metadata["violations"])
+			}
+		}
+	})
+
+	t.Run("reset-token-path-is-checked-too", func(t *testing.T) {
+		plantVerificationToken(t, tu, models.VerificationPurposeResetPasswordToken, acc.ID, "", "424242")
+		_, err := tu.accounts.UpdateAccountPassword(acc.Context, &accountsv1.UpdateAccountPasswordRequest{AccountId: acc.ID, Token: "424242", Password: "password-a"})
+		requireErrorHasGRPCCode(t, codes.InvalidArgument, err)
+	})
+
+	t.Run("history-is-bounded", func(t *testing.T) {
+		require.NoError(t, changePassword("password-b", "password-c"))
+		require.NoError(t, changePassword("password-c", "password-d"))
+		require.NoError(t, changePassword("password-d", "password-a"))
+
+		updated, err := tu.accountsRepository.Get(context.TODO(), &models.OneAccountFilter{ID: acc.ID})
+		require.NoError(t, err)
+		require.Len(t, updated.PasswordHistory, 2)
+	})
+}
+
+func TestSetPassword(t *testing.T) {
+	tu := newTestUtilsOrDie(t)
+	srv, issuer := withTestProvider(t, tu)
+
+	user := oidctest.User{Subject: tu.newUUID(), Email: tu.randomAlphanumeric() + "@gmail.fr", EmailVerified: true, Name: "Provided"}
+	login, err := loginWithTestProvider(t, srv, issuer, user)
+	require.NoError(t, err)
+	ctx := contextWithSignedToken(login.Token)
+	acc, err := tu.accountsRepository.Get(context.TODO(), &models.OneAccountFilter{Email: user.Email})
+	require.NoError(t, err)
+
+	t.Run("account-without-password-cannot-authenticate", func(t *testing.T) {
+		_, err := srv.Authenticate(context.TODO(), &accountsv1.AuthenticateRequest{Email: user.Email, Password: "whatever"})
+		requireErrorHasGRPCCode(t, codes.InvalidArgument, err)
+	})
+
+	t.Run("old-login-is-refused", func(t *testing.T) {
+		token, err := tu.auth.TokenFromContext(ctx)
+		require.NoError(t, err)
+		token.AuthTime = time.Now().Add(-time.Hour).Unix()
+		oldCtx, err := tu.auth.ContextWithToken(context.TODO(), token)
+		require.NoError(t, err)
+
+		_, err = srv.SetPassword(oldCtx, &accountsv1.SetPasswordRequest{AccountId: acc.ID, Password: "a new password"})
+		requireErrorHasGRPCCode(t, codes.PermissionDenied, err)
+	})
+
+	t.Run("password-is-set", func(t *testing.T) {
+		res, err := srv.SetPassword(ctx, &accountsv1.SetPasswordRequest{AccountId: acc.ID, Password: "a new password"})
+		require.NoError(t, err)
+		require.Equal(t, acc.ID, res.Account.Id)
+
+		auth, err := srv.Authenticate(context.TODO(), &accountsv1.AuthenticateRequest{Email: user.Email, Password: "a new password"})
+		require.NoError(t, err)
+		require.NotEmpty(t, auth.Token)
+	})
+
+	t.Run("password-cannot-be-set-twice", func(t *testing.T) {
+		_, err := srv.SetPassword(ctx, &accountsv1.SetPasswordRequest{AccountId: acc.ID, Password: "another password"})
+		requireErrorHasGRPCCode(t, codes.FailedPrecondition, err)
+	})
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"accounts-service/auth"
+	"accounts-service/models"
+	accountsv1 "accounts-service/protorepo/noted/accounts/v1"
+	"accounts-service/validators"
+	"context"
+	"errors"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// CreatePersonalAccessToken returns a new token limited to the requested
+// scopes, which never expires unless an expire time is given. The token is
+// only returned once, as only its hash is stored. It outlives the session
+// creating it, which must therefore have logged in recently.
+func (srv *accountsAPI) CreatePersonalAccessToken(ctx context.Context, in *accountsv1.CreatePersonalAccessTokenRequest) (*accountsv1.CreatePersonalAccessTokenResponse, error) {
+	token, err := srv.principal(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	err = validators.ValidateCreatePersonalAccessTokenRequest(in)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if !containsAll(auth.DelegableScopes, in.Scopes) {
+		return nil, status.Error(codes.InvalidArgument, "unknown scope")
+	}
+
+	var expiresAt *time.Time
+	if in.ExpireTime != nil {
+		t := in.ExpireTime.AsTime().UTC()
+		if !t.After(time.Now()) {
+			return nil, status.Error(codes.InvalidArgument, "expire time must be in the future")
+		}
+		expiresAt = &t
+	}
+
+	err = srv.requireRecentAuthentication(ctx, token, sensitiveOperationMaxAuthAge)
+	if err != nil {
+		return nil, err
+	}
+
+	acc, err := srv.getOwnAccount(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := auth.GeneratePersonalAccessToken()
+	if err != nil {
+		srv.logger.Error("failed to generate personal access token", zap.Error(err))
+		return nil, status.Error(codes.Internal, "failed to create personal access token")
+	}
+
+	pat, err := srv.personalAccessTokens.Create(ctx, &models.PersonalAccessTokenPayload{
+		AccountID: acc.ID,
+		Name:      in.Name,
+		Hash:      auth.HashSecret(secret),
+		Scopes:    in.Scopes,
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		return nil, statusFromModelError(err)
+	}
+
+	return &accountsv1.CreatePersonalAccessTokenResponse{
+		PersonalAccessToken: modelsPersonalAccessTokenToProtobufPersonalAccessToken(pat),
+		Token:               secret,
+	}, nil
+}
+
+func (srv *accountsAPI) ListPersonalAccessTokens(ctx context.Context, in *accountsv1.ListPersonalAccessTokensRequest) (*accountsv1.ListPersonalAccessTokensResponse, error) {
+	token, err := srv.principal(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	err = validators.ValidateListPersonalAccessTokensRequest(in)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	acc, err := srv.getOwnAccount(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	pats, err := srv.personalAccessTokens.List(ctx, &models.ManyPersonalAccessTokensFilter{AccountID: acc.ID})
+	if err != nil {
+		return nil, statusFromModelError(err)
+	}
+
+	res := []*accountsv1.PersonalAccessToken{}
+	for i := range pats {
+		res = append(res, modelsPersonalAccessTokenToProtobufPersonalAccessToken(&pats[i]))
+	}
+
+	return &accountsv1.ListPersonalAccessTokensResponse{PersonalAccessTokens: res}, nil
+}
+
+func (srv *accountsAPI) RevokePersonalAccessToken(ctx context.Context, in *accountsv1.RevokePersonalAccessTokenRequest) (*accountsv1.RevokePersonalAccessTokenResponse, error) {
+	token, err := srv.principal(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	err = validators.ValidateRevokePersonalAccessTokenRequest(in)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	acc, err := srv.getOwnAccount(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	err = srv.personalAccessTokens.Delete(ctx, &models.OnePersonalAccessTokenFilter{ID: in.PersonalAccessTokenId, AccountID: acc.ID})
+	if err != nil {
+		return nil, statusFromModelError(err)
+	}
+
+	return &accountsv1.RevokePersonalAccessTokenResponse{}, nil
+}
+
+// personalAccessTokenResolver looks up the personal access tokens in the
+// repository and records their use. The tokens of suspended accounts are
+// rejected.
+type personalAccessTokenResolver struct {
+	repo     models.PersonalAccessTokensRepository
+	accounts models.AccountsRepository
+}
+
+var _ auth.PersonalAccessTokenResolver = &personalAccessTokenResolver{}
+
+func (r *personalAccessTokenResolver) ResolvePersonalAccessToken(ctx context.Context, secret string) (*auth.Token, error) {
+	pat, err := r.repo.Use(ctx, &models.OnePersonalAccessTokenFilter{Hash: auth.HashSecret(secret)})
+	if err != nil {
+		return nil, err
+	}
+
+	acc, err := r.accounts.Get(ctx, &models.OneAccountFilter{ID: pat.AccountID})
+	if err != nil {
+		return nil, err
+	}
+	if acc.IsSuspended() {
+		return nil, errors.New("account suspended")
+	}
+
+	token := &auth.Token{AccountID: acc.ID, Scopes: pat.Scopes, PersonalAccessTokenID: pat.ID}
+	if pat.ExpiresAt != nil {
+		token.ExpiresAt = pat.ExpiresAt.Unix()
+	}
+	return token, nil
+}
+
+func modelsPersonalAccessTokenToProtobufPersonalAccessToken(pat *models.PersonalAccessToken) *accountsv1.PersonalAccessToken {
+	res := &accountsv1.PersonalAccessToken{
+		Id:         pat.ID,
+		Name:       pat.Name,
+		Scopes:     pat.Scopes,
+		CreateTime: timestamppb.New(pat.CreatedAt),
+	}
+	if pat.ExpiresAt != nil {
+		res.ExpireTime = timestamppb.New(*pat.ExpiresAt)
+	}
+	if pat.LastUsedAt != nil {
+		res.LastUseTime = timestamppb.New(*pat.LastUsedAt)
+	}
+	return res
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"accounts-service/auth"
+	accountsv1 "accounts-service/protorepo/noted/accounts/v1"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestPersonalAccessTokens(t *testing.T) {
+	tu := newTestUtilsOrDie(t)
+
+	email := tu.randomAlphanumeric() + "@gmail.fr"
+	tu.newTestAccount(t, "Scripter", email, "123456")
+	acc := tu.validateTestAccount(t, email, "123456")
+
+	t.Run("unknown-scope", func(t *testing.T) {
+		_, err := tu.accounts.CreatePersonalAccessToken(acc.Context, &accountsv1.CreatePersonalAccessTokenRequest{AccountId: acc.ID, Name: "CLI", Scopes: []string{"accounts.admin"}})
+		requireErrorHasGRPCCode(t, codes.InvalidArgument, err)
+	})
+
+	t.Run("expire-time-in-the-past", func(t *testing.T) {
+		_, err := tu.accounts.CreatePersonalAccessToken(acc.Context, &accountsv1.CreatePersonalAccessTokenRequest{
+			AccountId:  acc.ID,
+			Name:       "CLI",
+			Scopes:     []string{auth.ScopeNotesRead},
+			ExpireTime: timestamppb.New(time.Now().Add(-time.Hour)),
+		})
+		requireErrorHasGRPCCode(t, codes.InvalidArgument, err)
+	})
+
+	res, err := tu.accounts.CreatePersonalAccessToken(acc.Context, &accountsv1.CreatePersonalAccessTokenRequest{
+		AccountId:  acc.ID,
+		Name:       "CLI",
+		Scopes:     []string{auth.ScopeNotesRead},
+		ExpireTime: timestamppb.New(time.Now().Add(time.Hour)),
+	})
+	require.NoError(t, err)
+	require.Contains(t, res.Token, auth.PersonalAccessTokenPrefix)
+	require.Nil(t, res.PersonalAccessToken.LastUseTime)
+	patCtx := contextWithSignedToken(res.Token)
+
+	t.Run("token-carries-its-scopes", func(t *testing.T) {
+		token, err := tu.auth.TokenFromContext(patCtx)
+		require.NoError(t, err)
+		require.Equal(t, acc.ID, token.AccountID)
+		require.Equal(t, []string{auth.ScopeNotesRead}, token.Scopes)
+		require.True(t, token.IsPersonal())
+	})
+
+	t.Run("token-cannot-manage-account", func(t *testing.T) {
+		_, err := tu.accounts.GetAccount(patCtx, &accountsv1.GetAccountRequest{AccountId: acc.ID})
+		requireErrorHasGRPCCode(t, codes.PermissionDenied, err)
+	})
+
+	t.Run("list-records-last-use", func(t *testing.T) {
+		list, err := tu.accounts.ListPersonalAccessTokens(acc.Context, &accountsv1.ListPersonalAccessTokensRequest{AccountId: acc.ID})
+		require.NoError(t, err)
+		require.Len(t, list.PersonalAccessTokens, 1)
+		require.Equal(t, res.PersonalAccessToken.Id, list.PersonalAccessTokens[0].Id)
+		require.NotNil(t, list.PersonalAccessTokens[0].LastUseTime)
+	})
+
+	t.Run("token-of-another-account", func(t *testing.T) {
+		otherEmail := tu.randomAlphanumeric() + "@gmail.fr"
+		tu.newTestAccount(t, "Other", otherEmail, "123456")
+		other := tu.validateTestAccount(t, otherEmail, "123456")
+
+		_, err := tu.accounts.RevokePersonalAccessToken(other.Context, &accountsv1.RevokePersonalAccessTokenRequest{AccountId: other.ID, PersonalAccessTokenId: res.PersonalAccessToken.Id})
+		requireErrorHasGRPCCode(t, codes.NotFound, err)
+	})
+
+	t.Run("stale-session-cannot-create", func(t *testing.T) {
+		staleCtx, err := tu.auth.ContextWithToken(context.TODO(), &auth.Token{AccountID: acc.ID, AuthTime: time.Now().Add(-time.Hour).Unix()})
+		require.NoError(t, err)
+
+		_, err = tu.accounts.CreatePersonalAccessToken(staleCtx, &accountsv1.CreatePersonalAccessTokenRequest{AccountId: acc.ID, Name: "CLI", Scopes: []string{auth.ScopeNotesRead}})
+		requireErrorHasGRPCCode(t, codes.PermissionDenied, err)
+	})
+
+	t.Run("revoke", func(t *testing.T) {
+		_, err := tu.accounts.RevokePersonalAccessToken(acc.Context, &accountsv1.RevokePersonalAccessTokenRequest{AccountId: acc.ID, PersonalAccessTokenId: res.PersonalAccessToken.Id})
+		require.NoError(t, err)
+
+		_, err = tu.auth.TokenFromContext(patCtx)
+		require.Error(t, err)
+	})
+
+	t.Run("revoke-all-sessions-revokes-tokens", func(t *testing.T) {
+		other, err := tu.accounts.CreatePersonalAccessToken(acc.Context, &accountsv1.CreatePersonalAccessTokenRequest{AccountId: acc.ID, Name: "CI", Scopes: []string{auth.ScopeNotesRead}})
+		require.NoError(t, err)
+
+		_, err = tu.accounts.RevokeAllSessions(acc.Context, &accountsv1.RevokeAllSessionsRequest{AccountId: acc.ID})
+		require.NoError(t, err)
+
+		_, err = tu.auth.TokenFromContext(contextWithSignedToken(other.Token))
+		require.Error(t, err)
+	})
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"accounts-service/auth"
+	"accounts-service/models"
+	"accounts-service/models/mongo"
+	"accounts-service/oidc"
+	accountsv1 "accounts-service/protorepo/noted/accounts/v1"
+	v1 "accounts-service/protorepo/noted/notes/v1"
+	"accounts-service/validators"
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/oauth2"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// Name of the provider used by the deprecated Google login RPCs.
+	googleProviderName = "google"
+	// Timeout of the requests to the providers.
+	providerRequestTimeout = 10 * time.Second
+)
+
+var (
+	errInvalidProviderState  = status.Error(codes.InvalidArgument, "invalid or expired state")
+	errEmailOfAnotherAccount = status.Error(codes.FailedPrecondition, "email already used by another account, log in to it and link the provider")
+)
+
+// BeginAuthenticateWithProvider returns the URL of the page of the provider
+// where the user logs in. The provider redirects the user to the client
+// with a code and the returned state, which must be given to
+// AuthenticateWithProvider.
+func (srv *accountsAPI) BeginAuthenticateWithProvider(ctx context.Context, in *accountsv1.BeginAuthenticateWithProviderRequest) (*accountsv1.BeginAuthenticateWithProviderResponse, error) {
+	err := validators.ValidateBeginAuthenticateWithProviderRequest(in)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	url, state, err := srv.beginProviderFlow(ctx, models.ChallengePurposeOIDCLogin, "", in.Provider)
+	if err != nil {
+		return nil, err
+	}
+
+	return &accountsv1.BeginAuthenticateWithProviderResponse{AuthorizationUrl: url, State: state}, nil
+}
+
+// AuthenticateWithProvider logs in with the code returned by the provider,
+// creating the account on first login.
+func (srv *accountsAPI) AuthenticateWithProvider(ctx context.Context, in *accountsv1.AuthenticateWithProviderRequest) (*accountsv1.AuthenticateWithProviderResponse, error) {
+	err := validators.ValidateAuthenticateWithProviderRequest(in)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	idToken, err := srv.finishProviderFlow(ctx, models.ChallengePurposeOIDCLogin, "", in.Provider, in.Code, in.State)
+	if err != nil {
+		return nil, err
+	}
+
+	acc, err := srv.getAccountOfIdentity(ctx, in.Provider, idToken)
+	if err != nil {
+		return nil, err
+	}
+
+	if acc.HasSecondFactor() {
+		challenge, err := srv.createSecondFactorChallenge(ctx, acc, auth.AuthMethodFederated)
+		if err != nil {
+			return nil, err
+		}
+		return &accountsv1.AuthenticateWithProviderResponse{Challenge: challenge}, nil
+	}
+
+	tokenString, refreshToken, err := srv.issueTokens(ctx, acc, auth.AuthMethodFederated)
+	if err != nil {
+		return nil, err
+	}
+
+	return &accountsv1.AuthenticateWithProviderResponse{Token: tokenString, RefreshToken: refreshToken}, nil
+}
+
+// beginProviderFlow starts an authorization code flow with a provider and
+// returns the URL to send the user to along with the state of the flow. The
+// state is bound to accountID unless it is empty.
+func (srv *accountsAPI) beginProviderFlow(ctx context.Context, purpose string, accountID string, providerName string) (string, string, error) {
+	provider, err := srv.getProvider(providerName)
+	if err != nil {
+		return "", "", err
+	}
+
+	nonce, err := auth.GenerateSecret(32)
+	if err != nil {
+		srv.logger.Error("failed to generate nonce", zap.Error(err))
+		return "", "", status.Error(codes.Internal, "failed to begin login")
+	}
+	verifier := oauth2.GenerateVerifier()
+
+	state, err := srv.createChallengeWithData(ctx, purpose, accountID, map[string]string{
+		"provider":      providerName,
+		"nonce":         nonce,
+		"code_verifier": verifier,
+	})
+	if err != nil {
+		return "", "", err
+	}
+
+	url, err := provider.AuthCodeURL(ctx, state, nonce, verifier)
+	if err != nil {
+		srv.logger.Error("identity provider discovery failed", zap.String("provider", providerName), zap.Error(err))
+		return "", "", status.Error(codes.Unavailable, "identity provider unavailable")
+	}
+
+	return url, state, nil
+}
+
+// finishProviderFlow consumes the state of a flow started by
+// beginProviderFlow, redeems the code returned by the provider and returns
+// the verified ID token of the user.
+func (srv *accountsAPI) finishProviderFlow(ctx context.Context, purpose string, accountID string, providerName string, code string, state string) (*oidc.IDToken, error) {
+	provider, err := srv.getProvider(providerName)
+	if err != nil {
+		return nil, err
+	}
+
+	challenge, err := srv.challenges.Use(ctx, &models.OneChallengeFilter{ID: auth.HashSecret(state), Purpose: purpose, AccountID: accountID})
+	if err != nil {
+		if err == models.ErrNotFound {
+			return nil, errInvalidProviderState
+		}
+		return nil, statusFromModelError(err)
+	}
+	if challenge.Data["provider"] != providerName {
+		return nil, errInvalidProviderState
+	}
+
+	token, err := provider.Exchange(ctx, code, challenge.Data["code_verifier"])
+	if err != nil {
+		srv.logger.Warn("code exchange failed", zap.String("provider", providerName), zap.Error(err))
+		return nil, status.Error(codes.Unauthenticated, "invalid authorization code")
+	}
+	if token.IDToken == "" {
+		return nil, status.Error(codes.Unauthenticated, "identity provider returned no id token")
+	}
+
+	idToken, err := provider.VerifyIDToken(ctx, token.IDToken, challenge.Data["nonce"])
+	if err != nil {
+		srv.logger.Warn("id token verification failed", zap.String("provider", providerName), zap.Error(err))
+		return nil, status.Error(codes.Unauthenticated, "invalid id token")
+	}
+
+	return idToken, nil
+}
+
+func (srv *accountsAPI) getProvider(name string) (*oidc.Provider, error) {
+	if srv.providers == nil {
+		return nil, status.Error(codes.NotFound, oidc.ErrUnknownProvider.Error())
+	}
+	provider, err := srv.providers.Get(name)
+	if err != nil {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+	return provider, nil
+}
+
+// getAccountOfIdentity returns the account linked to the user identified by
+// idToken at provider. On the first login of the user, the identity is
+// linked to a new account created for the email verified by the provider.
+// Emails are not enough to identify users across providers, so the email
+// of an existing account is refused unless the account was created by the
+// former Google login, before identities were stored.
+func (srv *accountsAPI) getAccountOfIdentity(ctx context.Context, provider string, idToken *oidc.IDToken) (*models.Account, error) {
+	identity, err := srv.identities.Get(ctx, &models.OneIdentityFilter{Provider: provider, Subject: idToken.Subject})
+	if err == nil {
+		acc, err := srv.repo.Get(ctx, &models.OneAccountFilter{ID: identity.AccountID})
+		if err != nil {
+			return nil, statusFromModelError(err)
+		}
+		return acc, nil
+	}
+	if err != models.ErrNotFound {
+		return nil, statusFromModelError(err)
+	}
+
+	if idToken.Email == "" || !idToken.EmailVerified {
+		return nil, status.Error(codes.PermissionDenied, "email not verified by the identity provider")
+	}
+
+	acc, err := srv.repo.Get(ctx, &models.OneAccountFilter{Email: idToken.Email})
+	if err == models.ErrNotFound {
+		acc, err = srv.createExternalAccount(ctx, idToken.Email, idToken.Name)
+		if err != nil {
+			return nil, err
+		}
+	} else if err != nil {
+		return nil, statusFromModelError(err)
+	} else {
+		// The former login only went through Google, so the other
+		// providers cannot vouch for the owner of the legacy accounts.
+		if provider != googleProviderName || !acc.IsLegacyExternal {
+			return nil, errEmailOfAnotherAccount
+		}
+		acc, err = srv.repo.AdoptLegacyExternalAccount(ctx, &models.OneAccountFilter{ID: acc.ID})
+		if err == models.ErrNotFound {
+			return nil, errEmailOfAnotherAccount
+		}
+		if err != nil {
+			return nil, statusFromModelError(err)
+		}
+	}
+
+	_, err = srv.identities.Create(ctx, &models.IdentityPayload{
+		Provider:  provider,
+		Subject:   idToken.Subject,
+		AccountID: acc.ID,
+		Email:     idToken.Email,
+	})
+	if err != nil {
+		return nil, statusFromModelError(err)
+	}
+
+	return acc, nil
+}
+
+// markLegacyAccounts marks the accounts left by the former Google login, so
+// that their owner can adopt them on their first login with Google.
+func markLegacyAccounts() {
+	logger := zap.NewNop()
+	db, err := mongo.NewDatabase(context.Background(), *mongoUri, *mongoDbName, logger)
+	must(err, "could not instantiate mongo database")
+	defer db.Disconnect(context.Background())
+
+	marked, err := mongo.NewAccountsRepository(db.DB, logger).MarkLegacyExternalAccounts(context.Background())
+	must(err, "could not mark legacy accounts")
+
+	fmt.Printf("marked %d legacy accounts\n", marked)
+}
+
+// createExternalAccount creates a validated account without password for a
+// user logged in with a provider.
+func (srv *accountsAPI) createExternalAccount(ctx context.Context, email string, name string) (*models.Account, error) {
+	if name == "" {
+		name = strings.Split(email, "@")[0]
+	}
+	acc, err := srv.repo.Create(ctx, &models.AccountPayload{Email: &email, Name: &name}, true)
+	if err != nil {
+		return nil, statusFromModelError(err)
+	}
+
+	if srv.noteService != nil {
+		_, err = srv.noteService.Groups.CreateWorkspace(ctx, &v1.CreateWorkspaceRequest{AccountId: acc.ID})
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		srv.logger.Warn("CreateWorkspace was not called on CreateAccount because it is not connected to the notes-service")
+	}
+
+	return acc, nil
+}
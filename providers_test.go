@@ -0,0 +1,210 @@
+package main
+
+import (
+	"accounts-service/models"
+	"accounts-service/oidc"
+	"accounts-service/oidc/oidctest"
+	accountsv1 "accounts-service/protorepo/noted/accounts/v1"
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+)
+
+const testProviderName = "test"
+
+// withTestProvider returns a copy of the API of tu which logs in with a
+// fake issuer registered as testProviderName and as googleProviderName.
+func withTestProvider(t *testing.T, tu *testUtils) (*testAccountsAPI, *oidctest.Issuer) {
+	issuer, err := oidctest.NewIssuer("accounts-service", "secret")
+	require.NoError(t, err)
+	t.Cleanup(issuer.Close)
+
+	providers, err := oidc.NewRegistry([]oidc.Config{
+		issuer.Config(testProviderName, "http://localhost:3000/authenticate/test"),
+		issuer.Config(googleProviderName, "http://localhost:3000/authenticate/google"),
+	}, http.DefaultClient)
+	require.NoError(t, err)
+
+	srv := *tu.accounts.(*testAccountsAPI).srv
+	srv.providers = providers
+	return newTestAccountsAPI(&srv), issuer
+}
+
+// loginWithTestProvider goes through the whole login of user at issuer.
+func loginWithTestProvider(t *testing.T, srv *testAccountsAPI, issuer *oidctest.Issuer, user oidctest.User) (*accountsv1.AuthenticateWithProviderResponse, error) {
+	begin, err := srv.BeginAuthenticateWithProvider(context.TODO(), &accountsv1.BeginAuthenticateWithProviderRequest{Provider: testProviderName})
+	require.NoError(t, err)
+
+	code, state, err := issuer.Authorize(begin.AuthorizationUrl, user)
+	require.NoError(t, err)
+	require.Equal(t, begin.State, state)
+
+	return srv.AuthenticateWithProvider(context.TODO(), &accountsv1.AuthenticateWithProviderRequest{Provider: testProviderName, Code: code, State: state})
+}
+
+// newLegacyTestAccount creates an account like the ones left by the former
+// Google login.
+func newLegacyTestAccount(t *testing.T, tu *testUtils, email string) *models.Account {
+	name := "Legacy"
+	acc, err := tu.accountsRepository.Create(context.TODO(), &models.AccountPayload{Email: &email, Name: &name}, true)
+	require.NoError(t, err)
+	_, err = tu.accountsRepository.MarkLegacyExternalAccounts(context.TODO())
+	require.NoError(t, err)
+	return acc
+}
+
+func TestAuthenticateWithProvider(t *testing.T) {
+	tu := newTestUtilsOrDie(t)
+	srv, issuer := withTestProvider(t, tu)
+
+	t.Run("unknown-provider", func(t *testing.T) {
+		_, err := srv.BeginAuthenticateWithProvider(context.TODO(), &accountsv1.BeginAuthenticateWithProviderRequest{Provider: "unknown"})
+		requireErrorHasGRPCCode(t, codes.NotFound, err)
+	})
+
+	t.Run("first-login-creates-validated-account", func(t *testing.T) {
+		email := tu.randomAlphanumeric() + "@gmail.fr"
+		res, err := loginWithTestProvider(t, srv, issuer, oidctest.User{Subject: tu.newUUID(), Email: email, EmailVerified: true, Name: "Provided"})
+		require.NoError(t, err)
+		require.NotEmpty(t, res.Token)
+		require.NotEmpty(t, res.RefreshToken)
+
+		acc, err := tu.accountsRepository.Get(context.TODO(), &models.OneAccountFilter{Email: email})
+		require.NoError(t, err)
+		require.True(t, acc.IsValidated)
+		require.Equal(t, "Provided", *acc.Name)
+		require.Nil(t, acc.Hash)
+	})
+
+	t.Run("unverified-email-is-refused", func(t *testing.T) {
+		email := tu.randomAlphanumeric() + "@gmail.fr"
+		_, err := loginWithTestProvider(t, srv, issuer, oidctest.User{Subject: tu.newUUID(), Email: email, Name: "Unverified"})
+		requireErrorHasGRPCCode(t, codes.PermissionDenied, err)
+
+		_, err = tu.accountsRepository.Get(context.TODO(), &models.OneAccountFilter{Email: email})
+		require.Equal(t, models.ErrNotFound, err)
+	})
+
+	t.Run("subject-identifies-user", func(t *testing.T) {
+		user := oidctest.User{Subject: tu.newUUID(), Email: tu.randomAlphanumeric() + "@gmail.fr", EmailVerified: true, Name: "Moving"}
+		_, err := loginWithTestProvider(t, srv, issuer, user)
+		require.NoError(t, err)
+		acc, err := tu.accountsRepository.Get(context.TODO(), &models.OneAccountFilter{Email: user.Email})
+		require.NoError(t, err)
+
+		// The email at the provider changes, even to an unverified one.
+		user.Email, user.EmailVerified = tu.randomAlphanumeric()+"@gmail.fr", false
+		_, err = loginWithTestProvider(t, srv, issuer, user)
+		require.NoError(t, err)
+
+		identity, err := tu.identitiesRepository.Get(context.TODO(), &models.OneIdentityFilter{Provider: testProviderName, Subject: user.Subject})
+		require.NoError(t, err)
+		require.Equal(t, acc.ID, identity.AccountID)
+		_, err = tu.accountsRepository.Get(context.TODO(), &models.OneAccountFilter{Email: user.Email})
+		require.Equal(t, models.ErrNotFound, err)
+	})
+
+	t.Run("email-of-password-account-is-refused", func(t *testing.T) {
+		email := tu.randomAlphanumeric() + "@gmail.fr"
+		tu.newTestAccount(t, "Victim", email, "123456")
+
+		_, err := loginWithTestProvider(t, srv, issuer, oidctest.User{Subject: tu.newUUID(), Email: email, EmailVerified: true, Name: "Attacker"})
+		requireErrorHasGRPCCode(t, codes.FailedPrecondition, err)
+	})
+
+	t.Run("legacy-account-is-refused", func(t *testing.T) {
+		email := tu.randomAlphanumeric() + "@gmail.fr"
+		newLegacyTestAccount(t, tu, email)
+
+		_, err := loginWithTestProvider(t, srv, issuer, oidctest.User{Subject: tu.newUUID(), Email: email, EmailVerified: true, Name: "Attacker"})
+		requireErrorHasGRPCCode(t, codes.FailedPrecondition, err)
+	})
+
+	t.Run("state-is-single-use", func(t *testing.T) {
+		begin, err := srv.BeginAuthenticateWithProvider(context.TODO(), &accountsv1.BeginAuthenticateWithProviderRequest{Provider: testProviderName})
+		require.NoError(t, err)
+		user := oidctest.User{Subject: tu.newUUID(), Email: tu.randomAlphanumeric() + "@gmail.fr", EmailVerified: true, Name: "Once"}
+		code, state, err := issuer.Authorize(begin.AuthorizationUrl, user)
+		require.NoError(t, err)
+
+		_, err = srv.AuthenticateWithProvider(context.TODO(), &accountsv1.AuthenticateWithProviderRequest{Provider: testProviderName, Code: code, State: state})
+		require.NoError(t, err)
+		_, err = srv.AuthenticateWithProvider(context.TODO(), &accountsv1.AuthenticateWithProviderRequest{Provider: testProviderName, Code: code, State: state})
+		requireErrorHasGRPCCode(t, codes.InvalidArgument, err)
+	})
+
+	t.Run("forged-state-is-refused", func(t *testing.T) {
+		begin, err := srv.BeginAuthenticateWithProvider(context.TODO(), &accountsv1.BeginAuthenticateWithProviderRequest{Provider: testProviderName})
+		require.NoError(t, err)
+		code, _, err := issuer.Authorize(begin.AuthorizationUrl, oidctest.User{Subject: tu.newUUID(), Email: tu.randomAlphanumeric() + "@gmail.fr", EmailVerified: true})
+		require.NoError(t, err)
+
+		_, err = srv.AuthenticateWithProvider(context.TODO(), &accountsv1.AuthenticateWithProviderRequest{Provider: testProviderName, Code: code, State: "forged"})
+		requireErrorHasGRPCCode(t, codes.InvalidArgument, err)
+	})
+
+	t.Run("code-of-another-login-is-refused", func(t *testing.T) {
+		first, err := srv.BeginAuthenticateWithProvider(context.TODO(), &accountsv1.BeginAuthenticateWithProviderRequest{Provider: testProviderName})
+		require.NoError(t, err)
+		second, err := srv.BeginAuthenticateWithProvider(context.TODO(), &accountsv1.BeginAuthenticateWithProviderRequest{Provider: testProviderName})
+		require.NoError(t, err)
+		code, _, err := issuer.Authorize(first.AuthorizationUrl, oidctest.User{Subject: tu.newUUID(), Email: tu.randomAlphanumeric() + "@gmail.fr", EmailVerified: true})
+		require.NoError(t, err)
+
+		// The code verifier bound to the second state does not match the
+		// challenge of the first login.
+		_, err = srv.AuthenticateWithProvider(context.TODO(), &accountsv1.AuthenticateWithProviderRequest{Provider: testProviderName, Code: code, State: second.State})
+		requireErrorHasGRPCCode(t, codes.Unauthenticated, err)
+	})
+}
+
+func TestAuthenticateGoogle(t *testing.T) {
+	tu := newTestUtilsOrDie(t)
+	srv, issuer := withTestProvider(t, tu)
+
+	authenticate := func(claims map[string]interface{}) (*accountsv1.AuthenticateGoogleResponse, error) {
+		return srv.AuthenticateGoogle(context.TODO(), &accountsv1.AuthenticateGoogleRequest{IdToken: issuer.SignIDToken(claims)})
+	}
+
+	t.Run("id-token-is-required", func(t *testing.T) {
+		_, err := srv.AuthenticateGoogle(context.TODO(), &accountsv1.AuthenticateGoogleRequest{ClientAccessToken: "access-token"})
+		requireErrorHasGRPCCode(t, codes.InvalidArgument, err)
+	})
+
+	t.Run("token-of-another-client-is-refused", func(t *testing.T) {
+		claims := issuer.IDTokenClaims(oidctest.User{Subject: tu.newUUID(), Email: tu.randomAlphanumeric() + "@gmail.fr", EmailVerified: true}, "")
+		claims["aud"] = "another-client"
+		_, err := authenticate(claims)
+		requireErrorHasGRPCCode(t, codes.Unauthenticated, err)
+	})
+
+	t.Run("unverified-email-is-refused", func(t *testing.T) {
+		email := tu.randomAlphanumeric() + "@gmail.fr"
+		tu.newTestAccount(t, "Victim", email, "123456")
+
+		_, err := authenticate(issuer.IDTokenClaims(oidctest.User{Subject: tu.newUUID(), Email: email}, ""))
+		requireErrorHasGRPCCode(t, codes.PermissionDenied, err)
+	})
+
+	t.Run("legacy-account-is-linked", func(t *testing.T) {
+		email := tu.randomAlphanumeric() + "@gmail.fr"
+		acc := newLegacyTestAccount(t, tu, email)
+		user := oidctest.User{Subject: tu.newUUID(), Email: email, EmailVerified: true}
+
+		res, err := authenticate(issuer.IDTokenClaims(user, ""))
+		require.NoError(t, err)
+		require.NotEmpty(t, res.Token)
+
+		identity, err := tu.identitiesRepository.Get(context.TODO(), &models.OneIdentityFilter{Provider: googleProviderName, Subject: user.Subject})
+		require.NoError(t, err)
+		require.Equal(t, acc.ID, identity.AccountID)
+
+		// Another Google user with the same email cannot take the account
+		// over once it is linked.
+		_, err = authenticate(issuer.IDTokenClaims(oidctest.User{Subject: tu.newUUID(), Email: email, EmailVerified: true}, ""))
+		requireErrorHasGRPCCode(t, codes.FailedPrecondition, err)
+	})
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"accounts-service/auth"
+	"accounts-service/models"
+	accountsv1 "accounts-service/protorepo/noted/accounts/v1"
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// Maximum age of the authentication of the sessions performing
+	// sensitive operations, such as deleting the account.
+	sensitiveOperationMaxAuthAge = 5 * time.Minute
+
+	// Reason of the errors returned to the sessions which must call
+	// Reauthenticate before retrying. The maximum age of the authentication
+	// in seconds and the methods the account can reauthenticate with are
+	// given in the "max_age" and "methods" metadata.
+	reauthenticationRequiredReason = "REAUTHENTICATION_REQUIRED"
+)
+
+var errInvalidReauthenticationMethod = status.Error(codes.InvalidArgument, "exactly one of password, second factor code or passkey assertion is required")
+
+// Reauthenticate proves a credential of the account again, so that the
+// current session can perform the sensitive operations which require a
+// recent authentication. It returns a new access token carrying the new
+// authentication time, and the refresh tokens of the session carry it from
+// then on. Passkey assertions sign a challenge returned by BeginPasskeyLogin.
+func (srv *accountsAPI) Reauthenticate(ctx context.Context, in *accountsv1.ReauthenticateRequest) (*accountsv1.ReauthenticateResponse, error) {
+	token, err := srv.principal(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	given := 0
+	for _, set := range []bool{in.Password != "", in.SecondFactorCode != "", in.PasskeyAssertion != nil} {
+		if set {
+			given++
+		}
+	}
+	if given != 1 {
+		return nil, errInvalidReauthenticationMethod
+	}
+
+	acc, err := srv.repo.Get(ctx, &models.OneAccountFilter{ID: token.AccountID})
+	if err != nil {
+		return nil, statusFromModelError(err)
+	}
+
+	var method string
+	switch {
+	case in.Password != "":
+		_, err = srv.verifyPassword(ctx, *acc.Email, in.Password)
+		method = auth.AuthMethodPassword
+	case in.SecondFactorCode != "":
+		if !acc.HasSecondFactor() {
+			return nil, status.Error(codes.FailedPrecondition, "two-factor authentication is not enabled")
+		}
+		err = srv.verifySecondFactor(ctx, acc, in.SecondFactorCode)
+		method = auth.AuthMethodOTP
+	default:
+		var passkey *models.Passkey
+		passkey, err = srv.verifyPasskeyAssertion(ctx, in.PasskeyAssertion)
+		if err == nil && passkey.AccountID != acc.ID {
+			err = status.Error(codes.Unauthenticated, "unknown passkey")
+		}
+		method = auth.AuthMethodPasskey
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	session, err := srv.sessions.Reauthenticate(ctx, &models.OneSessionFilter{ID: token.SessionID, AccountID: acc.ID}, []string{method})
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			return nil, status.Error(codes.Unauthenticated, "session revoked")
+		}
+		return nil, statusFromModelError(err)
+	}
+
+	tokenString, err := srv.signToken(acc, session)
+	if err != nil {
+		return nil, err
+	}
+
+	return &accountsv1.ReauthenticateResponse{Token: tokenString}, nil
+}
+
+// requireRecentAuthentication is called by the handlers of sensitive
+// operations. Unless the session of token proved a credential less than
+// maxAge ago, it returns PermissionDenied with the
+// REAUTHENTICATION_REQUIRED reason, telling the client to call
+// Reauthenticate and retry.
+func (srv *accountsAPI) requireRecentAuthentication(ctx context.Context, token *auth.Token, maxAge time.Duration) error {
+	if token.AuthenticatedWithin(maxAge) {
+		return nil
+	}
+
+	methods, err := srv.reauthenticationMethods(ctx, token.AccountID)
+	if err != nil {
+		return err
+	}
+
+	errorInfo := &errdetails.ErrorInfo{
+		Reason: reauthenticationRequiredReason,
+		Domain: errorDomain,
+		Metadata: map[string]string{
+			"max_age": strconv.Itoa(int(maxAge.Seconds())),
+			"methods": strings.Join(methods, ","),
+		},
+	}
+
+	st, err := status.New(codes.PermissionDenied, "recent authentication required, reauthenticate and retry").WithDetails(errorInfo)
+	if err != nil {
+		return status.Error(codes.PermissionDenied, "recent authentication required, reauthenticate and retry")
+	}
+	return st.Err()
+}
+
+// reauthenticationMethods returns the methods the account can reauthenticate
+// with. Accounts which have none, like the accounts created through an
+// identity provider, must log in again instead.
+func (srv *accountsAPI) reauthenticationMethods(ctx context.Context, accountID string) ([]string, error) {
+	acc, err := srv.repo.Get(ctx, &models.OneAccountFilter{ID: accountID})
+	if err != nil {
+		return nil, statusFromModelError(err)
+	}
+
+	methods := []string{}
+	if acc.Hash != nil {
+		methods = append(methods, auth.AuthMethodPassword)
+	}
+	if acc.HasSecondFactor() {
+		methods = append(methods, auth.AuthMethodOTP)
+	}
+
+	passkeys, err := srv.passkeys.List(ctx, &models.ManyPasskeysFilter{AccountID: acc.ID})
+	if err != nil {
+		srv.logger.Error("failed to list passkeys", zap.Error(err), zap.String("account_id", acc.ID))
+	} else if len(passkeys) > 0 {
+		methods = append(methods, auth.AuthMethodPasskey)
+	}
+
+	return methods, nil
+}
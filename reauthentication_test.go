@@ -0,0 +1,102 @@
+package main
+
+import (
+	"accounts-service/auth"
+	accountsv1 "accounts-service/protorepo/noted/accounts/v1"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestLoginRecordsAuthentication(t *testing.T) {
+	tu := newTestUtilsOrDie(t)
+
+	email := tu.randomAlphanumeric() + "@gmail.fr"
+	tu.newTestAccount(t, "Recorded", email, "123456")
+	tu.validateTestAccount(t, email, "123456")
+
+	login, err := tu.accounts.Authenticate(context.TODO(), &accountsv1.AuthenticateRequest{Email: email, Password: "123456"})
+	require.NoError(t, err)
+	token, err := tu.auth.TokenFromContext(contextWithSignedToken(login.Token))
+	require.NoError(t, err)
+	require.Equal(t, []string{auth.AuthMethodPassword}, token.AuthMethods)
+	require.True(t, token.AuthenticatedWithin(time.Minute))
+
+	refreshed, err := tu.accounts.RefreshToken(context.TODO(), &accountsv1.RefreshTokenRequest{RefreshToken: login.RefreshToken})
+	require.NoError(t, err)
+	again, err := tu.auth.TokenFromContext(contextWithSignedToken(refreshed.Token))
+	require.NoError(t, err)
+	require.Equal(t, token.AuthTime, again.AuthTime, "refreshing does not authenticate")
+	require.Equal(t, token.AuthMethods, again.AuthMethods)
+}
+
+func TestReauthenticate(t *testing.T) {
+	tu := newTestUtilsOrDie(t)
+
+	email := tu.randomAlphanumeric() + "@gmail.fr"
+	tu.newTestAccount(t, "Stale", email, "123456")
+	acc := tu.validateTestAccount(t, email, "123456")
+
+	login, err := tu.accounts.Authenticate(context.TODO(), &accountsv1.AuthenticateRequest{Email: email, Password: "123456"})
+	require.NoError(t, err)
+	token, err := tu.auth.TokenFromContext(contextWithSignedToken(login.Token))
+	require.NoError(t, err)
+	token.AuthTime = time.Now().Add(-time.Hour).Unix()
+	staleCtx, err := tu.auth.ContextWithToken(context.TODO(), token)
+	require.NoError(t, err)
+
+	t.Run("stale-session-must-reauthenticate", func(t *testing.T) {
+		_, err := tu.accounts.DeleteAccount(staleCtx, &accountsv1.DeleteAccountRequest{AccountId: acc.ID})
+		requireErrorHasGRPCCode(t, codes.PermissionDenied, err)
+
+		st, _ := status.FromError(err)
+		require.NotEmpty(t, st.Details())
+		errorInfo, ok := st.Details()[0].(*errdetails.ErrorInfo)
+		require.True(t, ok)
+		require.Equal(t, reauthenticationRequiredReason, errorInfo.Reason)
+		require.Equal(t, "300", errorInfo.Metadata["max_age"])
+		require.Equal(t, auth.AuthMethodPassword, errorInfo.Metadata["methods"])
+	})
+
+	t.Run("one-method-at-a-time", func(t *testing.T) {
+		_, err := tu.accounts.Reauthenticate(staleCtx, &accountsv1.ReauthenticateRequest{})
+		requireErrorHasGRPCCode(t, codes.InvalidArgument, err)
+
+		_, err = tu.accounts.Reauthenticate(staleCtx, &accountsv1.ReauthenticateRequest{Password: "123456", SecondFactorCode: "123456"})
+		requireErrorHasGRPCCode(t, codes.InvalidArgument, err)
+	})
+
+	t.Run("wrong-password", func(t *testing.T) {
+		_, err := tu.accounts.Reauthenticate(staleCtx, &accountsv1.ReauthenticateRequest{Password: "654321"})
+		requireErrorHasGRPCCode(t, codes.InvalidArgument, err)
+	})
+
+	t.Run("second-factor-not-enabled", func(t *testing.T) {
+		_, err := tu.accounts.Reauthenticate(staleCtx, &accountsv1.ReauthenticateRequest{SecondFactorCode: "123456"})
+		requireErrorHasGRPCCode(t, codes.FailedPrecondition, err)
+	})
+
+	res, err := tu.accounts.Reauthenticate(staleCtx, &accountsv1.ReauthenticateRequest{Password: "123456"})
+	require.NoError(t, err)
+	freshCtx := contextWithSignedToken(res.Token)
+	fresh, err := tu.auth.TokenFromContext(freshCtx)
+	require.NoError(t, err)
+	require.Equal(t, token.SessionID, fresh.SessionID)
+	require.True(t, fresh.AuthenticatedWithin(time.Minute))
+
+	t.Run("refresh-keeps-reauthentication", func(t *testing.T) {
+		refreshed, err := tu.accounts.RefreshToken(context.TODO(), &accountsv1.RefreshTokenRequest{RefreshToken: login.RefreshToken})
+		require.NoError(t, err)
+		token, err := tu.auth.TokenFromContext(contextWithSignedToken(refreshed.Token))
+		require.NoError(t, err)
+		require.Equal(t, fresh.AuthTime, token.AuthTime)
+	})
+
+	_, err = tu.accounts.DeleteAccount(freshCtx, &accountsv1.DeleteAccountRequest{AccountId: acc.ID})
+	require.NoError(t, err)
+}
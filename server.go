@@ -5,24 +5,25 @@ import (
 	"accounts-service/communication"
 	"accounts-service/models"
 	"accounts-service/models/mongo"
+	"accounts-service/oidc"
+	"accounts-service/webauthn"
 
 	mailing "github.com/noted-eip/noted/mailing-service"
 
 	accountsv1 "accounts-service/protorepo/noted/accounts/v1"
 	"context"
-	"crypto/ed25519"
 	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"net"
+	"net/http"
 	"os"
 	"strings"
 	"time"
 
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
-	"golang.org/x/oauth2"
-	"golang.org/x/oauth2/google"
 	"google.golang.org/api/firebaseappdistribution/v1"
 	"google.golang.org/api/option"
 	"google.golang.org/grpc"
@@ -34,11 +35,27 @@ type server struct {
 	logger *zap.Logger
 
 	authService    auth.Service
+	keyring        *auth.Keyring
 	mailingService mailing.Service
 
 	mongoDB *mongo.Database
 
-	accountsRepository models.AccountsRepository
+	accountsRepository        models.AccountsRepository
+	refreshTokensRepository   models.RefreshTokensRepository
+	sessionsRepository        models.SessionsRepository
+	serviceAccountsRepository models.ServiceAccountsRepository
+	challengesRepository      models.ChallengesRepository
+	passkeysRepository        models.PasskeysRepository
+	throttlesRepository       models.ThrottlesRepository
+
+	verificationTokensRepository models.VerificationTokensRepository
+	identitiesRepository         models.IdentitiesRepository
+	oauthClientsRepository       models.OAuthClientsRepository
+	consentsRepository           models.ConsentsRepository
+
+	personalAccessTokensRepository models.PersonalAccessTokensRepository
+	deviceAuthorizationsRepository models.DeviceAuthorizationsRepository
+	loginRequestsRepository        models.LoginRequestsRepository
 
 	accountsService accountsv1.AccountsAPIServer
 	noteService     *communication.NoteServiceClient
@@ -47,17 +64,18 @@ type server struct {
 
 	grpcServer *grpc.Server
 
-	googleOauthConfig *oauth2.Config
+	providers *oidc.Registry
 }
 
 // Init initializes the dependencies of the server and panics on error.
 func (s *server) Init(opt ...grpc.ServerOption) {
 	s.initLogger()
+	s.initRepositories()
 	s.initAuthService()
 	s.initMailingService()
-	s.initRepositories()
 	s.initNoteServiceClient()
 	s.initFirebaseService()
+	s.initProviders()
 	s.initAccountsAPI()
 	s.initGrpcServer(opt...)
 }
@@ -129,42 +147,70 @@ func (s *server) initNoteServiceClient() {
 	s.noteService = noteService
 }
 
-func (s *server) InitAuthGoogleService() {
-	const googleAppId = "871625340195-kf7c2u88u9aivgdru776a36hgel0kjja.apps.googleusercontent.com"
-	var googleRedirectUri = ""
-	var googleAuthSecret = os.Getenv("GOOGLE_SECRET_AUTH")
-
-	if googleAuthSecret == "" {
-		panic(fmt.Errorf("empty google secret from environment"))
+// initProviders registers the OpenID Connect providers listed in the
+// --oidc-providers file. Google is registered from GOOGLE_SECRET_AUTH when
+// the file does not list it, as it was before the file existed.
+func (s *server) initProviders() {
+	configs := []oidc.Config{}
+	if *oidcProviders != "" {
+		content, err := os.ReadFile(*oidcProviders)
+		must(err, "could not read oidc providers")
+		err = json.Unmarshal([]byte(os.ExpandEnv(string(content))), &configs)
+		must(err, "could not decode oidc providers")
 	}
 
-	if *environment == "production" {
-		googleRedirectUri = "https://notes-are-noted.vercel.app/authenticate/google"
-	} else if *environment == "development" {
-		googleRedirectUri = "http://localhost:3000/authenticate/google"
+	hasGoogle := false
+	for _, config := range configs {
+		hasGoogle = hasGoogle || config.Name == googleProviderName
 	}
-
-	if googleRedirectUri == "" {
-		panic(fmt.Errorf("empty google auth uri due to environment (production or development)"))
+	googleSecret := os.Getenv("GOOGLE_SECRET_AUTH")
+	if !hasGoogle && googleSecret != "" {
+		redirectURL := "https://notes-are-noted.vercel.app/authenticate/google"
+		if *environment == envIsDev {
+			redirectURL = "http://localhost:3000/authenticate/google"
+		}
+		configs = append(configs, oidc.Config{
+			Name:         googleProviderName,
+			Issuer:       "https://accounts.google.com",
+			ClientID:     *googleClientID,
+			ClientSecret: googleSecret,
+			RedirectURL:  redirectURL,
+			JWKSURL:      *googleJWKSURL,
+			// Google issues ID tokens under both forms.
+			IssuerAliases: []string{"accounts.google.com"},
+		})
 	}
 
-	s.googleOauthConfig = &oauth2.Config{
-		RedirectURL:  googleRedirectUri,
-		ClientID:     googleAppId,
-		ClientSecret: googleAuthSecret,
-		Scopes: []string{
-			"https://www.googleapis.com/auth/userinfo.email",
-			"https://www.googleapis.com/auth/userinfo.profile",
-		},
-		Endpoint: google.Endpoint,
-	}
+	registry, err := oidc.NewRegistry(configs, &http.Client{Timeout: providerRequestTimeout})
+	must(err, "invalid oidc providers")
+	s.providers = registry
+	s.logger.Info("identity providers registered", zap.Strings("providers", registry.Names()))
 }
 
 func (s *server) initAuthService() {
-	s.InitAuthGoogleService()
-	rawKey, err := base64.StdEncoding.DecodeString(*jwtPrivateKey)
+	signingKey, _, err := auth.ParseKey(*jwtPrivateKey)
 	must(err, "could not decode jwt private key")
-	s.authService = auth.NewService(ed25519.PrivateKey(rawKey))
+	if signingKey == nil {
+		must(auth.ErrInvalidKey, "jwt private key is a public key")
+	}
+	s.keyring = auth.NewKeyring(signingKey)
+
+	for _, encodedKey := range strings.Split(*jwtVerifyKeys, ",") {
+		if encodedKey == "" {
+			continue
+		}
+		_, key, err := auth.ParseKey(strings.TrimSpace(encodedKey))
+		must(err, "could not decode jwt verification key")
+		s.keyring.Add(key)
+	}
+
+	s.authService = auth.NewService(s.keyring,
+		auth.WithTokenLifetime(*jwtLifetime),
+		auth.WithIssuer(*jwtIssuer),
+		auth.WithAudience(*jwtAudience),
+		auth.WithSessionValidator(&sessionValidator{repo: s.sessionsRepository}),
+		auth.WithPersonalAccessTokens(&personalAccessTokenResolver{repo: s.personalAccessTokensRepository, accounts: s.accountsRepository}),
+	)
 }
 
 func (s *server) initRepositories() {
@@ -172,6 +218,19 @@ func (s *server) initRepositories() {
 	s.mongoDB, err = mongo.NewDatabase(context.Background(), *mongoUri, *mongoDbName, s.logger)
 	must(err, "could not instantiate mongo database")
 	s.accountsRepository = mongo.NewAccountsRepository(s.mongoDB.DB, s.logger)
+	s.refreshTokensRepository = mongo.NewRefreshTokensRepository(s.mongoDB.DB, s.logger)
+	s.sessionsRepository = mongo.NewSessionsRepository(s.mongoDB.DB, s.logger)
+	s.serviceAccountsRepository = mongo.NewServiceAccountsRepository(s.mongoDB.DB, s.logger)
+	s.challengesRepository = mongo.NewChallengesRepository(s.mongoDB.DB, s.logger)
+	s.passkeysRepository = mongo.NewPasskeysRepository(s.mongoDB.DB, s.logger)
+	s.throttlesRepository = mongo.NewThrottlesRepository(s.mongoDB.DB, s.logger)
+	s.verificationTokensRepository = mongo.NewVerificationTokensRepository(s.mongoDB.DB, s.logger)
+	s.identitiesRepository = mongo.NewIdentitiesRepository(s.mongoDB.DB, s.logger)
+	s.oauthClientsRepository = mongo.NewOAuthClientsRepository(s.mongoDB.DB, s.logger)
+	s.consentsRepository = mongo.NewConsentsRepository(s.mongoDB.DB, s.logger)
+	s.personalAccessTokensRepository = mongo.NewPersonalAccessTokensRepository(s.mongoDB.DB, s.logger)
+	s.deviceAuthorizationsRepository = mongo.NewDeviceAuthorizationsRepository(s.mongoDB.DB, s.logger)
+	s.loginRequestsRepository = mongo.NewLoginRequestsRepository(s.mongoDB.DB, s.logger)
 }
 
 func (s *server) initMailingService() {
@@ -179,20 +238,84 @@ func (s *server) initMailingService() {
 }
 
 func (s *server) initAccountsAPI() {
+	relyingParty := &webauthn.RelyingParty{
+		ID:      *webauthnRPID,
+		Name:    "Noted",
+		Origins: strings.Split(*webauthnOrigins, ","),
+	}
+
+	trustedProxies, err := parseIPRanges(*trustedProxyIPs)
+	must(err, "invalid trusted proxies")
+
+	if *verifyCodeLength < minVerificationCodeLength || *verifyCodeLength > maxVerificationCodeLength {
+		must(fmt.Errorf("must be between %d and %d", minVerificationCodeLength, maxVerificationCodeLength), "invalid verification code length")
+	}
+
+	passwords := auth.NewArgon2idHasher(auth.Argon2idParams{
+		Memory:      *argon2Memory,
+		Iterations:  *argon2Iterations,
+		Parallelism: *argon2Threads,
+		SaltLength:  auth.DefaultArgon2idParams.SaltLength,
+		KeyLength:   auth.DefaultArgon2idParams.KeyLength,
+	})
+
+	passwordPolicy := &auth.PasswordPolicy{
+		MinLength:  *pwdMinLength,
+		MaxLength:  *pwdMaxLength,
+		MinEntropy: *pwdMinEntropy,
+	}
+	if *breachedPwdsFile != "" {
+		breached, err := auth.LoadBreachedPasswords(*breachedPwdsFile, breachedPasswordsFalsePositiveRate)
+		must(err, "could not load breached passwords")
+		passwordPolicy.Breached = breached
+	}
+
 	s.accountsService = &accountsAPI{
-		noteService:     s.noteService,
-		mailingService:  s.mailingService,
-		auth:            s.authService,
-		logger:          s.logger,
-		repo:            s.accountsRepository,
-		googleOAuth:     s.googleOauthConfig,
-		firebaseService: s.firebaseService,
+		noteService:          s.noteService,
+		mailingService:       s.mailingService,
+		auth:                 s.authService,
+		keyring:              s.keyring,
+		logger:               s.logger,
+		repo:                 s.accountsRepository,
+		refreshTokens:        s.refreshTokensRepository,
+		sessions:             s.sessionsRepository,
+		serviceAccounts:      s.serviceAccountsRepository,
+		passwords:            passwords,
+		passwordPolicy:       passwordPolicy,
+		challenges:           s.challengesRepository,
+		passkeys:             s.passkeysRepository,
+		throttles:            s.throttlesRepository,
+		relyingParty:         relyingParty,
+		trustedProxies:       trustedProxies,
+		refreshTokenLifetime: *refreshLifetime,
+		providers:            s.providers,
+		firebaseService:      s.firebaseService,
+
+		verificationTokens:     s.verificationTokensRepository,
+		identities:             s.identitiesRepository,
+		oauthClients:           s.oauthClientsRepository,
+		consents:               s.consentsRepository,
+		verificationCodeLength: *verifyCodeLength,
+		passwordHistoryDepth:   *pwdHistoryDepth,
+
+		accessTokenLifetime: *jwtLifetime,
+		oauthIssuer:         *oauthIssuer,
+		oauthConsentURL:     *oauthConsentURL,
+		deviceVerifyURL:     *deviceVerifyURL,
+
+		personalAccessTokens: s.personalAccessTokensRepository,
+		deviceAuthorizations: s.deviceAuthorizationsRepository,
+		loginRequests:        s.loginRequestsRepository,
 	}
 }
 
 func (s *server) initGrpcServer(opt ...grpc.ServerOption) {
+	authorizer := newAuthorizer(s.authService)
+	opt = append(opt, grpc.ChainUnaryInterceptor(authorizer.UnaryInterceptor))
 	s.grpcServer = grpc.NewServer(opt...)
 	accountsv1.RegisterAccountsAPIServer(s.grpcServer, s.accountsService)
+	err := authorizer.Check(s.grpcServer.GetServiceInfo())
+	must(err, "invalid authorization policies")
 }
 
 func (s *server) initFirebaseService() {
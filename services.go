@@ -0,0 +1,67 @@
+package main
+
+import (
+	"accounts-service/auth"
+	"accounts-service/models"
+	"accounts-service/models/mongo"
+	accountsv1 "accounts-service/protorepo/noted/accounts/v1"
+	"accounts-service/validators"
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// AuthenticateService exchanges the credentials of a machine identity for a
+// token carrying the scopes granted to it.
+func (srv *accountsAPI) AuthenticateService(ctx context.Context, in *accountsv1.AuthenticateServiceRequest) (*accountsv1.AuthenticateServiceResponse, error) {
+	err := validators.ValidateAuthenticateServiceRequest(in)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	serviceAccount, err := srv.serviceAccounts.Get(ctx, &models.OneServiceAccountFilter{ID: in.ClientId})
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			return nil, status.Error(codes.Unauthenticated, "invalid client credentials")
+		}
+		return nil, statusFromModelError(err)
+	}
+
+	if subtle.ConstantTimeCompare([]byte(serviceAccount.SecretHash), []byte(auth.HashSecret(in.ClientSecret))) != 1 {
+		return nil, status.Error(codes.Unauthenticated, "invalid client credentials")
+	}
+
+	tokenString, err := srv.auth.SignToken(&auth.Token{ServiceID: serviceAccount.Name, Scopes: serviceAccount.Scopes})
+	if err != nil {
+		srv.logger.Error("failed to sign service token", zap.Error(err))
+		return nil, status.Error(codes.Internal, "failed to authenticate service")
+	}
+
+	return &accountsv1.AuthenticateServiceResponse{Token: tokenString}, nil
+}
+
+// createServiceAccount registers the machine identity of another service
+// and prints its credentials, which are not stored and cannot be shown again.
+func createServiceAccount(name string, scopes []string) {
+	logger := zap.NewNop()
+	db, err := mongo.NewDatabase(context.Background(), *mongoUri, *mongoDbName, logger)
+	must(err, "could not instantiate mongo database")
+	defer db.Disconnect(context.Background())
+
+	secret, err := auth.GenerateSecret(32)
+	must(err, "could not generate client secret")
+
+	serviceAccount, err := mongo.NewServiceAccountsRepository(db.DB, logger).Create(context.Background(), &models.ServiceAccountPayload{
+		Name:       name,
+		SecretHash: auth.HashSecret(secret),
+		Scopes:     scopes,
+	})
+	must(err, "could not create service account")
+
+	fmt.Printf("client_id: %s\nclient_secret: %s\n", serviceAccount.ID, secret)
+}
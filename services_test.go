@@ -0,0 +1,54 @@
+package main
+
+import (
+	"accounts-service/auth"
+	"accounts-service/models"
+	accountsv1 "accounts-service/protorepo/noted/accounts/v1"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+)
+
+func TestAuthenticateService(t *testing.T) {
+	tu := newTestUtilsOrDie(t)
+	secret, err := auth.GenerateSecret(32)
+	require.NoError(t, err)
+	serviceAccount, err := tu.serviceAccountsRepository.Create(context.Background(), &models.ServiceAccountPayload{
+		Name:       "notes-service-" + tu.randomAlphanumeric(),
+		SecretHash: auth.HashSecret(secret),
+		Scopes:     []string{auth.ScopeAccountsEmailsRead},
+	})
+	require.NoError(t, err)
+
+	t.Run("service-can-authenticate", func(t *testing.T) {
+		res, err := tu.accounts.AuthenticateService(context.Background(), &accountsv1.AuthenticateServiceRequest{
+			ClientId:     serviceAccount.ID,
+			ClientSecret: secret,
+		})
+		require.NoError(t, err)
+
+		token, err := tu.auth.TokenFromContext(contextWithSignedToken(res.Token))
+		require.NoError(t, err)
+		require.Equal(t, serviceAccount.Name, token.ServiceID)
+		require.Equal(t, []string{auth.ScopeAccountsEmailsRead}, token.Scopes)
+	})
+
+	t.Run("service-cannot-authenticate-with-wrong-secret", func(t *testing.T) {
+		res, err := tu.accounts.AuthenticateService(context.Background(), &accountsv1.AuthenticateServiceRequest{
+			ClientId:     serviceAccount.ID,
+			ClientSecret: "wrong",
+		})
+		requireErrorHasGRPCCode(t, codes.Unauthenticated, err)
+		require.Nil(t, res)
+	})
+
+	t.Run("service-cannot-act-on-behalf-of-an-account", func(t *testing.T) {
+		res, err := tu.accounts.GetAccount(tu.newTestServiceContext(t, auth.ScopeAccountsEmailsRead), &accountsv1.GetAccountRequest{
+			AccountId: "whatever",
+		})
+		requireErrorHasGRPCCode(t, codes.PermissionDenied, err)
+		require.Nil(t, res)
+	})
+}
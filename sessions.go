@@ -0,0 +1,283 @@
+package main
+
+import (
+	"accounts-service/auth"
+	"accounts-service/models"
+	accountsv1 "accounts-service/protorepo/noted/accounts/v1"
+	"accounts-service/validators"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const (
+	// Optional metadata key in which clients name the device they run on.
+	deviceNameMetadataKey = "x-device-name"
+)
+
+func (srv *accountsAPI) ListSessions(ctx context.Context, in *accountsv1.ListSessionsRequest) (*accountsv1.ListSessionsResponse, error) {
+	token, err := srv.principal(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	err = validators.ValidateListSessionsRequest(in)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	if in.Limit == 0 {
+		in.Limit = 20
+	}
+
+	sessions, err := srv.sessions.List(ctx, &models.ManySessionsFilter{AccountID: in.AccountId}, &models.Pagination{Offset: int64(in.Offset), Limit: int64(in.Limit)})
+	if err != nil {
+		return nil, statusFromModelError(err)
+	}
+
+	sessionsResp := []*accountsv1.Session{}
+	for i := range sessions {
+		sessionsResp = append(sessionsResp, modelsSessionToProtobufSession(&sessions[i], token.SessionID))
+	}
+
+	return &accountsv1.ListSessionsResponse{Sessions: sessionsResp}, nil
+}
+
+func (srv *accountsAPI) RevokeSession(ctx context.Context, in *accountsv1.RevokeSessionRequest) (*accountsv1.RevokeSessionResponse, error) {
+	err := validators.ValidateRevokeSessionRequest(in)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	err = srv.revokeSession(ctx, &models.OneSessionFilter{ID: in.SessionId, AccountID: in.AccountId})
+	if err != nil {
+		return nil, statusFromModelError(err)
+	}
+
+	return &accountsv1.RevokeSessionResponse{}, nil
+}
+
+func (srv *accountsAPI) RevokeAllSessions(ctx context.Context, in *accountsv1.RevokeAllSessionsRequest) (*accountsv1.RevokeAllSessionsResponse, error) {
+	err := validators.ValidateRevokeAllSessionsRequest(in)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	err = srv.revokeSessions(ctx, &models.ManySessionsFilter{AccountID: in.AccountId})
+	if err != nil {
+		return nil, statusFromModelError(err)
+	}
+
+	// Personal access tokens would otherwise keep a stolen account open.
+	err = srv.personalAccessTokens.DeleteMany(ctx, &models.ManyPersonalAccessTokensFilter{AccountID: in.AccountId})
+	if err != nil {
+		return nil, statusFromModelError(err)
+	}
+
+	return &accountsv1.RevokeAllSessionsResponse{}, nil
+}
+
+func (srv *accountsAPI) Logout(ctx context.Context, in *accountsv1.LogoutRequest) (*accountsv1.LogoutResponse, error) {
+	token, err := srv.principal(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if token.SessionID == "" {
+		return nil, status.Error(codes.InvalidArgument, "token is not bound to a session")
+	}
+
+	err = srv.revokeSession(ctx, &models.OneSessionFilter{ID: token.SessionID, AccountID: token.AccountID})
+	if err != nil {
+		return nil, statusFromModelError(err)
+	}
+
+	return &accountsv1.LogoutResponse{}, nil
+}
+
+// startSession records a new session for the account, described by the
+// client information found in ctx.
+func (srv *accountsAPI) startSession(ctx context.Context, accountID string, methods []string) (*models.Session, error) {
+	payload := srv.clientInfo(ctx)
+	payload.AccountID = accountID
+	payload.ExpiresAt = time.Now().UTC().Add(srv.refreshTokenLifetime)
+	if len(methods) > 0 {
+		payload.AuthenticatedAt = time.Now().UTC()
+		payload.AuthMethods = methods
+	}
+
+	session, err := srv.sessions.Create(ctx, payload)
+	if err != nil {
+		return nil, statusFromModelError(err)
+	}
+	return session, nil
+}
+
+// revokeSession deletes a session along with its refresh tokens. The access
+// tokens of the session are rejected from then on.
+func (srv *accountsAPI) revokeSession(ctx context.Context, filter *models.OneSessionFilter) error {
+	session, err := srv.sessions.Get(ctx, filter)
+	if err != nil {
+		return err
+	}
+
+	err = srv.sessions.Delete(ctx, &models.OneSessionFilter{ID: session.ID})
+	if err != nil {
+		return err
+	}
+
+	return srv.refreshTokens.DeleteMany(ctx, &models.ManyRefreshTokensFilter{FamilyID: session.ID})
+}
+
+// revokeSessions is the bulk version of revokeSession.
+func (srv *accountsAPI) revokeSessions(ctx context.Context, filter *models.ManySessionsFilter) error {
+	err := srv.sessions.DeleteMany(ctx, filter)
+	if err != nil {
+		return err
+	}
+
+	return srv.refreshTokens.DeleteMany(ctx, &models.ManyRefreshTokensFilter{AccountID: filter.AccountID, ExceptFamilyID: filter.ExceptID})
+}
+
+// sessionValidator rejects the tokens of the sessions which are no longer
+// stored in the repository.
+type sessionValidator struct {
+	repo models.SessionsRepository
+}
+
+var _ auth.SessionValidator = &sessionValidator{}
+
+func (v *sessionValidator) ValidateSession(ctx context.Context, token *auth.Token) error {
+	if token.SessionID == "" {
+		return auth.ErrSessionRevoked
+	}
+
+	_, err := v.repo.Get(ctx, &models.OneSessionFilter{ID: token.SessionID, AccountID: token.AccountID})
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			return auth.ErrSessionRevoked
+		}
+		return err
+	}
+
+	return nil
+}
+
+// clientInfo describes the client of the incoming request. The headers
+// forwarded by grpc-gateway take precedence over the ones of the gateway
+// itself. The IP address forwarded in x-forwarded-for is only used when the
+// request comes from a trusted proxy, as anyone else can set it.
+func (srv *accountsAPI) clientInfo(ctx context.Context) *models.SessionPayload {
+	info := &models.SessionPayload{}
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	info.Device = firstMetadataValue(md, deviceNameMetadataKey)
+	info.UserAgent = firstMetadataValue(md, "grpcgateway-user-agent", "user-agent")
+
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return info
+	}
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return info
+	}
+	info.IPAddress = host
+
+	if !srv.trustedProxies.contains(host) {
+		return info
+	}
+
+	// Each proxy appends the address it received the request from, so the
+	// client is the last address which is not one of the proxies.
+	forwardedFor := strings.Split(strings.Join(md.Get("x-forwarded-for"), ","), ",")
+	for i := len(forwardedFor) - 1; i >= 0; i-- {
+		ip := strings.TrimSpace(forwardedFor[i])
+		if net.ParseIP(ip) == nil {
+			break
+		}
+		info.IPAddress = ip
+		if !srv.trustedProxies.contains(ip) {
+			break
+		}
+	}
+
+	return info
+}
+
+// ipRanges lists the addresses of the gateways and proxies in front of the
+// service.
+type ipRanges []*net.IPNet
+
+// parseIPRanges parses comma separated IP addresses and CIDR ranges.
+func parseIPRanges(s string) (ipRanges, error) {
+	ranges := ipRanges{}
+	for _, value := range strings.Split(s, ",") {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+		if !strings.Contains(value, "/") {
+			ip := net.ParseIP(value)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid IP address %q", value)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			ranges = append(ranges, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(value)
+		if err != nil {
+			return nil, err
+		}
+		ranges = append(ranges, ipNet)
+	}
+	return ranges, nil
+}
+
+func (r ipRanges) contains(address string) bool {
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return false
+	}
+	for _, ipNet := range r {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func firstMetadataValue(md metadata.MD, keys ...string) string {
+	for _, key := range keys {
+		values := md.Get(key)
+		if len(values) > 0 && values[0] != "" {
+			return values[0]
+		}
+	}
+	return ""
+}
+
+func modelsSessionToProtobufSession(session *models.Session, currentSessionID string) *accountsv1.Session {
+	return &accountsv1.Session{
+		Id:          session.ID,
+		Device:      session.Device,
+		IpAddress:   session.IPAddress,
+		UserAgent:   session.UserAgent,
+		CreateTime:  timestamppb.New(session.CreatedAt),
+		LastUseTime: timestamppb.New(session.LastUsedAt),
+		IsCurrent:   session.ID == currentSessionID,
+	}
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"accounts-service/auth"
+	"accounts-service/models"
+	accountsv1 "accounts-service/protorepo/noted/accounts/v1"
+	"context"
+	"crypto/ed25519"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+func TestSessions(t *testing.T) {
+	tu := newTestUtilsOrDie(t)
+	email := tu.randomAlphanumeric() + "@gmail.com"
+	password := tu.randomAlphanumeric()
+	tu.newTestAccount(t, "Sally Doe", email, password)
+	sally := tu.validateTestAccount(t, email, password)
+
+	login := func(t *testing.T) *accountsv1.AuthenticateResponse {
+		res, err := tu.accounts.Authenticate(context.Background(), &accountsv1.AuthenticateRequest{
+			Email:    email,
+			Password: password,
+		})
+		require.NoError(t, err)
+		return res
+	}
+
+	laptop := login(t)
+	phone := login(t)
+	laptopCtx := contextWithSignedToken(laptop.Token)
+
+	t.Run("owner-can-list-sessions", func(t *testing.T) {
+		res, err := tu.accounts.ListSessions(laptopCtx, &accountsv1.ListSessionsRequest{AccountId: sally.ID})
+		require.NoError(t, err)
+		require.Len(t, res.Sessions, 2)
+
+		current := 0
+		for _, session := range res.Sessions {
+			if session.IsCurrent {
+				current++
+			}
+		}
+		require.Equal(t, 1, current)
+	})
+
+	t.Run("stranger-cannot-list-sessions", func(t *testing.T) {
+		res, err := tu.accounts.ListSessions(contextWithSignedToken(phone.Token), &accountsv1.ListSessionsRequest{AccountId: "someone-else"})
+		requireErrorHasGRPCCode(t, codes.NotFound, err)
+		require.Nil(t, res)
+	})
+
+	t.Run("owner-can-logout", func(t *testing.T) {
+		_, err := tu.accounts.Logout(contextWithSignedToken(phone.Token), &accountsv1.LogoutRequest{})
+		require.NoError(t, err)
+
+		res, err := tu.accounts.RefreshToken(context.Background(), &accountsv1.RefreshTokenRequest{RefreshToken: phone.RefreshToken})
+		requireErrorHasGRPCCode(t, codes.Unauthenticated, err)
+		require.Nil(t, res)
+
+		sessions, err := tu.sessionsRepository.List(context.Background(), &models.ManySessionsFilter{AccountID: sally.ID}, &models.Pagination{Limit: 20})
+		require.NoError(t, err)
+		require.Len(t, sessions, 1)
+	})
+
+	t.Run("password-update-revokes-other-sessions", func(t *testing.T) {
+		other := login(t)
+		newPassword := tu.randomAlphanumeric()
+
+		_, err := tu.accounts.UpdateAccountPassword(laptopCtx, &accountsv1.UpdateAccountPasswordRequest{
+			AccountId:   sally.ID,
+			Password:    newPassword,
+			OldPassword: password,
+		})
+		require.NoError(t, err)
+		password = newPassword
+
+		res, err := tu.accounts.RefreshToken(context.Background(), &accountsv1.RefreshTokenRequest{RefreshToken: other.RefreshToken})
+		requireErrorHasGRPCCode(t, codes.Unauthenticated, err)
+		require.Nil(t, res)
+
+		refreshed, err := tu.accounts.RefreshToken(context.Background(), &accountsv1.RefreshTokenRequest{RefreshToken: laptop.RefreshToken})
+		require.NoError(t, err)
+		require.NotEmpty(t, refreshed.Token)
+	})
+
+	t.Run("owner-can-revoke-all-sessions", func(t *testing.T) {
+		_, err := tu.accounts.RevokeAllSessions(laptopCtx, &accountsv1.RevokeAllSessionsRequest{AccountId: sally.ID})
+		require.NoError(t, err)
+
+		sessions, err := tu.sessionsRepository.List(context.Background(), &models.ManySessionsFilter{AccountID: sally.ID}, &models.Pagination{Limit: 20})
+		require.NoError(t, err)
+		require.Empty(t, sessions)
+	})
+}
+
+func TestClientInfo(t *testing.T) {
+	proxies, err := parseIPRanges("10.0.0.0/8, ::1")
+	require.NoError(t, err)
+	srv := &accountsAPI{trustedProxies: proxies}
+
+	clientIP := func(peerAddress string, forwardedFor string) string {
+		ctx := peer.NewContext(context.TODO(), &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP(peerAddress), Port: 4242}})
+		ctx = metadata.NewIncomingContext(ctx, metadata.Pairs("x-forwarded-for", forwardedFor))
+		return srv.clientInfo(ctx).IPAddress
+	}
+
+	require.Equal(t, "203.0.113.7", clientIP("203.0.113.7", "198.51.100.1"), "untrusted peer")
+	require.Equal(t, "198.51.100.1", clientIP("10.1.2.3", "198.51.100.1"))
+	require.Equal(t, "198.51.100.1", clientIP("::1", "192.0.2.9, 198.51.100.1, 10.0.0.2"), "spoofed and proxy addresses")
+	require.Equal(t, "10.1.2.3", clientIP("10.1.2.3", "not-an-ip"))
+
+	_, err = parseIPRanges("10.0.0.0/33")
+	require.Error(t, err)
+}
+
+// The API of testUtils uses auth.TestService, which never consults the
+// sessions, so this test signs real tokens.
+func TestRevokedSessionIsRejected(t *testing.T) {
+	tu := newTestUtilsOrDie(t)
+	_, priv, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	srv := *tu.accounts.(*testAccountsAPI).srv
+	srv.auth = auth.NewService(auth.NewKeyring(priv), auth.WithSessionValidator(&sessionValidator{repo: tu.sessionsRepository}))
+	api := newTestAccountsAPI(&srv)
+
+	email := tu.randomAlphanumeric() + "@gmail.com"
+	tu.newTestAccount(t, "Revoked", email, "123456")
+	acc := tu.validateTestAccount(t, email, "123456")
+
+	login := func(t *testing.T) string {
+		res, err := api.Authenticate(context.TODO(), &accountsv1.AuthenticateRequest{Email: email, Password: "123456"})
+		require.NoError(t, err)
+
+		_, err = api.GetAccount(contextWithSignedToken(res.Token), &accountsv1.GetAccountRequest{AccountId: acc.ID})
+		require.NoError(t, err)
+		return res.Token
+	}
+
+	t.Run("logout", func(t *testing.T) {
+		ctx := contextWithSignedToken(login(t))
+
+		_, err := api.Logout(ctx, &accountsv1.LogoutRequest{})
+		require.NoError(t, err)
+
+		_, err = api.GetAccount(ctx, &accountsv1.GetAccountRequest{AccountId: acc.ID})
+		requireErrorHasGRPCCode(t, codes.Unauthenticated, err)
+	})
+
+	t.Run("revoke-session", func(t *testing.T) {
+		revoked := login(t)
+		token, err := srv.auth.ParseToken(context.TODO(), revoked)
+		require.NoError(t, err)
+
+		_, err = api.RevokeSession(contextWithSignedToken(login(t)), &accountsv1.RevokeSessionRequest{AccountId: acc.ID, SessionId: token.SessionID})
+		require.NoError(t, err)
+
+		_, err = srv.auth.ParseToken(context.TODO(), revoked)
+		require.ErrorIs(t, err, auth.ErrSessionRevoked)
+		_, err = api.GetAccount(contextWithSignedToken(revoked), &accountsv1.GetAccountRequest{AccountId: acc.ID})
+		requireErrorHasGRPCCode(t, codes.Unauthenticated, err)
+	})
+}
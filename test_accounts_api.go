@@ -0,0 +1,285 @@
+package main
+
+import (
+	"accounts-service/auth"
+	accountsv1 "accounts-service/protorepo/noted/accounts/v1"
+	"context"
+
+	"google.golang.org/grpc"
+)
+
+// testAccountsAPI calls the handlers of an accountsAPI through the
+// authorization interceptor, like the gRPC server does.
+type testAccountsAPI struct {
+	srv        *accountsAPI
+	authorizer *auth.Authorizer
+}
+
+var _ accountsv1.AccountsAPIServer = &testAccountsAPI{}
+
+func newTestAccountsAPI(srv *accountsAPI) *testAccountsAPI {
+	return &testAccountsAPI{srv: srv, authorizer: newAuthorizer(srv.auth)}
+}
+
+func intercept[Req any, Res any](api *testAccountsAPI, ctx context.Context, method string, in Req, handler func(context.Context, Req) (*Res, error)) (*Res, error) {
+	info := &grpc.UnaryServerInfo{Server: api.srv, FullMethod: "/" + accountsv1.AccountsAPI_ServiceDesc.ServiceName + "/" + method}
+	res, err := api.authorizer.UnaryInterceptor(ctx, in, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return handler(ctx, req.(Req))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res.(*Res), nil
+}
+
+func (api *testAccountsAPI) CreateAccount(ctx context.Context, in *accountsv1.CreateAccountRequest) (*accountsv1.CreateAccountResponse, error) {
+	return intercept(api, ctx, "CreateAccount", in, api.srv.CreateAccount)
+}
+
+func (api *testAccountsAPI) ValidateAccount(ctx context.Context, in *accountsv1.ValidateAccountRequest) (*accountsv1.ValidateAccountResponse, error) {
+	return intercept(api, ctx, "ValidateAccount", in, api.srv.ValidateAccount)
+}
+
+func (api *testAccountsAPI) GetAccount(ctx context.Context, in *accountsv1.GetAccountRequest) (*accountsv1.GetAccountResponse, error) {
+	return intercept(api, ctx, "GetAccount", in, api.srv.GetAccount)
+}
+
+func (api *testAccountsAPI) GetMailsFromIDs(ctx context.Context, in *accountsv1.GetMailsFromIDsRequest) (*accountsv1.GetMailsFromIDsResponse, error) {
+	return intercept(api, ctx, "GetMailsFromIDs", in, api.srv.GetMailsFromIDs)
+}
+
+func (api *testAccountsAPI) UpdateAccount(ctx context.Context, in *accountsv1.UpdateAccountRequest) (*accountsv1.UpdateAccountResponse, error) {
+	return intercept(api, ctx, "UpdateAccount", in, api.srv.UpdateAccount)
+}
+
+func (api *testAccountsAPI) DeleteAccount(ctx context.Context, in *accountsv1.DeleteAccountRequest) (*accountsv1.DeleteAccountResponse, error) {
+	return intercept(api, ctx, "DeleteAccount", in, api.srv.DeleteAccount)
+}
+
+func (api *testAccountsAPI) ListAccounts(ctx context.Context, in *accountsv1.ListAccountsRequest) (*accountsv1.ListAccountsResponse, error) {
+	return intercept(api, ctx, "ListAccounts", in, api.srv.ListAccounts)
+}
+
+func (api *testAccountsAPI) ForgetAccountPassword(ctx context.Context, in *accountsv1.ForgetAccountPasswordRequest) (*accountsv1.ForgetAccountPasswordResponse, error) {
+	return intercept(api, ctx, "ForgetAccountPassword", in, api.srv.ForgetAccountPassword)
+}
+
+func (api *testAccountsAPI) ForgetAccountPasswordValidateToken(ctx context.Context, in *accountsv1.ForgetAccountPasswordValidateTokenRequest) (*accountsv1.ForgetAccountPasswordValidateTokenResponse, error) {
+	return intercept(api, ctx, "ForgetAccountPasswordValidateToken", in, api.srv.ForgetAccountPasswordValidateToken)
+}
+
+func (api *testAccountsAPI) UpdateAccountPassword(ctx context.Context, in *accountsv1.UpdateAccountPasswordRequest) (*accountsv1.UpdateAccountPasswordResponse, error) {
+	return intercept(api, ctx, "UpdateAccountPassword", in, api.srv.UpdateAccountPassword)
+}
+
+func (api *testAccountsAPI) SendGroupInviteMail(ctx context.Context, in *accountsv1.SendGroupInviteMailRequest) (*accountsv1.SendGroupInviteMailResponse, error) {
+	return intercept(api, ctx, "SendGroupInviteMail", in, api.srv.SendGroupInviteMail)
+}
+
+func (api *testAccountsAPI) Authenticate(ctx context.Context, in *accountsv1.AuthenticateRequest) (*accountsv1.AuthenticateResponse, error) {
+	return intercept(api, ctx, "Authenticate", in, api.srv.Authenticate)
+}
+
+func (api *testAccountsAPI) RefreshToken(ctx context.Context, in *accountsv1.RefreshTokenRequest) (*accountsv1.RefreshTokenResponse, error) {
+	return intercept(api, ctx, "RefreshToken", in, api.srv.RefreshToken)
+}
+
+func (api *testAccountsAPI) GetAccessTokenGoogle(ctx context.Context, in *accountsv1.GetAccessTokenGoogleRequest) (*accountsv1.GetAccessTokenGoogleResponse, error) {
+	return intercept(api, ctx, "GetAccessTokenGoogle", in, api.srv.GetAccessTokenGoogle)
+}
+
+func (api *testAccountsAPI) AuthenticateGoogle(ctx context.Context, in *accountsv1.AuthenticateGoogleRequest) (*accountsv1.AuthenticateGoogleResponse, error) {
+	return intercept(api, ctx, "AuthenticateGoogle", in, api.srv.AuthenticateGoogle)
+}
+
+func (api *testAccountsAPI) RegisterUserToMobileBeta(ctx context.Context, in *accountsv1.RegisterUserToMobileBetaRequest) (*accountsv1.RegisterUserToMobileBetaResponse, error) {
+	return intercept(api, ctx, "RegisterUserToMobileBeta", in, api.srv.RegisterUserToMobileBeta)
+}
+
+func (api *testAccountsAPI) IsAccountValidate(ctx context.Context, in *accountsv1.IsAccountValidateRequest) (*accountsv1.IsAccountValidateResponse, error) {
+	return intercept(api, ctx, "IsAccountValidate", in, api.srv.IsAccountValidate)
+}
+
+func (api *testAccountsAPI) SendValidationToken(ctx context.Context, in *accountsv1.SendValidationTokenRequest) (*accountsv1.SendValidationTokenResponse, error) {
+	return intercept(api, ctx, "SendValidationToken", in, api.srv.SendValidationToken)
+}
+
+func (api *testAccountsAPI) ListSessions(ctx context.Context, in *accountsv1.ListSessionsRequest) (*accountsv1.ListSessionsResponse, error) {
+	return intercept(api, ctx, "ListSessions", in, api.srv.ListSessions)
+}
+
+func (api *testAccountsAPI) RevokeSession(ctx context.Context, in *accountsv1.RevokeSessionRequest) (*accountsv1.RevokeSessionResponse, error) {
+	return intercept(api, ctx, "RevokeSession", in, api.srv.RevokeSession)
+}
+
+func (api *testAccountsAPI) RevokeAllSessions(ctx context.Context, in *accountsv1.RevokeAllSessionsRequest) (*accountsv1.RevokeAllSessionsResponse, error) {
+	return intercept(api, ctx, "RevokeAllSessions", in, api.srv.RevokeAllSessions)
+}
+
+func (api *testAccountsAPI) Logout(ctx context.Context, in *accountsv1.LogoutRequest) (*accountsv1.LogoutResponse, error) {
+	return intercept(api, ctx, "Logout", in, api.srv.Logout)
+}
+
+func (api *testAccountsAPI) GetJSONWebKeySet(ctx context.Context, in *accountsv1.GetJSONWebKeySetRequest) (*accountsv1.GetJSONWebKeySetResponse, error) {
+	return intercept(api, ctx, "GetJSONWebKeySet", in, api.srv.GetJSONWebKeySet)
+}
+
+func (api *testAccountsAPI) AuthenticateService(ctx context.Context, in *accountsv1.AuthenticateServiceRequest) (*accountsv1.AuthenticateServiceResponse, error) {
+	return intercept(api, ctx, "AuthenticateService", in, api.srv.AuthenticateService)
+}
+
+func (api *testAccountsAPI) SearchAccounts(ctx context.Context, in *accountsv1.SearchAccountsRequest) (*accountsv1.SearchAccountsResponse, error) {
+	return intercept(api, ctx, "SearchAccounts", in, api.srv.SearchAccounts)
+}
+
+func (api *testAccountsAPI) SuspendAccount(ctx context.Context, in *accountsv1.SuspendAccountRequest) (*accountsv1.SuspendAccountResponse, error) {
+	return intercept(api, ctx, "SuspendAccount", in, api.srv.SuspendAccount)
+}
+
+func (api *testAccountsAPI) ReinstateAccount(ctx context.Context, in *accountsv1.ReinstateAccountRequest) (*accountsv1.ReinstateAccountResponse, error) {
+	return intercept(api, ctx, "ReinstateAccount", in, api.srv.ReinstateAccount)
+}
+
+func (api *testAccountsAPI) ForceDeleteAccount(ctx context.Context, in *accountsv1.ForceDeleteAccountRequest) (*accountsv1.ForceDeleteAccountResponse, error) {
+	return intercept(api, ctx, "ForceDeleteAccount", in, api.srv.ForceDeleteAccount)
+}
+
+func (api *testAccountsAPI) EnrollTOTP(ctx context.Context, in *accountsv1.EnrollTOTPRequest) (*accountsv1.EnrollTOTPResponse, error) {
+	return intercept(api, ctx, "EnrollTOTP", in, api.srv.EnrollTOTP)
+}
+
+func (api *testAccountsAPI) ConfirmTOTP(ctx context.Context, in *accountsv1.ConfirmTOTPRequest) (*accountsv1.ConfirmTOTPResponse, error) {
+	return intercept(api, ctx, "ConfirmTOTP", in, api.srv.ConfirmTOTP)
+}
+
+func (api *testAccountsAPI) DisableTOTP(ctx context.Context, in *accountsv1.DisableTOTPRequest) (*accountsv1.DisableTOTPResponse, error) {
+	return intercept(api, ctx, "DisableTOTP", in, api.srv.DisableTOTP)
+}
+
+func (api *testAccountsAPI) RegenerateRecoveryCodes(ctx context.Context, in *accountsv1.RegenerateRecoveryCodesRequest) (*accountsv1.RegenerateRecoveryCodesResponse, error) {
+	return intercept(api, ctx, "RegenerateRecoveryCodes", in, api.srv.RegenerateRecoveryCodes)
+}
+
+func (api *testAccountsAPI) CompleteSecondFactor(ctx context.Context, in *accountsv1.CompleteSecondFactorRequest) (*accountsv1.CompleteSecondFactorResponse, error) {
+	return intercept(api, ctx, "CompleteSecondFactor", in, api.srv.CompleteSecondFactor)
+}
+
+func (api *testAccountsAPI) BeginPasskeyRegistration(ctx context.Context, in *accountsv1.BeginPasskeyRegistrationRequest) (*accountsv1.BeginPasskeyRegistrationResponse, error) {
+	return intercept(api, ctx, "BeginPasskeyRegistration", in, api.srv.BeginPasskeyRegistration)
+}
+
+func (api *testAccountsAPI) FinishPasskeyRegistration(ctx context.Context, in *accountsv1.FinishPasskeyRegistrationRequest) (*accountsv1.FinishPasskeyRegistrationResponse, error) {
+	return intercept(api, ctx, "FinishPasskeyRegistration", in, api.srv.FinishPasskeyRegistration)
+}
+
+func (api *testAccountsAPI) BeginPasskeyLogin(ctx context.Context, in *accountsv1.BeginPasskeyLoginRequest) (*accountsv1.BeginPasskeyLoginResponse, error) {
+	return intercept(api, ctx, "BeginPasskeyLogin", in, api.srv.BeginPasskeyLogin)
+}
+
+func (api *testAccountsAPI) FinishPasskeyLogin(ctx context.Context, in *accountsv1.FinishPasskeyLoginRequest) (*accountsv1.FinishPasskeyLoginResponse, error) {
+	return intercept(api, ctx, "FinishPasskeyLogin", in, api.srv.FinishPasskeyLogin)
+}
+
+func (api *testAccountsAPI) RequestLoginCode(ctx context.Context, in *accountsv1.RequestLoginCodeRequest) (*accountsv1.RequestLoginCodeResponse, error) {
+	return intercept(api, ctx, "RequestLoginCode", in, api.srv.RequestLoginCode)
+}
+
+func (api *testAccountsAPI) LoginWithCode(ctx context.Context, in *accountsv1.LoginWithCodeRequest) (*accountsv1.LoginWithCodeResponse, error) {
+	return intercept(api, ctx, "LoginWithCode", in, api.srv.LoginWithCode)
+}
+
+func (api *testAccountsAPI) BeginAuthenticateWithProvider(ctx context.Context, in *accountsv1.BeginAuthenticateWithProviderRequest) (*accountsv1.BeginAuthenticateWithProviderResponse, error) {
+	return intercept(api, ctx, "BeginAuthenticateWithProvider", in, api.srv.BeginAuthenticateWithProvider)
+}
+
+func (api *testAccountsAPI) AuthenticateWithProvider(ctx context.Context, in *accountsv1.AuthenticateWithProviderRequest) (*accountsv1.AuthenticateWithProviderResponse, error) {
+	return intercept(api, ctx, "AuthenticateWithProvider", in, api.srv.AuthenticateWithProvider)
+}
+
+func (api *testAccountsAPI) ListLinkedIdentities(ctx context.Context, in *accountsv1.ListLinkedIdentitiesRequest) (*accountsv1.ListLinkedIdentitiesResponse, error) {
+	return intercept(api, ctx, "ListLinkedIdentities", in, api.srv.ListLinkedIdentities)
+}
+
+func (api *testAccountsAPI) BeginLinkIdentity(ctx context.Context, in *accountsv1.BeginLinkIdentityRequest) (*accountsv1.BeginLinkIdentityResponse, error) {
+	return intercept(api, ctx, "BeginLinkIdentity", in, api.srv.BeginLinkIdentity)
+}
+
+func (api *testAccountsAPI) LinkIdentity(ctx context.Context, in *accountsv1.LinkIdentityRequest) (*accountsv1.LinkIdentityResponse, error) {
+	return intercept(api, ctx, "LinkIdentity", in, api.srv.LinkIdentity)
+}
+
+func (api *testAccountsAPI) UnlinkIdentity(ctx context.Context, in *accountsv1.UnlinkIdentityRequest) (*accountsv1.UnlinkIdentityResponse, error) {
+	return intercept(api, ctx, "UnlinkIdentity", in, api.srv.UnlinkIdentity)
+}
+
+func (api *testAccountsAPI) SetPassword(ctx context.Context, in *accountsv1.SetPasswordRequest) (*accountsv1.SetPasswordResponse, error) {
+	return intercept(api, ctx, "SetPassword", in, api.srv.SetPassword)
+}
+
+func (api *testAccountsAPI) AuthorizeOAuthClient(ctx context.Context, in *accountsv1.AuthorizeOAuthClientRequest) (*accountsv1.AuthorizeOAuthClientResponse, error) {
+	return intercept(api, ctx, "AuthorizeOAuthClient", in, api.srv.AuthorizeOAuthClient)
+}
+
+func (api *testAccountsAPI) ExchangeOAuthToken(ctx context.Context, in *accountsv1.ExchangeOAuthTokenRequest) (*accountsv1.ExchangeOAuthTokenResponse, error) {
+	return intercept(api, ctx, "ExchangeOAuthToken", in, api.srv.ExchangeOAuthToken)
+}
+
+func (api *testAccountsAPI) GetOAuthUserInfo(ctx context.Context, in *accountsv1.GetOAuthUserInfoRequest) (*accountsv1.GetOAuthUserInfoResponse, error) {
+	return intercept(api, ctx, "GetOAuthUserInfo", in, api.srv.GetOAuthUserInfo)
+}
+
+func (api *testAccountsAPI) GetOpenIDConfiguration(ctx context.Context, in *accountsv1.GetOpenIDConfigurationRequest) (*accountsv1.GetOpenIDConfigurationResponse, error) {
+	return intercept(api, ctx, "GetOpenIDConfiguration", in, api.srv.GetOpenIDConfiguration)
+}
+
+func (api *testAccountsAPI) ListAuthorizedApps(ctx context.Context, in *accountsv1.ListAuthorizedAppsRequest) (*accountsv1.ListAuthorizedAppsResponse, error) {
+	return intercept(api, ctx, "ListAuthorizedApps", in, api.srv.ListAuthorizedApps)
+}
+
+func (api *testAccountsAPI) RevokeAuthorizedApp(ctx context.Context, in *accountsv1.RevokeAuthorizedAppRequest) (*accountsv1.RevokeAuthorizedAppResponse, error) {
+	return intercept(api, ctx, "RevokeAuthorizedApp", in, api.srv.RevokeAuthorizedApp)
+}
+
+func (api *testAccountsAPI) CreatePersonalAccessToken(ctx context.Context, in *accountsv1.CreatePersonalAccessTokenRequest) (*accountsv1.CreatePersonalAccessTokenResponse, error) {
+	return intercept(api, ctx, "CreatePersonalAccessToken", in, api.srv.CreatePersonalAccessToken)
+}
+
+func (api *testAccountsAPI) ListPersonalAccessTokens(ctx context.Context, in *accountsv1.ListPersonalAccessTokensRequest) (*accountsv1.ListPersonalAccessTokensResponse, error) {
+	return intercept(api, ctx, "ListPersonalAccessTokens", in, api.srv.ListPersonalAccessTokens)
+}
+
+func (api *testAccountsAPI) RevokePersonalAccessToken(ctx context.Context, in *accountsv1.RevokePersonalAccessTokenRequest) (*accountsv1.RevokePersonalAccessTokenResponse, error) {
+	return intercept(api, ctx, "RevokePersonalAccessToken", in, api.srv.RevokePersonalAccessToken)
+}
+
+func (api *testAccountsAPI) StartDeviceAuthorization(ctx context.Context, in *accountsv1.StartDeviceAuthorizationRequest) (*accountsv1.StartDeviceAuthorizationResponse, error) {
+	return intercept(api, ctx, "StartDeviceAuthorization", in, api.srv.StartDeviceAuthorization)
+}
+
+func (api *testAccountsAPI) ApproveDevice(ctx context.Context, in *accountsv1.ApproveDeviceRequest) (*accountsv1.ApproveDeviceResponse, error) {
+	return intercept(api, ctx, "ApproveDevice", in, api.srv.ApproveDevice)
+}
+
+func (api *testAccountsAPI) PollDeviceToken(ctx context.Context, in *accountsv1.PollDeviceTokenRequest) (*accountsv1.PollDeviceTokenResponse, error) {
+	return intercept(api, ctx, "PollDeviceToken", in, api.srv.PollDeviceToken)
+}
+
+func (api *testAccountsAPI) CreateLoginRequest(ctx context.Context, in *accountsv1.CreateLoginRequestRequest) (*accountsv1.CreateLoginRequestResponse, error) {
+	return intercept(api, ctx, "CreateLoginRequest", in, api.srv.CreateLoginRequest)
+}
+
+func (api *testAccountsAPI) ApproveLoginRequest(ctx context.Context, in *accountsv1.ApproveLoginRequestRequest) (*accountsv1.ApproveLoginRequestResponse, error) {
+	return intercept(api, ctx, "ApproveLoginRequest", in, api.srv.ApproveLoginRequest)
+}
+
+func (api *testAccountsAPI) PollLoginRequest(ctx context.Context, in *accountsv1.PollLoginRequestRequest) (*accountsv1.PollLoginRequestResponse, error) {
+	return intercept(api, ctx, "PollLoginRequest", in, api.srv.PollLoginRequest)
+}
+
+func (api *testAccountsAPI) Reauthenticate(ctx context.Context, in *accountsv1.ReauthenticateRequest) (*accountsv1.ReauthenticateResponse, error) {
+	return intercept(api, ctx, "Reauthenticate", in, api.srv.Reauthenticate)
+}
+
+func (api *testAccountsAPI) IntrospectToken(ctx context.Context, in *accountsv1.IntrospectTokenRequest) (*accountsv1.IntrospectTokenResponse, error) {
+	return intercept(api, ctx, "IntrospectToken", in, api.srv.IntrospectToken)
+}
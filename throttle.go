@@ -0,0 +1,201 @@
+package main
+
+import (
+	"accounts-service/models"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// Kinds of credentials whose failed attempts are counted separately, so that
+// guessing one of them does not lock the others. Verification tokens are
+// counted under the kind of their purpose.
+const (
+	throttlePassword = "password"
+	throttleUserCode = "user_code"
+
+	// Counted across the codes of the account, since requesting a new code
+	// resets the attempts allowed by the previous one.
+	throttleLoginCode = "login_code"
+
+	throttleSecondFactor = "second_factor"
+)
+
+const (
+	// Number of failures allowed before locking an account or an IP
+	// address. IP addresses are shared by many users behind NATs and
+	// proxies, so they are given more leeway.
+	throttleAccountFreeFailures = 5
+	throttleIPFreeFailures      = 20
+
+	// The lockout starts at throttleBaseDelay and doubles with each failure
+	// until throttleMaxDelay.
+	throttleBaseDelay = 30 * time.Second
+	throttleMaxDelay  = time.Hour
+
+	// Failures are forgotten after this duration without new failure.
+	throttleWindow = 24 * time.Hour
+)
+
+// throttleKey identifies a failed attempt counter along with the number of
+// failures it allows before locking. Counters of accounts are reset once the
+// credential is proven.
+type throttleKey struct {
+	id           string
+	freeFailures int
+	account      bool
+}
+
+// accountThrottleKey returns the counter of the attempts to prove the kind
+// of credential of the account.
+func accountThrottleKey(kind string, accountID string) throttleKey {
+	return throttleKey{id: fmt.Sprintf("%s:account:%s", kind, accountID), freeFailures: throttleAccountFreeFailures, account: true}
+}
+
+// throttleKeys returns the counters of the attempts to prove the kind of
+// credential of the account from the IP address of the client. An empty
+// accountID only returns the counter of the IP address.
+func (srv *accountsAPI) throttleKeys(ctx context.Context, kind string, accountID string) []throttleKey {
+	keys := []throttleKey{}
+	if accountID != "" {
+		keys = append(keys, accountThrottleKey(kind, accountID))
+	}
+	if ip := srv.clientInfo(ctx).IPAddress; ip != "" {
+		keys = append(keys, throttleKey{id: "ip:" + ip, freeFailures: throttleIPFreeFailures})
+	}
+	return keys
+}
+
+// throttleDelay returns how long a counter of failures is locked after its
+// last failure.
+func throttleDelay(failures int, freeFailures int) time.Duration {
+	if failures < freeFailures {
+		return 0
+	}
+	delay := throttleBaseDelay
+	for i := freeFailures; i < failures && delay < throttleMaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > throttleMaxDelay {
+		delay = throttleMaxDelay
+	}
+	return delay
+}
+
+// reserveAttempt counts an attempt on each counter before the credential is
+// checked, so that concurrent attempts cannot all pass a lock checked before
+// any of them failed. The attempt stays counted as a failure unless it is
+// released or the throttle is reset. If one of the counters was locked, the
+// attempt is released and ResourceExhausted is returned along with the delay
+// after which to retry.
+func (srv *accountsAPI) reserveAttempt(ctx context.Context, keys []throttleKey) error {
+	var retryAfter time.Duration
+	for i, key := range keys {
+		throttle, err := srv.throttles.RecordFailure(ctx, &models.OneThrottleFilter{ID: key.id}, time.Now().UTC().Add(throttleWindow))
+		if err != nil {
+			srv.releaseAttempt(ctx, keys[:i])
+			return statusFromModelError(err)
+		}
+
+		// The counter is locked by the failures before this attempt.
+		remaining := time.Until(throttle.PreviousFailureAt.Add(throttleDelay(throttle.Failures-1, key.freeFailures)))
+		if remaining > retryAfter {
+			retryAfter = remaining
+		}
+	}
+
+	if retryAfter <= 0 {
+		return nil
+	}
+	srv.releaseAttempt(ctx, keys)
+
+	st, err := status.New(codes.ResourceExhausted, "too many failed attempts, try again later").
+		WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(retryAfter.Round(time.Second))})
+	if err != nil {
+		return status.Error(codes.ResourceExhausted, "too many failed attempts, try again later")
+	}
+	return st.Err()
+}
+
+// releaseAttempt uncounts an attempt reserved on each counter, when it
+// neither proved nor failed to prove the credential.
+func (srv *accountsAPI) releaseAttempt(ctx context.Context, keys []throttleKey) {
+	for _, key := range keys {
+		err := srv.throttles.CancelFailure(ctx, &models.OneThrottleFilter{ID: key.id})
+		if err != nil {
+			srv.logger.Error("failed to release attempt", zap.Error(err), zap.String("throttle", key.id))
+		}
+	}
+}
+
+// resetThrottle forgets the failures of the account once it proved the
+// credential. The counter of the IP address is only released, so that an
+// attacker cannot reset it with an account of their own.
+func (srv *accountsAPI) resetThrottle(ctx context.Context, keys []throttleKey) {
+	for _, key := range keys {
+		if !key.account {
+			srv.releaseAttempt(ctx, []throttleKey{key})
+			continue
+		}
+		err := srv.throttles.Delete(ctx, &models.OneThrottleFilter{ID: key.id})
+		if err != nil {
+			srv.logger.Error("failed to reset failed attempts", zap.Error(err), zap.String("throttle", key.id))
+		}
+	}
+}
+
+// verifyPassword returns the account registered with email if password is
+// its password. Failed attempts are throttled per account and IP address.
+func (srv *accountsAPI) verifyPassword(ctx context.Context, email string, password string) (*models.Account, error) {
+	// The IP address is reserved first so that unknown emails are throttled
+	// too.
+	keys := srv.throttleKeys(ctx, throttlePassword, "")
+	err := srv.reserveAttempt(ctx, keys)
+	if err != nil {
+		return nil, err
+	}
+
+	acc, err := srv.repo.Get(ctx, &models.OneAccountFilter{Email: email})
+	if err != nil {
+		if !errors.Is(err, models.ErrNotFound) {
+			srv.releaseAttempt(ctx, keys)
+		}
+		return nil, statusFromModelError(err)
+	}
+
+	if acc.Hash == nil {
+		srv.releaseAttempt(ctx, keys)
+		return nil, errAccountWithoutPassword
+	}
+
+	accountKeys := []throttleKey{accountThrottleKey(throttlePassword, acc.ID)}
+	err = srv.reserveAttempt(ctx, accountKeys)
+	if err != nil {
+		srv.releaseAttempt(ctx, keys)
+		return nil, err
+	}
+	keys = append(accountKeys, keys...)
+
+	ok, needsRehash, err := srv.comparePassword(acc, password)
+	if err != nil {
+		srv.releaseAttempt(ctx, keys)
+		return nil, err
+	}
+	if !ok {
+		return nil, status.Error(codes.InvalidArgument, "wrong password or email")
+	}
+	srv.resetThrottle(ctx, keys)
+
+	if needsRehash {
+		srv.upgradePasswordHash(ctx, acc, password)
+	}
+
+	return acc, nil
+}
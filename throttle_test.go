@@ -0,0 +1,121 @@
+package main
+
+import (
+	"accounts-service/auth"
+	accountsv1 "accounts-service/protorepo/noted/accounts/v1"
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestThrottleDelay(t *testing.T) {
+	require.Equal(t, time.Duration(0), throttleDelay(4, 5))
+	require.Equal(t, throttleBaseDelay, throttleDelay(5, 5))
+	require.Equal(t, 4*throttleBaseDelay, throttleDelay(7, 5))
+	require.Equal(t, throttleMaxDelay, throttleDelay(1000, 5))
+}
+
+func TestAuthenticateIsThrottled(t *testing.T) {
+	tu := newTestUtilsOrDie(t)
+	email := tu.randomAlphanumeric() + "@gmail.fr"
+	tu.newTestAccount(t, "Throttled", email, "123456")
+
+	for i := 0; i < throttleAccountFreeFailures; i++ {
+		_, err := tu.accounts.Authenticate(context.TODO(), &accountsv1.AuthenticateRequest{Email: email, Password: "wrong-password"})
+		requireErrorHasGRPCCode(t, codes.InvalidArgument, err)
+	}
+
+	// The right password is rejected as well while the account is locked.
+	_, err := tu.accounts.Authenticate(context.TODO(), &accountsv1.AuthenticateRequest{Email: email, Password: "123456"})
+	requireErrorHasGRPCCode(t, codes.ResourceExhausted, err)
+
+	st, _ := status.FromError(err)
+	require.Len(t, st.Details(), 1)
+	retryInfo, ok := st.Details()[0].(*errdetails.RetryInfo)
+	require.True(t, ok)
+	require.InDelta(t, throttleBaseDelay.Seconds(), retryInfo.RetryDelay.AsDuration().Seconds(), 2)
+}
+
+// slowPasswordHasher counts the passwords it verifies, taking long enough to
+// let concurrent attempts overlap.
+type slowPasswordHasher struct {
+	auth.PasswordHasher
+	verified int32
+}
+
+func (h *slowPasswordHasher) Verify(hash []byte, password string) (bool, bool, error) {
+	atomic.AddInt32(&h.verified, 1)
+	time.Sleep(100 * time.Millisecond)
+	return h.PasswordHasher.Verify(hash, password)
+}
+
+func TestConcurrentAttemptsAreThrottled(t *testing.T) {
+	tu := newTestUtilsOrDie(t)
+	srv := *tu.accounts.(*testAccountsAPI).srv
+	hasher := &slowPasswordHasher{PasswordHasher: srv.passwords}
+	srv.passwords = hasher
+	email := tu.randomAlphanumeric() + "@gmail.fr"
+	tu.newTestAccount(t, "Throttled", email, "123456")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4*throttleAccountFreeFailures; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _ = srv.Authenticate(context.TODO(), &accountsv1.AuthenticateRequest{Email: email, Password: "wrong-password"})
+		}()
+	}
+	wg.Wait()
+
+	require.LessOrEqual(t, int(atomic.LoadInt32(&hasher.verified)), throttleAccountFreeFailures)
+}
+
+func TestConfirmTOTPIsThrottled(t *testing.T) {
+	tu := newTestUtilsOrDie(t)
+	email := tu.randomAlphanumeric() + "@gmail.fr"
+	tu.newTestAccount(t, "Throttled", email, "123456")
+	acc := tu.validateTestAccount(t, email, "123456")
+
+	enrollment, err := tu.accounts.EnrollTOTP(acc.Context, &accountsv1.EnrollTOTPRequest{AccountId: acc.ID})
+	require.NoError(t, err)
+
+	for i := 0; i < throttleAccountFreeFailures; i++ {
+		_, err := tu.accounts.ConfirmTOTP(acc.Context, &accountsv1.ConfirmTOTPRequest{AccountId: acc.ID, Code: "000000"})
+		requireErrorHasGRPCCode(t, codes.InvalidArgument, err)
+	}
+
+	code, err := auth.TOTPCode(enrollment.Secret, time.Now())
+	require.NoError(t, err)
+	_, err = tu.accounts.ConfirmTOTP(acc.Context, &accountsv1.ConfirmTOTPRequest{AccountId: acc.ID, Code: code})
+	requireErrorHasGRPCCode(t, codes.ResourceExhausted, err)
+}
+
+func TestSecondFactorIsThrottled(t *testing.T) {
+	tu := newTestUtilsOrDie(t)
+	email := tu.randomAlphanumeric() + "@gmail.fr"
+	tu.newTestAccount(t, "Throttled", email, "123456")
+	acc := tu.validateTestAccount(t, email, "123456")
+
+	enrollment, err := tu.accounts.EnrollTOTP(acc.Context, &accountsv1.EnrollTOTPRequest{AccountId: acc.ID})
+	require.NoError(t, err)
+	code, err := auth.TOTPCode(enrollment.Secret, time.Now())
+	require.NoError(t, err)
+	confirmation, err := tu.accounts.ConfirmTOTP(acc.Context, &accountsv1.ConfirmTOTPRequest{AccountId: acc.ID, Code: code})
+	require.NoError(t, err)
+
+	for i := 0; i < throttleAccountFreeFailures; i++ {
+		_, err := tu.accounts.RegenerateRecoveryCodes(acc.Context, &accountsv1.RegenerateRecoveryCodesRequest{AccountId: acc.ID, Code: "000000"})
+		requireErrorHasGRPCCode(t, codes.InvalidArgument, err)
+	}
+
+	// Other methods checking a second factor share the counter.
+	_, err = tu.accounts.DisableTOTP(acc.Context, &accountsv1.DisableTOTPRequest{AccountId: acc.ID, Code: confirmation.RecoveryCodes[0]})
+	requireErrorHasGRPCCode(t, codes.ResourceExhausted, err)
+}
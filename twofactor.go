@@ -0,0 +1,358 @@
+package main
+
+import (
+	"accounts-service/auth"
+	"accounts-service/models"
+	accountsv1 "accounts-service/protorepo/noted/accounts/v1"
+	"accounts-service/validators"
+	"context"
+	"errors"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// Name under which the accounts are registered in authenticator
+	// applications.
+	totpIssuer = "Noted"
+
+	recoveryCodesCount = 10
+
+	challengeLifetime    = 5 * time.Minute
+	challengeMaxAttempts = 5
+)
+
+var errInvalidSecondFactor = status.Error(codes.InvalidArgument, "invalid code")
+
+// EnrollTOTP generates the secret of a new authenticator. It is only
+// required to log in once confirmed with ConfirmTOTP.
+func (srv *accountsAPI) EnrollTOTP(ctx context.Context, in *accountsv1.EnrollTOTPRequest) (*accountsv1.EnrollTOTPResponse, error) {
+	token, err := srv.principal(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	err = validators.ValidateEnrollTOTPRequest(in)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	acc, err := srv.getOwnAccount(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	if acc.HasSecondFactor() {
+		return nil, status.Error(codes.FailedPrecondition, "two-factor authentication already enabled")
+	}
+
+	// Otherwise a stolen token could enroll an authenticator of its own and
+	// lock the owner out.
+	err = srv.requireRecentAuthentication(ctx, token, sensitiveOperationMaxAuthAge)
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		srv.logger.Error("failed to generate totp secret", zap.Error(err))
+		return nil, status.Error(codes.Internal, "failed to enroll authenticator")
+	}
+
+	_, err = srv.repo.SetTOTPSecret(ctx, &models.OneAccountFilter{ID: acc.ID}, secret)
+	if err != nil {
+		return nil, statusFromModelError(err)
+	}
+
+	return &accountsv1.EnrollTOTPResponse{
+		Secret: secret,
+		Uri:    auth.TOTPURI(totpIssuer, *acc.Email, secret),
+	}, nil
+}
+
+// ConfirmTOTP enables two-factor authentication once the user proves that
+// the authenticator was set up, and returns the recovery codes.
+func (srv *accountsAPI) ConfirmTOTP(ctx context.Context, in *accountsv1.ConfirmTOTPRequest) (*accountsv1.ConfirmTOTPResponse, error) {
+	token, err := srv.principal(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	err = validators.ValidateConfirmTOTPRequest(in)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	acc, err := srv.getOwnAccount(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	if acc.HasSecondFactor() {
+		return nil, status.Error(codes.FailedPrecondition, "two-factor authentication already enabled")
+	}
+	if acc.TOTPSecret == "" {
+		return nil, status.Error(codes.FailedPrecondition, "no authenticator enrolled")
+	}
+
+	err = srv.requireRecentAuthentication(ctx, token, sensitiveOperationMaxAuthAge)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := srv.throttleKeys(ctx, throttleSecondFactor, acc.ID)
+	err = srv.reserveAttempt(ctx, keys)
+	if err != nil {
+		return nil, err
+	}
+	step, ok := auth.ValidateTOTP(acc.TOTPSecret, in.Code, time.Now())
+	if !ok {
+		return nil, errInvalidSecondFactor
+	}
+	srv.resetThrottle(ctx, keys)
+
+	recoveryCodes, hashes, err := srv.generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = srv.repo.EnableTOTP(ctx, &models.OneAccountFilter{ID: acc.ID}, step, hashes)
+	if err != nil {
+		return nil, statusFromModelError(err)
+	}
+
+	return &accountsv1.ConfirmTOTPResponse{RecoveryCodes: recoveryCodes}, nil
+}
+
+func (srv *accountsAPI) DisableTOTP(ctx context.Context, in *accountsv1.DisableTOTPRequest) (*accountsv1.DisableTOTPResponse, error) {
+	token, err := srv.principal(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	err = validators.ValidateDisableTOTPRequest(in)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	acc, err := srv.getOwnAccount(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	if !acc.HasSecondFactor() {
+		return nil, status.Error(codes.FailedPrecondition, "two-factor authentication not enabled")
+	}
+
+	err = srv.requireRecentAuthentication(ctx, token, sensitiveOperationMaxAuthAge)
+	if err != nil {
+		return nil, err
+	}
+
+	err = srv.verifySecondFactor(ctx, acc, in.Code)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = srv.repo.DisableTOTP(ctx, &models.OneAccountFilter{ID: acc.ID})
+	if err != nil {
+		return nil, statusFromModelError(err)
+	}
+
+	return &accountsv1.DisableTOTPResponse{}, nil
+}
+
+// RegenerateRecoveryCodes replaces the recovery codes of the account, used
+// or not.
+func (srv *accountsAPI) RegenerateRecoveryCodes(ctx context.Context, in *accountsv1.RegenerateRecoveryCodesRequest) (*accountsv1.RegenerateRecoveryCodesResponse, error) {
+	token, err := srv.principal(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	err = validators.ValidateRegenerateRecoveryCodesRequest(in)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	acc, err := srv.getOwnAccount(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	if !acc.HasSecondFactor() {
+		return nil, status.Error(codes.FailedPrecondition, "two-factor authentication not enabled")
+	}
+
+	err = srv.verifySecondFactor(ctx, acc, in.Code)
+	if err != nil {
+		return nil, err
+	}
+
+	recoveryCodes, hashes, err := srv.generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = srv.repo.UpdateRecoveryCodes(ctx, &models.OneAccountFilter{ID: acc.ID}, hashes)
+	if err != nil {
+		return nil, statusFromModelError(err)
+	}
+
+	return &accountsv1.RegenerateRecoveryCodesResponse{RecoveryCodes: recoveryCodes}, nil
+}
+
+// CompleteSecondFactor exchanges the challenge returned by an authentication
+// RPC along with a TOTP or recovery code for a token.
+func (srv *accountsAPI) CompleteSecondFactor(ctx context.Context, in *accountsv1.CompleteSecondFactorRequest) (*accountsv1.CompleteSecondFactorResponse, error) {
+	err := validators.ValidateCompleteSecondFactorRequest(in)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	filter := &models.OneChallengeFilter{ID: auth.HashSecret(in.Challenge), Purpose: models.ChallengePurposeSecondFactor}
+	challenge, err := srv.challenges.Attempt(ctx, filter, challengeMaxAttempts)
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			return nil, status.Error(codes.Unauthenticated, "invalid or expired challenge")
+		}
+		return nil, statusFromModelError(err)
+	}
+
+	acc, err := srv.repo.Get(ctx, &models.OneAccountFilter{ID: challenge.AccountID})
+	if err != nil {
+		return nil, statusFromModelError(err)
+	}
+
+	err = srv.verifySecondFactor(ctx, acc, in.Code)
+	if err != nil {
+		return nil, err
+	}
+
+	err = srv.challenges.Delete(ctx, filter)
+	if err != nil {
+		// The challenge was answered concurrently.
+		return nil, status.Error(codes.Unauthenticated, "invalid or expired challenge")
+	}
+
+	methods := []string{auth.AuthMethodOTP, auth.AuthMethodMultiFactor}
+	if first := challenge.Data["amr"]; first != "" {
+		methods = append([]string{first}, methods...)
+	}
+	tokenString, refreshToken, err := srv.issueTokens(ctx, acc, methods...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &accountsv1.CompleteSecondFactorResponse{Token: tokenString, RefreshToken: refreshToken}, nil
+}
+
+// getOwnAccount returns the account of the caller, which the policies of
+// the owner-only methods ensure is the account targeted by the request.
+func (srv *accountsAPI) getOwnAccount(ctx context.Context, token *auth.Token) (*models.Account, error) {
+	acc, err := srv.repo.Get(ctx, &models.OneAccountFilter{ID: token.AccountID})
+	if err != nil {
+		return nil, statusFromModelError(err)
+	}
+	return acc, nil
+}
+
+// createSecondFactorChallenge returns the challenge which must be answered
+// with a second factor to log in to acc, which proved the first factor with
+// method.
+func (srv *accountsAPI) createSecondFactorChallenge(ctx context.Context, acc *models.Account, method string) (string, error) {
+	if acc.IsSuspended() {
+		return "", status.Error(codes.PermissionDenied, "account suspended")
+	}
+	return srv.createChallengeWithData(ctx, models.ChallengePurposeSecondFactor, acc.ID, map[string]string{"amr": method})
+}
+
+// createChallenge stores the hash of a new challenge and returns it.
+func (srv *accountsAPI) createChallenge(ctx context.Context, purpose string, accountID string) (string, error) {
+	return srv.createChallengeWithData(ctx, purpose, accountID, nil)
+}
+
+// createChallengeWithData is like createChallenge but keeps data along with
+// the challenge.
+func (srv *accountsAPI) createChallengeWithData(ctx context.Context, purpose string, accountID string, data map[string]string) (string, error) {
+	challenge, err := auth.GenerateSecret(32)
+	if err != nil {
+		srv.logger.Error("failed to generate challenge", zap.Error(err))
+		return "", status.Error(codes.Internal, "failed to generate challenge")
+	}
+
+	_, err = srv.challenges.Create(ctx, &models.ChallengePayload{
+		ID:        auth.HashSecret(challenge),
+		Purpose:   purpose,
+		AccountID: accountID,
+		ExpiresAt: time.Now().UTC().Add(challengeLifetime),
+		Data:      data,
+	})
+	if err != nil {
+		return "", statusFromModelError(err)
+	}
+
+	return challenge, nil
+}
+
+// verifySecondFactor consumes either a TOTP code or a recovery code of acc.
+// Failed attempts are throttled per account and IP address, on top of the
+// attempts allowed by the challenges answered with it.
+func (srv *accountsAPI) verifySecondFactor(ctx context.Context, acc *models.Account, code string) error {
+	keys := srv.throttleKeys(ctx, throttleSecondFactor, acc.ID)
+	err := srv.reserveAttempt(ctx, keys)
+	if err != nil {
+		return err
+	}
+
+	err = srv.consumeSecondFactor(ctx, acc, code)
+	if err != nil {
+		if err != errInvalidSecondFactor {
+			srv.releaseAttempt(ctx, keys)
+		}
+		return err
+	}
+	srv.resetThrottle(ctx, keys)
+
+	return nil
+}
+
+// consumeSecondFactor marks the TOTP step or the recovery code given as
+// code as used.
+func (srv *accountsAPI) consumeSecondFactor(ctx context.Context, acc *models.Account, code string) error {
+	filter := &models.OneAccountFilter{ID: acc.ID}
+
+	step, ok := auth.ValidateTOTP(acc.TOTPSecret, code, time.Now())
+	if ok {
+		_, err := srv.repo.UseTOTPStep(ctx, filter, step)
+		if errors.Is(err, models.ErrNotFound) {
+			return errInvalidSecondFactor
+		}
+		return statusFromModelError(err)
+	}
+
+	_, err := srv.repo.UseRecoveryCode(ctx, filter, auth.HashSecret(auth.NormalizeRecoveryCode(code)))
+	if errors.Is(err, models.ErrNotFound) {
+		return errInvalidSecondFactor
+	}
+	return statusFromModelError(err)
+}
+
+// generateRecoveryCodes returns new recovery codes along with their hashes.
+func (srv *accountsAPI) generateRecoveryCodes() ([]string, []string, error) {
+	recoveryCodes := make([]string, recoveryCodesCount)
+	hashes := make([]string, recoveryCodesCount)
+	for i := range recoveryCodes {
+		code, err := auth.GenerateRecoveryCode()
+		if err != nil {
+			srv.logger.Error("failed to generate recovery code", zap.Error(err))
+			return nil, nil, status.Error(codes.Internal, "failed to generate recovery codes")
+		}
+		recoveryCodes[i] = code
+		hashes[i] = auth.HashSecret(auth.NormalizeRecoveryCode(code))
+	}
+	return recoveryCodes, hashes, nil
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"accounts-service/auth"
+	"accounts-service/models"
+	accountsv1 "accounts-service/protorepo/noted/accounts/v1"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+)
+
+func TestTwoFactorAuthentication(t *testing.T) {
+	tu := newTestUtilsOrDie(t)
+	email := tu.randomAlphanumeric() + "@gmail.fr"
+	password := "123456"
+	tu.newTestAccount(t, "Two Factor", email, password)
+	acc := tu.validateTestAccount(t, email, password)
+
+	var secret string
+	var recoveryCodes []string
+
+	t.Run("stale-session-cannot-enroll", func(t *testing.T) {
+		staleCtx, err := tu.auth.ContextWithToken(context.TODO(), &auth.Token{AccountID: acc.ID, AuthTime: time.Now().Add(-time.Hour).Unix()})
+		require.NoError(t, err)
+
+		_, err = tu.accounts.EnrollTOTP(staleCtx, &accountsv1.EnrollTOTPRequest{AccountId: acc.ID})
+		requireErrorHasGRPCCode(t, codes.PermissionDenied, err)
+
+		res, err := tu.accounts.EnrollTOTP(acc.Context, &accountsv1.EnrollTOTPRequest{AccountId: acc.ID})
+		require.NoError(t, err)
+		code, err := auth.TOTPCode(res.Secret, time.Now())
+		require.NoError(t, err)
+		_, err = tu.accounts.ConfirmTOTP(staleCtx, &accountsv1.ConfirmTOTPRequest{AccountId: acc.ID, Code: code})
+		requireErrorHasGRPCCode(t, codes.PermissionDenied, err)
+	})
+
+	t.Run("cannot-confirm-with-wrong-code", func(t *testing.T) {
+		res, err := tu.accounts.EnrollTOTP(acc.Context, &accountsv1.EnrollTOTPRequest{AccountId: acc.ID})
+		require.NoError(t, err)
+		require.Contains(t, res.Uri, "otpauth://totp/")
+		secret = res.Secret
+
+		_, err = tu.accounts.ConfirmTOTP(acc.Context, &accountsv1.ConfirmTOTPRequest{AccountId: acc.ID, Code: "000000"})
+		requireErrorHasGRPCCode(t, codes.InvalidArgument, err)
+	})
+
+	t.Run("can-confirm-enrollment", func(t *testing.T) {
+		code, err := auth.TOTPCode(secret, time.Now())
+		require.NoError(t, err)
+
+		res, err := tu.accounts.ConfirmTOTP(acc.Context, &accountsv1.ConfirmTOTPRequest{AccountId: acc.ID, Code: code})
+		require.NoError(t, err)
+		require.Len(t, res.RecoveryCodes, recoveryCodesCount)
+		recoveryCodes = res.RecoveryCodes
+	})
+
+	t.Run("authenticate-returns-challenge", func(t *testing.T) {
+		res, err := tu.accounts.Authenticate(context.TODO(), &accountsv1.AuthenticateRequest{Email: email, Password: password})
+		require.NoError(t, err)
+		require.Empty(t, res.Token)
+		require.NotEmpty(t, res.Challenge)
+
+		// The code of the confirmation was consumed, use the next one.
+		code, err := auth.TOTPCode(secret, time.Now().Add(30*time.Second))
+		require.NoError(t, err)
+		completed, err := tu.accounts.CompleteSecondFactor(context.TODO(), &accountsv1.CompleteSecondFactorRequest{Challenge: res.Challenge, Code: code})
+		require.NoError(t, err)
+		require.NotEmpty(t, completed.Token)
+		require.NotEmpty(t, completed.RefreshToken)
+
+		_, err = tu.accounts.CompleteSecondFactor(context.TODO(), &accountsv1.CompleteSecondFactorRequest{Challenge: res.Challenge, Code: recoveryCodes[0]})
+		requireErrorHasGRPCCode(t, codes.Unauthenticated, err)
+	})
+
+	t.Run("reset-code-returns-challenge", func(t *testing.T) {
+		plantVerificationToken(t, tu, models.VerificationPurposeResetPassword, acc.ID, "", "424242")
+
+		res, err := tu.accounts.ForgetAccountPasswordValidateToken(context.TODO(), &accountsv1.ForgetAccountPasswordValidateTokenRequest{AccountId: acc.ID, Token: "424242"})
+		require.NoError(t, err)
+		require.Empty(t, res.AuthToken)
+		require.NotEmpty(t, res.ResetToken)
+		require.NotEmpty(t, res.Challenge)
+	})
+
+	t.Run("recovery-code-is-single-use", func(t *testing.T) {
+		res, err := tu.accounts.Authenticate(context.TODO(), &accountsv1.AuthenticateRequest{Email: email, Password: password})
+		require.NoError(t, err)
+
+		_, err = tu.accounts.CompleteSecondFactor(context.TODO(), &accountsv1.CompleteSecondFactorRequest{Challenge: res.Challenge, Code: recoveryCodes[1]})
+		require.NoError(t, err)
+
+		res, err = tu.accounts.Authenticate(context.TODO(), &accountsv1.AuthenticateRequest{Email: email, Password: password})
+		require.NoError(t, err)
+
+		_, err = tu.accounts.CompleteSecondFactor(context.TODO(), &accountsv1.CompleteSecondFactorRequest{Challenge: res.Challenge, Code: recoveryCodes[1]})
+		requireErrorHasGRPCCode(t, codes.InvalidArgument, err)
+	})
+
+	t.Run("can-disable", func(t *testing.T) {
+		_, err := tu.accounts.DisableTOTP(acc.Context, &accountsv1.DisableTOTPRequest{AccountId: acc.ID, Code: recoveryCodes[2]})
+		require.NoError(t, err)
+
+		res, err := tu.accounts.Authenticate(context.TODO(), &accountsv1.AuthenticateRequest{Email: email, Password: password})
+		require.NoError(t, err)
+		require.NotEmpty(t, res.Token)
+	})
+}
@@ -9,23 +9,40 @@ import (
 
 	"accounts-service/models"
 	"accounts-service/models/mongo"
+	"accounts-service/webauthn"
+	"accounts-service/webauthn/webauthntest"
 
 	"github.com/jaevor/go-nanoid"
 	"github.com/stretchr/testify/require"
 	"go.uber.org/zap"
-	"golang.org/x/crypto/bcrypt"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 )
 
 type testUtils struct {
-	logger             *zap.Logger
-	auth               *auth.TestService
-	db                 *mongo.Database
-	accountsRepository models.AccountsRepository
-	accounts           accountsv1.AccountsAPIServer
-	newUUID            func() string
-	randomAlphanumeric func() string
+	logger                    *zap.Logger
+	auth                      *auth.TestService
+	db                        *mongo.Database
+	accountsRepository        models.AccountsRepository
+	refreshTokensRepository   models.RefreshTokensRepository
+	sessionsRepository        models.SessionsRepository
+	serviceAccountsRepository models.ServiceAccountsRepository
+	challengesRepository      models.ChallengesRepository
+	passkeysRepository        models.PasskeysRepository
+	throttlesRepository       models.ThrottlesRepository
+	accounts                  accountsv1.AccountsAPIServer
+	newUUID                   func() string
+	randomAlphanumeric        func() string
+
+	verificationTokensRepository models.VerificationTokensRepository
+	identitiesRepository         models.IdentitiesRepository
+	oauthClientsRepository       models.OAuthClientsRepository
+	consentsRepository           models.ConsentsRepository
+
+	personalAccessTokensRepository models.PersonalAccessTokensRepository
+	deviceAuthorizationsRepository models.DeviceAuthorizationsRepository
+	loginRequestsRepository        models.LoginRequestsRepository
 }
 
 func newTestUtilsOrDie(t *testing.T) *testUtils {
@@ -40,23 +57,78 @@ func newTestUtilsOrDie(t *testing.T) *testUtils {
 		t.Skip("skipping test, unable to connect to mongodb")
 	}
 	accountsRepository := mongo.NewAccountsRepository(db.DB, logger)
+	refreshTokensRepository := mongo.NewRefreshTokensRepository(db.DB, logger)
+	sessionsRepository := mongo.NewSessionsRepository(db.DB, logger)
+	serviceAccountsRepository := mongo.NewServiceAccountsRepository(db.DB, logger)
+	challengesRepository := mongo.NewChallengesRepository(db.DB, logger)
+	passkeysRepository := mongo.NewPasskeysRepository(db.DB, logger)
+	throttlesRepository := mongo.NewThrottlesRepository(db.DB, logger)
+	verificationTokensRepository := mongo.NewVerificationTokensRepository(db.DB, logger)
+	identitiesRepository := mongo.NewIdentitiesRepository(db.DB, logger)
+	oauthClientsRepository := mongo.NewOAuthClientsRepository(db.DB, logger)
+	consentsRepository := mongo.NewConsentsRepository(db.DB, logger)
+	personalAccessTokensRepository := mongo.NewPersonalAccessTokensRepository(db.DB, logger)
+	deviceAuthorizationsRepository := mongo.NewDeviceAuthorizationsRepository(db.DB, logger)
+	loginRequestsRepository := mongo.NewLoginRequestsRepository(db.DB, logger)
+	auth.PersonalAccessTokens = &personalAccessTokenResolver{repo: personalAccessTokensRepository, accounts: accountsRepository}
 	newUUID, err := nanoid.Standard(21)
 	require.NoError(t, err)
 	randomAlphanumeric, err := nanoid.CustomASCII("0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ", 8)
 	require.NoError(t, err)
 
 	return &testUtils{
-		logger:             logger,
-		auth:               auth,
-		db:                 db,
-		newUUID:            newUUID,
-		randomAlphanumeric: randomAlphanumeric,
-		accountsRepository: accountsRepository,
-		accounts: &accountsAPI{
-			auth:   auth,
-			logger: logger,
-			repo:   accountsRepository,
-		},
+		logger:                    logger,
+		auth:                      auth,
+		db:                        db,
+		newUUID:                   newUUID,
+		randomAlphanumeric:        randomAlphanumeric,
+		accountsRepository:        accountsRepository,
+		refreshTokensRepository:   refreshTokensRepository,
+		sessionsRepository:        sessionsRepository,
+		serviceAccountsRepository: serviceAccountsRepository,
+		challengesRepository:      challengesRepository,
+		passkeysRepository:        passkeysRepository,
+		throttlesRepository:       throttlesRepository,
+		accounts: newTestAccountsAPI(&accountsAPI{
+			auth:                 auth,
+			logger:               logger,
+			repo:                 accountsRepository,
+			refreshTokens:        refreshTokensRepository,
+			sessions:             sessionsRepository,
+			serviceAccounts:      serviceAccountsRepository,
+			passwords:            testPasswordHasher,
+			passwordPolicy:       testPasswordPolicy,
+			challenges:           challengesRepository,
+			passkeys:             passkeysRepository,
+			throttles:            throttlesRepository,
+			relyingParty:         testRelyingParty,
+			refreshTokenLifetime: time.Hour,
+
+			verificationTokens:     verificationTokensRepository,
+			identities:             identitiesRepository,
+			oauthClients:           oauthClientsRepository,
+			consents:               consentsRepository,
+			verificationCodeLength: 6,
+			passwordHistoryDepth:   2,
+
+			accessTokenLifetime: time.Minute,
+			oauthIssuer:         "https://accounts.example.com",
+			oauthConsentURL:     "https://noted.example.com/oauth/authorize",
+			deviceVerifyURL:     "https://noted.example.com/device",
+
+			personalAccessTokens: personalAccessTokensRepository,
+			deviceAuthorizations: deviceAuthorizationsRepository,
+			loginRequests:        loginRequestsRepository,
+		}),
+
+		verificationTokensRepository: verificationTokensRepository,
+		identitiesRepository:         identitiesRepository,
+		oauthClientsRepository:       oauthClientsRepository,
+		consentsRepository:           consentsRepository,
+
+		personalAccessTokensRepository: personalAccessTokensRepository,
+		deviceAuthorizationsRepository: deviceAuthorizationsRepository,
+		loginRequestsRepository:        loginRequestsRepository,
 	}
 }
 
@@ -81,12 +153,13 @@ func (tu *testUtils) validateTestAccount(t *testing.T, email string, password st
 
 	acc, err := tu.accountsRepository.Get(context.TODO(), &models.OneAccountFilter{Email: email})
 	require.NoError(t, err)
-	err = bcrypt.CompareHashAndPassword(*acc.Hash, []byte(password))
+	ok, _, err := testPasswordHasher.Verify(*acc.Hash, password)
 	require.NoError(t, err)
+	require.True(t, ok)
 
 	res, err := tu.accountsRepository.UpdateAccountValidationState(context.TODO(), &models.OneAccountFilter{Email: email, IsValidated: false})
 	require.NoError(t, err)
-	ctx, err := tu.auth.ContextWithToken(context.TODO(), &auth.Token{AccountID: res.ID})
+	ctx, err := tu.auth.ContextWithToken(context.TODO(), &auth.Token{AccountID: res.ID, AuthTime: time.Now().Unix(), AuthMethods: []string{auth.AuthMethodPassword}})
 	require.NoError(t, err)
 	return &testAccount{
 		ID:      res.ID,
@@ -94,8 +167,37 @@ func (tu *testUtils) validateTestAccount(t *testing.T, email string, password st
 	}
 }
 
+// newTestServiceContext returns the context of a machine identity granted
+// scopes.
+func (tu *testUtils) newTestServiceContext(t *testing.T, scopes ...string) context.Context {
+	ctx, err := tu.auth.ContextWithToken(context.TODO(), &auth.Token{ServiceID: "notes-service", Scopes: scopes})
+	require.NoError(t, err)
+	return ctx
+}
+
+// contextWithSignedToken returns a context authenticated with a token
+// returned by one of the authentication RPCs.
+func contextWithSignedToken(token string) context.Context {
+	return metadata.AppendToOutgoingContext(context.TODO(), auth.AuthorizationHeaderKey, auth.AuthorizationHeaderPrefix+" "+token)
+}
+
 func requireErrorHasGRPCCode(t *testing.T, code codes.Code, err error) {
 	s, ok := status.FromError(err)
 	require.True(t, ok, "expected grpc code %v got non-grpc error code", code)
 	require.Equal(t, code, s.Code(), "expected grpc code %v got %v: %v", code, s.Code(), err)
 }
+
+// testRelyingParty is the relying party of the passkeys registered by the
+// tests, with authenticators created by newTestAuthenticator.
+var testRelyingParty = &webauthn.RelyingParty{ID: "noted.test", Name: "Noted", Origins: []string{"https://noted.test"}}
+
+// testPasswordHasher uses cheap parameters to keep the tests fast.
+var testPasswordHasher = auth.NewArgon2idHasher(auth.Argon2idParams{Memory: 64, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32})
+
+// testPasswordPolicy accepts the short passwords of the tests. The policy
+// itself is tested by TestPasswordPolicy.
+var testPasswordPolicy = &auth.PasswordPolicy{MinLength: 4}
+
+func newTestAuthenticator() *webauthntest.Authenticator {
+	return webauthntest.NewAuthenticator(testRelyingParty.ID, testRelyingParty.Origins[0])
+}
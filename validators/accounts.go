@@ -3,18 +3,23 @@ package validators
 import (
 	accountsv1 "accounts-service/protorepo/noted/accounts/v1"
 	"errors"
+	"net/url"
 
 	validation "github.com/go-ozzo/ozzo-validation/v4"
 	"github.com/go-ozzo/ozzo-validation/v4/is"
 )
 
+// Passwords are checked against the password policy by the service. This
+// bound only keeps them cheap to hash.
+const maxPasswordLength = 1024
+
 type notSameRecipientAndSenderRule struct{}
 
 func ValidateCreateAccountRequest(in *accountsv1.CreateAccountRequest) error {
 	return validation.ValidateStruct(in,
 		validation.Field(&in.Name, validation.Required, validation.Length(4, 20)),
 		validation.Field(&in.Email, validation.Required, is.Email),
-		validation.Field(&in.Password, validation.Required, validation.Length(4, 20)),
+		validation.Field(&in.Password, validation.Required, validation.Length(1, maxPasswordLength)),
 	)
 }
 
@@ -64,7 +69,68 @@ func ValidateRegisterUserToMobileBeta(in *accountsv1.RegisterUserToMobileBetaReq
 func ValidateAuthenticateRequest(in *accountsv1.AuthenticateRequest) error {
 	return validation.ValidateStruct(in,
 		validation.Field(&in.Email, validation.Required, is.Email),
-		validation.Field(&in.Password, validation.Required, validation.Length(4, 20)),
+		validation.Field(&in.Password, validation.Required, validation.Length(1, maxPasswordLength)),
+	)
+}
+
+func ValidateRefreshTokenRequest(in *accountsv1.RefreshTokenRequest) error {
+	return validation.ValidateStruct(in,
+		validation.Field(&in.RefreshToken, validation.Required),
+	)
+}
+
+func ValidateListSessionsRequest(in *accountsv1.ListSessionsRequest) error {
+	return validation.ValidateStruct(in,
+		validation.Field(&in.AccountId, validation.Required),
+		validation.Field(&in.Limit, validation.Min(0)),
+		validation.Field(&in.Offset, validation.Min(0)),
+	)
+}
+
+func ValidateRevokeSessionRequest(in *accountsv1.RevokeSessionRequest) error {
+	return validation.ValidateStruct(in,
+		validation.Field(&in.AccountId, validation.Required),
+		validation.Field(&in.SessionId, validation.Required),
+	)
+}
+
+func ValidateRevokeAllSessionsRequest(in *accountsv1.RevokeAllSessionsRequest) error {
+	return validation.ValidateStruct(in,
+		validation.Field(&in.AccountId, validation.Required),
+	)
+}
+
+func ValidateAuthenticateServiceRequest(in *accountsv1.AuthenticateServiceRequest) error {
+	return validation.ValidateStruct(in,
+		validation.Field(&in.ClientId, validation.Required),
+		validation.Field(&in.ClientSecret, validation.Required),
+	)
+}
+
+func ValidateSearchAccountsRequest(in *accountsv1.SearchAccountsRequest) error {
+	return validation.ValidateStruct(in,
+		validation.Field(&in.Query, validation.Required, validation.Length(1, 100)),
+		validation.Field(&in.Limit, validation.Min(0)),
+		validation.Field(&in.Offset, validation.Min(0)),
+	)
+}
+
+func ValidateSuspendAccountRequest(in *accountsv1.SuspendAccountRequest) error {
+	return validation.ValidateStruct(in,
+		validation.Field(&in.AccountId, validation.Required),
+		validation.Field(&in.Reason, validation.Length(0, 500)),
+	)
+}
+
+func ValidateReinstateAccountRequest(in *accountsv1.ReinstateAccountRequest) error {
+	return validation.ValidateStruct(in,
+		validation.Field(&in.AccountId, validation.Required),
+	)
+}
+
+func ValidateForceDeleteAccountRequest(in *accountsv1.ForceDeleteAccountRequest) error {
+	return validation.ValidateStruct(in,
+		validation.Field(&in.AccountId, validation.Required),
 	)
 }
 
@@ -87,16 +153,16 @@ func ValidateForgetAccountPasswordRequest(in *accountsv1.ForgetAccountPasswordRe
 
 func ValidateForgetAccountPasswordValidateTokenRequest(in *accountsv1.ForgetAccountPasswordValidateTokenRequest) error {
 	return validation.ValidateStruct(in,
-		validation.Field(&in.Token, validation.Required, validation.Length(4, 4)),
+		validation.Field(&in.Token, validation.Required, validation.Length(4, 64)),
 		validation.Field(&in.AccountId, validation.Required, validation.NotNil))
 }
 
 func ValidateUpdateAccountPasswordRequest(in *accountsv1.UpdateAccountPasswordRequest) error {
 	return validation.ValidateStruct(in,
 		validation.Field(&in.AccountId, validation.Required),
-		validation.Field(&in.Password, validation.Required, validation.Length(4, 20)),
-		validation.Field(&in.Token, validation.When(in.Token != ""), validation.Length(4, 4)),
-		validation.Field(&in.OldPassword, validation.When(in.OldPassword != ""), validation.Length(4, 20)),
+		validation.Field(&in.Password, validation.Required, validation.Length(1, maxPasswordLength)),
+		validation.Field(&in.Token, validation.When(in.Token != ""), validation.Length(4, 64)),
+		validation.Field(&in.OldPassword, validation.Length(0, maxPasswordLength)),
 	)
 }
 
@@ -124,28 +190,261 @@ func ValidateGetAccessTokenGoogleRequest(in *accountsv1.GetAccessTokenGoogleRequ
 
 func ValidateAuthenticateGoogleRequest(in *accountsv1.AuthenticateGoogleRequest) error {
 	return validation.ValidateStruct(in,
-		validation.Field(&in.ClientAccessToken, validation.Required, validation.NotNil),
+		validation.Field(&in.IdToken, validation.Required),
 	)
 }
 
 func ValidateAccountValidationStateRequest(in *accountsv1.ValidateAccountRequest) error {
 	return validation.ValidateStruct(in,
 		validation.Field(&in.Email, validation.Required, is.Email),
-		validation.Field(&in.Password, validation.Required, validation.Length(4, 20)),
-		validation.Field(&in.ValidationToken, validation.Required, validation.Length(4, 4)),
+		validation.Field(&in.Password, validation.Required, validation.Length(1, maxPasswordLength)),
+		validation.Field(&in.ValidationToken, validation.Required, validation.Length(4, 64)),
 	)
 }
 
 func ValidateSendValidationToken(in *accountsv1.SendValidationTokenRequest) error {
 	return validation.ValidateStruct(in,
 		validation.Field(&in.Email, validation.Required, is.Email),
-		validation.Field(&in.Password, validation.Required, validation.Length(4, 20)),
+		validation.Field(&in.Password, validation.Required, validation.Length(1, maxPasswordLength)),
 	)
 }
 
 func ValidateIsAccountValidateRequest(in *accountsv1.IsAccountValidateRequest) error {
 	return validation.ValidateStruct(in,
 		validation.Field(&in.Email, validation.Required, is.Email),
-		validation.Field(&in.Password, validation.Required, validation.Length(4, 20)),
+		validation.Field(&in.Password, validation.Required, validation.Length(1, maxPasswordLength)),
+	)
+}
+
+func ValidateEnrollTOTPRequest(in *accountsv1.EnrollTOTPRequest) error {
+	return validation.ValidateStruct(in,
+		validation.Field(&in.AccountId, validation.Required),
+	)
+}
+
+func ValidateConfirmTOTPRequest(in *accountsv1.ConfirmTOTPRequest) error {
+	return validation.ValidateStruct(in,
+		validation.Field(&in.AccountId, validation.Required),
+		validation.Field(&in.Code, validation.Required, validation.Length(6, 6)),
+	)
+}
+
+func ValidateDisableTOTPRequest(in *accountsv1.DisableTOTPRequest) error {
+	return validation.ValidateStruct(in,
+		validation.Field(&in.AccountId, validation.Required),
+		validation.Field(&in.Code, validation.Required, validation.Length(1, 32)),
+	)
+}
+
+func ValidateRegenerateRecoveryCodesRequest(in *accountsv1.RegenerateRecoveryCodesRequest) error {
+	return validation.ValidateStruct(in,
+		validation.Field(&in.AccountId, validation.Required),
+		validation.Field(&in.Code, validation.Required, validation.Length(1, 32)),
+	)
+}
+
+func ValidateCompleteSecondFactorRequest(in *accountsv1.CompleteSecondFactorRequest) error {
+	return validation.ValidateStruct(in,
+		validation.Field(&in.Challenge, validation.Required),
+		validation.Field(&in.Code, validation.Required, validation.Length(1, 32)),
+	)
+}
+
+func ValidateBeginPasskeyRegistrationRequest(in *accountsv1.BeginPasskeyRegistrationRequest) error {
+	return validation.ValidateStruct(in,
+		validation.Field(&in.AccountId, validation.Required),
+	)
+}
+
+func ValidateFinishPasskeyRegistrationRequest(in *accountsv1.FinishPasskeyRegistrationRequest) error {
+	return validation.ValidateStruct(in,
+		validation.Field(&in.AccountId, validation.Required),
+		validation.Field(&in.Name, validation.Length(0, 64)),
+		validation.Field(&in.ClientDataJson, validation.Required),
+		validation.Field(&in.AttestationObject, validation.Required),
+	)
+}
+
+func ValidateFinishPasskeyLoginRequest(in *accountsv1.FinishPasskeyLoginRequest) error {
+	return validation.ValidateStruct(in,
+		validation.Field(&in.CredentialId, validation.Required),
+		validation.Field(&in.ClientDataJson, validation.Required),
+		validation.Field(&in.AuthenticatorData, validation.Required),
+		validation.Field(&in.Signature, validation.Required),
+	)
+}
+
+func ValidateRequestLoginCodeRequest(in *accountsv1.RequestLoginCodeRequest) error {
+	return validation.ValidateStruct(in,
+		validation.Field(&in.Email, validation.Required, is.Email),
+	)
+}
+
+func ValidateLoginWithCodeRequest(in *accountsv1.LoginWithCodeRequest) error {
+	return validation.ValidateStruct(in,
+		validation.Field(&in.Email, validation.Required, is.Email),
+		validation.Field(&in.Code, validation.Required, validation.Length(6, 6)),
+	)
+}
+
+func ValidateBeginAuthenticateWithProviderRequest(in *accountsv1.BeginAuthenticateWithProviderRequest) error {
+	return validation.ValidateStruct(in,
+		validation.Field(&in.Provider, validation.Required),
+	)
+}
+
+func ValidateAuthenticateWithProviderRequest(in *accountsv1.AuthenticateWithProviderRequest) error {
+	return validation.ValidateStruct(in,
+		validation.Field(&in.Provider, validation.Required),
+		validation.Field(&in.Code, validation.Required),
+		validation.Field(&in.State, validation.Required),
+	)
+}
+
+func ValidateListLinkedIdentitiesRequest(in *accountsv1.ListLinkedIdentitiesRequest) error {
+	return validation.ValidateStruct(in,
+		validation.Field(&in.AccountId, validation.Required),
+	)
+}
+
+func ValidateBeginLinkIdentityRequest(in *accountsv1.BeginLinkIdentityRequest) error {
+	return validation.ValidateStruct(in,
+		validation.Field(&in.AccountId, validation.Required),
+		validation.Field(&in.Provider, validation.Required),
+	)
+}
+
+func ValidateLinkIdentityRequest(in *accountsv1.LinkIdentityRequest) error {
+	return validation.ValidateStruct(in,
+		validation.Field(&in.AccountId, validation.Required),
+		validation.Field(&in.Provider, validation.Required),
+		validation.Field(&in.Code, validation.Required),
+		validation.Field(&in.State, validation.Required),
+	)
+}
+
+func ValidateUnlinkIdentityRequest(in *accountsv1.UnlinkIdentityRequest) error {
+	return validation.ValidateStruct(in,
+		validation.Field(&in.AccountId, validation.Required),
+		validation.Field(&in.IdentityId, validation.Required),
+	)
+}
+
+func ValidateSetPasswordRequest(in *accountsv1.SetPasswordRequest) error {
+	return validation.ValidateStruct(in,
+		validation.Field(&in.AccountId, validation.Required),
+		validation.Field(&in.Password, validation.Required, validation.Length(1, maxPasswordLength)),
+	)
+}
+
+func ValidateAuthorizeOAuthClientRequest(in *accountsv1.AuthorizeOAuthClientRequest) error {
+	return validation.ValidateStruct(in,
+		validation.Field(&in.ClientId, validation.Required),
+		validation.Field(&in.RedirectUri, validation.Required),
+		validation.Field(&in.ResponseType, validation.Required, validation.In("code")),
+		validation.Field(&in.Scope, validation.Required),
+		validation.Field(&in.State, validation.Length(0, 512)),
+		validation.Field(&in.Nonce, validation.Length(0, 512)),
+		validation.Field(&in.CodeChallenge, validation.Required, validation.Length(43, 128)),
+		validation.Field(&in.CodeChallengeMethod, validation.Required, validation.In("S256")),
+	)
+}
+
+func ValidateExchangeOAuthTokenRequest(in *accountsv1.ExchangeOAuthTokenRequest) error {
+	isCode := in.GrantType == "authorization_code"
+	return validation.ValidateStruct(in,
+		validation.Field(&in.GrantType, validation.Required, validation.In("authorization_code", "refresh_token")),
+		validation.Field(&in.ClientId, validation.Required),
+		validation.Field(&in.Code, validation.When(isCode, validation.Required)),
+		validation.Field(&in.RedirectUri, validation.When(isCode, validation.Required)),
+		validation.Field(&in.CodeVerifier, validation.When(isCode, validation.Required, validation.Length(43, 128))),
+		validation.Field(&in.RefreshToken, validation.When(!isCode, validation.Required)),
+	)
+}
+
+func ValidateListAuthorizedAppsRequest(in *accountsv1.ListAuthorizedAppsRequest) error {
+	return validation.ValidateStruct(in,
+		validation.Field(&in.AccountId, validation.Required),
+	)
+}
+
+func ValidateRevokeAuthorizedAppRequest(in *accountsv1.RevokeAuthorizedAppRequest) error {
+	return validation.ValidateStruct(in,
+		validation.Field(&in.AccountId, validation.Required),
+		validation.Field(&in.ClientId, validation.Required),
+	)
+}
+
+// ValidateOAuthRedirectURI only accepts the absolute https URIs to which
+// third-party apps are redirected, or http ones on the loopback interface
+// for the apps running on the machine of the user.
+func ValidateOAuthRedirectURI(uri string) error {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return err
+	}
+	if u.Host == "" || u.Fragment != "" {
+		return errors.New("must be an absolute uri without fragment")
+	}
+	switch u.Scheme {
+	case "https":
+		return nil
+	case "http":
+		if u.Hostname() == "localhost" || u.Hostname() == "127.0.0.1" || u.Hostname() == "::1" {
+			return nil
+		}
+	}
+	return errors.New("must use https outside of the loopback interface")
+}
+
+func ValidateCreatePersonalAccessTokenRequest(in *accountsv1.CreatePersonalAccessTokenRequest) error {
+	return validation.ValidateStruct(in,
+		validation.Field(&in.AccountId, validation.Required),
+		validation.Field(&in.Name, validation.Required, validation.Length(1, 64)),
+		validation.Field(&in.Scopes, validation.Required),
+	)
+}
+
+func ValidateListPersonalAccessTokensRequest(in *accountsv1.ListPersonalAccessTokensRequest) error {
+	return validation.ValidateStruct(in,
+		validation.Field(&in.AccountId, validation.Required),
+	)
+}
+
+func ValidateRevokePersonalAccessTokenRequest(in *accountsv1.RevokePersonalAccessTokenRequest) error {
+	return validation.ValidateStruct(in,
+		validation.Field(&in.AccountId, validation.Required),
+		validation.Field(&in.PersonalAccessTokenId, validation.Required),
+	)
+}
+
+func ValidateApproveDeviceRequest(in *accountsv1.ApproveDeviceRequest) error {
+	return validation.ValidateStruct(in,
+		validation.Field(&in.UserCode, validation.Required, validation.Length(8, 16)),
+	)
+}
+
+func ValidatePollDeviceTokenRequest(in *accountsv1.PollDeviceTokenRequest) error {
+	return validation.ValidateStruct(in,
+		validation.Field(&in.DeviceCode, validation.Required),
+	)
+}
+
+func ValidateApproveLoginRequestRequest(in *accountsv1.ApproveLoginRequestRequest) error {
+	return validation.ValidateStruct(in,
+		validation.Field(&in.LoginRequestId, validation.Required),
+	)
+}
+
+func ValidatePollLoginRequestRequest(in *accountsv1.PollLoginRequestRequest) error {
+	return validation.ValidateStruct(in,
+		validation.Field(&in.LoginRequestId, validation.Required),
+		validation.Field(&in.Secret, validation.Required),
+	)
+}
+
+func ValidateIntrospectTokenRequest(in *accountsv1.IntrospectTokenRequest) error {
+	return validation.ValidateStruct(in,
+		validation.Field(&in.Token, validation.Required),
 	)
 }
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"accounts-service/auth"
+	"accounts-service/models"
+	"context"
+	"errors"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// Bounds of the number of digits of the codes sent by email. Guessing a
+	// code is throttled, which keeps short codes safe to use.
+	minVerificationCodeLength = 4
+	maxVerificationCodeLength = 12
+
+	// Size of the reset token exchanged for a password reset code. It is
+	// handed to the client rather than typed in, so it need not be short.
+	resetTokenBytes = 32
+)
+
+var verificationTokenLifetimes = map[string]time.Duration{
+	models.VerificationPurposeValidateEmail:      24 * time.Hour,
+	models.VerificationPurposeResetPassword:      time.Hour,
+	models.VerificationPurposeResetPasswordToken: time.Hour,
+	models.VerificationPurposeChangeEmail:        time.Hour,
+}
+
+var errInvalidVerificationToken = status.Error(codes.NotFound, "invalid or expired token")
+
+// createVerificationToken generates a code to be emailed for purpose, in
+// place of any code previously sent for the same purpose. email is the
+// address the code is sent to when it is not the one of the account.
+func (srv *accountsAPI) createVerificationToken(ctx context.Context, purpose string, accountID string, email string) (string, *models.VerificationToken, error) {
+	code, err := auth.GenerateCode(srv.verificationCodeLength)
+	if err != nil {
+		srv.logger.Error("failed to generate verification code", zap.Error(err))
+		return "", nil, status.Error(codes.Internal, "failed to generate verification code")
+	}
+
+	verificationToken, err := srv.storeVerificationToken(ctx, purpose, accountID, email, code)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return code, verificationToken, nil
+}
+
+func (srv *accountsAPI) storeVerificationToken(ctx context.Context, purpose string, accountID string, email string, token string) (*models.VerificationToken, error) {
+	err := srv.verificationTokens.DeleteMany(ctx, &models.ManyVerificationTokensFilter{Purpose: purpose, AccountID: accountID})
+	if err != nil {
+		return nil, statusFromModelError(err)
+	}
+
+	verificationToken, err := srv.verificationTokens.Create(ctx, &models.VerificationTokenPayload{
+		ID:        verificationTokenHash(accountID, token),
+		Purpose:   purpose,
+		AccountID: accountID,
+		Email:     email,
+		ExpiresAt: time.Now().UTC().Add(verificationTokenLifetimes[purpose]),
+	})
+	if err != nil {
+		return nil, statusFromModelError(err)
+	}
+
+	return verificationToken, nil
+}
+
+// useVerificationToken consumes the token of the account created for
+// purpose. Failed attempts are throttled per account and IP address.
+func (srv *accountsAPI) useVerificationToken(ctx context.Context, purpose string, accountID string, token string) (*models.VerificationToken, error) {
+	keys := srv.throttleKeys(ctx, purpose, accountID)
+	err := srv.reserveAttempt(ctx, keys)
+	if err != nil {
+		return nil, err
+	}
+
+	verificationToken, err := srv.verificationTokens.Use(ctx, &models.OneVerificationTokenFilter{
+		ID:        verificationTokenHash(accountID, token),
+		Purpose:   purpose,
+		AccountID: accountID,
+	})
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			return nil, errInvalidVerificationToken
+		}
+		srv.releaseAttempt(ctx, keys)
+		return nil, statusFromModelError(err)
+	}
+	srv.resetThrottle(ctx, keys)
+
+	return verificationToken, nil
+}
+
+// verificationTokenHash is the ID under which a verification token is
+// stored. The account ID is mixed in so that short codes of distinct
+// accounts do not collide.
+func verificationTokenHash(accountID string, token string) string {
+	return auth.HashSecret(accountID + ":" + token)
+}
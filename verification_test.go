@@ -0,0 +1,51 @@
+package main
+
+import (
+	"accounts-service/models"
+	accountsv1 "accounts-service/protorepo/noted/accounts/v1"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+)
+
+// plantVerificationToken replaces the tokens of the account for purpose
+// with a known one, since the codes sent by email are not observable.
+func plantVerificationToken(t *testing.T, tu *testUtils, purpose string, accountID string, email string, token string) {
+	require.NoError(t, tu.verificationTokensRepository.DeleteMany(context.TODO(), &models.ManyVerificationTokensFilter{Purpose: purpose, AccountID: accountID}))
+	_, err := tu.verificationTokensRepository.Create(context.TODO(), &models.VerificationTokenPayload{
+		ID:        verificationTokenHash(accountID, token),
+		Purpose:   purpose,
+		AccountID: accountID,
+		Email:     email,
+		ExpiresAt: time.Now().UTC().Add(time.Hour),
+	})
+	require.NoError(t, err)
+}
+
+func TestValidateAccount(t *testing.T) {
+	tu := newTestUtilsOrDie(t)
+	email := tu.randomAlphanumeric() + "@gmail.fr"
+	acc := tu.newTestAccount(t, "Unvalidated", email, "123456")
+
+	t.Run("token-of-another-purpose-is-rejected", func(t *testing.T) {
+		plantVerificationToken(t, tu, models.VerificationPurposeResetPassword, acc.ID, "", "424242")
+
+		_, err := tu.accounts.ValidateAccount(context.TODO(), &accountsv1.ValidateAccountRequest{Email: email, Password: "123456", ValidationToken: "424242"})
+		requireErrorHasGRPCCode(t, codes.NotFound, err)
+	})
+
+	t.Run("token-validates-account-once", func(t *testing.T) {
+		plantVerificationToken(t, tu, models.VerificationPurposeValidateEmail, acc.ID, "", "424242")
+
+		res, err := tu.accounts.ValidateAccount(context.TODO(), &accountsv1.ValidateAccountRequest{Email: email, Password: "123456", ValidationToken: "424242"})
+		require.NoError(t, err)
+		require.Equal(t, acc.ID, res.Account.Id)
+
+		validated, err := tu.accountsRepository.Get(context.TODO(), &models.OneAccountFilter{ID: acc.ID})
+		require.NoError(t, err)
+		require.True(t, validated.IsValidated)
+	})
+}
@@ -0,0 +1,37 @@
+package webauthn
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodeCBOR(t *testing.T) {
+	// Examples of RFC 8949 appendix A.
+	for encoded, expected := range map[string]interface{}{
+		"00":                 int64(0),
+		"1903e8":             int64(1000),
+		"3863":               int64(-100),
+		"4401020304":         []byte{1, 2, 3, 4},
+		"6449455446":         "IETF",
+		"83010203":           []interface{}{int64(1), int64(2), int64(3)},
+		"a201020304":         map[interface{}]interface{}{int64(1): int64(2), int64(3): int64(4)},
+		"a26161016162820203": map[interface{}]interface{}{"a": int64(1), "b": []interface{}{int64(2), int64(3)}},
+		"f5":                 true,
+	} {
+		data, err := hex.DecodeString(encoded)
+		require.NoError(t, err)
+		item, rest, err := decodeCBOR(data)
+		require.NoError(t, err, encoded)
+		require.Empty(t, rest)
+		require.Equal(t, expected, item, encoded)
+	}
+
+	for _, malformed := range []string{"", "18", "5f", "44010203", "9b00000000ffffffff", "a1f5f5"} {
+		data, err := hex.DecodeString(malformed)
+		require.NoError(t, err)
+		_, _, err = decodeCBOR(data)
+		require.ErrorIs(t, err, errMalformedCBOR, malformed)
+	}
+}
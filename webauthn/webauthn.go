@@ -0,0 +1,312 @@
+// Package webauthn implements the relying party side of the WebAuthn
+// registration and authentication ceremonies for passkeys.
+//
+// Attestation statements are not verified: the relying party requests no
+// attestation and accepts any authenticator, so only the credential public
+// key embedded in the authenticator data matters.
+package webauthn
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	// Timeout hinted to clients for the ceremonies.
+	Timeout = 5 * time.Minute
+
+	ceremonyCreate = "webauthn.create"
+	ceremonyGet    = "webauthn.get"
+
+	flagUserPresent          = 0x01
+	flagUserVerified         = 0x04
+	flagBackupEligible       = 0x08
+	flagBackedUp             = 0x10
+	flagAttestedCredential   = 0x40
+	authenticatorDataMinSize = 37
+)
+
+var (
+	ErrInvalidClientData        = errors.New("invalid client data")
+	ErrInvalidAuthenticatorData = errors.New("invalid authenticator data")
+	ErrInvalidSignature         = errors.New("invalid assertion signature")
+	ErrSignCount                = errors.New("signature counter did not increase, the authenticator may be cloned")
+)
+
+// RelyingParty verifies the ceremonies of the clients served from Origins
+// for credentials scoped to ID, a registrable domain.
+type RelyingParty struct {
+	ID      string
+	Name    string
+	Origins []string
+}
+
+// User is the account a credential is registered for. ID is the user
+// handle returned by authenticators on login.
+type User struct {
+	ID          []byte
+	Name        string
+	DisplayName string
+}
+
+// Credential is a public key credential created by an authenticator.
+type Credential struct {
+	ID        []byte
+	PublicKey []byte // COSE encoded.
+	SignCount uint32
+	AAGUID    []byte
+	BackedUp  bool
+}
+
+// CreationOptions is the JSON serialization of the
+// PublicKeyCredentialCreationOptions given to navigator.credentials.create.
+type CreationOptions struct {
+	Challenge              string                 `json:"challenge"`
+	RP                     rpEntity               `json:"rp"`
+	User                   userEntity             `json:"user"`
+	PubKeyCredParams       []credentialParameters `json:"pubKeyCredParams"`
+	Timeout                int64                  `json:"timeout"`
+	ExcludeCredentials     []credentialDescriptor `json:"excludeCredentials"`
+	AuthenticatorSelection authenticatorSelection `json:"authenticatorSelection"`
+	Attestation            string                 `json:"attestation"`
+}
+
+// RequestOptions is the JSON serialization of the
+// PublicKeyCredentialRequestOptions given to navigator.credentials.get.
+type RequestOptions struct {
+	Challenge        string                 `json:"challenge"`
+	RPID             string                 `json:"rpId"`
+	Timeout          int64                  `json:"timeout"`
+	AllowCredentials []credentialDescriptor `json:"allowCredentials"`
+	UserVerification string                 `json:"userVerification"`
+}
+
+type rpEntity struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type userEntity struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName"`
+}
+
+type credentialParameters struct {
+	Type string `json:"type"`
+	Alg  int64  `json:"alg"`
+}
+
+type credentialDescriptor struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+}
+
+type authenticatorSelection struct {
+	ResidentKey        string `json:"residentKey"`
+	RequireResidentKey bool   `json:"requireResidentKey"`
+	UserVerification   string `json:"userVerification"`
+}
+
+type clientData struct {
+	Type      string `json:"type"`
+	Challenge string `json:"challenge"`
+	Origin    string `json:"origin"`
+}
+
+// CreationOptions returns the options registering a discoverable credential
+// for user. The authenticators holding one of the exclude credentials are
+// not registered twice.
+func (rp *RelyingParty) CreationOptions(challenge string, user User, exclude [][]byte) *CreationOptions {
+	opts := &CreationOptions{
+		Challenge: challenge,
+		RP:        rpEntity{ID: rp.ID, Name: rp.Name},
+		User: userEntity{
+			ID:          base64.RawURLEncoding.EncodeToString(user.ID),
+			Name:        user.Name,
+			DisplayName: user.DisplayName,
+		},
+		Timeout:            Timeout.Milliseconds(),
+		ExcludeCredentials: []credentialDescriptor{},
+		AuthenticatorSelection: authenticatorSelection{
+			ResidentKey:        "required",
+			RequireResidentKey: true,
+			UserVerification:   "required",
+		},
+		Attestation: "none",
+	}
+	for _, alg := range SupportedAlgorithms {
+		opts.PubKeyCredParams = append(opts.PubKeyCredParams, credentialParameters{Type: "public-key", Alg: alg})
+	}
+	for _, id := range exclude {
+		opts.ExcludeCredentials = append(opts.ExcludeCredentials, credentialDescriptor{Type: "public-key", ID: base64.RawURLEncoding.EncodeToString(id)})
+	}
+	return opts
+}
+
+// RequestOptions returns the options of a login with any discoverable
+// credential of the relying party.
+func (rp *RelyingParty) RequestOptions(challenge string) *RequestOptions {
+	return &RequestOptions{
+		Challenge:        challenge,
+		RPID:             rp.ID,
+		Timeout:          Timeout.Milliseconds(),
+		AllowCredentials: []credentialDescriptor{},
+		UserVerification: "required",
+	}
+}
+
+// ChallengeFromClientData returns the challenge a client signed, so that the
+// ceremony it belongs to can be looked up before being verified.
+func ChallengeFromClientData(clientDataJSON []byte) (string, error) {
+	cd := &clientData{}
+	err := json.Unmarshal(clientDataJSON, cd)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidClientData, err)
+	}
+	return cd.Challenge, nil
+}
+
+// VerifyRegistration verifies the response of an authenticator to
+// navigator.credentials.create and returns the created credential.
+func (rp *RelyingParty) VerifyRegistration(challenge string, clientDataJSON, attestationObject []byte) (*Credential, error) {
+	err := rp.verifyClientData(clientDataJSON, ceremonyCreate, challenge)
+	if err != nil {
+		return nil, err
+	}
+
+	item, _, err := decodeCBOR(attestationObject)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidAuthenticatorData, err)
+	}
+	attestation, ok := item.(map[interface{}]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%w: attestation object is not a map", ErrInvalidAuthenticatorData)
+	}
+	authData, ok := attestation["authData"].([]byte)
+	if !ok {
+		return nil, fmt.Errorf("%w: missing authData", ErrInvalidAuthenticatorData)
+	}
+
+	flags, signCount, err := rp.verifyAuthenticatorData(authData)
+	if err != nil {
+		return nil, err
+	}
+	if flags&flagAttestedCredential == 0 {
+		return nil, fmt.Errorf("%w: missing attested credential data", ErrInvalidAuthenticatorData)
+	}
+
+	// aaguid (16) | credentialIdLength (2) | credentialId | credentialPublicKey
+	data := authData[authenticatorDataMinSize:]
+	if len(data) < 18 {
+		return nil, fmt.Errorf("%w: truncated attested credential data", ErrInvalidAuthenticatorData)
+	}
+	aaguid := data[:16]
+	idLen := int(binary.BigEndian.Uint16(data[16:18]))
+	data = data[18:]
+	if idLen > 1023 || len(data) < idLen {
+		return nil, fmt.Errorf("%w: invalid credential id", ErrInvalidAuthenticatorData)
+	}
+	credentialID := data[:idLen]
+
+	_, rest, err := decodeCBOR(data[idLen:])
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidAuthenticatorData, err)
+	}
+	cosePublicKey := data[idLen : len(data)-len(rest)]
+	_, err = parsePublicKey(cosePublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Credential{
+		ID:        append([]byte{}, credentialID...),
+		PublicKey: append([]byte{}, cosePublicKey...),
+		SignCount: signCount,
+		AAGUID:    append([]byte{}, aaguid...),
+		BackedUp:  flags&flagBackedUp != 0,
+	}, nil
+}
+
+// VerifyAssertion verifies the response of an authenticator holding cred to
+// navigator.credentials.get and returns the new signature counter of cred.
+func (rp *RelyingParty) VerifyAssertion(cred *Credential, challenge string, clientDataJSON, authenticatorData, signature []byte) (uint32, error) {
+	err := rp.verifyClientData(clientDataJSON, ceremonyGet, challenge)
+	if err != nil {
+		return 0, err
+	}
+
+	_, signCount, err := rp.verifyAuthenticatorData(authenticatorData)
+	if err != nil {
+		return 0, err
+	}
+
+	key, err := parsePublicKey(cred.PublicKey)
+	if err != nil {
+		return 0, err
+	}
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	signed := append(append([]byte{}, authenticatorData...), clientDataHash[:]...)
+	if !key.verify(signed, signature) {
+		return 0, ErrInvalidSignature
+	}
+
+	// Authenticators which do not implement the counter, like most synced
+	// passkeys, always report zero.
+	if (signCount != 0 || cred.SignCount != 0) && signCount <= cred.SignCount {
+		return 0, ErrSignCount
+	}
+
+	return signCount, nil
+}
+
+func (rp *RelyingParty) verifyClientData(clientDataJSON []byte, ceremony string, challenge string) error {
+	cd := &clientData{}
+	err := json.Unmarshal(clientDataJSON, cd)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidClientData, err)
+	}
+	if cd.Type != ceremony {
+		return fmt.Errorf("%w: unexpected type %q", ErrInvalidClientData, cd.Type)
+	}
+	if subtle.ConstantTimeCompare([]byte(cd.Challenge), []byte(challenge)) != 1 {
+		return fmt.Errorf("%w: challenge mismatch", ErrInvalidClientData)
+	}
+	for _, origin := range rp.Origins {
+		if cd.Origin == origin {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: unexpected origin %q", ErrInvalidClientData, cd.Origin)
+}
+
+// verifyAuthenticatorData checks that the authenticator data is scoped to
+// the relying party and that the user was verified, and returns its flags
+// and signature counter.
+func (rp *RelyingParty) verifyAuthenticatorData(authData []byte) (byte, uint32, error) {
+	if len(authData) < authenticatorDataMinSize {
+		return 0, 0, fmt.Errorf("%w: too short", ErrInvalidAuthenticatorData)
+	}
+
+	rpIDHash := sha256.Sum256([]byte(rp.ID))
+	if !bytes.Equal(authData[:32], rpIDHash[:]) {
+		return 0, 0, fmt.Errorf("%w: relying party mismatch", ErrInvalidAuthenticatorData)
+	}
+
+	flags := authData[32]
+	if flags&flagUserPresent == 0 || flags&flagUserVerified == 0 {
+		return 0, 0, fmt.Errorf("%w: user not verified", ErrInvalidAuthenticatorData)
+	}
+	if flags&flagBackedUp != 0 && flags&flagBackupEligible == 0 {
+		return 0, 0, fmt.Errorf("%w: invalid backup flags", ErrInvalidAuthenticatorData)
+	}
+
+	return flags, binary.BigEndian.Uint32(authData[33:37]), nil
+}
@@ -0,0 +1,65 @@
+package webauthn_test
+
+import (
+	"accounts-service/webauthn"
+	"accounts-service/webauthn/webauthntest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+var rp = &webauthn.RelyingParty{ID: "noted.example", Name: "Noted", Origins: []string{"https://noted.example"}}
+
+func TestRegistrationAndAssertion(t *testing.T) {
+	authenticator := webauthntest.NewAuthenticator(rp.ID, "https://noted.example")
+	authenticator.Counter = true
+
+	clientData, attestation := authenticator.Register("registration-challenge", []byte("account-id"))
+	challenge, err := webauthn.ChallengeFromClientData(clientData)
+	require.NoError(t, err)
+	require.Equal(t, "registration-challenge", challenge)
+
+	cred, err := rp.VerifyRegistration("registration-challenge", clientData, attestation)
+	require.NoError(t, err)
+	require.Equal(t, authenticator.CredentialID, cred.ID)
+
+	clientData, authData, sig := authenticator.Assert("login-challenge")
+	signCount, err := rp.VerifyAssertion(cred, "login-challenge", clientData, authData, sig)
+	require.NoError(t, err)
+	require.Equal(t, uint32(1), signCount)
+	cred.SignCount = signCount
+
+	t.Run("rejects-replayed-counter", func(t *testing.T) {
+		_, err := rp.VerifyAssertion(cred, "login-challenge", clientData, authData, sig)
+		require.ErrorIs(t, err, webauthn.ErrSignCount)
+	})
+
+	t.Run("rejects-other-challenge", func(t *testing.T) {
+		clientData, authData, sig := authenticator.Assert("login-challenge")
+		_, err := rp.VerifyAssertion(cred, "other-challenge", clientData, authData, sig)
+		require.ErrorIs(t, err, webauthn.ErrInvalidClientData)
+	})
+
+	t.Run("rejects-tampered-signature", func(t *testing.T) {
+		clientData, authData, sig := authenticator.Assert("login-challenge")
+		authData[len(authData)-1]++
+		_, err := rp.VerifyAssertion(cred, "login-challenge", clientData, authData, sig)
+		require.ErrorIs(t, err, webauthn.ErrInvalidSignature)
+	})
+}
+
+func TestVerifyRegistration_RejectsOtherRelyingParty(t *testing.T) {
+	t.Run("origin", func(t *testing.T) {
+		authenticator := webauthntest.NewAuthenticator(rp.ID, "https://evil.example")
+		clientData, attestation := authenticator.Register("challenge", []byte("account-id"))
+		_, err := rp.VerifyRegistration("challenge", clientData, attestation)
+		require.ErrorIs(t, err, webauthn.ErrInvalidClientData)
+	})
+
+	t.Run("rp-id", func(t *testing.T) {
+		authenticator := webauthntest.NewAuthenticator("evil.example", "https://noted.example")
+		clientData, attestation := authenticator.Register("challenge", []byte("account-id"))
+		_, err := rp.VerifyRegistration("challenge", clientData, attestation)
+		require.ErrorIs(t, err, webauthn.ErrInvalidAuthenticatorData)
+	})
+}
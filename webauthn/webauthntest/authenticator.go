@@ -0,0 +1,121 @@
+// Package webauthntest provides a software authenticator which performs the
+// client side of the WebAuthn ceremonies, so that they can be tested without
+// a browser.
+package webauthntest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+)
+
+// Authenticator holds a single ES256 credential scoped to RPID, as a
+// platform authenticator would. It is not safe for use in multiple
+// goroutines.
+type Authenticator struct {
+	RPID   string
+	Origin string
+
+	// Increments the signature counter on each assertion when set, otherwise
+	// the counter is always zero like synced passkeys.
+	Counter bool
+
+	CredentialID []byte
+	UserHandle   []byte
+	SignCount    uint32
+
+	key *ecdsa.PrivateKey
+}
+
+// NewAuthenticator creates an authenticator for the relying party
+// identified by rpID, driven by a client served from origin.
+func NewAuthenticator(rpID, origin string) *Authenticator {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+	id := make([]byte, 16)
+	_, err = rand.Read(id)
+	if err != nil {
+		panic(err)
+	}
+	return &Authenticator{RPID: rpID, Origin: origin, CredentialID: id, key: key}
+}
+
+// Register creates the credential of userHandle and returns the client data
+// and the attestation object of navigator.credentials.create.
+func (a *Authenticator) Register(challenge string, userHandle []byte) (clientDataJSON, attestationObject []byte) {
+	a.UserHandle = userHandle
+	clientDataJSON = a.clientData("webauthn.create", challenge)
+
+	x, y := make([]byte, 32), make([]byte, 32)
+	a.key.X.FillBytes(x)
+	a.key.Y.FillBytes(y)
+	cosePublicKey := encode(cborMap{
+		{int64(1), int64(2)},  // kty: EC2
+		{int64(3), int64(-7)}, // alg: ES256
+		{int64(-1), int64(1)}, // crv: P-256
+		{int64(-2), x},
+		{int64(-3), y},
+	})
+
+	credentialIDLen := make([]byte, 2)
+	binary.BigEndian.PutUint16(credentialIDLen, uint16(len(a.CredentialID)))
+	authData := a.authenticatorData(0x40)
+	authData = append(authData, make([]byte, 16)...) // aaguid
+	authData = append(authData, credentialIDLen...)
+	authData = append(authData, a.CredentialID...)
+	authData = append(authData, cosePublicKey...)
+
+	attestationObject = encode(cborMap{
+		{"fmt", "none"},
+		{"attStmt", cborMap{}},
+		{"authData", authData},
+	})
+	return clientDataJSON, attestationObject
+}
+
+// Assert signs challenge and returns the client data, the authenticator data
+// and the signature of navigator.credentials.get.
+func (a *Authenticator) Assert(challenge string) (clientDataJSON, authenticatorData, signature []byte) {
+	if a.Counter {
+		a.SignCount++
+	}
+	clientDataJSON = a.clientData("webauthn.get", challenge)
+	authenticatorData = a.authenticatorData(0)
+
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	digest := sha256.Sum256(append(append([]byte{}, authenticatorData...), clientDataHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	if err != nil {
+		panic(err)
+	}
+	return clientDataJSON, authenticatorData, signature
+}
+
+func (a *Authenticator) clientData(ceremony, challenge string) []byte {
+	b, err := json.Marshal(map[string]interface{}{
+		"type":        ceremony,
+		"challenge":   challenge,
+		"origin":      a.Origin,
+		"crossOrigin": false,
+	})
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+// authenticatorData returns the fixed part of the authenticator data with
+// the user present and verified flags set on top of flags.
+func (a *Authenticator) authenticatorData(flags byte) []byte {
+	rpIDHash := sha256.Sum256([]byte(a.RPID))
+	data := append([]byte{}, rpIDHash[:]...)
+	data = append(data, flags|0x01|0x04)
+	signCount := make([]byte, 4)
+	binary.BigEndian.PutUint32(signCount, a.SignCount)
+	return append(data, signCount...)
+}